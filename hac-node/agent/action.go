@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	abci "github.com/cometbft/cometbft/abci/types"
+)
+
+// encodeActions is the JSON the actions of a proposal are indexed as, empty
+// if there are none.
+func encodeActions(actions []tx.ProposalAction) string {
+	if len(actions) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(actions)
+	return string(data)
+}
+
+func decodeActions(data string) []tx.ProposalAction {
+	if data == "" {
+		return nil
+	}
+	var actions []tx.ProposalAction
+	if err := json.Unmarshal([]byte(data), &actions); err != nil {
+		return nil
+	}
+	return actions
+}
+
+// proposalManifest returns the manifest an executed proposal set, false if
+// it set none. Its actions run after its category, the last one wins.
+func proposalManifest(p Proposal) (string, bool) {
+	manifest, ok := "", false
+	if p.Category == tx.ProposalCategoryManifest {
+		manifest, ok = p.Data, true
+	}
+	for _, action := range decodeActions(p.Actions) {
+		if action.Type != tx.ProposalActionUpdateManifest {
+			continue
+		}
+		if payload, err := tx.DecodeProposalAction(action); err == nil {
+			manifest, ok = payload.(string), true
+		}
+	}
+	return manifest, ok
+}
+
+// proposalWebhookKey identifies the webhook action at index of a proposal in
+// the outbox and to its receiver, which gets it from every node.
+func proposalWebhookKey(proposal uint64, action uint64) string {
+	return fmt.Sprintf("%s:%d:%d", hac_types.EventProposalWebhookType, proposal, action)
+}
+
+// handleEventProposalWebhook queues the webhook action of an executed
+// proposal in the outbox, the broadcaster delivers it.
+func (c *ChainIndexer) handleEventProposalWebhook(ctx context.Context, b *heightBatch, event abci.Event) error {
+	ev := hac_types.DecodeEventProposalWebhook(event)
+	if ev == nil {
+		return fmt.Errorf("decode proposal webhook event fail: %v", event)
+	}
+	key := proposalWebhookKey(ev.Proposal, ev.Action)
+	var cnt uint64
+	if err := b.db.Model(&OutboxPost{}).Where("key = ?", key).Count(&cnt).Error; err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return nil
+	}
+	payload := ev.Payload
+	if payload == "" {
+		payload = fmt.Sprintf(`{"proposal":%d,"action":%d}`, ev.Proposal, ev.Action)
+	}
+	now := time.Now().Unix()
+	return b.db.Create(&OutboxPost{
+		Key:         key,
+		Height:      uint64(b.height),
+		EventType:   hac_types.EventProposalWebhookType,
+		Text:        payload,
+		Status:      OutboxPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+		Url:         ev.Url,
+	}).Error
+}
@@ -0,0 +1,500 @@
+package agent
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// majority of a discussion, see DiscussionConsensus
+	DiscussionMajorityAccept = "accept"
+	DiscussionMajorityReject = "reject"
+	DiscussionMajorityTie    = "tie"
+)
+
+// AgentParticipation is how an agent took part in the decisions taken while
+// it was in the validator set. An abstention is a committed vote that
+// neither approves nor rejects the decision.
+type AgentParticipation struct {
+	Address           string  `json:"address"`
+	Name              string  `json:"name"`
+	Decisions         uint64  `json:"decisions"`
+	Commits           uint64  `json:"commits"`
+	Absents           uint64  `json:"absents"`
+	Nils              uint64  `json:"nils"`
+	Yes               uint64  `json:"yes"`
+	No                uint64  `json:"no"`
+	Abstains          uint64  `json:"abstains"`
+	ParticipationRate float64 `json:"participation_rate"`
+	AbstentionRate    float64 `json:"abstention_rate"`
+}
+
+// AgentAgreement is how often two agents took the same side on the decisions
+// both voted yes or no on.
+type AgentAgreement struct {
+	A          string  `json:"a"`
+	B          string  `json:"b"`
+	Decisions  uint64  `json:"decisions"`
+	Agreements uint64  `json:"agreements"`
+	Rate       float64 `json:"rate"`
+}
+
+// ProposerInfluence is the outcome of the proposals of an agent. The pass
+// rate is taken over the decided proposals.
+type ProposerInfluence struct {
+	Address    string  `json:"address"`
+	Name       string  `json:"name"`
+	Proposed   uint64  `json:"proposed"`
+	Accepted   uint64  `json:"accepted"`
+	Rejected   uint64  `json:"rejected"`
+	Ignored    uint64  `json:"ignored"`
+	Processing uint64  `json:"processing"`
+	PassRate   float64 `json:"pass_rate"`
+}
+
+// SpeakerShare is the part of the discussion of a proposal held by a
+// speaker.
+type SpeakerShare struct {
+	Address  string  `json:"address"`
+	Name     string  `json:"name"`
+	Messages uint64  `json:"messages"`
+	Share    float64 `json:"share"`
+}
+
+// DiscussionConsensus compares the outcome of a settled proposal with the
+// majority view of its discussion. Discussions carry no stance, so every
+// message counts for the side its speaker voted for when the proposal was
+// settled; messages of speakers who did not vote yes or no are left out.
+type DiscussionConsensus struct {
+	Proposal    uint64 `json:"proposal"`
+	Status      uint64 `json:"status"`
+	Messages    uint64 `json:"messages"`
+	AcceptVoice uint64 `json:"accept_voice"`
+	RejectVoice uint64 `json:"reject_voice"`
+	Majority    string `json:"majority"`
+	Matched     bool   `json:"matched"`
+}
+
+type agentPair struct {
+	a, b string
+}
+
+func newAgentPair(a, b string) agentPair {
+	if b < a {
+		a, b = b, a
+	}
+	return agentPair{a: a, b: b}
+}
+
+type proposalStats struct {
+	proposer string
+	status   uint64
+	speakers map[string]uint64
+	messages uint64
+	// side of the settle vote of every voter
+	settle map[string]int
+}
+
+// decisionVote is a proposal or grant vote reduced to what the analytics use.
+type decisionVote struct {
+	height  uint64
+	kind    string
+	subject uint64
+	address string
+	flag    string
+	code    uint64
+}
+
+// voteSide returns 1 for a vote approving its decision, -1 for a vote
+// rejecting it and 0 otherwise. Vote codes are distinct per decision kind,
+// so votes indexed before kinds were recorded are classified too.
+func voteSide(code uint64) int {
+	switch tx.VoteCode(code) {
+	case tx.VoteProcessProposal, tx.VoteAcceptProposal, tx.VoteGrantNewMember:
+		return 1
+	case tx.VoteIgnoreProposal, tx.VoteRejectProposal, tx.VoteRejectNewMember:
+		return -1
+	default:
+		return 0
+	}
+}
+
+func rate(n, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// Analytics caches governance statistics computed from the indexed votes and
+// discussions. The cache is built from the store on first use and then
+// refreshed with the rows of every height the indexer commits. Heights
+// indexed out of order, by a gap repair, make it stale and it is rebuilt on
+// the next read.
+type Analytics struct {
+	logger cmtlog.Logger
+	db     *gorm.DB
+
+	mtx       sync.RWMutex
+	built     bool
+	height    uint64
+	agents    map[string]*AgentParticipation
+	pairs     map[agentPair]*AgentAgreement
+	proposals map[uint64]*proposalStats
+}
+
+func NewAnalytics(logger cmtlog.Logger, db *gorm.DB) *Analytics {
+	return &Analytics{
+		logger: logger.With("module", "analytics"),
+		db:     db,
+	}
+}
+
+func (a *Analytics) reset() {
+	a.built = false
+	a.height = 0
+	a.agents = make(map[string]*AgentParticipation)
+	a.pairs = make(map[agentPair]*AgentAgreement)
+	a.proposals = make(map[uint64]*proposalStats)
+}
+
+// Invalidate drops the cache, it is rebuilt on the next read.
+func (a *Analytics) Invalidate() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.built = false
+}
+
+// Indexed folds the rows of a newly committed height into the cache.
+func (a *Analytics) Indexed(height uint64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if !a.built {
+		return
+	}
+	if height != a.height+1 {
+		a.built = false
+		return
+	}
+	if err := a.load(a.db.Where("height = ?", height), a.db.Where("new_height = ? OR settle_height = ?", height, height)); err != nil {
+		a.logger.Error("refresh analytics fail", "height", height, "err", err)
+		a.built = false
+		return
+	}
+	a.height = height
+}
+
+// snapshot builds the cache if needed and runs f on it under the read lock.
+func (a *Analytics) snapshot(f func() error) (uint64, error) {
+	a.mtx.RLock()
+	if !a.built {
+		a.mtx.RUnlock()
+		if err := a.rebuild(); err != nil {
+			return 0, err
+		}
+		a.mtx.RLock()
+	}
+	defer a.mtx.RUnlock()
+	return a.height, f()
+}
+
+func (a *Analytics) rebuild() error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.built {
+		return nil
+	}
+	h, err := loadIndexedHeight(a.db)
+	if err != nil {
+		return err
+	}
+	a.reset()
+	if err := a.load(a.db.Where("height <= ?", h.Height), a.db); err != nil {
+		return err
+	}
+	a.height = h.Height
+	a.built = true
+	return nil
+}
+
+// load folds the votes and discussions selected by rows and the proposals
+// selected by proposals.
+func (a *Analytics) load(rows *gorm.DB, proposals *gorm.DB) error {
+	var ps []Proposal
+	if err := proposals.Find(&ps).Error; err != nil {
+		return err
+	}
+	for _, p := range ps {
+		a.proposal(p.Id).proposer = p.ProposerAddress
+		a.proposal(p.Id).status = p.Status
+	}
+
+	var pvs []ProposalVote
+	if err := rows.Order("height asc").Find(&pvs).Error; err != nil {
+		return err
+	}
+	var gvs []GrantVote
+	if err := rows.Order("height asc").Find(&gvs).Error; err != nil {
+		return err
+	}
+	votes := make([]decisionVote, 0, len(pvs)+len(gvs))
+	for _, v := range pvs {
+		votes = append(votes, decisionVote{height: v.Height, kind: v.Kind, subject: v.Proposal, address: v.VoterAddress, flag: v.Flag, code: v.Vote})
+	}
+	for _, v := range gvs {
+		votes = append(votes, decisionVote{height: v.Height, kind: VoteKindGrant, subject: v.AccountIndex, address: v.VoterAddress, flag: v.Flag, code: v.Vote})
+	}
+	sort.SliceStable(votes, func(i, j int) bool { return votes[i].height < votes[j].height })
+	for start := 0; start < len(votes); {
+		end := start + 1
+		for end < len(votes) && votes[end].height == votes[start].height {
+			end++
+		}
+		a.foldDecision(votes[start:end])
+		start = end
+	}
+
+	var ds []Discussion
+	if err := rows.Find(&ds).Error; err != nil {
+		return err
+	}
+	for _, d := range ds {
+		p := a.proposal(d.Proposal)
+		p.speakers[d.SpeakerAddress]++
+		p.messages++
+	}
+	return nil
+}
+
+func (a *Analytics) proposal(id uint64) *proposalStats {
+	p, ok := a.proposals[id]
+	if !ok {
+		p = &proposalStats{speakers: make(map[string]uint64), settle: make(map[string]int)}
+		a.proposals[id] = p
+	}
+	return p
+}
+
+// foldDecision folds the votes of the validator set on one decision.
+func (a *Analytics) foldDecision(votes []decisionVote) {
+	sides := make(map[string]int, len(votes))
+	for _, v := range votes {
+		agent, ok := a.agents[v.address]
+		if !ok {
+			agent = &AgentParticipation{Address: v.address}
+			a.agents[v.address] = agent
+		}
+		agent.Decisions++
+		switch v.flag {
+		case VoteFlagAbsent:
+			agent.Absents++
+			continue
+		case VoteFlagNil:
+			agent.Nils++
+			continue
+		}
+		// votes indexed before flags were recorded are commits
+		agent.Commits++
+		side := voteSide(v.code)
+		switch side {
+		case 1:
+			agent.Yes++
+		case -1:
+			agent.No++
+		default:
+			agent.Abstains++
+			continue
+		}
+		sides[v.address] = side
+		settle := v.kind == VoteKindSettle ||
+			(v.kind == "" && (v.code == uint64(tx.VoteAcceptProposal) || v.code == uint64(tx.VoteRejectProposal)))
+		if settle {
+			a.proposal(v.subject).settle[v.address] = side
+		}
+	}
+	voters := make([]string, 0, len(sides))
+	for addr := range sides {
+		voters = append(voters, addr)
+	}
+	for i := 0; i < len(voters); i++ {
+		for j := i + 1; j < len(voters); j++ {
+			key := newAgentPair(voters[i], voters[j])
+			pair, ok := a.pairs[key]
+			if !ok {
+				pair = &AgentAgreement{A: key.a, B: key.b}
+				a.pairs[key] = pair
+			}
+			pair.Decisions++
+			if sides[voters[i]] == sides[voters[j]] {
+				pair.Agreements++
+			}
+		}
+	}
+}
+
+func (a *Analytics) names() (map[string]string, error) {
+	var agents []ValidatorAgent
+	if err := a.db.Select("address, name").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(agents))
+	for _, v := range agents {
+		names[v.Address] = v.Name
+	}
+	return names, nil
+}
+
+// Participation returns the participation of every agent that took part in
+// a decision and the height of the statistics.
+func (a *Analytics) Participation() ([]AgentParticipation, uint64, error) {
+	names, err := a.names()
+	if err != nil {
+		return nil, 0, err
+	}
+	res := make([]AgentParticipation, 0)
+	height, err := a.snapshot(func() error {
+		for _, agent := range a.agents {
+			p := *agent
+			p.Name = names[p.Address]
+			p.ParticipationRate = rate(p.Commits, p.Decisions)
+			p.AbstentionRate = rate(p.Abstains, p.Decisions)
+			res = append(res, p)
+		}
+		return nil
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+	return res, height, err
+}
+
+// Agreement returns the agreement of every pair of agents that voted on a
+// common decision.
+func (a *Analytics) Agreement() ([]AgentAgreement, uint64, error) {
+	res := make([]AgentAgreement, 0)
+	height, err := a.snapshot(func() error {
+		for _, pair := range a.pairs {
+			p := *pair
+			p.Rate = rate(p.Agreements, p.Decisions)
+			res = append(res, p)
+		}
+		return nil
+	})
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].A != res[j].A {
+			return res[i].A < res[j].A
+		}
+		return res[i].B < res[j].B
+	})
+	return res, height, err
+}
+
+// Influence returns the proposal outcomes of every proposer.
+func (a *Analytics) Influence() ([]ProposerInfluence, uint64, error) {
+	names, err := a.names()
+	if err != nil {
+		return nil, 0, err
+	}
+	byProposer := make(map[string]*ProposerInfluence)
+	height, err := a.snapshot(func() error {
+		for _, p := range a.proposals {
+			if p.proposer == "" {
+				continue
+			}
+			inf, ok := byProposer[p.proposer]
+			if !ok {
+				inf = &ProposerInfluence{Address: p.proposer, Name: names[p.proposer]}
+				byProposer[p.proposer] = inf
+			}
+			inf.Proposed++
+			switch hac_types.ProposalStatus(p.status) {
+			case hac_types.ProposalStatusAccepted:
+				inf.Accepted++
+			case hac_types.ProposalStatusRejected:
+				inf.Rejected++
+			case hac_types.ProposalStatusIgnore:
+				inf.Ignored++
+			default:
+				inf.Processing++
+			}
+		}
+		return nil
+	})
+	res := make([]ProposerInfluence, 0, len(byProposer))
+	for _, inf := range byProposer {
+		inf.PassRate = rate(inf.Accepted, inf.Accepted+inf.Rejected+inf.Ignored)
+		res = append(res, *inf)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+	return res, height, err
+}
+
+// SpeakerShares returns the share of the discussion of a proposal held by
+// each speaker, largest first.
+func (a *Analytics) SpeakerShares(proposal uint64) ([]SpeakerShare, uint64, error) {
+	names, err := a.names()
+	if err != nil {
+		return nil, 0, err
+	}
+	res := make([]SpeakerShare, 0)
+	height, err := a.snapshot(func() error {
+		p, ok := a.proposals[proposal]
+		if !ok {
+			return nil
+		}
+		for addr, n := range p.speakers {
+			res = append(res, SpeakerShare{Address: addr, Name: names[addr], Messages: n, Share: rate(n, p.messages)})
+		}
+		return nil
+	})
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Messages != res[j].Messages {
+			return res[i].Messages > res[j].Messages
+		}
+		return res[i].Address < res[j].Address
+	})
+	return res, height, err
+}
+
+// DiscussionConsensus returns the consensus of every accepted or rejected
+// proposal that was discussed, newest first.
+func (a *Analytics) DiscussionConsensus() ([]DiscussionConsensus, uint64, error) {
+	res := make([]DiscussionConsensus, 0)
+	height, err := a.snapshot(func() error {
+		for id, p := range a.proposals {
+			status := hac_types.ProposalStatus(p.status)
+			if p.messages == 0 || (status != hac_types.ProposalStatusAccepted && status != hac_types.ProposalStatusRejected) {
+				continue
+			}
+			dc := DiscussionConsensus{Proposal: id, Status: p.status, Messages: p.messages}
+			for addr, n := range p.speakers {
+				switch p.settle[addr] {
+				case 1:
+					dc.AcceptVoice += n
+				case -1:
+					dc.RejectVoice += n
+				}
+			}
+			switch {
+			case dc.AcceptVoice > dc.RejectVoice:
+				dc.Majority = DiscussionMajorityAccept
+				dc.Matched = status == hac_types.ProposalStatusAccepted
+			case dc.RejectVoice > dc.AcceptVoice:
+				dc.Majority = DiscussionMajorityReject
+				dc.Matched = status == hac_types.ProposalStatusRejected
+			case dc.AcceptVoice > 0:
+				dc.Majority = DiscussionMajorityTie
+			default:
+				// no speaker voted on the outcome
+				continue
+			}
+			res = append(res, dc)
+		}
+		return nil
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Proposal > res[j].Proposal })
+	return res, height, err
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/jinzhu/gorm"
+)
+
+func createRows(t *testing.T, db *gorm.DB, rows ...interface{}) {
+	t.Helper()
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func commitVote(proposal uint64, kind string, voter string, height uint64, code tx.VoteCode) *ProposalVote {
+	return &ProposalVote{Proposal: proposal, Kind: kind, VoterAddress: voter, Height: height, Vote: uint64(code), Flag: VoteFlagCommit}
+}
+
+func TestAnalytics(t *testing.T) {
+	db := openTestStore(t).DB()
+	createRows(t, db,
+		&Height{Id: 1, Height: 3},
+		&ValidatorAgent{Id: 1, Address: "A", Name: "alice"},
+		&Proposal{Id: 1, ProposerAddress: "A", NewHeight: 1, SettleHeight: 3, Status: uint64(hac_types.ProposalStatusAccepted)},
+		commitVote(1, VoteKindProcess, "A", 1, tx.VoteProcessProposal),
+		commitVote(1, VoteKindProcess, "B", 1, tx.VoteIgnoreProposal),
+		&ProposalVote{Proposal: 1, Kind: VoteKindProcess, VoterAddress: "C", Height: 1, Flag: VoteFlagAbsent},
+		&Discussion{Id: 1, Proposal: 1, SpeakerAddress: "A", Height: 2},
+		&Discussion{Id: 2, Proposal: 1, SpeakerAddress: "A", Height: 2},
+		&Discussion{Id: 3, Proposal: 1, SpeakerAddress: "B", Height: 2},
+		&Discussion{Id: 4, Proposal: 1, SpeakerAddress: "C", Height: 2},
+		commitVote(1, VoteKindSettle, "A", 3, tx.VoteAcceptProposal),
+		commitVote(1, VoteKindSettle, "B", 3, tx.VoteRejectProposal),
+		&ProposalVote{Proposal: 1, Kind: VoteKindSettle, VoterAddress: "C", Height: 3, Flag: VoteFlagNil},
+	)
+	a := NewAnalytics(cmtlog.NewNopLogger(), db)
+
+	participation, height, err := a.Participation()
+	if err != nil || height != 3 {
+		t.Fatalf("height %d, %v", height, err)
+	}
+	wantParticipation := []AgentParticipation{
+		{Address: "A", Name: "alice", Decisions: 2, Commits: 2, Yes: 2, ParticipationRate: 1},
+		{Address: "B", Decisions: 2, Commits: 2, No: 2, ParticipationRate: 1},
+		{Address: "C", Decisions: 2, Absents: 1, Nils: 1},
+	}
+	if !reflect.DeepEqual(participation, wantParticipation) {
+		t.Fatalf("participation %+v, want %+v", participation, wantParticipation)
+	}
+
+	influence, _, err := a.Influence()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ProposerInfluence{{Address: "A", Name: "alice", Proposed: 1, Accepted: 1, PassRate: 1}}; !reflect.DeepEqual(influence, want) {
+		t.Fatalf("influence %+v, want %+v", influence, want)
+	}
+
+	shares, _, err := a.SpeakerShares(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantShares := []SpeakerShare{
+		{Address: "A", Name: "alice", Messages: 2, Share: 0.5},
+		{Address: "B", Messages: 1, Share: 0.25},
+		{Address: "C", Messages: 1, Share: 0.25},
+	}
+	if !reflect.DeepEqual(shares, wantShares) {
+		t.Fatalf("shares %+v, want %+v", shares, wantShares)
+	}
+
+	// C spoke but did not vote on the outcome
+	consensus, _, err := a.DiscussionConsensus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantConsensus := []DiscussionConsensus{{Proposal: 1, Status: uint64(hac_types.ProposalStatusAccepted), Messages: 4,
+		AcceptVoice: 2, RejectVoice: 1, Majority: DiscussionMajorityAccept, Matched: true}}
+	if !reflect.DeepEqual(consensus, wantConsensus) {
+		t.Fatalf("consensus %+v, want %+v", consensus, wantConsensus)
+	}
+
+	// the next height is folded into the cache
+	createRows(t, db,
+		&GrantVote{AccountIndex: 9, VoterAddress: "A", Height: 4, Vote: uint64(tx.VoteGrantNewMember), Flag: VoteFlagCommit},
+		&GrantVote{AccountIndex: 9, VoterAddress: "B", Height: 4, Vote: uint64(tx.VoteGrantNewMember), Flag: VoteFlagCommit},
+	)
+	if err := db.Save(&Height{Id: 1, Height: 4}).Error; err != nil {
+		t.Fatal(err)
+	}
+	a.Indexed(4)
+	agreement, height, err := a.Agreement()
+	if err != nil || height != 4 {
+		t.Fatalf("height %d, %v", height, err)
+	}
+	wantAgreement := []AgentAgreement{{A: "A", B: "B", Decisions: 3, Agreements: 1, Rate: 1.0 / 3}}
+	if !reflect.DeepEqual(agreement, wantAgreement) {
+		t.Fatalf("agreement %+v, want %+v", agreement, wantAgreement)
+	}
+	rebuilt, _, err := NewAnalytics(cmtlog.NewNopLogger(), db).Agreement()
+	if err != nil || !reflect.DeepEqual(rebuilt, agreement) {
+		t.Fatalf("rebuilt agreement %+v, %v", rebuilt, err)
+	}
+
+	// a height out of order drops the cache
+	createRows(t, db, &ProposalVote{Proposal: 2, Kind: VoteKindProcess, VoterAddress: "A", Height: 6, Flag: VoteFlagAbsent})
+	if err := db.Save(&Height{Id: 1, Height: 6}).Error; err != nil {
+		t.Fatal(err)
+	}
+	a.Indexed(6)
+	participation, height, err = a.Participation()
+	if err != nil || height != 6 || participation[0].Decisions != 4 || participation[0].Absents != 1 {
+		t.Fatalf("participation %+v at %d, %v", participation, height, err)
+	}
+}
@@ -0,0 +1,427 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	app_config "github.com/calehh/hac-app/config"
+	hac_types "github.com/calehh/hac-app/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+
+	// interval between two outbox checks when no height was indexed
+	BroadcastInterval = time.Second
+	// delay before the first retry of a post, doubled on every failure
+	BroadcastRetryDelay    = 10 * time.Second
+	BroadcastMaxRetryDelay = 10 * time.Minute
+	// heights turned into posts at once
+	broadcastComposeBatch = 100
+	broadcastCursorName   = "broadcast"
+	webhookTimeout        = 10 * time.Second
+)
+
+// retryDelay is the delay before the next attempt after attempts failed
+// ones, doubled from base on every failure up to max.
+func retryDelay(base, max time.Duration, attempts int) time.Duration {
+	delay := base << (attempts - 1)
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+	return delay
+}
+
+// BroadcastSink delivers posts to an external platform.
+type BroadcastSink interface {
+	Deliver(ctx context.Context, post OutboxPost) error
+}
+
+// broadcastPayload is what the sinks publish for a post.
+type broadcastPayload struct {
+	Id        uint64 `json:"id"`
+	Key       string `json:"key"`
+	Type      string `json:"type"`
+	Height    uint64 `json:"height"`
+	Text      string `json:"text"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+func newBroadcastPayload(post OutboxPost) broadcastPayload {
+	return broadcastPayload{
+		Id:        post.Id,
+		Key:       post.Key,
+		Type:      post.EventType,
+		Height:    post.Height,
+		Text:      post.Text,
+		CreatedAt: post.CreatedAt,
+	}
+}
+
+// WebhookSink posts every post as JSON to a URL, any 2xx answer is a
+// delivery.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (s *WebhookSink) Deliver(ctx context.Context, post OutboxPost) error {
+	data, err := json.Marshal(newBroadcastPayload(post))
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, s.client, s.url, post.Key, data)
+}
+
+// postJSON posts data to url, any 2xx answer is a delivery. key lets the
+// receiver drop the posts it got already.
+func postJSON(ctx context.Context, client *http.Client, url string, key string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", key)
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", res.Status)
+	}
+	return nil
+}
+
+// FileSink appends every post as a JSON line to a file, or to stdout.
+type FileSink struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	if path == "" {
+		return &FileSink{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{w: f}, nil
+}
+
+func (s *FileSink) Deliver(ctx context.Context, post OutboxPost) error {
+	data, err := json.Marshal(newBroadcastPayload(post))
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
+
+func newBroadcastSink(cfg app_config.BroadcastConfig) (BroadcastSink, error) {
+	switch cfg.Sink {
+	case app_config.BroadcastSinkWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, errors.New("webhook broadcast sink needs a webhook_url")
+		}
+		return NewWebhookSink(cfg.WebhookURL), nil
+	case "", app_config.BroadcastSinkFile:
+		return NewFileSink(cfg.FilePath)
+	default:
+		return nil, fmt.Errorf("unknown broadcast sink %q", cfg.Sink)
+	}
+}
+
+var broadcastFuncs = template.FuncMap{
+	"truncate": func(s string, n int) string {
+		r := []rune(strings.TrimSpace(s))
+		if len(r) <= n {
+			return string(r)
+		}
+		return string(r[:n]) + "..."
+	},
+	"short": func(address string) string {
+		if len(address) <= 8 {
+			return address
+		}
+		return address[:8]
+	},
+	"percent": func(n, total int64) string {
+		if total == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%d%%", n*100/total)
+	},
+	"status": func(status uint64) string {
+		switch hac_types.ProposalStatus(status) {
+		case hac_types.ProposalStatusIgnore:
+			return "ignored"
+		case hac_types.ProposalStatusProcessing:
+			return "in discussion"
+		case hac_types.ProposalStatusAccepted:
+			return "accepted"
+		case hac_types.ProposalStatusRejected:
+			return "rejected"
+		default:
+			return "unknown"
+		}
+	},
+}
+
+// Broadcaster turns the indexed governance events into posts and delivers
+// them. Composing and delivering are decoupled by the outbox: posts survive a
+// restart, are retried with a growing delay and leave at the configured rate.
+type Broadcaster struct {
+	logger      cmtlog.Logger
+	db          *gorm.DB
+	sink        BroadcastSink
+	client      *http.Client
+	templates   map[string]*template.Template
+	writer      Client
+	minInterval time.Duration
+	maxAttempts int
+	notify      chan struct{}
+	lastSent    time.Time
+}
+
+// NewBroadcaster creates the broadcaster of cfg. writer rewrites the posts if
+// it is not nil.
+func NewBroadcaster(logger cmtlog.Logger, db *gorm.DB, cfg app_config.BroadcastConfig, writer Client) (*Broadcaster, error) {
+	sink, err := newBroadcastSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+	templates := make(map[string]*template.Template)
+	for kind, text := range cfg.Templates {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		if _, ok := streamEventOrder[kind]; !ok {
+			return nil, fmt.Errorf("broadcast template for unknown event type %s", kind)
+		}
+		t, err := template.New(kind).Funcs(broadcastFuncs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("broadcast template %s: %w", kind, err)
+		}
+		templates[kind] = t
+	}
+	rate := cfg.RatePerMinute
+	if rate <= 0 {
+		rate = app_config.DefaultBroadcastRate
+	}
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = app_config.DefaultBroadcastMaxAttempts
+	}
+	return &Broadcaster{
+		logger:      logger.With("module", "broadcast"),
+		db:          db,
+		sink:        sink,
+		client:      &http.Client{Timeout: webhookTimeout},
+		templates:   templates,
+		writer:      writer,
+		minInterval: time.Minute / time.Duration(rate),
+		maxAttempts: maxAttempts,
+		notify:      make(chan struct{}, 1),
+	}, nil
+}
+
+// Indexed wakes the broadcaster up after a height was committed.
+func (b *Broadcaster) Indexed(height uint64) {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run composes and delivers posts until ctx is done.
+func (b *Broadcaster) Run(ctx context.Context) {
+	ticker := time.NewTicker(BroadcastInterval)
+	defer ticker.Stop()
+	for {
+		if err := b.compose(ctx); err != nil {
+			b.logger.Error("compose posts fail", "err", err)
+		}
+		if err := b.deliver(ctx); err != nil {
+			b.logger.Error("deliver posts fail", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.notify:
+		}
+	}
+}
+
+// compose turns the events of the heights indexed since the cursor into
+// pending posts. Heights are composed once their votes are indexed, see
+// streamHeight. A new outbox starts at the indexed height instead of
+// narrating the whole history.
+func (b *Broadcaster) compose(ctx context.Context) error {
+	indexed, err := streamHeight(b.db)
+	if err != nil {
+		return err
+	}
+	cursor := BroadcastCursor{Name: broadcastCursorName}
+	if err := b.db.First(&cursor).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		cursor.Height = indexed
+		cursor.UpdatedAt = time.Now().Unix()
+		return b.db.Save(&cursor).Error
+	}
+	for cursor.Height < indexed {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		from := cursor.Height + 1
+		to := from + broadcastComposeBatch - 1
+		if to > indexed {
+			to = indexed
+		}
+		events, err := loadStreamEvents(b.db, from, to)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if err := b.enqueue(ctx, ev); err != nil {
+				return err
+			}
+		}
+		cursor.Height = to
+		cursor.UpdatedAt = time.Now().Unix()
+		if err := b.db.Save(&cursor).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Broadcaster) enqueue(ctx context.Context, ev StreamEvent) error {
+	t, ok := b.templates[ev.Type]
+	if !ok {
+		return nil
+	}
+	key := streamEventKey(ev)
+	var cnt uint64
+	if err := b.db.Model(&OutboxPost{}).Where("key = ?", key).Count(&cnt).Error; err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, ev); err != nil {
+		b.logger.Error("render post fail", "key", key, "err", err)
+		return nil
+	}
+	text := strings.TrimSpace(buf.String())
+	if text == "" {
+		return nil
+	}
+	if b.writer != nil {
+		written, err := b.writer.WritePost(ctx, ev.Type, text)
+		if err != nil {
+			b.logger.Error("agent write post fail, use template", "key", key, "err", err)
+		} else if strings.TrimSpace(written) != "" {
+			text = strings.TrimSpace(written)
+		}
+	}
+	now := time.Now().Unix()
+	return b.db.Create(&OutboxPost{
+		Key:         key,
+		Height:      ev.Height,
+		EventType:   ev.Type,
+		Text:        text,
+		Status:      OutboxPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}).Error
+}
+
+// deliver sends the due posts in order, no faster than the rate limit.
+func (b *Broadcaster) deliver(ctx context.Context) error {
+	for ctx.Err() == nil {
+		if wait := b.minInterval - time.Since(b.lastSent); wait > 0 {
+			return nil
+		}
+		var post OutboxPost
+		err := b.db.Where("status = ? AND next_attempt <= ?", OutboxPending, time.Now().Unix()).Order("id asc").First(&post).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.lastSent = time.Now()
+		post.Attempts++
+		if err := b.deliverPost(ctx, post); err != nil {
+			post.LastError = err.Error()
+			if post.Attempts >= b.maxAttempts {
+				post.Status = OutboxFailed
+				b.logger.Error("give up post", "key", post.Key, "attempts", post.Attempts, "err", err)
+			} else {
+				delay := retryDelay(BroadcastRetryDelay, BroadcastMaxRetryDelay, post.Attempts)
+				post.NextAttempt = time.Now().Add(delay).Unix()
+				b.logger.Info("deliver post fail, retry", "key", post.Key, "attempts", post.Attempts, "retry", delay, "err", err)
+			}
+		} else {
+			post.Status = OutboxSent
+			post.SentAt = time.Now().Unix()
+			post.LastError = ""
+		}
+		if err := b.db.Save(&post).Error; err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// deliverPost sends a post to the sink, or the payload of a proposal webhook
+// action to its url.
+func (b *Broadcaster) deliverPost(ctx context.Context, post OutboxPost) error {
+	if post.Url != "" {
+		return postJSON(ctx, b.client, post.Url, post.Key, []byte(post.Text))
+	}
+	return b.sink.Deliver(ctx, post)
+}
+
+func (c *ChainIndexer) getOutboxPosts(status string, page int, pageSize int) ([]OutboxPost, uint64, error) {
+	query := c.db.Model(&OutboxPost{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total uint64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	posts := make([]OutboxPost, 0)
+	if err := query.Order("id desc").Offset(page * pageSize).Limit(pageSize).Find(&posts).Error; err != nil {
+		return nil, 0, err
+	}
+	return posts, total, nil
+}
@@ -0,0 +1,270 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	app_config "github.com/calehh/hac-app/config"
+	hac_types "github.com/calehh/hac-app/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+func TestRetryDelay(t *testing.T) {
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute},
+		// the shift overflows
+		{80, time.Minute},
+	} {
+		if got := retryDelay(time.Second, time.Minute, tc.attempts); got != tc.want {
+			t.Errorf("retryDelay after %d attempts is %v, want %v", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestBroadcastTemplates(t *testing.T) {
+	cfg := app_config.BroadcastConfig{Templates: app_config.DefaultBroadcastTemplates()}
+	b, err := NewBroadcaster(cmtlog.NewNopLogger(), nil, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tally := &VoteTally{YesPower: 2, TotalPower: 3}
+	for _, tc := range []struct {
+		ev   StreamEvent
+		want string
+	}{
+		{StreamEvent{Type: StreamEventProposal, Proposal: 1, Data: Proposal{ProposerName: "alice", Title: strings.Repeat("x", 130)}},
+			"New proposal #1 by alice: " + strings.Repeat("x", 120) + "..."},
+		{StreamEvent{Type: StreamEventSettle, Proposal: 2, Data: StreamSettle{Status: uint64(hac_types.ProposalStatusAccepted), Tally: tally}},
+			"Proposal #2 is accepted with 66% of the voting power in favour"},
+		{StreamEvent{Type: StreamEventGrant, Data: StreamGrant{Grant: Grant{Address: "ABCDEF0123456789", Grant: true}}},
+			"ABCDEF01 joins the council"},
+	} {
+		var buf bytes.Buffer
+		if err := b.templates[tc.ev.Type].Execute(&buf, tc.ev); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("%s post %q, want %q", tc.ev.Type, buf.String(), tc.want)
+		}
+	}
+
+	for name, templates := range map[string]map[string]string{
+		"unknown event type": {"vote": "x"},
+		"invalid template":   {"proposal": "{{.Proposal"},
+	} {
+		if _, err := NewBroadcaster(cmtlog.NewNopLogger(), nil, app_config.BroadcastConfig{Templates: templates}, nil); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+	if _, err := NewBroadcaster(cmtlog.NewNopLogger(), nil, app_config.BroadcastConfig{Sink: app_config.BroadcastSinkWebhook}, nil); err == nil {
+		t.Error("webhook sink without url accepted")
+	}
+}
+
+// loudWriter is an agent rewriting the posts.
+type loudWriter struct {
+	MockClient
+	fail bool
+}
+
+func (w *loudWriter) WritePost(ctx context.Context, kind string, text string) (string, error) {
+	if w.fail {
+		return "", errors.New("agent down")
+	}
+	return strings.ToUpper(text), nil
+}
+
+func TestBroadcasterCompose(t *testing.T) {
+	db := openTestStore(t).DB()
+	createRows(t, db, &Height{Id: 1, Height: 1}, &Proposal{Id: 1, NewHeight: 1, Title: "old"})
+	writer := &loudWriter{}
+	cfg := app_config.BroadcastConfig{Templates: map[string]string{"proposal": "#{{.Proposal}} {{.Data.Title}}"}}
+	b, err := NewBroadcaster(cmtlog.NewNopLogger(), db, cfg, writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	posts := func() []OutboxPost {
+		t.Helper()
+		var posts []OutboxPost
+		if err := db.Order("id asc").Find(&posts).Error; err != nil {
+			t.Fatal(err)
+		}
+		return posts
+	}
+
+	// a new outbox does not narrate the history
+	if err := b.compose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := posts(); len(got) != 0 {
+		t.Fatalf("posts %+v of the history", got)
+	}
+
+	// the height waits for its votes
+	createRows(t, db, &Proposal{Id: 2, NewHeight: 2, Title: "new"}, &IndexedBlock{Height: 2, VotesPending: true})
+	if err := db.Save(&Height{Id: 1, Height: 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := b.compose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := posts(); len(got) != 0 {
+		t.Fatalf("posts %+v before the votes", got)
+	}
+	if err := db.Model(&IndexedBlock{}).Where("height = ?", 2).Update("votes_pending", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := b.compose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got := posts()
+	if len(got) != 1 || got[0].Text != "#2 NEW" || got[0].Key != "2-0-proposal" || got[0].Status != OutboxPending {
+		t.Fatalf("posts %+v, want the rewritten proposal 2", got)
+	}
+
+	// an event is posted once, the template stands in for a failing agent
+	if err := db.Save(&BroadcastCursor{Name: broadcastCursorName, Height: 0}).Error; err != nil {
+		t.Fatal(err)
+	}
+	writer.fail = true
+	if err := b.compose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	got = posts()
+	if len(got) != 2 || got[1].Text != "#1 old" {
+		t.Fatalf("posts %+v, want proposal 1 from the template", got)
+	}
+}
+
+// recordSink records the posts it delivers, failing while fail is set.
+type recordSink struct {
+	fail      bool
+	delivered []OutboxPost
+}
+
+func (s *recordSink) Deliver(ctx context.Context, post OutboxPost) error {
+	if s.fail {
+		return errors.New("platform down")
+	}
+	s.delivered = append(s.delivered, post)
+	return nil
+}
+
+func TestBroadcasterDeliver(t *testing.T) {
+	db := openTestStore(t).DB()
+	sink := &recordSink{fail: true}
+	b := &Broadcaster{logger: cmtlog.NewNopLogger(), db: db, sink: sink, maxAttempts: 2}
+	now := time.Now().Unix()
+	createRows(t, db,
+		&OutboxPost{Key: "a", Text: "a", Status: OutboxPending, NextAttempt: now},
+		&OutboxPost{Key: "b", Text: "b", Status: OutboxPending, NextAttempt: now + 3600},
+	)
+	ctx := context.Background()
+	load := func(key string) OutboxPost {
+		t.Helper()
+		var post OutboxPost
+		if err := db.First(&post, "key = ?", key).Error; err != nil {
+			t.Fatal(err)
+		}
+		return post
+	}
+
+	if err := b.deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+	post := load("a")
+	if post.Status != OutboxPending || post.Attempts != 1 || post.NextAttempt < now+int64(BroadcastRetryDelay/time.Second) || post.LastError == "" {
+		t.Fatalf("post %+v after a failure", post)
+	}
+
+	// given up after the last attempt
+	if err := db.Model(&post).Update("next_attempt", now).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := b.deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if post = load("a"); post.Status != OutboxFailed || post.Attempts != 2 {
+		t.Fatalf("post %+v, want it given up", post)
+	}
+
+	// due posts leave in order, no faster than the rate
+	sink.fail = false
+	createRows(t, db,
+		&OutboxPost{Key: "c", Text: "c", Status: OutboxPending, NextAttempt: now},
+		&OutboxPost{Key: "d", Text: "d", Status: OutboxPending, NextAttempt: now},
+	)
+	b.minInterval = time.Hour
+	b.lastSent = time.Time{}
+	if err := b.deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.delivered) != 1 || sink.delivered[0].Key != "c" {
+		t.Fatalf("delivered %+v, want only c", sink.delivered)
+	}
+	if post = load("c"); post.Status != OutboxSent || post.SentAt == 0 || post.LastError != "" {
+		t.Fatalf("post %+v, want it sent", post)
+	}
+	b.minInterval = 0
+	if err := b.deliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.delivered) != 2 || sink.delivered[1].Key != "d" {
+		t.Fatalf("delivered %+v, want d next and b not due", sink.delivered)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := &FileSink{w: &buf}
+	for _, key := range []string{"1-0-proposal", "1-1-discussion"} {
+		if err := s.Deliver(context.Background(), OutboxPost{Key: key, Height: 1, Text: "t"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d lines", len(lines))
+	}
+	var payload broadcastPayload
+	if err := json.Unmarshal([]byte(lines[1]), &payload); err != nil || payload.Key != "1-1-discussion" || payload.Text != "t" {
+		t.Fatalf("payload %+v, %v", payload, err)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var keys []string
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := NewWebhookSink(srv.URL)
+	post := OutboxPost{Key: "3-0-proposal", Height: 3, Text: "t"}
+	if err := s.Deliver(context.Background(), post); err == nil {
+		t.Fatal("delivered on a 503")
+	}
+	status = http.StatusAccepted
+	if err := s.Deliver(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != post.Key || keys[1] != post.Key {
+		t.Fatalf("idempotency keys %v", keys)
+	}
+}
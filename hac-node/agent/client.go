@@ -11,23 +11,42 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 var ElizaCli Client
 
-var DiscussionRate = 0
-
-var DiscussionTrigger = 0
+// speaker types of a discussion: validators speak through their agent,
+// participants are humans
+const (
+	SpeakerTypeAgent = "agent"
+	SpeakerTypeHuman = "human"
+)
 
 type Client interface {
-	IfProcessProposal(ctx context.Context, data []byte) (bool, error)
-	IfAcceptProposal(ctx context.Context, proposal uint64, voter string) (bool, error)
+	IfProcessProposal(ctx context.Context, category string, data []byte) (bool, error)
+	IfAcceptProposal(ctx context.Context, proposal uint64, revision uint64, voter string) (bool, error)
 	IfGrantNewMember(ctx context.Context, validator uint64, proposer string, amount uint64, statement string) (bool, error)
+	IfSettleProposal(ctx context.Context, proposal uint64, proposer string) (bool, error)
+	IfSponsorProposal(ctx context.Context, author string, text string) (bool, string, error)
 	CommentPropoal(ctx context.Context, proposal uint64, speaker string) (string, error)
-	AddProposal(ctx context.Context, proposal uint64, proposer string, text string) error
-	AddDiscussion(ctx context.Context, proposal uint64, speaker string, text string) error
+	AddProposal(ctx context.Context, proposal uint64, category string, proposer string, text string) error
+	AddProposalRevision(ctx context.Context, proposal uint64, revision uint64, proposer string, text string, diff string) error
+	DraftProposal(ctx context.Context, text string) (title string, summary string, err error)
+	WritePost(ctx context.Context, kind string, text string) (string, error)
+	AddDiscussion(ctx context.Context, discussion Discussion) error
 	GetSelfIntro(ctx context.Context) (string, error)
 	GetHeadPhoto(ctx context.Context) (string, error)
+	GetStatus(ctx context.Context) (*AgentStatus, error)
+}
+
+// AgentStatus identifies an agent and its memory. Epoch changes whenever
+// the agent starts with an empty memory, Height is the last block height the
+// agent remembers, if it keeps track of it.
+type AgentStatus struct {
+	Id     string `json:"id"`
+	Epoch  string `json:"epoch"`
+	Height uint64 `json:"height"`
 }
 
 var _ Client = &MockClient{}
@@ -52,6 +71,40 @@ func (c *ElizaClient) GetHeadPhoto(ctx context.Context) (string, error) {
 	return string(buf), nil
 }
 
+// GetStatus reports the memory status of the agent. Agents without a status
+// endpoint report an empty epoch, so a reset of their memory goes unnoticed.
+func (c *ElizaClient) GetStatus(ctx context.Context) (*AgentStatus, error) {
+	status := &AgentStatus{Id: fmt.Sprintf("%s/%s", c.Url, c.AgentId)}
+	res, err := http.Get(fmt.Sprintf("%s/%s/status", c.Url, c.AgentId))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return status, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent status: %s", res.Status)
+	}
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.logger.Error("read response body fail", "err", err)
+		return nil, err
+	}
+	var resp struct {
+		Epoch  string `json:"epoch"`
+		Height uint64 `json:"height"`
+	}
+	err = json.Unmarshal(buf, &resp)
+	if err != nil {
+		c.logger.Error("unmarshal response body fail", "err", err)
+		return nil, err
+	}
+	status.Epoch = resp.Epoch
+	status.Height = resp.Height
+	return status, nil
+}
+
 func (c *ElizaClient) GetSelfIntro(ctx context.Context) (string, error) {
 	agentUrl, err := url.JoinPath(c.Url, c.AgentId, "/selfintro")
 	if err != nil {
@@ -183,17 +236,26 @@ func (e *ElizaClient) CommentPropoal(ctx context.Context, proposal uint64, speak
 }
 
 type AddDiscussionReq struct {
-	ProposalId       uint64 `json:"proposalId"`
-	ValidatorAddress string `json:"validatorAddress"`
-	Text             string `json:"text"`
+	ProposalId       uint64                `json:"proposalId"`
+	DiscussionId     uint64                `json:"discussionId"`
+	ValidatorAddress string                `json:"validatorAddress"`
+	SpeakerType      string                `json:"speakerType"`
+	ReplyTo          uint64                `json:"replyTo,omitempty"`
+	References       []DiscussionReference `json:"references,omitempty"`
+	Text             string                `json:"text"`
 }
 
-func (e *ElizaClient) AddDiscussion(ctx context.Context, proposal uint64, speaker string, text string) error {
-	e.logger.Info("AddDiscussion", "proposal", proposal, "speaker", speaker, "text", text)
+func (e *ElizaClient) AddDiscussion(ctx context.Context, discussion Discussion) error {
+	proposal, speaker, text := discussion.Proposal, discussion.SpeakerAddress, discussion.Data
+	e.logger.Info("AddDiscussion", "proposal", proposal, "discussion", discussion.Id, "speaker", speaker, "replyTo", discussion.ReplyTo, "text", text)
 	url := fmt.Sprintf("%s/%s/discussion", e.Url, e.AgentId)
 	req := AddDiscussionReq{
 		ProposalId:       proposal,
+		DiscussionId:     discussion.Id,
 		ValidatorAddress: speaker,
+		SpeakerType:      discussion.speakerType(),
+		ReplyTo:          discussion.ReplyTo,
+		References:       discussion.References,
 		Text:             text,
 	}
 	data, _ := json.Marshal(req)
@@ -202,21 +264,58 @@ func (e *ElizaClient) AddDiscussion(ctx context.Context, proposal uint64, speake
 		return err
 	}
 	defer res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("add discussion: %s", res.Status)
+	}
 	e.logger.Info("add discussion", "proposal", proposal, "speaker", speaker, "text", text)
 	return nil
 }
 
+type AddProposalRevisionReq struct {
+	ProposalId       uint64 `json:"proposalId"`
+	Revision         uint64 `json:"revision"`
+	ValidatorAddress string `json:"validatorAddress"`
+	Text             string `json:"text"`
+	Diff             string `json:"diff"`
+}
+
+// AddProposalRevision tells the agent the proposal was revised, text is the
+// new content and diff the changes against the previous revision.
+func (e *ElizaClient) AddProposalRevision(ctx context.Context, proposal uint64, revision uint64, proposer string, text string, diff string) error {
+	e.logger.Info("AddProposalRevision", "proposal", proposal, "revision", revision, "proposer", proposer)
+	url := fmt.Sprintf("%s/%s/proposalrevision", e.Url, e.AgentId)
+	req := AddProposalRevisionReq{
+		ProposalId:       proposal,
+		Revision:         revision,
+		ValidatorAddress: proposer,
+		Text:             text,
+		Diff:             diff,
+	}
+	data, _ := json.Marshal(req)
+	res, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("add proposal revision: %s", res.Status)
+	}
+	return nil
+}
+
 type AddProposalReq struct {
 	ProposalId       uint64 `json:"proposalId"`
+	Category         string `json:"category"`
 	ValidatorAddress string `json:"validatorAddress"`
 	Text             string `json:"text"`
 }
 
-func (e *ElizaClient) AddProposal(ctx context.Context, proposal uint64, proposer string, text string) error {
-	e.logger.Info("AddProposal", "proposal", proposal, "proposer", proposer, "text", text)
+func (e *ElizaClient) AddProposal(ctx context.Context, proposal uint64, category string, proposer string, text string) error {
+	e.logger.Info("AddProposal", "proposal", proposal, "category", category, "proposer", proposer, "text", text)
 	url := fmt.Sprintf("%s/%s/proposal", e.Url, e.AgentId)
 	req := AddProposalReq{
 		ProposalId:       proposal,
+		Category:         category,
 		ValidatorAddress: proposer,
 		Text:             text,
 	}
@@ -226,6 +325,9 @@ func (e *ElizaClient) AddProposal(ctx context.Context, proposal uint64, proposer
 		return err
 	}
 	defer res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("add proposal: %s", res.Status)
+	}
 	data, err = io.ReadAll(res.Body)
 	resp := ""
 	if err == nil {
@@ -235,15 +337,84 @@ func (e *ElizaClient) AddProposal(ctx context.Context, proposal uint64, proposer
 	return nil
 }
 
+type DraftProposalReq struct {
+	Text string `json:"text"`
+}
+
+type DraftProposalResp struct {
+	Title   string `json:"title"`
+	Summary string `json:"summary"`
+}
+
+// DraftProposal asks the agent to draft the title and summary of a proposal
+// from the source text.
+func (e *ElizaClient) DraftProposal(ctx context.Context, text string) (string, string, error) {
+	e.logger.Info("DraftProposal", "text", text)
+	url := fmt.Sprintf("%s/%s/draftproposal", e.Url, e.AgentId)
+	data, _ := json.Marshal(DraftProposalReq{Text: text})
+	res, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		e.logger.Error("read response body fail", "err", err)
+		return "", "", err
+	}
+	var draft DraftProposalResp
+	err = json.Unmarshal(bodyBytes, &draft)
+	if err != nil {
+		e.logger.Error("unmarshal response body fail", "err", err)
+		return "", "", err
+	}
+	e.logger.Info("draft proposal", "title", draft.Title, "summary", draft.Summary)
+	return draft.Title, draft.Summary, nil
+}
+
+type WritePostReq struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type WritePostResp struct {
+	Text string `json:"text"`
+}
+
+// WritePost asks the agent to write a social post about a governance event
+// in its own voice, text is the post rendered from the event template.
+func (e *ElizaClient) WritePost(ctx context.Context, kind string, text string) (string, error) {
+	e.logger.Info("WritePost", "type", kind, "text", text)
+	url := fmt.Sprintf("%s/%s/writepost", e.Url, e.AgentId)
+	data, _ := json.Marshal(WritePostReq{Type: kind, Text: text})
+	res, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return "", fmt.Errorf("write post: %s", res.Status)
+	}
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	var post WritePostResp
+	if err := json.Unmarshal(bodyBytes, &post); err != nil {
+		return "", err
+	}
+	return post.Text, nil
+}
+
 type VoteResponse struct {
 	Vote   string `json:"vote"`
 	Reason string `json:"reason"`
 }
 
-func (e *ElizaClient) IfAcceptProposal(ctx context.Context, proposal uint64, voter string) (bool, error) {
-	e.logger.Info("IfAcceptProposal", "proposal", proposal, "voter", voter)
+func (e *ElizaClient) IfAcceptProposal(ctx context.Context, proposal uint64, revision uint64, voter string) (bool, error) {
+	e.logger.Info("IfAcceptProposal", "proposal", proposal, "revision", revision, "voter", voter)
 	url := fmt.Sprintf("%s/%s/voteproposal", e.Url, e.AgentId)
-	body := fmt.Sprintf(`{"proposalId":"%d","validatorAddress":"%s","text":"analyze proposal"}`, proposal, voter)
+	body := fmt.Sprintf(`{"proposalId":"%d","revision":%d,"validatorAddress":"%s","text":"analyze proposal"}`, proposal, revision, voter)
 	res, err := http.Post(url, "application/json", bytes.NewBuffer([]byte(body)))
 	if err != nil {
 		return false, err
@@ -267,7 +438,70 @@ func (e *ElizaClient) IfAcceptProposal(ctx context.Context, proposal uint64, vot
 	return false, nil
 }
 
-func (e *ElizaClient) IfProcessProposal(ctx context.Context, data []byte) (bool, error) {
+// IfSettleProposal asks the agent whether its own proposal should be settled
+// before the discussion thresholds of the settle policy are met.
+func (e *ElizaClient) IfSettleProposal(ctx context.Context, proposal uint64, proposer string) (bool, error) {
+	e.logger.Info("IfSettleProposal", "proposal", proposal, "proposer", proposer)
+	url := fmt.Sprintf("%s/%s/settleproposal", e.Url, e.AgentId)
+	body := fmt.Sprintf(`{"proposalId":"%d","validatorAddress":"%s","text":"settle proposal"}`, proposal, proposer)
+	res, err := http.Post(url, "application/json", bytes.NewBuffer([]byte(body)))
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		e.logger.Error("read response body fail", "err", err)
+		return false, err
+	}
+	var vote VoteResponse
+	err = json.Unmarshal(bodyBytes, &vote)
+	if err != nil {
+		e.logger.Error("unmarshal response body fail", "err", err)
+		return false, err
+	}
+	e.logger.Info("settle proposal", "proposal", proposal, "proposer", proposer, "vote", vote.Vote, "reason", vote.Reason)
+	if vote.Vote == "yes" {
+		return true, nil
+	}
+	return false, nil
+}
+
+type SponsorProposalReq struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+// IfSponsorProposal asks the agent whether the node should put a proposal
+// submitted by the community on chain, and why.
+func (e *ElizaClient) IfSponsorProposal(ctx context.Context, author string, text string) (bool, string, error) {
+	e.logger.Info("IfSponsorProposal", "author", author, "text", text)
+	url := fmt.Sprintf("%s/%s/sponsorproposal", e.Url, e.AgentId)
+	data, _ := json.Marshal(SponsorProposalReq{Author: author, Text: text})
+	res, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return false, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return false, "", fmt.Errorf("sponsor proposal: %s", res.Status)
+	}
+	bodyBytes, err := io.ReadAll(res.Body)
+	if err != nil {
+		e.logger.Error("read response body fail", "err", err)
+		return false, "", err
+	}
+	var vote VoteResponse
+	err = json.Unmarshal(bodyBytes, &vote)
+	if err != nil {
+		e.logger.Error("unmarshal response body fail", "err", err)
+		return false, "", err
+	}
+	e.logger.Info("sponsor proposal", "author", author, "vote", vote.Vote, "reason", vote.Reason)
+	return vote.Vote == "yes", vote.Reason, nil
+}
+
+func (e *ElizaClient) IfProcessProposal(ctx context.Context, category string, data []byte) (bool, error) {
 	return true, nil
 }
 
@@ -278,18 +512,35 @@ func (m *MockClient) GetHeadPhoto(ctx context.Context) (string, error) {
 	return "", nil
 }
 
+func (m *MockClient) GetStatus(ctx context.Context) (*AgentStatus, error) {
+	return &AgentStatus{Id: "mock"}, nil
+}
+
 func (m *MockClient) GetSelfIntro(ctx context.Context) (string, error) {
 	return "mock", nil
 }
 
-func (m *MockClient) AddDiscussion(ctx context.Context, proposal uint64, speaker string, text string) error {
+func (m *MockClient) AddDiscussion(ctx context.Context, discussion Discussion) error {
+	return nil
+}
+
+func (m *MockClient) AddProposal(ctx context.Context, proposal uint64, category string, proposer string, text string) error {
 	return nil
 }
 
-func (m *MockClient) AddProposal(ctx context.Context, proposal uint64, proposer string, text string) error {
+func (m *MockClient) AddProposalRevision(ctx context.Context, proposal uint64, revision uint64, proposer string, text string, diff string) error {
 	return nil
 }
 
+func (m *MockClient) DraftProposal(ctx context.Context, text string) (string, string, error) {
+	title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return title, text, nil
+}
+
+func (m *MockClient) WritePost(ctx context.Context, kind string, text string) (string, error) {
+	return text, nil
+}
+
 func (m *MockClient) CommentPropoal(ctx context.Context, proposal uint64, speaker string) (string, error) {
 	return "", nil
 }
@@ -298,7 +549,7 @@ func NewMockClient() *MockClient {
 	return &MockClient{}
 }
 
-func (m *MockClient) IfAcceptProposal(ctx context.Context, proposal uint64, voter string) (bool, error) {
+func (m *MockClient) IfAcceptProposal(ctx context.Context, proposal uint64, revision uint64, voter string) (bool, error) {
 	return true, nil
 }
 
@@ -306,6 +557,84 @@ func (m *MockClient) IfGrantNewMember(ctx context.Context, validator uint64, pro
 	return true, nil
 }
 
-func (m *MockClient) IfProcessProposal(ctx context.Context, data []byte) (bool, error) {
+func (m *MockClient) IfSettleProposal(ctx context.Context, proposal uint64, proposer string) (bool, error) {
+	return false, nil
+}
+
+func (m *MockClient) IfSponsorProposal(ctx context.Context, author string, text string) (bool, string, error) {
+	return true, "mock", nil
+}
+
+func (m *MockClient) IfProcessProposal(ctx context.Context, category string, data []byte) (bool, error) {
 	return true, nil
 }
+
+// ObserverClient stands in for the agent on an observer node. An observer has
+// no validator key, so its votes are never signed; it answers every question
+// with no and remembers nothing.
+type ObserverClient struct {
+}
+
+var _ Client = &ObserverClient{}
+
+var ErrObserverNode = errors.New("observer node has no agent")
+
+func NewObserverClient() *ObserverClient {
+	return &ObserverClient{}
+}
+
+func (o *ObserverClient) GetHeadPhoto(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func (o *ObserverClient) GetStatus(ctx context.Context) (*AgentStatus, error) {
+	return &AgentStatus{Id: "observer"}, nil
+}
+
+func (o *ObserverClient) GetSelfIntro(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func (o *ObserverClient) AddDiscussion(ctx context.Context, discussion Discussion) error {
+	return nil
+}
+
+func (o *ObserverClient) AddProposal(ctx context.Context, proposal uint64, category string, proposer string, text string) error {
+	return nil
+}
+
+func (o *ObserverClient) AddProposalRevision(ctx context.Context, proposal uint64, revision uint64, proposer string, text string, diff string) error {
+	return nil
+}
+
+func (o *ObserverClient) DraftProposal(ctx context.Context, text string) (string, string, error) {
+	return "", "", ErrObserverNode
+}
+
+func (o *ObserverClient) WritePost(ctx context.Context, kind string, text string) (string, error) {
+	return "", ErrObserverNode
+}
+
+func (o *ObserverClient) CommentPropoal(ctx context.Context, proposal uint64, speaker string) (string, error) {
+	return "", ErrObserverNode
+}
+
+func (o *ObserverClient) IfAcceptProposal(ctx context.Context, proposal uint64, revision uint64, voter string) (bool, error) {
+	return false, nil
+}
+
+func (o *ObserverClient) IfGrantNewMember(ctx context.Context, validator uint64, proposer string, amount uint64, statement string) (bool, error) {
+	return false, nil
+}
+
+func (o *ObserverClient) IfSettleProposal(ctx context.Context, proposal uint64, proposer string) (bool, error) {
+	return false, nil
+}
+
+func (o *ObserverClient) IfSponsorProposal(ctx context.Context, author string, text string) (bool, string, error) {
+	return false, "", ErrObserverNode
+}
+
+func (o *ObserverClient) IfProcessProposal(ctx context.Context, category string, data []byte) (bool, error) {
+	return false, nil
+}
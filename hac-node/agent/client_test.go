@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestObserverClient(t *testing.T) {
+	o := NewObserverClient()
+	ctx := context.Background()
+
+	// an observer never votes for anything
+	if pass, err := o.IfProcessProposal(ctx, "text", nil); pass || err != nil {
+		t.Fatalf("process %v %v", pass, err)
+	}
+	if pass, err := o.IfAcceptProposal(ctx, 1, 0, "v"); pass || err != nil {
+		t.Fatalf("accept %v %v", pass, err)
+	}
+	if pass, err := o.IfGrantNewMember(ctx, 1, "p", 1, "s"); pass || err != nil {
+		t.Fatalf("grant %v %v", pass, err)
+	}
+	if pass, err := o.IfSettleProposal(ctx, 1, "p"); pass || err != nil {
+		t.Fatalf("settle %v %v", pass, err)
+	}
+
+	// and writes nothing
+	if _, err := o.CommentPropoal(ctx, 1, "s"); !errors.Is(err, ErrObserverNode) {
+		t.Fatalf("comment error %v, want %v", err, ErrObserverNode)
+	}
+	if _, _, err := o.DraftProposal(ctx, "text"); !errors.Is(err, ErrObserverNode) {
+		t.Fatalf("draft error %v, want %v", err, ErrObserverNode)
+	}
+	if _, err := o.WritePost(ctx, "proposal", "text"); !errors.Is(err, ErrObserverNode) {
+		t.Fatalf("post error %v, want %v", err, ErrObserverNode)
+	}
+	if _, _, err := o.IfSponsorProposal(ctx, "a", "text"); !errors.Is(err, ErrObserverNode) {
+		t.Fatalf("sponsor error %v, want %v", err, ErrObserverNode)
+	}
+	if err := o.AddDiscussion(ctx, Discussion{}); err != nil {
+		t.Fatal(err)
+	}
+}
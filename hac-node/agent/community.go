@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	app_config "github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	eth_crypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	CommunityPending   = "pending"
+	CommunityDeclined  = "declined"
+	CommunitySponsored = "sponsored"
+	CommunityProposed  = "proposed"
+	CommunityFailed    = "failed"
+
+	// interval between two reviews of the community queue
+	CommunityInterval = 10 * time.Second
+	// a sponsored submission not on chain after this delay is submitted
+	// again, at most CommunityMaxSubmits times
+	CommunityResubmitDelay = 5 * time.Minute
+	CommunityMaxSubmits    = 3
+
+	MaxCommunityTitleLen = 200
+	MaxCommunityDataLen  = 16 * 1024
+)
+
+var (
+	ErrCommunityQueueFull   = errors.New("community queue is full")
+	ErrSubmissionNotFound   = errors.New("community submission not found")
+	ErrSubmissionSignature  = errors.New("submission signature does not match the author")
+	ErrSubmissionNeedsSig   = errors.New("submission must be signed")
+	ErrSubmissionAuthorOnly = errors.New("an author needs a signature")
+)
+
+// CommunityProposal is the content of a community submission.
+type CommunityProposal struct {
+	Title    string `json:"title"`
+	Link     string `json:"link"`
+	ImageUrl string `json:"imageUrl"`
+	Data     string `json:"data"`
+}
+
+func (p CommunityProposal) validate() error {
+	if strings.TrimSpace(p.Title) == "" {
+		return errors.New("proposal title is empty")
+	}
+	if utf8.RuneCountInString(p.Title) > MaxCommunityTitleLen {
+		return fmt.Errorf("proposal title is longer than %d characters", MaxCommunityTitleLen)
+	}
+	if len(p.Data) > MaxCommunityDataLen {
+		return fmt.Errorf("proposal data is larger than %d bytes", MaxCommunityDataLen)
+	}
+	return nil
+}
+
+// Message is the text an author signs with personal_sign, and the agent
+// reads when deciding on the submission.
+func (p CommunityProposal) Message() string {
+	return fmt.Sprintf("HAC community proposal\nTitle: %s\nLink: %s\nImage: %s\n\n%s", p.Title, p.Link, p.ImageUrl, p.Data)
+}
+
+// Hash is the hex sha256 of the message and the author, empty if unsigned. It
+// identifies the submission on chain, so the same proposal signed by two
+// authors are two submissions.
+func (p CommunityProposal) Hash(author string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n\nAuthor: %s", p.Message(), author)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s CommunitySubmission) proposal() CommunityProposal {
+	return CommunityProposal{Title: s.Title, Link: s.Link, ImageUrl: s.ImageUrl, Data: s.Data}
+}
+
+// recoverSigner returns the address that signed message with personal_sign.
+func recoverSigner(message string, signature string) (string, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return "", err
+	}
+	if len(sig) != eth_crypto.SignatureLength {
+		return "", fmt.Errorf("signature must be %d bytes", eth_crypto.SignatureLength)
+	}
+	if sig[eth_crypto.RecoveryIDOffset] >= 27 {
+		sig[eth_crypto.RecoveryIDOffset] -= 27
+	}
+	hash := eth_crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	pub, err := eth_crypto.SigToPub(hash, sig)
+	if err != nil {
+		return "", err
+	}
+	return eth_crypto.PubkeyToAddress(*pub).Hex(), nil
+}
+
+// CommunityQueue presents the community submissions to the local agent, one
+// at a time, and submits the ones it sponsors as a ProposalTx of the node.
+type CommunityQueue struct {
+	logger cmtlog.Logger
+	db     *gorm.DB
+	agent  Client
+	sender *TxSender
+	notify chan struct{}
+}
+
+func NewCommunityQueue(logger cmtlog.Logger, db *gorm.DB, agent Client, sender *TxSender) *CommunityQueue {
+	return &CommunityQueue{
+		logger: logger.With("module", "community"),
+		db:     db,
+		agent:  agent,
+		sender: sender,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// Submitted wakes the queue up after a submission was stored.
+func (q *CommunityQueue) Submitted() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run reviews the queue until ctx is done.
+func (q *CommunityQueue) Run(ctx context.Context) {
+	ticker := time.NewTicker(CommunityInterval)
+	defer ticker.Stop()
+	for {
+		if err := q.review(ctx); err != nil {
+			q.logger.Error("review community submissions fail", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.notify:
+		}
+	}
+}
+
+// review takes the next step on the queue. The node has a single proposal in
+// flight, so nothing happens while one is pending.
+func (q *CommunityQueue) review(ctx context.Context) error {
+	if q.sender.IsPending(tx.HACTxTypeProposal, nil) {
+		return nil
+	}
+	var sub CommunitySubmission
+	deadline := time.Now().Add(-CommunityResubmitDelay).Unix()
+	err := q.db.Where("status = ? AND submitted_at <= ?", CommunitySponsored, deadline).Order("id asc").First(&sub).Error
+	if err == nil {
+		if sub.Submits >= CommunityMaxSubmits {
+			q.logger.Error("sponsored submission not on chain, give up", "hash", sub.Hash, "submits", sub.Submits)
+			return q.update(sub, CommunitySponsored, map[string]interface{}{"status": CommunityFailed})
+		}
+		return q.submit(sub)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	err = q.db.Where("status = ?", CommunityPending).Order("id asc").First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sponsor, reason, err := q.agent.IfSponsorProposal(ctx, sub.Author, sub.proposal().Message())
+	if err != nil {
+		return err
+	}
+	q.logger.Info("agent reviewed submission", "hash", sub.Hash, "sponsor", sponsor, "reason", reason)
+	fields := map[string]interface{}{"reason": reason, "decided_at": time.Now().Unix()}
+	if !sponsor {
+		fields["status"] = CommunityDeclined
+		return q.update(sub, CommunityPending, fields)
+	}
+	if err := q.update(sub, CommunityPending, fields); err != nil {
+		return err
+	}
+	return q.submit(sub)
+}
+
+// submit queues the ProposalTx of a sponsored submission.
+func (q *CommunityQueue) submit(sub CommunitySubmission) error {
+	err := q.sender.Submit(tx.HACTxTypeProposal, &tx.ProposalTx{
+		ImageUrl:       sub.ImageUrl,
+		Title:          sub.Title,
+		Link:           sub.Link,
+		Data:           []byte(sub.Data),
+		Author:         sub.Author,
+		SubmissionHash: sub.Hash,
+	})
+	if err != nil {
+		return err
+	}
+	q.logger.Info("sponsor community proposal", "hash", sub.Hash, "author", sub.Author, "title", sub.Title)
+	return q.db.Model(&CommunitySubmission{}).Where("id = ? AND status IN (?)", sub.Id, []string{CommunityPending, CommunitySponsored}).
+		Updates(map[string]interface{}{
+			"status":       CommunitySponsored,
+			"submits":      sub.Submits + 1,
+			"submitted_at": time.Now().Unix(),
+		}).Error
+}
+
+// update changes a submission unless the indexer moved it on meanwhile.
+func (q *CommunityQueue) update(sub CommunitySubmission, status string, fields map[string]interface{}) error {
+	return q.db.Model(&CommunitySubmission{}).Where("id = ? AND status = ?", sub.Id, status).Updates(fields).Error
+}
+
+// proposeSubmission marks the submission of a sponsored proposal as on chain.
+func (c *ChainIndexer) proposeSubmission(b *heightBatch, hash string, proposal uint64) error {
+	return b.db.Model(&CommunitySubmission{}).Where("hash = ?", hash).Updates(map[string]interface{}{
+		"status":   CommunityProposed,
+		"proposal": proposal,
+		"height":   uint64(b.height),
+	}).Error
+}
+
+// submitCommunityProposal stores a submission for the local agent to review.
+// A signed submission is attributed to its signer, submitting the same content
+// again under the same author returns the stored submission.
+func (c *ChainIndexer) submitCommunityProposal(p CommunityProposal, author string, signature string) (*CommunitySubmission, error) {
+	if c.community == nil {
+		return nil, ErrObserverNode
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	cfg := c.appConfig.App.Community
+	if signature != "" {
+		signer, err := recoverSigner(p.Message(), signature)
+		if err != nil {
+			return nil, err
+		}
+		if author != "" && !strings.EqualFold(author, signer) {
+			return nil, ErrSubmissionSignature
+		}
+		author = signer
+	} else if cfg.RequireSignature {
+		return nil, ErrSubmissionNeedsSig
+	} else if author != "" {
+		return nil, ErrSubmissionAuthorOnly
+	}
+
+	hash := p.Hash(author)
+	var existing CommunitySubmission
+	if err := c.db.Where("hash = ?", hash).First(&existing).Error; err == nil {
+		return &existing, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	maxPending := cfg.MaxPending
+	if maxPending <= 0 {
+		maxPending = app_config.DefaultCommunityMaxPending
+	}
+	var pending int
+	if err := c.db.Model(&CommunitySubmission{}).Where("status = ?", CommunityPending).Count(&pending).Error; err != nil {
+		return nil, err
+	}
+	if pending >= maxPending {
+		return nil, ErrCommunityQueueFull
+	}
+	sub := &CommunitySubmission{
+		Hash:      hash,
+		Title:     p.Title,
+		Link:      p.Link,
+		ImageUrl:  p.ImageUrl,
+		Data:      p.Data,
+		Author:    author,
+		Signature: signature,
+		Status:    CommunityPending,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := c.db.Create(sub).Error; err != nil {
+		return nil, err
+	}
+	c.community.Submitted()
+	return sub, nil
+}
+
+func (c *ChainIndexer) getCommunitySubmission(hash string) (*CommunitySubmission, error) {
+	var sub CommunitySubmission
+	if err := c.db.Where("hash = ?", strings.ToLower(hash)).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubmissionNotFound
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// getCommunitySubmissions returns the submissions, newest first.
+func (c *ChainIndexer) getCommunitySubmissions(status string, page int, pageSize int) ([]CommunitySubmission, uint64, error) {
+	query := c.db.Model(&CommunitySubmission{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total uint64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	subs := make([]CommunitySubmission, 0)
+	if err := query.Order("id desc").Offset(page * pageSize).Limit(pageSize).Find(&subs).Error; err != nil {
+		return nil, 0, err
+	}
+	return subs, total, nil
+}
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	app_config "github.com/calehh/hac-app/config"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	eth_crypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// personalSign signs message like an ethereum wallet, with v 27 or 28.
+func personalSign(t *testing.T, key string, message string) (string, string) {
+	t.Helper()
+	priv, err := eth_crypto.HexToECDSA(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := eth_crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	sig, err := eth_crypto.Sign(hash, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[eth_crypto.RecoveryIDOffset] += 27
+	return eth_crypto.PubkeyToAddress(priv.PublicKey).Hex(), hexutil.Encode(sig)
+}
+
+const (
+	aliceKey = "b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291"
+	bobKey   = "289c2857d4598e37fb9647507e47a309d6133539bf21a8b9cb6df88fd5232032"
+)
+
+func TestRecoverSigner(t *testing.T) {
+	p := CommunityProposal{Title: "Fund the docs", Link: "https://example.com", Data: "details"}
+	alice, sig := personalSign(t, aliceKey, p.Message())
+	signer, err := recoverSigner(p.Message(), sig)
+	if err != nil || signer != alice {
+		t.Fatalf("signer %s, %v, want %s", signer, err, alice)
+	}
+
+	// a v of 0 or 1 is accepted as well
+	raw, _ := hexutil.Decode(sig)
+	raw[eth_crypto.RecoveryIDOffset] -= 27
+	if signer, err := recoverSigner(p.Message(), hexutil.Encode(raw)); err != nil || signer != alice {
+		t.Fatalf("signer %s, %v with a raw v", signer, err)
+	}
+
+	// another message recovers another address
+	other := p
+	other.Title = "Fund the art"
+	if signer, err := recoverSigner(other.Message(), sig); err == nil && signer == alice {
+		t.Fatal("signature recovered for another message")
+	}
+	for _, bad := range []string{"", "0x1234", "zz", sig[:len(sig)-2]} {
+		if _, err := recoverSigner(p.Message(), bad); err == nil {
+			t.Errorf("signature %q accepted", bad)
+		}
+	}
+}
+
+func TestCommunityProposalHash(t *testing.T) {
+	p := CommunityProposal{Title: "Fund the docs"}
+	alice, _ := personalSign(t, aliceKey, p.Message())
+	bob, _ := personalSign(t, bobKey, p.Message())
+	hashes := map[string]bool{p.Hash(""): true, p.Hash(alice): true, p.Hash(bob): true}
+	other := p
+	other.Data = "more"
+	hashes[other.Hash(alice)] = true
+	if len(hashes) != 4 {
+		t.Fatalf("hashes %v collide", hashes)
+	}
+	if p.Hash(alice) != p.Hash(alice) || len(p.Hash(alice)) != 64 {
+		t.Fatalf("hash %s", p.Hash(alice))
+	}
+
+	for _, tc := range []struct {
+		p  CommunityProposal
+		ok bool
+	}{
+		{p, true},
+		{CommunityProposal{Title: "  "}, false},
+		{CommunityProposal{Title: strings.Repeat("é", MaxCommunityTitleLen)}, true},
+		{CommunityProposal{Title: strings.Repeat("é", MaxCommunityTitleLen+1)}, false},
+		{CommunityProposal{Title: "t", Data: strings.Repeat("x", MaxCommunityDataLen+1)}, false},
+	} {
+		if err := tc.p.validate(); (err == nil) != tc.ok {
+			t.Errorf("validate %.20q: %v", tc.p.Title, err)
+		}
+	}
+}
+
+func TestSubmitCommunityProposal(t *testing.T) {
+	db := openTestStore(t).DB()
+	cfg := &app_config.Config{App: app_config.DefaultHACAppConfig(t.TempDir())}
+	cfg.App.Community.MaxPending = 3
+	c := &ChainIndexer{db: db, appConfig: cfg, community: &CommunityQueue{notify: make(chan struct{}, 1)}}
+
+	p := CommunityProposal{Title: "Fund the docs"}
+	alice, aliceSig := personalSign(t, aliceKey, p.Message())
+	bob, bobSig := personalSign(t, bobKey, p.Message())
+
+	// the author is recovered from the signature, in any case
+	sub, err := c.submitCommunityProposal(p, "", aliceSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Author != alice || sub.Hash != p.Hash(alice) || sub.Status != CommunityPending {
+		t.Fatalf("submission %+v", sub)
+	}
+	again, err := c.submitCommunityProposal(p, strings.ToLower(alice), aliceSig)
+	if err != nil || again.Id != sub.Id {
+		t.Fatalf("submission %+v, %v, want the stored one", again, err)
+	}
+
+	// the same content signed by another author is another submission
+	bobSub, err := c.submitCommunityProposal(p, bob, bobSig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bobSub.Id == sub.Id || bobSub.Author != bob || bobSub.Hash != p.Hash(bob) {
+		t.Fatalf("submission %+v of bob", bobSub)
+	}
+	if got, err := c.getCommunitySubmission(strings.ToUpper(bobSub.Hash)); err != nil || got.Author != bob {
+		t.Fatalf("submission %+v, %v by hash", got, err)
+	}
+
+	for name, tc := range map[string]struct {
+		author, signature string
+		err               error
+	}{
+		"claimed author":  {alice, bobSig, ErrSubmissionSignature},
+		"unsigned author": {alice, "", ErrSubmissionAuthorOnly},
+	} {
+		if _, err := c.submitCommunityProposal(p, tc.author, tc.signature); !errors.Is(err, tc.err) {
+			t.Errorf("%s: %v, want %v", name, err, tc.err)
+		}
+	}
+
+	anon, err := c.submitCommunityProposal(p, "", "")
+	if err != nil || anon.Author != "" || anon.Hash != p.Hash("") {
+		t.Fatalf("unsigned submission %+v, %v", anon, err)
+	}
+	if _, err := c.submitCommunityProposal(CommunityProposal{Title: "another"}, "", ""); !errors.Is(err, ErrCommunityQueueFull) {
+		t.Fatalf("submission beyond the queue: %v", err)
+	}
+	cfg.App.Community.RequireSignature = true
+	if _, err := c.submitCommunityProposal(p, "", ""); !errors.Is(err, ErrSubmissionNeedsSig) {
+		t.Fatalf("unsigned submission: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	app_config "github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+var (
+	ErrDiscussionEmpty         = errors.New("discussion is empty")
+	ErrDiscussionProposalLimit = errors.New("discussion limit per proposal reached")
+	ErrDiscussionBlockLimit    = errors.New("discussion limit per block reached")
+)
+
+// DiscussionAuthor turns the comments of the local agent into DiscussionTx
+// and submits them through the node TxSender, which signs them with the node
+// key.
+type DiscussionAuthor struct {
+	logger cmtlog.Logger
+	sender *TxSender
+
+	rate        int
+	trigger     int
+	perProposal int
+	perBlock    int
+
+	mtx         sync.Mutex
+	blockHeight int64
+	blockCnt    int
+	proposalCnt map[uint64]int
+}
+
+func NewDiscussionAuthor(logger cmtlog.Logger, cfg *app_config.HACAppConfig, sender *TxSender) *DiscussionAuthor {
+	a := &DiscussionAuthor{
+		logger:      logger.With("module", "discussion"),
+		sender:      sender,
+		rate:        cfg.DiscussionRate,
+		perProposal: cfg.DiscussionPerProposal,
+		perBlock:    cfg.DiscussionPerBlock,
+		proposalCnt: make(map[uint64]int),
+	}
+	if a.rate > 0 {
+		a.trigger = rand.New(rand.NewSource(time.Now().UnixNano())).Intn(a.rate)
+	}
+	return a
+}
+
+// Triggered reports whether the local agent should consider commenting on a
+// processing proposal at the given height.
+func (a *DiscussionAuthor) Triggered(height int64) bool {
+	if a.rate <= 0 {
+		return false
+	}
+	return (height+int64(a.trigger))%int64(a.rate) == 0
+}
+
+// Allowed reports whether the per-proposal and per-block limits leave room
+// for another discussion. indexed is the number of discussions of the local
+// agent on the proposal that are already indexed.
+func (a *DiscussionAuthor) Allowed(proposal uint64, height int64, indexed uint64) error {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.allowed(proposal, height, indexed)
+}
+
+func (a *DiscussionAuthor) allowed(proposal uint64, height int64, indexed uint64) error {
+	if a.perBlock > 0 && a.blockHeight == height && a.blockCnt >= a.perBlock {
+		return ErrDiscussionBlockLimit
+	}
+	if a.perProposal > 0 {
+		cnt := a.proposalCnt[proposal]
+		if int(indexed) > cnt {
+			cnt = int(indexed)
+		}
+		if cnt >= a.perProposal {
+			return ErrDiscussionProposalLimit
+		}
+	}
+	return nil
+}
+
+// Discuss submits the comment as a DiscussionTx on the proposal.
+func (a *DiscussionAuthor) Discuss(ctx context.Context, proposal uint64, height int64, indexed uint64, comment string) error {
+	comment = strings.TrimSpace(comment)
+	if comment == "" {
+		return ErrDiscussionEmpty
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if err := a.allowed(proposal, height, indexed); err != nil {
+		return err
+	}
+
+	err := a.sender.Submit(tx.HACTxTypeDiscussion, &tx.DiscussionTx{
+		Proposal: proposal,
+		Data:     []byte(comment),
+	})
+	if err != nil {
+		return err
+	}
+	if a.blockHeight != height {
+		a.blockHeight = height
+		a.blockCnt = 0
+	}
+	a.blockCnt++
+	a.proposalCnt[proposal]++
+	a.logger.Info("discussion submitted", "proposal", proposal, "height", height)
+	return nil
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	app_config "github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+func newTestAuthor(t *testing.T, perProposal, perBlock int) (*DiscussionAuthor, *TxSender) {
+	t.Helper()
+	sender := newTestSender(t, newFakeChain())
+	cfg := &app_config.HACAppConfig{DiscussionPerProposal: perProposal, DiscussionPerBlock: perBlock}
+	return NewDiscussionAuthor(cmtlog.NewNopLogger(), cfg, sender), sender
+}
+
+func TestDiscussionAuthorLimits(t *testing.T) {
+	ctx := context.Background()
+	a, sender := newTestAuthor(t, 2, 1)
+
+	if err := a.Discuss(ctx, 1, 10, 0, "  \n"); !errors.Is(err, ErrDiscussionEmpty) {
+		t.Fatalf("error %v, want %v", err, ErrDiscussionEmpty)
+	}
+	if err := a.Discuss(ctx, 1, 10, 0, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Discuss(ctx, 2, 10, 0, "same block"); !errors.Is(err, ErrDiscussionBlockLimit) {
+		t.Fatalf("error %v, want %v", err, ErrDiscussionBlockLimit)
+	}
+	if err := a.Discuss(ctx, 1, 11, 0, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Discuss(ctx, 1, 12, 0, "third"); !errors.Is(err, ErrDiscussionProposalLimit) {
+		t.Fatalf("error %v, want %v", err, ErrDiscussionProposalLimit)
+	}
+	// discussions already on chain count even if this node did not post them
+	if err := a.Allowed(3, 12, 2); !errors.Is(err, ErrDiscussionProposalLimit) {
+		t.Fatalf("error %v, want %v", err, ErrDiscussionProposalLimit)
+	}
+	if err := a.Allowed(3, 12, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := sender.PendingCount(); n != 2 {
+		t.Fatalf("%d txs submitted, want 2", n)
+	}
+	if !sender.IsPending(tx.HACTxTypeDiscussion, func(body any) bool {
+		return string(body.(*tx.DiscussionTx).Data) == "second"
+	}) {
+		t.Fatal("discussion not submitted as DiscussionTx")
+	}
+}
+
+func TestDiscussionAuthorTriggered(t *testing.T) {
+	a, _ := newTestAuthor(t, 0, 0)
+	for h := int64(0); h < 10; h++ {
+		if a.Triggered(h) {
+			t.Fatalf("triggered at %d without a rate", h)
+		}
+	}
+
+	a.rate, a.trigger = 4, 1
+	triggered := 0
+	for h := int64(0); h < 12; h++ {
+		if a.Triggered(h) {
+			triggered++
+		}
+	}
+	if triggered != 3 {
+		t.Fatalf("triggered %d times in 12 blocks, want 3", triggered)
+	}
+}
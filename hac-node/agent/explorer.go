@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/calehh/hac-app/tx"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+const (
+	DefaultExplorerPageSize = 20
+	MaxExplorerPageSize     = 100
+)
+
+// TxEvent is an event emitted by a transaction.
+type TxEvent struct {
+	Type       string            `json:"type"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// TxInfo is a transaction decoded into its typed form. Tx is nil and Error is
+// set if the bytes are not a HAC transaction.
+type TxInfo struct {
+	Hash          string    `json:"hash"`
+	Height        uint64    `json:"height"`
+	Index         int       `json:"index"`
+	Type          uint8     `json:"type"`
+	TypeName      string    `json:"type_name"`
+	Version       uint8     `json:"version"`
+	Signer        uint64    `json:"signer"`
+	SignerAddress string    `json:"signer_address"`
+	SignerName    string    `json:"signer_name"`
+	Nonce         uint64    `json:"nonce"`
+	Code          uint32    `json:"code"`
+	Log           string    `json:"log"`
+	Events        []TxEvent `json:"events"`
+	Tx            any       `json:"tx"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// BlockSummary is the metadata of a block.
+type BlockSummary struct {
+	Height          uint64 `json:"height"`
+	Hash            string `json:"hash"`
+	Timestamp       int64  `json:"timestamp"`
+	ProposerAddress string `json:"proposer_address"`
+	ProposerName    string `json:"proposer_name"`
+	ProposerId      uint64 `json:"proposer_id"`
+	VoteCode        int64  `json:"vote_code"`
+	TxCount         int    `json:"tx_count"`
+	Size            int    `json:"size"`
+	AppHash         string `json:"app_hash"`
+}
+
+type BlockDetail struct {
+	BlockSummary
+	Txs []TxInfo `json:"txs"`
+}
+
+func txEvents(events []abci.Event) []TxEvent {
+	res := make([]TxEvent, 0, len(events))
+	for _, e := range events {
+		ev := TxEvent{Type: e.Type, Attributes: make(map[string]string, len(e.Attributes))}
+		for _, attr := range e.Attributes {
+			ev.Attributes[attr.Key] = attr.Value
+		}
+		res = append(res, ev)
+	}
+	return res
+}
+
+// newIndexedTx decodes the transaction at index of a block. Transactions that
+// do not decode are kept with the unknown type.
+func newIndexedTx(height uint64, index int, raw cmttypes.Tx, result *abci.ExecTxResult) (IndexedTx, error) {
+	row := IndexedTx{
+		Hash:   fmt.Sprintf("%X", raw.Hash()),
+		Height: height,
+		Index:  index,
+		Type:   uint8(tx.HACTxTypeUnknown),
+	}
+	if result != nil {
+		row.Code = result.Code
+		row.Log = result.Log
+		events, err := json.Marshal(txEvents(result.Events))
+		if err != nil {
+			return row, err
+		}
+		row.Events = string(events)
+	}
+	btx, err := tx.UnmarshalHACTx(raw)
+	if err != nil {
+		return row, nil
+	}
+	row.Type = uint8(btx.Type)
+	row.Signer = btx.Validator
+	row.Nonce = btx.Nonce
+	row.Data = string(raw)
+	if rtx, ok := btx.Tx.(*tx.RegisterParticipantTx); ok {
+		// the account does not exist before the registration, it signs with
+		// the key it registers
+		row.SignerAddress = ed25519.PubKey(rtx.PubKey).Address().String()
+	}
+	return row, nil
+}
+
+// txInfo decodes an indexed transaction.
+func (t IndexedTx) txInfo() TxInfo {
+	info := TxInfo{
+		Hash:          t.Hash,
+		Height:        t.Height,
+		Index:         t.Index,
+		Type:          t.Type,
+		TypeName:      tx.HACTxType(t.Type).String(),
+		Signer:        t.Signer,
+		SignerAddress: t.SignerAddress,
+		Nonce:         t.Nonce,
+		Code:          t.Code,
+		Log:           t.Log,
+		Events:        make([]TxEvent, 0),
+	}
+	if t.Events != "" {
+		if err := json.Unmarshal([]byte(t.Events), &info.Events); err != nil {
+			info.Error = err.Error()
+		}
+	}
+	if t.Data == "" {
+		info.Error = tx.ErrUnsupportedTxType.Error()
+		return info
+	}
+	btx, err := tx.UnmarshalHACTx([]byte(t.Data))
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.Version = btx.Version
+	info.Tx = btx.Tx
+	return info
+}
+
+// blockTxs decodes the transactions of a block and resolves their signers.
+func (c *ChainIndexer) blockTxs(ctx context.Context, height uint64, txs cmttypes.Txs, results []*abci.ExecTxResult) ([]IndexedTx, error) {
+	rows := make([]IndexedTx, 0, len(txs))
+	signers := make(map[uint64]string)
+	for i, raw := range txs {
+		var result *abci.ExecTxResult
+		if i < len(results) {
+			result = results[i]
+		}
+		row, err := newIndexedTx(height, i, raw, result)
+		if err != nil {
+			return nil, err
+		}
+		if row.Type != uint8(tx.HACTxTypeUnknown) && row.SignerAddress == "" {
+			address, ok := signers[row.Signer]
+			if !ok {
+				acc, err := c.queryAccount(ctx, row.Signer, "")
+				if err != nil {
+					return nil, err
+				}
+				if acc != nil {
+					address = acc.Address()
+				}
+				signers[row.Signer] = address
+			}
+			row.SignerAddress = address
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// indexTxs records the transactions of the height, replacing the records of
+// an earlier indexing.
+func (c *ChainIndexer) indexTxs(ctx context.Context, b *heightBatch, txs cmttypes.Txs, results []*abci.ExecTxResult) error {
+	rows, err := c.blockTxs(ctx, uint64(b.height), txs, results)
+	if err != nil {
+		return err
+	}
+	if err := b.db.Where("height = ?", b.height).Delete(&IndexedTx{}).Error; err != nil {
+		return err
+	}
+	for i := range rows {
+		if err := b.db.Save(&rows[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ChainIndexer) agentNames() (map[string]ValidatorAgent, error) {
+	agents, err := c.getValidators()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]ValidatorAgent, len(agents))
+	for _, a := range agents {
+		res[a.Address] = a
+	}
+	return res, nil
+}
+
+func blockSummary(meta *cmttypes.BlockMeta, agents map[string]ValidatorAgent) BlockSummary {
+	proposer := meta.Header.ProposerAddress.String()
+	return BlockSummary{
+		Height:          uint64(meta.Header.Height),
+		Hash:            meta.BlockID.Hash.String(),
+		Timestamp:       meta.Header.Time.Unix(),
+		ProposerAddress: proposer,
+		ProposerName:    agents[proposer].Name,
+		ProposerId:      agents[proposer].Id,
+		VoteCode:        meta.Header.VoteCode,
+		TxCount:         meta.NumTxs,
+		Size:            meta.BlockSize,
+		AppHash:         meta.Header.AppHash.String(),
+	}
+}
+
+// getBlocks returns the blocks of the block store from the latest one down,
+// and the number of blocks in the store.
+func (c *ChainIndexer) getBlocks(page int, pageSize int) ([]BlockSummary, uint64, error) {
+	latest, base := c.BlockStore.Height(), c.BlockStore.Base()
+	if latest == 0 {
+		return []BlockSummary{}, 0, nil
+	}
+	total := uint64(latest - base + 1)
+	agents, err := c.agentNames()
+	if err != nil {
+		return nil, 0, err
+	}
+	blocks := make([]BlockSummary, 0, pageSize)
+	for h := latest - int64(page*pageSize); h >= base && len(blocks) < pageSize; h-- {
+		meta := c.BlockStore.LoadBlockMeta(h)
+		if meta == nil {
+			continue
+		}
+		blocks = append(blocks, blockSummary(meta, agents))
+	}
+	return blocks, total, nil
+}
+
+// getBlock returns a block with its decoded transactions, nil if the block
+// store does not have it.
+func (c *ChainIndexer) getBlock(ctx context.Context, height int64) (*BlockDetail, error) {
+	meta := c.BlockStore.LoadBlockMeta(height)
+	block := c.BlockStore.LoadBlock(height)
+	if meta == nil || block == nil {
+		return nil, nil
+	}
+	agents, err := c.agentNames()
+	if err != nil {
+		return nil, err
+	}
+	// results are missing if the node discards them
+	var results []*abci.ExecTxResult
+	if res, err := c.stateStore.LoadFinalizeBlockResponse(height); err == nil {
+		results = res.TxResults
+	}
+	rows, err := c.blockTxs(ctx, uint64(height), block.Txs, results)
+	if err != nil {
+		return nil, err
+	}
+	detail := &BlockDetail{BlockSummary: blockSummary(meta, agents), Txs: make([]TxInfo, 0, len(rows))}
+	for _, row := range rows {
+		info := row.txInfo()
+		info.SignerName = agents[info.SignerAddress].Name
+		detail.Txs = append(detail.Txs, info)
+	}
+	return detail, nil
+}
+
+// getAccountTxs returns the transactions signed by an account, newest first.
+func (c *ChainIndexer) getAccountTxs(address string, page int, pageSize int) ([]TxInfo, uint64, error) {
+	var rows []IndexedTx
+	err := c.db.Where("signer_address = ?", address).Order("height desc, \"index\" desc").Offset(page * pageSize).Limit(pageSize).Find(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var total uint64
+	if err := c.db.Model(&IndexedTx{}).Where("signer_address = ?", address).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	agents, err := c.agentNames()
+	if err != nil {
+		return nil, 0, err
+	}
+	txs := make([]TxInfo, 0, len(rows))
+	for _, row := range rows {
+		info := row.txInfo()
+		info.SignerName = agents[info.SignerAddress].Name
+		txs = append(txs, info)
+	}
+	return txs, total, nil
+}
@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/calehh/hac-app/tx"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+func marshalTx(t *testing.T, btx *tx.HACTx) cmttypes.Tx {
+	t.Helper()
+	dat, err := tx.MarshalHACTx(btx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dat
+}
+
+func TestNewIndexedTx(t *testing.T) {
+	pub := ed25519.GenPrivKey().PubKey()
+	discussion := marshalTx(t, &tx.HACTx{Type: tx.HACTxTypeDiscussion, Nonce: 3, Validator: 7, Tx: &tx.DiscussionTx{Proposal: 1, Data: []byte("hi")}})
+	register := marshalTx(t, &tx.HACTx{Type: tx.HACTxTypeRegisterParticipant, Tx: &tx.RegisterParticipantTx{PubKey: pub.Bytes(), Name: "bob"}})
+	result := &abci.ExecTxResult{Code: 1, Log: "failed", Events: []abci.Event{{Type: "discussion", Attributes: []abci.EventAttribute{{Key: "proposal", Value: "1"}}}}}
+
+	for _, tc := range []struct {
+		name   string
+		raw    cmttypes.Tx
+		result *abci.ExecTxResult
+		typ    tx.HACTxType
+		signer uint64
+		nonce  uint64
+		addr   string
+		events int
+		body   any
+	}{
+		{"discussion", discussion, result, tx.HACTxTypeDiscussion, 7, 3, "", 1, &tx.DiscussionTx{}},
+		{"participant signs with its key", register, nil, tx.HACTxTypeRegisterParticipant, 0, 0, pub.Address().String(), 0, &tx.RegisterParticipantTx{}},
+		{"not a hac tx", cmttypes.Tx("garbage"), result, tx.HACTxTypeUnknown, 0, 0, "", 1, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			row, err := newIndexedTx(5, 2, tc.raw, tc.result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row.Type != uint8(tc.typ) || row.Signer != tc.signer || row.Nonce != tc.nonce || row.SignerAddress != tc.addr {
+				t.Fatalf("row %+v", row)
+			}
+			info := row.txInfo()
+			if info.Height != 5 || info.Index != 2 || info.TypeName != tc.typ.String() || len(info.Events) != tc.events {
+				t.Fatalf("info %+v", info)
+			}
+			if tc.result != nil && (info.Code != tc.result.Code || info.Log != tc.result.Log || info.Events[0].Attributes["proposal"] != "1") {
+				t.Fatalf("result not kept: %+v", info)
+			}
+			if tc.body == nil {
+				if info.Tx != nil || info.Error == "" {
+					t.Fatalf("undecodable tx decoded: %+v", info)
+				}
+				return
+			}
+			if info.Error != "" {
+				t.Fatal(info.Error)
+			}
+			switch tc.body.(type) {
+			case *tx.DiscussionTx:
+				if d, ok := info.Tx.(*tx.DiscussionTx); !ok || string(d.Data) != "hi" {
+					t.Fatalf("tx %#v", info.Tx)
+				}
+			case *tx.RegisterParticipantTx:
+				if r, ok := info.Tx.(*tx.RegisterParticipantTx); !ok || r.Name != "bob" {
+					t.Fatalf("tx %#v", info.Tx)
+				}
+			}
+		})
+	}
+}
+
+func TestExplorer(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	val := chain.vals.Validators[0]
+	acc, _, err := chain.accounts.GetAccountByAddress(val.Address)
+	if err != nil || acc == nil {
+		t.Fatalf("genesis account %v, %v", acc, err)
+	}
+	if err := c.db.Create(&ValidatorAgent{Id: acc.Index, Address: val.Address.String(), Name: "genesis"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for h := 1; h <= 3; h++ {
+		txs := []cmttypes.Tx{marshalTx(t, &tx.HACTx{Type: tx.HACTxTypeDiscussion, Nonce: uint64(h), Validator: acc.Index, Tx: &tx.DiscussionTx{Proposal: 1}})}
+		chain.addBlock(t, txs, []*abci.ExecTxResult{{Code: 1}})
+	}
+	chain.addBlocks(t, 2)
+	c.catchUp(context.Background())
+
+	blocks, total, err := c.getBlocks(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(blocks) != 2 || blocks[0].Height != 3 || blocks[1].Height != 2 {
+		t.Fatalf("blocks %+v of %d, want heights 3 and 2 of 5", blocks, total)
+	}
+	if b := blocks[0]; b.TxCount != 1 || b.ProposerName != "genesis" || b.ProposerId != acc.Index {
+		t.Fatalf("block %+v", b)
+	}
+	if blocks, _, err := c.getBlocks(2, 2); err != nil || len(blocks) != 1 || blocks[0].Height != 1 {
+		t.Fatalf("last page %+v, %v", blocks, err)
+	}
+
+	detail, err := c.getBlock(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.Txs) != 1 {
+		t.Fatalf("%d txs", len(detail.Txs))
+	}
+	if info := detail.Txs[0]; info.SignerAddress != val.Address.String() || info.SignerName != "genesis" || info.Nonce != 2 || info.Code != 1 {
+		t.Fatalf("tx %+v", info)
+	}
+	if detail, err := c.getBlock(context.Background(), 9); err != nil || detail != nil {
+		t.Fatalf("missing block %+v, %v", detail, err)
+	}
+
+	txs, total, err := c.getAccountTxs(val.Address.String(), 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 || len(txs) != 2 || txs[0].Nonce != 3 || txs[1].Nonce != 2 || txs[0].SignerName != "genesis" {
+		t.Fatalf("account txs %+v of %d", txs, total)
+	}
+}
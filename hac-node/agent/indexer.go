@@ -1,9 +1,9 @@
 package agent
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -11,6 +11,7 @@ import (
 	"path"
 	"time"
 
+	"github.com/calehh/hac-app/blob"
 	app_config "github.com/calehh/hac-app/config"
 	"github.com/calehh/hac-app/crypto"
 	"github.com/calehh/hac-app/state"
@@ -18,18 +19,31 @@ import (
 	hac_types "github.com/calehh/hac-app/types"
 	abci "github.com/cometbft/cometbft/abci/types"
 	cmtlog "github.com/cometbft/cometbft/libs/log"
-	comethttp "github.com/cometbft/cometbft/rpc/client/http"
+	rpcclient "github.com/cometbft/cometbft/rpc/client"
+	sm "github.com/cometbft/cometbft/state"
 	"github.com/cometbft/cometbft/store"
+	cmttypes "github.com/cometbft/cometbft/types"
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
+const (
+	indexerSubscriber = "hac-indexer"
+
+	// interval at which the indexer checks the stores for heights whose
+	// events were missed
+	IndexerCatchUpInterval = 5 * time.Second
+)
+
+// ChainIndexer indexes the governance history into its store. It runs in the
+// node process: new heights are pushed through the event bus and read from
+// the block store and state store, so no height is skipped.
 type ChainIndexer struct {
 	logger        cmtlog.Logger
-	Url           string
 	Height        int64
+	store         IndexerStore
 	db            *gorm.DB
-	cli           *comethttp.HTTP
+	cli           rpcclient.Client
+	stateStore    sm.Store
 	eventHandlers map[string]eventHandler
 	elizaClients  map[string]Client
 	BlockStore    *store.BlockStore
@@ -37,39 +51,35 @@ type ChainIndexer struct {
 	pv            *crypto.PV
 	localAddress  string
 	ChainId       string
-	chainUrl      string
+	sender        *TxSender
+	author        *DiscussionAuthor
+	settle        *SettlePolicyEngine
+	memory        *AgentMemory
+	analytics     *Analytics
+	stream        *StreamHub
+	broadcaster   *Broadcaster
+	webhooks      *WebhookDispatcher
+	blobs         *blob.Fetcher
+	community     *CommunityQueue
+	synced        bool
+
+	// an observer node has no validator key and no agent, it only indexes
+	observer bool
+
+	// app state read directly by the offline reindexer
+	accounts *state.StateDB
 }
 
-func NewChainIndexer(logger cmtlog.Logger, dbPath string, chainUrl string, bs *store.BlockStore, appConfig *app_config.Config) (*ChainIndexer, error) {
-	logger.Info("NewChainIndexer", "dbPath", dbPath, "url", chainUrl)
-	cli, err := comethttp.New(chainUrl, "/websocket")
-	if err != nil {
-		return nil, err
-	}
-	db, err := gorm.Open("sqlite3", dbPath)
+func NewChainIndexer(logger cmtlog.Logger, is IndexerStore, bs *store.BlockStore, ss sm.Store, appConfig *app_config.Config, nodeCli rpcclient.Client, memory *AgentMemory) (*ChainIndexer, error) {
+	logger.Info("NewChainIndexer", "driver", is.Driver())
+	db := is.DB()
+	h, err := loadIndexedHeight(db)
 	if err != nil {
 		return nil, err
 	}
-	if err := db.AutoMigrate(&Grant{}, &Discussion{}, &Proposal{}, &Height{}, &GrantVote{}, &ProposalVote{}, &ValidatorAgent{}).Error; err != nil {
-		return nil, err
-	}
-	h := Height{Id: 1}
-	if err = db.First(&h).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, err
-	}
-
-	if DiscussionRate > 0 {
-		DiscussionTrigger = rand.New(rand.NewSource(time.Now().UnixNano())).Intn(DiscussionRate)
-	} else {
-		DiscussionTrigger = 0
-	}
-	privKeyPath := path.Join(appConfig.RootDir, appConfig.PrivValidatorKey)
-	println("privkeyPath:", privKeyPath)
-	pv := crypto.LoadFilePV(privKeyPath)
-	localAddress := pv.Address()
 
 	ctx := context.Background()
-	gres, err := cli.Genesis(ctx)
+	gres, err := nodeCli.Genesis(ctx)
 	if err != nil {
 		logger.Error("get genesis fail", "err", err)
 		return nil, err
@@ -78,62 +88,157 @@ func NewChainIndexer(logger cmtlog.Logger, dbPath string, chainUrl string, bs *s
 
 	c := ChainIndexer{
 		logger:        logger.With("module", "indexer"),
-		Url:           chainUrl,
 		Height:        int64(h.Height + 1),
+		store:         is,
 		db:            db,
-		cli:           cli,
+		cli:           nodeCli,
+		stateStore:    ss,
 		eventHandlers: map[string]eventHandler{},
 		elizaClients:  make(map[string]Client),
 		BlockStore:    bs,
 		appConfig:     appConfig,
-		pv:            pv,
-		localAddress:  localAddress,
-		chainUrl:      chainUrl,
 		ChainId:       chainId,
+		observer:      appConfig.App.Observer,
+	}
+	c.settle = NewSettlePolicyEngine(appConfig.App)
+	c.blobs, err = blob.Open(logger, appConfig.App.Home, appConfig.App.Blobs)
+	if err != nil {
+		return nil, err
+	}
+	c.analytics = NewAnalytics(logger, db)
+	streamed, err := streamHeight(db)
+	if err != nil {
+		return nil, err
+	}
+	c.stream = NewStreamHub(logger, db, streamed)
+	if appConfig.App.Broadcast.Enabled {
+		var writer Client
+		if appConfig.App.Broadcast.AgentWrite && !c.observer {
+			writer = ElizaCli
+		}
+		c.broadcaster, err = NewBroadcaster(logger, db, appConfig.App.Broadcast, writer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if appConfig.App.Webhooks.Enabled {
+		c.webhooks = NewWebhookDispatcher(logger, db, appConfig.App.Webhooks)
+	}
+	if !c.observer {
+		privKeyPath := path.Join(appConfig.RootDir, appConfig.PrivValidatorKey)
+		println("privkeyPath:", privKeyPath)
+		c.pv = crypto.LoadFilePV(privKeyPath)
+		c.localAddress = c.pv.Address()
+		c.sender = NewTxSender(logger, nodeCli, chainId, c.pv)
+		c.author = NewDiscussionAuthor(logger, appConfig.App, c.sender)
+		if appConfig.App.Community.Enabled {
+			c.community = NewCommunityQueue(logger, db, ElizaCli, c.sender)
+		}
+	}
+	if memory != nil {
+		c.memory = memory
+		c.memory.db = db
+		c.memory.blobs = c.blobs
+		c.memory.indexed = h.Height
 	}
 
+	c.registerEventHandlers()
+	return &c, nil
+}
+
+func (c *ChainIndexer) registerEventHandlers() {
 	c.eventHandlers = map[string]eventHandler{
-		hac_types.EventGrantType:          c.handleEventGrant,
-		hac_types.EventDiscussionType:     c.handleEventDiscussion,
-		hac_types.EventSettleProposalType: c.handleEventSettleProposal,
-		hac_types.EventProposalType:       c.handleEventProposal,
+		hac_types.EventGrantType:           c.handleEventGrant,
+		hac_types.EventDiscussionType:      c.handleEventDiscussion,
+		hac_types.EventSettleProposalType:  c.handleEventSettleProposal,
+		hac_types.EventProposalType:        c.handleEventProposal,
+		hac_types.EventUnStakeType:         c.handleEventRetract,
+		hac_types.EventUpdateValidatorType: c.handleEventUpdateValidator,
+
+		hac_types.EventRegisterParticipantType: c.handleEventRegisterParticipant,
+		hac_types.EventReviseProposalType:      c.handleEventReviseProposal,
+		hac_types.EventExecuteProposalType:     c.handleEventExecuteProposal,
+		hac_types.EventProposalWebhookType:     c.handleEventProposalWebhook,
 	}
-	return &c, nil
 }
 
-type eventHandler func(ctx context.Context, event abci.Event, height int64)
+// loadIndexedHeight returns the height cursor of the indexer.
+func loadIndexedHeight(db *gorm.DB) (Height, error) {
+	h := Height{Id: 1}
+	if err := db.First(&h).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return h, err
+	}
+	return h, nil
+}
+
+// heightBatch carries the writes of one height. They are committed in one
+// transaction together with the height cursor, side effects on the agent run
+// only after the commit.
+type heightBatch struct {
+	db     *gorm.DB
+	height int64
+	time   time.Time
+	commit *cmttypes.Commit
+	vals   *cmttypes.ValidatorSet
+	after  []func()
+
+	// decision taken at the height, set by the event handlers
+	decision *voteDecision
+}
+
+type eventHandler func(ctx context.Context, b *heightBatch, event abci.Event) error
 
-func (c *ChainIndexer) handleEvent(ctx context.Context, event abci.Event, height int64) {
+func (c *ChainIndexer) handleEvent(ctx context.Context, b *heightBatch, event abci.Event) error {
 	if h, ok := c.eventHandlers[event.Type]; ok {
-		h(ctx, event, height)
+		return h(ctx, b, event)
 	}
+	return nil
 }
 
-func (c *ChainIndexer) handleEventGrant(ctx context.Context, event abci.Event, height int64) {
+func (c *ChainIndexer) handleEventGrant(ctx context.Context, b *heightBatch, event abci.Event) error {
 	ev := hac_types.ParseEventGrant(event)
 	if ev == nil {
-		c.logger.Error("decode event fail", "event", event)
-		return
+		return fmt.Errorf("decode grant event fail: %v", event)
 	}
 	grant := Grant{
 		Id:              ev.Validator,
 		Address:         ev.Address,
-		Height:          uint64(height),
+		Height:          uint64(b.height),
 		Stake:           ev.Amount,
 		Proposer:        ev.ProposerIndex,
 		ProposerAddress: ev.ProposerAddress,
 		Grant:           ev.Grant,
 	}
-	if err := c.db.Save(&grant).Error; err != nil {
-		c.logger.Error("save account fail", "err", err)
+	if err := b.db.Save(&grant).Error; err != nil {
+		return err
 	}
+	b.decision = &voteDecision{kind: VoteKindGrant, subject: grant.Id, grant: &grant}
 
-	val := ValidatorAgent{
-		Id:       ev.Validator,
-		Address:  ev.Address,
-		Stake:    ev.Amount,
-		AgentUrl: ev.AgentUrl,
-		Name:     ev.Name,
+	var val ValidatorAgent
+	if err := b.db.Where("id = ?", ev.Validator).First(&val).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	val.Id = ev.Validator
+	val.Address = ev.Address
+	val.Stake = ev.Amount
+	val.AgentUrl = ev.AgentUrl
+	val.Name = ev.Name
+	if ev.Grant {
+		val.Active = true
+		val.ExitHeight = 0
+		err := addMembershipEvent(b.db, MembershipEvent{
+			AccountIndex:    ev.Validator,
+			Address:         ev.Address,
+			Height:          uint64(b.height),
+			EffectiveHeight: uint64(b.height),
+			Kind:            MembershipGranted,
+			Stake:           ev.Amount,
+			Power:           val.Power,
+			PrevPower:       val.Power,
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	cli, err := NewElizaClient(ev.AgentUrl, c.logger)
@@ -147,233 +252,365 @@ func (c *ChainIndexer) handleEventGrant(ctx context.Context, event abci.Event, h
 		val.HeadPhoto = hp
 	}
 
-	if err := c.db.Save(&val).Error; err != nil {
-		c.logger.Error("save validator fail", "err", err)
-	}
+	return b.db.Save(&val).Error
 }
 
-func (c *ChainIndexer) handleEventDiscussion(ctx context.Context, event abci.Event, height int64) {
+func (c *ChainIndexer) handleEventDiscussion(ctx context.Context, b *heightBatch, event abci.Event) error {
 	ev := hac_types.DecodeEventDiscussion(event)
 	if ev == nil {
-		c.logger.Error("decode event fail", "event", event)
-		return
+		return fmt.Errorf("decode discussion event fail: %v", event)
 	}
-	speaker, err := c.getValidatorByAddress(ev.SpeakerAddress)
+	name, err := c.speakerName(b, ev.SpeakerAddress, ev.Human)
 	if err != nil {
-		c.logger.Error("get validator fail", "err", err)
-		return
-	}
-	if speaker.Id == 0 {
-		c.logger.Error("speaker not found", "address", ev.SpeakerAddress)
-		return
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.logger.Error("speaker not found", "address", ev.SpeakerAddress, "human", ev.Human)
+			return nil
+		}
+		return err
 	}
 	discusstion := Discussion{
-		Id:              0,
+		Id:              ev.Index,
 		Proposal:        ev.Proposal,
 		SpeakerIndex:    ev.Speaker,
 		SpeakerAddress:  ev.SpeakerAddress,
-		SpeakerName:     speaker.Name,
+		SpeakerName:     name,
 		Data:            string(ev.Data),
-		Height:          uint64(height),
-		CreateTimestamp: time.Now().Unix(),
+		Height:          uint64(b.height),
+		CreateTimestamp: b.time.Unix(),
+		Human:           ev.Human,
+		ReplyTo:         ev.ReplyTo,
+	}
+	if ev.Index == 0 {
+		// events of old blocks carry no discussion index, the state
+		// numbered the discussions in chain order
+		var cnt uint64
+		err := b.db.Model(&Discussion{}).Where("proposal = ? AND speaker_address = ? AND height = ? AND data = ?",
+			ev.Proposal, ev.SpeakerAddress, b.height, discusstion.Data).Count(&cnt).Error
+		if err != nil {
+			return err
+		}
+		if cnt > 0 {
+			return nil
+		}
+		var last Discussion
+		if err := b.db.Order("id desc").First(&last).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		discusstion.Id = last.Id + 1
 	}
-	if err := c.db.Save(&discusstion).Error; err != nil {
-		c.logger.Error("save discusstion fail", "err", err)
+	if err := b.db.Save(&discusstion).Error; err != nil {
+		return err
 	}
-	err = ElizaCli.AddDiscussion(ctx, ev.Proposal, ev.SpeakerAddress, string(ev.Data))
-	if err != nil {
-		c.logger.Error("add discussion fail", "err", err)
+	if err := b.db.Where("discussion = ?", discusstion.Id).Delete(&DiscussionReference{}).Error; err != nil {
+		return err
+	}
+	for _, ref := range ev.References {
+		r := DiscussionReference{Discussion: discusstion.Id, Type: ref.Type, Target: ref.Index}
+		if err := b.db.Create(&r).Error; err != nil {
+			return err
+		}
+		discusstion.References = append(discusstion.References, r)
 	}
+	b.after = append(b.after, func() {
+		c.memory.AddDiscussion(ctx, uint64(b.height), discusstion)
+	})
+	return nil
 }
 
-func (c *ChainIndexer) handleEventSettleProposal(ctx context.Context, event abci.Event, height int64) {
+// speakerName returns the name of the validator or participant at address.
+func (c *ChainIndexer) speakerName(b *heightBatch, address string, human bool) (string, error) {
+	if human {
+		var p Participant
+		if err := b.db.Where("address = ?", address).First(&p).Error; err != nil {
+			return "", err
+		}
+		return p.Name, nil
+	}
+	var speaker ValidatorAgent
+	if err := b.db.Where("address = ?", address).First(&speaker).Error; err != nil {
+		return "", err
+	}
+	return speaker.Name, nil
+}
+
+func (c *ChainIndexer) handleEventRegisterParticipant(ctx context.Context, b *heightBatch, event abci.Event) error {
+	ev := hac_types.DecodeEventRegisterParticipant(event)
+	if ev == nil {
+		return fmt.Errorf("decode register participant event fail: %v", event)
+	}
+	return b.db.Save(&Participant{
+		Id:              ev.Index,
+		Address:         ev.Address,
+		Name:            ev.Name,
+		Height:          uint64(b.height),
+		CreateTimestamp: b.time.Unix(),
+	}).Error
+}
+
+func (c *ChainIndexer) handleEventSettleProposal(ctx context.Context, b *heightBatch, event abci.Event) error {
 	ev := hac_types.DecodeEventSettleProposal(event)
 	if ev == nil {
-		c.logger.Error("decode event fail", "event", event)
-		return
+		return fmt.Errorf("decode settle event fail: %v", event)
 	}
 	var proposal Proposal
-	if err := c.db.First(&proposal, ev.Proposal).Error; err != nil {
-		c.logger.Error("get proposal fail", "err", err)
-		return
+	if err := b.db.First(&proposal, ev.Proposal).Error; err != nil {
+		return err
 	}
 	proposal.Status = uint64(ev.State)
-	proposal.SettleHeight = uint64(height)
-	if err := c.db.Save(&proposal).Error; err != nil {
-		c.logger.Error("save proposal fail", "err", err)
-	}
+	proposal.SettleHeight = uint64(b.height)
+	b.decision = &voteDecision{kind: VoteKindSettle, subject: ev.Proposal}
+	return b.db.Save(&proposal).Error
 }
 
-func (c *ChainIndexer) handleEventProposal(ctx context.Context, event abci.Event, height int64) {
+func (c *ChainIndexer) handleEventProposal(ctx context.Context, b *heightBatch, event abci.Event) error {
 	ev := hac_types.DecodeEventProposal(event)
 	if ev == nil {
-		c.logger.Error("decode event fail", "event", event)
-		return
+		return fmt.Errorf("decode proposal event fail: %v", event)
 	}
-	now := time.Now()
+	// validators that missed the tx in their mempool get the payload before
+	// the settle vote, which only reads the blob store
+	c.blobs.Prefetch(ev.ContentHash)
 	proposal := Proposal{
 		Id:              ev.ProposalIndex,
 		ProposerIndex:   ev.Proposer,
 		ProposerAddress: ev.ProposerAddress,
 		Data:            string(ev.Data),
-		NewHeight:       uint64(height),
+		NewHeight:       uint64(b.height),
 		Status:          ev.Status,
 		Title:           ev.Title,
 		Link:            ev.Link,
 		ImageUrl:        ev.ImageUrl,
-		CreateTimestamp: now.Unix(),
-		ExpireTimestamp: now.Add(time.Hour * 24 * 365).Unix(),
-	}
-	validator, err := c.getValidatorByAddress(ev.ProposerAddress)
-	if err != nil {
-		c.logger.Error("get validator fail", "err", err)
+		CreateTimestamp: b.time.Unix(),
+		ExpireTimestamp: b.time.Add(time.Hour * 24 * 365).Unix(),
+		Author:          ev.Author,
+		SubmissionHash:  ev.SubmissionHash,
+		ContentHash:     ev.ContentHash,
+		Category:        tx.NormalizeCategory(ev.Category),
+		Actions:         encodeActions(ev.Actions),
+	}
+	var validator ValidatorAgent
+	if err := b.db.Where("address = ?", ev.ProposerAddress).First(&validator).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
 	}
 	if validator.Name == "" {
 		validator.Name = "Enigma"
 	}
 	proposal.ProposerName = validator.Name
 
-	if err := c.db.Save(&proposal).Error; err != nil {
-		c.logger.Error("save proposal fail", "err", err)
+	// keep the outcome if the proposal was settled at a later height
+	var indexed Proposal
+	if err := b.db.Where("id = ?", ev.ProposalIndex).First(&indexed).Error; err == nil && indexed.SettleHeight > uint64(b.height) {
+		proposal.Status = indexed.Status
+		proposal.SettleHeight = indexed.SettleHeight
+		proposal.ExecutedHeight = indexed.ExecutedHeight
+		proposal.Execution = indexed.Execution
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
 	}
-	err = ElizaCli.AddProposal(ctx, ev.ProposalIndex, ev.ProposerAddress, string(ev.Data))
-	if err != nil {
-		c.logger.Error("add proposal fail", "err", err)
+
+	initial := initialRevision(proposal)
+	if err := saveRevision(b.db, &initial); err != nil {
+		return err
+	}
+	// keep the content of a later revision
+	if indexed.Revision > 0 {
+		proposal.Revision = indexed.Revision
+		proposal.Title = indexed.Title
+		proposal.Link = indexed.Link
+		proposal.ImageUrl = indexed.ImageUrl
+		proposal.Data = indexed.Data
+		proposal.ContentHash = indexed.ContentHash
+		proposal.Actions = indexed.Actions
+	}
+	if err := b.db.Save(&proposal).Error; err != nil {
+		return err
+	}
+	if ev.SubmissionHash != "" {
+		if err := c.proposeSubmission(b, ev.SubmissionHash, ev.ProposalIndex); err != nil {
+			return err
+		}
 	}
-	comment, err := ElizaCli.CommentPropoal(ctx, ev.ProposalIndex, ev.ProposerAddress)
-	if err != nil {
-		c.logger.Error("comment proposal fail", "err", err)
-	} else {
-		c.logger.Info("comment proposal", "comment", comment)
+	b.decision = &voteDecision{kind: VoteKindProcess, subject: ev.ProposalIndex}
+	// only comment on proposals that are still live, not while catching up
+	live := c.synced && !c.observer && ev.Status == uint64(hac_types.ProposalStatusProcessing)
+	b.after = append(b.after, func() {
+		c.memory.AddProposal(ctx, uint64(b.height), ev.ProposalIndex, tx.NormalizeCategory(ev.Category), ev.ProposerAddress, string(ev.Data), ev.ContentHash, encodeActions(ev.Actions))
+		if live {
+			c.discuss(ctx, ev.ProposalIndex, ev.ProposerAddress, b.height)
+		}
+	})
+	return nil
+}
+
+const (
+	// decisions taken by the validators at a height
+	VoteKindProcess = "process"
+	VoteKindSettle  = "settle"
+	VoteKindGrant   = "grant"
+
+	// how a validator took part in the commit of a height
+	VoteFlagCommit = "commit"
+	VoteFlagAbsent = "absent"
+	VoteFlagNil    = "nil"
+)
+
+// voteDecision is the decision taken at a height, recorded by the event
+// handlers so the votes of the commit can be attributed to it.
+type voteDecision struct {
+	kind    string
+	subject uint64
+	grant   *Grant
+}
+
+func voteFlag(flag cmttypes.BlockIDFlag) string {
+	switch flag {
+	case cmttypes.BlockIDFlagCommit:
+		return VoteFlagCommit
+	case cmttypes.BlockIDFlagNil:
+		return VoteFlagNil
+	default:
+		return VoteFlagAbsent
 	}
 }
 
-func (c *ChainIndexer) handleVote(ctx context.Context, height int64) error {
-	res, err := c.cli.Commit(ctx, &height)
-	if err != nil {
-		c.logger.Error("get Commit fail", "err", err)
-		if !c.cli.IsRunning() {
-			c.cli.Stop()
-			c.cli, err = comethttp.New(c.Url, "/websocket")
-			if err != nil {
-				c.logger.Error("reconnect fail", "err", err)
-				return err
-			}
-		}
+// voteCodeYes returns the vote code approving a decision of kind.
+func voteCodeYes(kind string) tx.VoteCode {
+	switch kind {
+	case VoteKindProcess:
+		return tx.VoteProcessProposal
+	case VoteKindSettle:
+		return tx.VoteAcceptProposal
+	default:
+		return tx.VoteGrantNewMember
 	}
-	voteHeight := res.Height
-	// new proposal
-	newProposel := Proposal{}
-	if err := c.db.Where("new_height = ?", voteHeight).First(&newProposel).Error; err != nil {
-		if err != gorm.ErrRecordNotFound {
-			return err
-		}
+}
+
+// voteCodeNo returns the vote code rejecting a decision of kind.
+func voteCodeNo(kind string) tx.VoteCode {
+	switch kind {
+	case VoteKindProcess:
+		return tx.VoteIgnoreProposal
+	case VoteKindSettle:
+		return tx.VoteRejectProposal
+	default:
+		return tx.VoteRejectNewMember
 	}
-	if newProposel.Id != 0 {
-		for _, v := range res.Commit.Signatures {
-			acc, err := c.queryAccount(ctx, 0, v.ValidatorAddress.String())
-			if err != nil {
-				return err
-			}
-			if acc == nil {
-				return fmt.Errorf("commit sig address not exist address:%s", v.ValidatorAddress.String())
-			}
-			if err := c.db.Where("height = ? And voter_index = ?", voteHeight, acc.Index).First(&ProposalVote{}).Error; err != nil {
-				if err != gorm.ErrRecordNotFound {
-					return err
-				}
-				vote := ProposalVote{
-					Proposal:     newProposel.Id,
-					VoterIndex:   acc.Index,
-					VoterAddress: v.ValidatorAddress.String(),
-					Height:       uint64(voteHeight),
-					Vote:         uint64(v.VoteCode),
-				}
-				if err := c.db.Create(&vote).Error; err != nil {
-					return err
-				}
-			}
-		}
+}
+
+// handleVote records the vote of every validator of the height's validator
+// set on the decision taken at the height, absent and nil votes included,
+// together with their voting power and the tally.
+func (c *ChainIndexer) handleVote(ctx context.Context, b *heightBatch) error {
+	d := b.decision
+	if d == nil {
 		return nil
 	}
-	// settle proposal
-	settleProposel := Proposal{}
-	if err := c.db.Where("settle_height = ?", voteHeight).First(&settleProposel).Error; err != nil {
-		if err != gorm.ErrRecordNotFound {
-			return err
-		}
+	commit := b.commit
+	vals := b.vals
+	if len(vals.Validators) != len(commit.Signatures) {
+		return fmt.Errorf("commit of height %d has %d signatures for %d validators", b.height, len(commit.Signatures), len(vals.Validators))
 	}
-	if settleProposel.Id != 0 {
-		for _, v := range res.Commit.Signatures {
-			acc, err := c.queryAccount(ctx, 0, v.ValidatorAddress.String())
-			if err != nil {
-				return err
-			}
-			if acc == nil {
-				return fmt.Errorf("commit sig address not exist address:%s", v.ValidatorAddress.String())
-			}
-			if err := c.db.Where("height = ? And voter_index = ?", voteHeight, acc.Index).First(&ProposalVote{}).Error; err != nil {
-				if err != gorm.ErrRecordNotFound {
-					return err
-				}
-				vote := ProposalVote{
-					Proposal:     settleProposel.Id,
-					VoterIndex:   acc.Index,
-					VoterAddress: v.ValidatorAddress.String(),
-					Height:       uint64(voteHeight),
-					Vote:         uint64(v.VoteCode),
-				}
-				if err := c.db.Create(&vote).Error; err != nil {
-					return err
-				}
-			}
-		}
-		return nil
+	// votes of an earlier indexing of the height are replaced
+	var err error
+	if d.kind == VoteKindGrant {
+		err = b.db.Where("height = ?", b.height).Delete(&GrantVote{}).Error
+	} else {
+		err = b.db.Where("height = ?", b.height).Delete(&ProposalVote{}).Error
+	}
+	if err != nil {
+		return err
 	}
-	// grant grant
-	grant := Grant{}
-	if err := c.db.Where("height = ?", voteHeight).First(&grant).Error; err != nil {
-		if err != gorm.ErrRecordNotFound {
+
+	tally := VoteTally{
+		Height:     uint64(b.height),
+		Kind:       d.kind,
+		Subject:    d.subject,
+		Validators: len(vals.Validators),
+	}
+	for i, val := range vals.Validators {
+		sig := commit.Signatures[i]
+		if sig.BlockIDFlag != cmttypes.BlockIDFlagAbsent && !bytes.Equal(sig.ValidatorAddress, val.Address) {
+			return fmt.Errorf("commit sig %d of height %d from %s, expected %s", i, b.height, sig.ValidatorAddress, val.Address)
+		}
+		acc, err := c.queryAccount(ctx, 0, val.Address.String())
+		if err != nil {
 			return err
 		}
-	}
-	if grant.Id != 0 {
-		for _, v := range res.Commit.Signatures {
-			acc, err := c.queryAccount(ctx, 0, v.ValidatorAddress.String())
-			if err != nil {
-				return err
-			}
-			if acc == nil {
-				return fmt.Errorf("commit sig address not exist address:%s", v.ValidatorAddress.String())
-			}
-			if err := c.db.Where("height = ? And voter_index = ?", voteHeight, acc.Index).First(&GrantVote{}).Error; err != nil {
-				if err != gorm.ErrRecordNotFound {
-					return err
-				}
-				vote := GrantVote{
-					ProposerIndex:   grant.Proposer,
-					ProposerAddress: grant.ProposerAddress,
-					AccountIndex:    grant.Id,
-					AccountAddr:     grant.Address,
-					VoterIndex:      acc.Index,
-					VoterAddress:    acc.Address(),
-					Height:          uint64(voteHeight),
-					Vote:            uint64(v.VoteCode),
-				}
-				if err := c.db.Create(&vote).Error; err != nil {
-					return err
-				}
+		if acc == nil {
+			return fmt.Errorf("commit sig address not exist address:%s", val.Address.String())
+		}
+		flag := voteFlag(sig.BlockIDFlag)
+		code := uint64(0)
+		tally.TotalPower += val.VotingPower
+		switch flag {
+		case VoteFlagCommit:
+			code = uint64(sig.VoteCode)
+			tally.Commits++
+			tally.CommitPower += val.VotingPower
+			switch sig.VoteCode {
+			case int64(voteCodeYes(d.kind)):
+				tally.YesPower += val.VotingPower
+			case int64(voteCodeNo(d.kind)):
+				tally.NoPower += val.VotingPower
 			}
+		case VoteFlagNil:
+			tally.Nils++
+			tally.NilPower += val.VotingPower
+		default:
+			tally.Absents++
+			tally.AbsentPower += val.VotingPower
+		}
+
+		if d.kind == VoteKindGrant {
+			err = b.db.Create(&GrantVote{
+				ProposerIndex:   d.grant.Proposer,
+				ProposerAddress: d.grant.ProposerAddress,
+				AccountIndex:    d.grant.Id,
+				AccountAddr:     d.grant.Address,
+				VoterIndex:      acc.Index,
+				VoterAddress:    acc.Address(),
+				Height:          uint64(b.height),
+				Vote:            code,
+				Flag:            flag,
+				Power:           val.VotingPower,
+			}).Error
+		} else {
+			err = b.db.Create(&ProposalVote{
+				Proposal:     d.subject,
+				Kind:         d.kind,
+				VoterIndex:   acc.Index,
+				VoterAddress: val.Address.String(),
+				Height:       uint64(b.height),
+				Vote:         code,
+				Flag:         flag,
+				Power:        val.VotingPower,
+			}).Error
+		}
+		if err != nil {
+			return err
 		}
-		return nil
 	}
-	return nil
+	return b.db.Save(&tally).Error
 }
 
 func (c *ChainIndexer) Start(ctx context.Context) {
-	var err error
-	ticker := time.NewTicker(time.Second)
-	time.Sleep(10 * time.Second)
+	if !c.observer {
+		if err := c.sender.Start(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if c.memory != nil {
+		go c.memory.Run(ctx)
+	}
+	if c.broadcaster != nil {
+		go c.broadcaster.Run(ctx)
+	}
+	if c.webhooks != nil {
+		go c.webhooks.Run(ctx)
+	}
+	if c.community != nil {
+		go c.community.Run(ctx)
+	}
 	res, err := c.cli.Validators(context.Background(), nil, nil, nil)
 	if err != nil {
 		log.Fatal(err)
@@ -398,6 +635,7 @@ func (c *ChainIndexer) Start(ctx context.Context) {
 			Stake:    acc.Stake,
 			AgentUrl: acc.AgentUrl,
 			Name:     acc.Name,
+			Active:   acc.Stake > 0,
 		}
 
 		cli, err := NewElizaClient(val.AgentUrl, c.logger)
@@ -423,74 +661,278 @@ func (c *ChainIndexer) Start(ctx context.Context) {
 		}
 	}()
 
+	blocks, err := c.cli.Subscribe(ctx, indexerSubscriber, cmttypes.EventQueryNewBlockEvents.String(), 64)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.repairGaps(ctx); err != nil {
+		c.logger.Error("repair indexer gaps fail", "err", err)
+	}
+	ticker := time.NewTicker(IndexerCatchUpInterval)
 	defer ticker.Stop()
+	c.catchUp(ctx)
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case _, ok := <-blocks:
+			if !ok {
+				c.logger.Error("event subscription closed, fall back to polling")
+				blocks = nil
+				continue
+			}
+			c.catchUp(ctx)
 		case <-ticker.C:
-			if c.cli == nil {
-				c.cli, err = comethttp.New(c.Url, "/websocket")
-				if err != nil {
-					c.logger.Error("connect fail", "err", err)
-					continue
-				}
+			c.catchUp(ctx)
+		}
+	}
+}
+
+// catchUp indexes every height up to the last height committed by the
+// application, then the votes left pending by earlier calls.
+func (c *ChainIndexer) catchUp(ctx context.Context) {
+	st, err := c.stateStore.Load()
+	if err != nil {
+		c.logger.Error("load state fail", "err", err)
+		return
+	}
+	latest := st.LastBlockHeight
+	for c.Height <= latest {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.indexHeight(ctx, c.Height); err != nil {
+			c.logger.Error("index height fail", "height", c.Height, "err", err)
+			return
+		}
+		if c.Height < latest {
+			c.logger.Info("indexer syncing", "height", c.Height, "latest", latest)
+		}
+		c.synced = c.Height == latest
+		if !c.observer {
+			if c.synced {
+				c.randomDiscuss()
 			}
-			b, err := c.cli.Status(context.TODO())
-			if err != nil {
-				c.logger.Error("get status fail", "err", err)
-				if !c.cli.IsRunning() {
-					c.cli.Stop()
-					c.cli, err = comethttp.New(c.Url, "/websocket")
-					if err != nil {
-						c.logger.Error("reconnect fail", "err", err)
-						continue
-					}
-				}
+			if c.Height%c.settle.Interval() == 0 {
+				c.settlePR()
 			}
-			for b.SyncInfo.LatestBlockHeight > c.Height {
-				time.Sleep(time.Millisecond * 100)
-				c.logger.Info("indexer syncing", "height", c.Height)
-				events, err := c.cli.BlockResults(ctx, &c.Height)
-				if err != nil {
-					c.logger.Error("get status fail", "err", err)
-					if !c.cli.IsRunning() {
-						c.cli.Stop()
-						c.cli, err = comethttp.New(c.Url, "/websocket")
-						if err != nil {
-							c.logger.Error("reconnect fail", "err", err)
-							continue
-						}
-					}
-				}
-				for _, res := range events.TxsResults {
-					for _, event := range res.Events {
-						c.handleEvent(ctx, event, c.Height)
-					}
-				}
-				err = c.handleVote(ctx, c.Height)
-				if err != nil {
-					c.logger.Error("handleVote fail", "height", c.Height, "err", err)
-					continue
-				}
-				if err := c.db.Save(Height{
-					Id:     1,
-					Height: uint64(c.Height),
-				}).Error; err != nil {
-					c.logger.Error("save height fail", "err", err)
-					continue
-				}
-				// random discuss if latest block height is current height + 1
-				if b.SyncInfo.LatestBlockHeight == c.Height+1 {
-					c.randomDiscuss()
-				}
-				if c.Height%5 == 0 {
-					c.settlePR()
+		}
+		c.Height++
+	}
+	if err := c.indexPendingVotes(ctx); err != nil {
+		c.logger.Error("index pending votes fail", "err", err)
+	}
+	if c.stream != nil {
+		streamed, err := streamHeight(c.db)
+		if err != nil {
+			c.logger.Error("load stream height fail", "err", err)
+			return
+		}
+		c.stream.Indexed(streamed)
+	}
+}
+
+// heightData is everything the indexer reads from the stores for a height.
+type heightData struct {
+	height int64
+	res    *abci.ResponseFinalizeBlock
+	meta   *cmttypes.BlockMeta
+	block  *cmttypes.Block
+	commit *cmttypes.Commit
+	vals   *cmttypes.ValidatorSet
+}
+
+func (c *ChainIndexer) loadHeight(height int64) (*heightData, error) {
+	res, err := c.stateStore.LoadFinalizeBlockResponse(height)
+	if err != nil {
+		return nil, err
+	}
+	meta := c.BlockStore.LoadBlockMeta(height)
+	if meta == nil {
+		return nil, fmt.Errorf("block not found height:%d", height)
+	}
+	block := c.BlockStore.LoadBlock(height)
+	if block == nil {
+		return nil, fmt.Errorf("block not found height:%d", height)
+	}
+	// nil for the latest height, its votes are indexed with the next one
+	commit := c.BlockStore.LoadBlockCommit(height)
+	vals, err := c.stateStore.LoadValidators(height)
+	if err != nil {
+		return nil, err
+	}
+	return &heightData{height: height, res: res, meta: meta, block: block, commit: commit, vals: vals}, nil
+}
+
+func (c *ChainIndexer) indexHeight(ctx context.Context, height int64) error {
+	d, err := c.loadHeight(height)
+	if err != nil {
+		return err
+	}
+	return c.applyHeight(ctx, d)
+}
+
+// applyHeight indexes the events and votes of a height in one transaction.
+// Heights below the cursor are re-indexed without moving the cursor or
+// notifying the agent, inserts are keyed by on-chain identifiers so indexing
+// a height twice is harmless.
+func (c *ChainIndexer) applyHeight(ctx context.Context, d *heightData) error {
+	height := d.height
+	repair := height+1 < c.Height
+	notify := !repair && c.memory != nil
+
+	tx := c.db.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	b := &heightBatch{db: tx, height: height, time: d.meta.Header.Time, commit: d.commit, vals: d.vals}
+	err := func() error {
+		for _, txRes := range d.res.TxResults {
+			for _, event := range txRes.Events {
+				if err := c.handleEvent(ctx, b, event); err != nil {
+					return err
 				}
-				c.Height++
 			}
 		}
+		// validator updates are emitted by FinalizeBlock itself
+		for _, event := range d.res.Events {
+			if err := c.handleEvent(ctx, b, event); err != nil {
+				return err
+			}
+		}
+		if b.commit != nil {
+			if err := c.handleVote(ctx, b); err != nil {
+				return err
+			}
+		}
+		if err := c.recordValidatorSet(ctx, b); err != nil {
+			return err
+		}
+		if err := c.indexTxs(ctx, b, d.block.Txs, d.res.TxResults); err != nil {
+			return err
+		}
+		if err := tx.Save(&IndexedBlock{
+			Height:       uint64(height),
+			Hash:         d.meta.BlockID.Hash.String(),
+			Txs:          d.meta.NumTxs,
+			Timestamp:    d.meta.Header.Time.Unix(),
+			VotesPending: b.decision != nil && b.commit == nil,
+		}).Error; err != nil {
+			return err
+		}
+		if repair {
+			return nil
+		}
+		return tx.Save(Height{
+			Id:     1,
+			Height: uint64(height),
+		}).Error
+	}()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if notify {
+		c.memory.BeginHeight(uint64(height))
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	if c.analytics != nil {
+		if repair {
+			c.analytics.Invalidate()
+		} else {
+			c.analytics.Indexed(uint64(height))
+		}
+	}
+	if c.broadcaster != nil && !repair {
+		c.broadcaster.Indexed(uint64(height))
+	}
+	if c.webhooks != nil && !repair {
+		c.webhooks.Indexed(uint64(height))
+	}
+	if !notify {
+		return nil
+	}
+	for _, f := range b.after {
+		f()
+	}
+	c.memory.Indexed(uint64(height))
+	return nil
+}
+
+// repairGaps re-indexes the heights below the cursor that have no
+// IndexedBlock record, e.g. heights indexed before blocks were recorded.
+func (c *ChainIndexer) repairGaps(ctx context.Context) error {
+	base := c.BlockStore.Base()
+	if base < 1 {
+		base = 1
+	}
+	cursor := c.Height - 1
+	if cursor < base {
+		return nil
+	}
+	var cnt int64
+	if err := c.db.Model(&IndexedBlock{}).Where("height >= ? AND height <= ?", base, cursor).Count(&cnt).Error; err != nil {
+		return err
+	}
+	if cnt == cursor-base+1 {
+		return nil
+	}
+	var heights []int64
+	if err := c.db.Model(&IndexedBlock{}).Where("height >= ? AND height <= ?", base, cursor).Order("height asc").Pluck("height", &heights).Error; err != nil {
+		return err
+	}
+	indexed := make(map[int64]bool, len(heights))
+	for _, h := range heights {
+		indexed[h] = true
+	}
+	c.logger.Info("repair indexer gaps", "from", base, "to", cursor, "missing", cursor-base+1-cnt)
+	var repaired int64
+	defer func() {
+		if c.stream != nil && repaired > 0 {
+			c.stream.Reindexed(uint64(repaired))
+		}
+	}()
+	for h := base; h <= cursor; h++ {
+		if indexed[h] {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := c.indexHeight(ctx, h); err != nil {
+			return fmt.Errorf("repair height %d: %w", h, err)
+		}
+		if repaired == 0 {
+			repaired = h
+		}
+	}
+	return nil
+}
+
+// indexPendingVotes re-indexes the heights whose votes wait for the
+// canonical commit once it is stored. The commit seen locally differs between
+// nodes, only the canonical one gives every indexer the same tally. The
+// height at the cursor is left to the next call so it is re-indexed as a
+// repair.
+func (c *ChainIndexer) indexPendingVotes(ctx context.Context) error {
+	var heights []int64
+	if err := c.db.Model(&IndexedBlock{}).Where("votes_pending = ? AND height < ?", true, c.Height-1).Order("height asc").Pluck("height", &heights).Error; err != nil {
+		return err
+	}
+	for _, h := range heights {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if h >= c.BlockStore.Height() {
+			return nil
+		}
+		if err := c.indexHeight(ctx, h); err != nil {
+			return fmt.Errorf("index votes of height %d: %w", h, err)
+		}
 	}
+	return nil
 }
 
 func (c *ChainIndexer) settlePR() {
@@ -500,60 +942,90 @@ func (c *ChainIndexer) settlePR() {
 		c.logger.Error("get proposals fail", "err", err)
 	}
 	for _, p := range proposals {
-		if p.ProposerAddress == c.localAddress {
-			_, cnt, err := c.getDiscussionByProposal(p.Id, 0, 1)
-			if cnt < 15 {
-				continue
-			}
-			cli, err := comethttp.New(c.chainUrl, "/websocket")
-			if err != nil {
-				c.logger.Error("new client fail", "err", err)
-				return
-			}
-			act, err := queryAccount(cli, 0, c.localAddress)
-			if err != nil {
-				return
-			}
-			btx := tx.HACTx{
-				Version:   tx.HACTxVersion1,
-				Nonce:     act.Nonce,
-				Validator: act.Index,
-			}
-			stx := &tx.SettleProposalTx{
-				Proposal:        p.Id,
-				ExpireTimestamp: uint(time.Now().Unix() + 60*3),
-			}
-			btx.Tx = stx
-			btx.Type = tx.HACTxTypeSettleProposal
-			dat, err := btx.SigData([]byte(c.ChainId))
-			if err != nil {
-				c.logger.Error("sign tx fail", "err", err)
-				return
-			}
-			sigs := [][]byte{}
-			sig, err := c.pv.Sign(dat)
-			if err != nil {
-				c.logger.Error("sign tx fail", "err", err)
-				return
-			}
-			sigs = append(sigs, sig)
-			btx.Sig = sigs
-			dat, _ = json.Marshal(btx)
-			_, err = cli.BroadcastTxSync(context.Background(), dat)
+		if p.ProposerAddress != c.localAddress {
+			continue
+		}
+		pending := c.sender.IsPending(tx.HACTxTypeSettleProposal, func(body any) bool {
+			return body.(*tx.SettleProposalTx).Proposal == p.Id
+		})
+		if pending {
+			continue
+		}
+		activity, err := c.getProposalActivity(p.Id)
+		if err != nil {
+			c.logger.Error("get proposal activity fail", "proposal", p.Id, "err", err)
+			continue
+		}
+		revisionHeight, err := c.revisionHeight(p)
+		if err != nil {
+			c.logger.Error("get proposal revisions fail", "proposal", p.Id, "err", err)
+			continue
+		}
+		category := c.proposalCategory(p)
+		settle, reason := c.settle.Evaluate(category, p.NewHeight, revisionHeight, uint64(c.Height), activity, false)
+		if !settle && c.synced && c.memory.Ready() {
+			early, err := ElizaCli.IfSettleProposal(context.Background(), p.Id, p.ProposerAddress)
 			if err != nil {
-				c.logger.Error("broadcast tx fail", "err", err)
-				return
+				c.logger.Error("ask agent to settle fail", "proposal", p.Id, "err", err)
+			} else if early {
+				settle, reason = c.settle.Evaluate(category, p.NewHeight, revisionHeight, uint64(c.Height), activity, true)
 			}
-			c.logger.Info("settle proposal", "proposal", p.Id)
 		}
+		if !settle {
+			c.logger.Debug("skip settle proposal", "proposal", p.Id, "reason", reason)
+			continue
+		}
+		stx := &tx.SettleProposalTx{
+			Proposal:        p.Id,
+			ExpireTimestamp: uint(time.Now().Unix() + c.settle.ExpireSeconds(category)),
+			Revision:        p.Revision,
+		}
+		err = c.sender.Submit(tx.HACTxTypeSettleProposal, stx)
+		if err != nil {
+			c.logger.Error("submit settle fail", "proposal", p.Id, "err", err)
+			return
+		}
+		c.logger.Info("settle proposal", "proposal", p.Id, "reason", reason)
 	}
 }
 
-func (c *ChainIndexer) randomDiscuss() {
-	if DiscussionRate == 0 {
-		return
+// proposalCategory returns the category of the proposal, the settle policy
+// engine falls back to the default policy for categories without one.
+func (c *ChainIndexer) proposalCategory(p Proposal) string {
+	return tx.NormalizeCategory(p.Category)
+}
+
+func (c *ChainIndexer) handleEventExecuteProposal(ctx context.Context, b *heightBatch, event abci.Event) error {
+	ev := hac_types.DecodeEventExecuteProposal(event)
+	if ev == nil {
+		return fmt.Errorf("decode execute proposal event fail: %v", event)
+	}
+	updates := map[string]interface{}{"execution": ev.Result}
+	if ev.Executed {
+		updates["executed_height"] = uint64(b.height)
 	}
-	if (c.Height+int64(DiscussionTrigger))%int64(DiscussionRate) != 0 {
+	return b.db.Model(&Proposal{}).Where("id = ?", ev.Proposal).Updates(updates).Error
+}
+
+// getManifest returns the manifest set by the last executed proposal
+// replacing it, the genesis manifest if there is none.
+func (c *ChainIndexer) getManifest() (string, error) {
+	var proposals []Proposal
+	err := c.db.Where("executed_height > 0 AND (category = ? OR actions LIKE ?)", tx.ProposalCategoryManifest, "%"+tx.ProposalActionUpdateManifest+"%").
+		Order("executed_height desc").Find(&proposals).Error
+	if err != nil {
+		return "", err
+	}
+	for _, p := range proposals {
+		if manifest, ok := proposalManifest(p); ok {
+			return manifest, nil
+		}
+	}
+	return MANIFESTO, nil
+}
+
+func (c *ChainIndexer) randomDiscuss() {
+	if !c.author.Triggered(c.Height) {
 		return
 	}
 	proposals, err := c.getProposalsByStatus(uint64(hac_types.ProposalStatusProcessing), 0, 10)
@@ -566,8 +1038,8 @@ func (c *ChainIndexer) randomDiscuss() {
 	}
 	suitePrs := make([]Proposal, 0)
 	for _, p := range proposals {
-		_, cnt, err := c.getDiscussionByProposal(p.Id, 0, 1)
-		if err == nil && cnt < 15 {
+		cnt, err := c.getDiscussionCntBySpeaker(p.Id, c.localAddress)
+		if err == nil && c.author.Allowed(p.Id, c.Height, cnt) == nil {
 			suitePrs = append(suitePrs, p)
 		}
 	}
@@ -575,12 +1047,35 @@ func (c *ChainIndexer) randomDiscuss() {
 		return
 	}
 	randProposal := suitePrs[rand.Intn(len(suitePrs))]
-	comment, err := ElizaCli.CommentPropoal(context.Background(), randProposal.Id, randProposal.ProposerAddress)
+	c.discuss(context.Background(), randProposal.Id, randProposal.ProposerAddress, c.Height)
+}
+
+// discuss asks the local agent for a comment on the proposal and publishes it
+// on chain as a DiscussionTx.
+func (c *ChainIndexer) discuss(ctx context.Context, proposal uint64, proposer string, height int64) {
+	cnt, err := c.getDiscussionCntBySpeaker(proposal, c.localAddress)
+	if err != nil {
+		c.logger.Error("get discussion count fail", "err", err)
+		return
+	}
+	if err := c.author.Allowed(proposal, height, cnt); err != nil {
+		c.logger.Debug("skip discussion", "proposal", proposal, "reason", err)
+		return
+	}
+	// the agent comments only once it knows the history
+	if !c.memory.Ready() {
+		c.logger.Debug("skip discussion", "proposal", proposal, "reason", ErrAgentReplaying)
+		return
+	}
+	comment, err := ElizaCli.CommentPropoal(ctx, proposal, proposer)
 	if err != nil {
 		c.logger.Error("comment proposal fail", "err", err)
 		return
 	}
-	c.logger.Info("comment proposal", "proposal", randProposal.Id, "comment", comment)
+	c.logger.Info("comment proposal", "proposal", proposal, "comment", comment)
+	if err := c.author.Discuss(ctx, proposal, height, cnt, comment); err != nil {
+		c.logger.Error("publish discussion fail", "proposal", proposal, "err", err)
+	}
 }
 
 func (c *ChainIndexer) fillAgentSelfIntro() {
@@ -630,17 +1125,19 @@ func (c *ChainIndexer) queryAccount(ctx context.Context, index uint64, address s
 		}
 		dat, _ = hex.DecodeString(s)
 	}
+	if c.accounts != nil {
+		var act *state.Account
+		if len(dat) == 20 {
+			act, _, err = c.accounts.GetAccountByAddress(dat)
+		} else {
+			act, _, err = c.accounts.GetAccountByIndex(index)
+		}
+		return act, err
+	}
 	res, err := c.cli.ABCIQuery(ctx, "/accounts/", dat)
 	if err != nil {
 		c.logger.Error("ABCIQuery fail", "err", err)
-		if !c.cli.IsRunning() {
-			c.cli.Stop()
-			c.cli, err = comethttp.New(c.Url, "/websocket")
-			if err != nil {
-				c.logger.Error("reconnect fail", "err", err)
-				return nil, err
-			}
-		}
+		return nil, err
 	}
 	if res.Response.Code != 0 {
 		fmt.Printf("%#v\n", res)
@@ -733,6 +1230,81 @@ func (c *ChainIndexer) getDiscussionByProposal(proposal uint64, page int, pageSi
 	return discussions, total, nil
 }
 
+// getDiscussionThreads returns the threads of a proposal, oldest first. The
+// discussions starting a thread are paged, each carries its replies.
+func (c *ChainIndexer) getDiscussionThreads(proposal uint64, page int, pageSize int) ([]Discussion, uint64, error) {
+	var roots []Discussion
+	err := c.db.Where("proposal = ? AND reply_to = 0", proposal).Order("id asc").Offset(page * pageSize).Limit(pageSize).Find(&roots).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var total uint64
+	err = c.db.Model(&Discussion{}).Where("proposal = ? AND reply_to = 0", proposal).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var replies []Discussion
+	if len(roots) > 0 {
+		err = c.db.Where("proposal = ? AND reply_to <> 0 AND id > ?", proposal, roots[0].Id).Order("id asc").Find(&replies).Error
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := loadDiscussionReferences(c.db, roots); err != nil {
+		return nil, 0, err
+	}
+	if err := loadDiscussionReferences(c.db, replies); err != nil {
+		return nil, 0, err
+	}
+	return discussionTree(roots, replies), total, nil
+}
+
+// discussionTree attaches the replies to the discussions they reply to,
+// replies are ordered by id so a parent always comes before its replies.
+func discussionTree(roots []Discussion, replies []Discussion) []Discussion {
+	children := make(map[uint64][]Discussion)
+	for _, d := range replies {
+		children[d.ReplyTo] = append(children[d.ReplyTo], d)
+	}
+	var attach func(d *Discussion)
+	attach = func(d *Discussion) {
+		d.Replies = children[d.Id]
+		for i := range d.Replies {
+			attach(&d.Replies[i])
+		}
+	}
+	for i := range roots {
+		attach(&roots[i])
+	}
+	return roots
+}
+
+// loadDiscussionReferences fills the references of discussions.
+func loadDiscussionReferences(db *gorm.DB, discussions []Discussion) error {
+	if len(discussions) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(discussions))
+	for i, d := range discussions {
+		ids[i] = d.Id
+	}
+	var refs []DiscussionReference
+	if err := db.Where("discussion IN (?)", ids).Order("id asc").Find(&refs).Error; err != nil {
+		return err
+	}
+	byDiscussion := make(map[uint64][]DiscussionReference)
+	for _, r := range refs {
+		byDiscussion[r.Discussion] = append(byDiscussion[r.Discussion], r)
+	}
+	for i := range discussions {
+		discussions[i].References = byDiscussion[discussions[i].Id]
+		if discussions[i].References == nil {
+			discussions[i].References = make([]DiscussionReference, 0)
+		}
+	}
+	return nil
+}
+
 func (c *ChainIndexer) getDiscussionCntByHeight(height uint64) (uint64, error) {
 	var total uint64
 	err := c.db.Model(&Discussion{}).Where("height = ?", height).Count(&total).Error
@@ -742,6 +1314,25 @@ func (c *ChainIndexer) getDiscussionCntByHeight(height uint64) (uint64, error) {
 	return total, nil
 }
 
+func (c *ChainIndexer) getDiscussionCntBySpeaker(proposal uint64, speaker string) (uint64, error) {
+	var total uint64
+	err := c.db.Model(&Discussion{}).Where("proposal = ? AND speaker_address = ?", proposal, speaker).Count(&total).Error
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func (c *ChainIndexer) getProposalActivity(proposal uint64) (ProposalActivity, error) {
+	var activity ProposalActivity
+	row := c.db.Model(&Discussion{}).Where("proposal = ?", proposal).
+		Select("count(*), count(distinct speaker_address), coalesce(max(height), 0), coalesce(sum(case when human then 0 else 1 end), 0)").Row()
+	if err := row.Scan(&activity.Discussions, &activity.Speakers, &activity.LastDiscussionHeight, &activity.MemberDiscussions); err != nil {
+		return activity, err
+	}
+	return activity, nil
+}
+
 func (c *ChainIndexer) getGrantById(grantId uint64) (Grant, error) {
 	var grant Grant
 	err := c.db.Where("id = ?", grantId).First(&grant).Error
@@ -783,6 +1374,20 @@ func (c *ChainIndexer) getGrants(page int, pageSize int) ([]Grant, uint64, error
 	return grants, total, nil
 }
 
+func (c *ChainIndexer) getParticipants(page int, pageSize int) ([]Participant, uint64, error) {
+	participants := make([]Participant, 0)
+	err := c.db.Order("id desc").Offset(page * pageSize).Limit(pageSize).Find(&participants).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var total uint64
+	err = c.db.Model(&Participant{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return participants, total, nil
+}
+
 func (c *ChainIndexer) getProposalByHeight(height uint64) (*Proposal, error) {
 	var proposal Proposal
 	err := c.db.Where("new_height = ?", height).First(&proposal).Error
@@ -828,36 +1433,45 @@ func (c *ChainIndexer) getGrantVotesByVoter(voter string, page int, pageSize int
 	return votes, nil
 }
 
-func queryAccount(cli *comethttp.HTTP, index uint64, address string) (*state.Account, error) {
-	ctx := context.Background()
-	var dat []byte
-	var err error
-	if len(address) > 0 {
-		dat, err = hex.DecodeString(address)
-		if err != nil {
-			fmt.Printf("invalid address:%v\n", address)
-			return nil, err
-		}
-	} else {
-		s := fmt.Sprintf("0%x", index)
-		if len(s)&1 == 1 {
-			s = s[1:]
-		}
-		dat, _ = hex.DecodeString(s)
+func (c *ChainIndexer) getVoteTally(height uint64) (*VoteTally, error) {
+	var tally VoteTally
+	err := c.db.Where("height = ?", height).First(&tally).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
 	}
-	res, err := cli.ABCIQuery(ctx, "/accounts/", dat)
 	if err != nil {
-		fmt.Printf("request err:%v\n", err)
 		return nil, err
 	}
-	if res.Response.Code != 0 {
-		fmt.Printf("%#v\n", res)
-		return nil, errors.New("response code 0")
+	return &tally, nil
+}
+
+func (c *ChainIndexer) getProposalVoteTallies(proposal uint64) ([]VoteTally, error) {
+	tallies := make([]VoteTally, 0)
+	err := c.db.Where("kind IN (?) AND subject = ?", []string{VoteKindProcess, VoteKindSettle}, proposal).Order("height asc").Find(&tallies).Error
+	if err != nil {
+		return nil, err
 	}
-	var act state.Account
-	err = act.UnmarshalJSON(res.Response.Value)
+	return tallies, nil
+}
+
+func (c *ChainIndexer) getGrantVoteTallies(grant uint64) ([]VoteTally, error) {
+	tallies := make([]VoteTally, 0)
+	err := c.db.Where("kind = ? AND subject = ?", VoteKindGrant, grant).Order("height asc").Find(&tallies).Error
 	if err != nil {
 		return nil, err
 	}
-	return &act, err
+	return tallies, nil
+}
+
+func (c *ChainIndexer) getVoteTallies(page int, pageSize int) ([]VoteTally, uint64, error) {
+	tallies := make([]VoteTally, 0)
+	err := c.db.Order("height desc").Offset(page * pageSize).Limit(pageSize).Find(&tallies).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var total uint64
+	if err := c.db.Model(&VoteTally{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	return tallies, total, nil
 }
@@ -0,0 +1,461 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	app_config "github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/state"
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	dbm "github.com/cometbft/cometbft-db"
+	abci "github.com/cometbft/cometbft/abci/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	sm "github.com/cometbft/cometbft/state"
+	"github.com/cometbft/cometbft/store"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+// testChain is a chain of empty blocks committed by a single validator, with
+// the stores and the app state the indexer reads.
+type testChain struct {
+	bs       *store.BlockStore
+	ss       sm.Store
+	st       sm.State
+	vals     *cmttypes.ValidatorSet
+	accounts *state.StateDB
+	dir      string
+	last     *cmttypes.Commit
+}
+
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+	pub, err := cmttypes.NewMockPV().GetPubKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals := cmttypes.NewValidatorSet([]*cmttypes.Validator{cmttypes.NewValidator(pub, 10)})
+	c := &testChain{
+		bs:   store.NewBlockStore(dbm.NewMemDB()),
+		ss:   sm.NewStore(dbm.NewMemDB(), sm.StoreOptions{}),
+		vals: vals,
+		dir:  filepath.Join(t.TempDir(), "hac"),
+		last: &cmttypes.Commit{},
+		st: sm.State{
+			ChainID:                     "test-chain",
+			InitialHeight:               1,
+			Validators:                  vals,
+			NextValidators:              vals.Copy(),
+			LastValidators:              vals.Copy(),
+			LastHeightValidatorsChanged: 1,
+			ConsensusParams:             *cmttypes.DefaultConsensusParams(),
+		},
+	}
+	if err := c.ss.Bootstrap(c.st); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := state.NewStateDB(c.dir, cmtlog.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := accounts.NewState()
+	if err := st.AddAccount(&state.Account{PubKey: pub.Bytes(), Stake: 10 * app_config.GWeiPerPower(0), Name: "genesis"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accounts.SetState(st); err != nil {
+		t.Fatal(err)
+	}
+	c.accounts = accounts
+	t.Cleanup(func() { c.accounts.Close() })
+	return c
+}
+
+// reopenAccounts opens a copy of the app state, as a process starting on
+// it. The open state keeps its database locked.
+func (c *testChain) reopenAccounts(t *testing.T) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "hac")
+	err := filepath.WalkDir(c.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(c.dir, path)
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0o755)
+		}
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, rel), dat, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := state.NewStateDB(dir, cmtlog.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.accounts = accounts
+}
+
+// addBlocks commits n empty blocks.
+func (c *testChain) addBlocks(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		c.addBlock(t, nil, nil)
+	}
+}
+
+// addBlock commits a block of txs with their results.
+func (c *testChain) addBlock(t *testing.T, txs []cmttypes.Tx, results []*abci.ExecTxResult) {
+	t.Helper()
+	val := c.vals.Validators[0]
+	height := c.bs.Height() + 1
+	block := cmttypes.MakeBlock(height, txs, c.last, nil)
+	block.ChainID = c.st.ChainID
+	block.Time = time.Unix(1700000000+height, 0)
+	block.ValidatorsHash = c.vals.Hash()
+	block.ProposerAddress = val.Address
+	parts, err := block.MakePartSet(cmttypes.BlockPartSizeBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockID := cmttypes.BlockID{Hash: block.Hash(), PartSetHeader: parts.Header()}
+	seen := &cmttypes.Commit{
+		Height:  height,
+		BlockID: blockID,
+		Signatures: []cmttypes.CommitSig{{
+			BlockIDFlag:      cmttypes.BlockIDFlagCommit,
+			ValidatorAddress: val.Address,
+			Timestamp:        block.Time,
+			// the indexer does not verify signatures
+			Signature: make([]byte, 64),
+		}},
+	}
+	c.bs.SaveBlock(block, parts, seen)
+	res := &abci.ResponseFinalizeBlock{AppHash: []byte{1}, TxResults: results}
+	if err := c.ss.SaveFinalizeBlockResponse(height, res); err != nil {
+		t.Fatal(err)
+	}
+	c.st.LastBlockHeight = height
+	c.st.LastBlockID = blockID
+	if err := c.ss.Save(c.st); err != nil {
+		t.Fatal(err)
+	}
+	c.last = seen
+}
+
+func openTestStore(t *testing.T) IndexerStore {
+	t.Helper()
+	is, err := OpenIndexerStore(IndexerDriverSqlite, filepath.Join(t.TempDir(), "indexer.db"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { is.Close() })
+	return is
+}
+
+// newTestIndexer returns an observer indexer of the chain, accounts are read
+// from the app state instead of the node.
+func newTestIndexer(t *testing.T, chain *testChain, is IndexerStore) *ChainIndexer {
+	t.Helper()
+	h, err := loadIndexedHeight(is.DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ChainIndexer{
+		logger:       cmtlog.NewNopLogger(),
+		Height:       int64(h.Height + 1),
+		store:        is,
+		db:           is.DB(),
+		stateStore:   chain.ss,
+		elizaClients: make(map[string]Client),
+		BlockStore:   chain.bs,
+		settle:       NewSettlePolicyEngine(&app_config.HACAppConfig{}),
+		observer:     true,
+		accounts:     chain.accounts,
+	}
+	c.registerEventHandlers()
+	return c
+}
+
+func indexedHeights(t *testing.T, c *ChainIndexer) []int64 {
+	t.Helper()
+	var heights []int64
+	if err := c.db.Model(&IndexedBlock{}).Order("height asc").Pluck("height", &heights).Error; err != nil {
+		t.Fatal(err)
+	}
+	return heights
+}
+
+func cursorOf(t *testing.T, c *ChainIndexer) uint64 {
+	t.Helper()
+	h, err := loadIndexedHeight(c.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h.Height
+}
+
+func TestIndexerCatchUp(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	ctx := context.Background()
+
+	// heights committed while no event was received are read from the
+	// stores
+	chain.addBlocks(t, 3)
+	c.catchUp(ctx)
+	if got := indexedHeights(t, c); len(got) != 3 || got[2] != 3 {
+		t.Fatalf("indexed heights %v, want 1..3", got)
+	}
+	if cursor := cursorOf(t, c); cursor != 3 || c.Height != 4 {
+		t.Fatalf("cursor %d, next height %d, want 3 and 4", cursor, c.Height)
+	}
+	var set ValidatorSet
+	if err := c.db.First(&set).Error; err != nil || set.Size != 1 {
+		t.Fatalf("validator set %+v, %v", set, err)
+	}
+
+	chain.addBlocks(t, 2)
+	c.catchUp(ctx)
+	if cursor := cursorOf(t, c); cursor != 5 {
+		t.Fatalf("cursor %d, want 5", cursor)
+	}
+	// nothing new to index
+	c.catchUp(ctx)
+	if got := indexedHeights(t, c); len(got) != 5 {
+		t.Fatalf("indexed heights %v, want 1..5", got)
+	}
+}
+
+func TestIndexerCatchUpStopsAtMissingHeight(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	chain.addBlocks(t, 2)
+	// the application committed a height the block store does not have
+	chain.st.LastBlockHeight = 3
+	if err := chain.ss.Save(chain.st); err != nil {
+		t.Fatal(err)
+	}
+	c.catchUp(context.Background())
+	if cursor := cursorOf(t, c); cursor != 2 || c.Height != 3 {
+		t.Fatalf("cursor %d, next height %d, want the missing height retried", cursor, c.Height)
+	}
+}
+
+func TestIndexerRepairGaps(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	ctx := context.Background()
+	chain.addBlocks(t, 4)
+	c.catchUp(ctx)
+
+	if err := c.db.Where("height IN (?)", []int64{2, 3}).Delete(&IndexedBlock{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.repairGaps(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexedHeights(t, c); len(got) != 4 {
+		t.Fatalf("indexed heights %v, want 1..4", got)
+	}
+	// repairs do not move the cursor
+	if cursor := cursorOf(t, c); cursor != 4 || c.Height != 5 {
+		t.Fatalf("cursor %d, next height %d, want 4 and 5", cursor, c.Height)
+	}
+}
+
+// oldDiscussionEvent is a discussion event as emitted before events carried
+// the chain index.
+func oldDiscussionEvent(ev *hac_types.EventDiscussion) abci.Event {
+	event := hac_types.EncodeEventDiscussion(ev)
+	attrs := event.Attributes[:0]
+	for _, attr := range event.Attributes {
+		if attr.Key != "index" {
+			attrs = append(attrs, attr)
+		}
+	}
+	event.Attributes = attrs
+	return event
+}
+
+func TestHandleEventDiscussionChainOrder(t *testing.T) {
+	c := newTestIndexer(t, newTestChain(t), openTestStore(t))
+	if err := c.db.Create(&ValidatorAgent{Id: 1, Address: "A1", Name: "alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	index := func(height int64, events ...abci.Event) {
+		t.Helper()
+		b := &heightBatch{db: c.db, height: height, time: time.Unix(1700000000, 0)}
+		for _, event := range events {
+			if err := c.handleEvent(ctx, b, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	index(1, oldDiscussionEvent(&hac_types.EventDiscussion{Speaker: 1, SpeakerAddress: "A1", Proposal: 1, Data: []byte("a")}),
+		oldDiscussionEvent(&hac_types.EventDiscussion{Speaker: 1, SpeakerAddress: "A1", Proposal: 1, Data: []byte("b")}))
+	// indexing an old height again adds nothing
+	index(1, oldDiscussionEvent(&hac_types.EventDiscussion{Speaker: 1, SpeakerAddress: "A1", Proposal: 1, Data: []byte("a")}))
+	index(2, hac_types.EncodeEventDiscussion(&hac_types.EventDiscussion{Index: 3, Speaker: 1, SpeakerAddress: "A1", Proposal: 1, Data: []byte("c"), ReplyTo: 1}))
+	index(2, hac_types.EncodeEventDiscussion(&hac_types.EventDiscussion{Index: 3, Speaker: 1, SpeakerAddress: "A1", Proposal: 1, Data: []byte("c"), ReplyTo: 1}))
+
+	var discussions []Discussion
+	if err := c.db.Order("id asc").Find(&discussions).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a", "b", "c"}
+	if len(discussions) != len(want) {
+		t.Fatalf("%d discussions, want %d", len(discussions), len(want))
+	}
+	for i, d := range discussions {
+		if d.Id != uint64(i+1) || d.Data != want[i] {
+			t.Fatalf("discussion %d is %q, want %q", d.Id, d.Data, want[i])
+		}
+	}
+}
+
+func TestObserverIndexerSynced(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	if err := c.db.Create(&Proposal{Id: 1, Status: uint64(hac_types.ProposalStatusProcessing)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// an observer has no sender and no author, the automated comments and
+	// settles of a synced validator are skipped
+	chain.addBlocks(t, 1)
+	c.catchUp(ctx)
+	if !c.synced {
+		t.Fatal("indexer not synced")
+	}
+	chain.addBlocks(t, int(c.settle.Interval()))
+	c.catchUp(ctx)
+	if cursor := cursorOf(t, c); cursor != uint64(c.settle.Interval())+1 {
+		t.Fatalf("cursor %d, want %d", cursor, c.settle.Interval()+1)
+	}
+}
+
+// addValidators adds accounts for new validators of the given powers and
+// returns the validator set with the genesis validator.
+func (c *testChain) addValidators(t *testing.T, powers ...int64) *cmttypes.ValidatorSet {
+	t.Helper()
+	st := c.accounts.NewState()
+	vals := []*cmttypes.Validator{c.vals.Validators[0].Copy()}
+	for i, power := range powers {
+		pub, err := cmttypes.NewMockPV().GetPubKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.AddAccount(&state.Account{PubKey: pub.Bytes(), Stake: uint64(power) * app_config.GWeiPerPower(0), Name: fmt.Sprintf("val%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+		vals = append(vals, cmttypes.NewValidator(pub, power))
+	}
+	if _, err := st.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.accounts.SetState(st); err != nil {
+		t.Fatal(err)
+	}
+	return cmttypes.NewValidatorSet(vals)
+}
+
+func TestHandleVoteRecordsEveryValidator(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	vals := chain.addValidators(t, 20, 30)
+
+	// ordered by power: 30 commits, 20 votes nil, the genesis 10 is absent
+	commit := &cmttypes.Commit{Height: 5}
+	for i, val := range vals.Validators {
+		sig := cmttypes.CommitSig{ValidatorAddress: val.Address}
+		switch i {
+		case 0:
+			sig.BlockIDFlag = cmttypes.BlockIDFlagCommit
+			sig.VoteCode = int64(tx.VoteProcessProposal)
+		case 1:
+			sig.BlockIDFlag = cmttypes.BlockIDFlagNil
+		default:
+			sig = cmttypes.NewCommitSigAbsent()
+		}
+		commit.Signatures = append(commit.Signatures, sig)
+	}
+	ctx := context.Background()
+	// indexing the height again replaces its votes
+	for i := 0; i < 2; i++ {
+		b := &heightBatch{db: c.db, height: 5, commit: commit, vals: vals,
+			decision: &voteDecision{kind: VoteKindProcess, subject: 7}}
+		if err := c.handleVote(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var votes []ProposalVote
+	if err := c.db.Order("power desc").Find(&votes).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		flag  string
+		vote  uint64
+		power int64
+	}{
+		{VoteFlagCommit, uint64(tx.VoteProcessProposal), 30},
+		{VoteFlagNil, 0, 20},
+		{VoteFlagAbsent, 0, 10},
+	}
+	if len(votes) != len(want) {
+		t.Fatalf("%d votes, want %d", len(votes), len(want))
+	}
+	for i, v := range votes {
+		if v.Flag != want[i].flag || v.Vote != want[i].vote || v.Power != want[i].power || v.Proposal != 7 || v.Kind != VoteKindProcess {
+			t.Fatalf("vote %d is %+v, want %+v", i, v, want[i])
+		}
+		if v.VoterAddress != vals.Validators[i].Address.String() {
+			t.Fatalf("vote %d by %s, want %s", i, v.VoterAddress, vals.Validators[i].Address)
+		}
+	}
+
+	var tally VoteTally
+	if err := c.db.First(&tally, "height = ?", 5).Error; err != nil {
+		t.Fatal(err)
+	}
+	wantTally := VoteTally{Height: 5, Kind: VoteKindProcess, Subject: 7, Validators: 3, Commits: 1, Absents: 1, Nils: 1,
+		TotalPower: 60, CommitPower: 30, AbsentPower: 10, NilPower: 20, YesPower: 30}
+	if tally != wantTally {
+		t.Fatalf("tally %+v, want %+v", tally, wantTally)
+	}
+}
+
+func TestHandleVoteRejectsForeignCommit(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	vals := chain.addValidators(t, 20)
+	other := chain.addValidators(t, 20)
+
+	commit := &cmttypes.Commit{Height: 5}
+	for _, val := range other.Validators {
+		commit.Signatures = append(commit.Signatures, cmttypes.CommitSig{BlockIDFlag: cmttypes.BlockIDFlagCommit, ValidatorAddress: val.Address})
+	}
+	b := &heightBatch{db: c.db, height: 5, commit: commit, vals: vals, decision: &voteDecision{kind: VoteKindSettle, subject: 1}}
+	if err := c.handleVote(context.Background(), b); err == nil {
+		t.Fatal("votes of another validator set recorded")
+	}
+	commit.Signatures = commit.Signatures[:1]
+	if err := c.handleVote(context.Background(), b); err == nil {
+		t.Fatal("commit missing a signature recorded")
+	}
+}
@@ -0,0 +1,229 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	hac_types "github.com/calehh/hac-app/types"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// entries of the membership timeline
+	MembershipGranted = "granted"
+	MembershipRetract = "retract"
+	MembershipJoin    = "join"
+	MembershipPower   = "power"
+	MembershipExit    = "exit"
+	MembershipGenesis = "genesis"
+
+	// validator updates returned by FinalizeBlock take effect two heights
+	// later
+	validatorUpdateDelay = 2
+)
+
+// addMembershipEvent stores an entry of the timeline, replacing the entry of
+// an earlier indexing of the same height.
+func addMembershipEvent(db *gorm.DB, ev MembershipEvent) error {
+	err := db.Where("height = ? AND address = ? AND kind = ?", ev.Height, ev.Address, ev.Kind).Delete(&MembershipEvent{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Create(&ev).Error
+}
+
+func (c *ChainIndexer) handleEventRetract(ctx context.Context, b *heightBatch, event abci.Event) error {
+	ev := hac_types.ParseEventUnStake(event)
+	if ev == nil {
+		return fmt.Errorf("decode retract event fail: %v", event)
+	}
+	var val ValidatorAgent
+	if err := b.db.Where("id = ?", ev.Validator).First(&val).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	val.Id = ev.Validator
+	val.Address = ev.Address
+	val.Stake = 0
+	val.Active = false
+	val.ExitHeight = uint64(b.height)
+	if err := b.db.Save(&val).Error; err != nil {
+		return err
+	}
+	return addMembershipEvent(b.db, MembershipEvent{
+		AccountIndex:    ev.Validator,
+		Address:         ev.Address,
+		Height:          uint64(b.height),
+		EffectiveHeight: uint64(b.height),
+		Kind:            MembershipRetract,
+		Stake:           ev.Amount,
+		Power:           val.Power,
+		PrevPower:       val.Power,
+	})
+}
+
+func (c *ChainIndexer) handleEventUpdateValidator(ctx context.Context, b *heightBatch, event abci.Event) error {
+	ev := hac_types.ParseEventUpdateValiators(event)
+	if ev == nil {
+		return fmt.Errorf("decode update validator event fail: %v", event)
+	}
+	for _, update := range ev.Updates {
+		address := ed25519.PubKey(update.PubKey.GetEd25519()).Address().String()
+		var val ValidatorAgent
+		if err := b.db.Where("address = ?", address).First(&val).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			acc, err := c.queryAccount(ctx, 0, address)
+			if err != nil {
+				return err
+			}
+			if acc == nil {
+				return fmt.Errorf("updated validator not exist address:%s", address)
+			}
+			val = ValidatorAgent{Id: acc.Index, Address: address, Stake: acc.Stake, AgentUrl: acc.AgentUrl, Name: acc.Name}
+		}
+		effective := uint64(b.height) + validatorUpdateDelay
+		kind := MembershipPower
+		switch {
+		case update.Power == 0:
+			kind = MembershipExit
+			val.ExitHeight = effective
+		case val.Power == 0:
+			kind = MembershipJoin
+			val.JoinHeight = effective
+			val.ExitHeight = 0
+		}
+		membership := MembershipEvent{
+			AccountIndex:    val.Id,
+			Address:         address,
+			Height:          uint64(b.height),
+			EffectiveHeight: effective,
+			Kind:            kind,
+			Stake:           val.Stake,
+			Power:           update.Power,
+			PrevPower:       val.Power,
+		}
+		val.Power = update.Power
+		if err := b.db.Save(&val).Error; err != nil {
+			return err
+		}
+		if err := addMembershipEvent(b.db, membership); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordValidatorSet stores a snapshot of the validator set of the height if
+// it differs from the previous snapshot. Validators found in the first
+// snapshot joined at genesis, or before the history was recorded if the
+// index is older than the history.
+func (c *ChainIndexer) recordValidatorSet(ctx context.Context, b *heightBatch) error {
+	hash := fmt.Sprintf("%X", b.vals.Hash())
+	var prev ValidatorSet
+	err := b.db.Where("height < ?", b.height).Order("height desc").First(&prev).Error
+	genesis := errors.Is(err, gorm.ErrRecordNotFound)
+	if err != nil && !genesis {
+		return err
+	}
+	if !genesis && prev.Hash == hash {
+		return nil
+	}
+	firstKind := MembershipGenesis
+	if b.height > 1 {
+		firstKind = MembershipJoin
+	}
+
+	if err := b.db.Where("height = ?", b.height).Delete(&ValidatorSetMember{}).Error; err != nil {
+		return err
+	}
+	for _, v := range b.vals.Validators {
+		member := ValidatorSetMember{
+			Height:  uint64(b.height),
+			Address: v.Address.String(),
+			Power:   v.VotingPower,
+		}
+		var val ValidatorAgent
+		err := b.db.Where("address = ?", member.Address).First(&val).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err != nil {
+			acc, err := c.queryAccount(ctx, 0, member.Address)
+			if err != nil {
+				return err
+			}
+			if acc != nil {
+				member.AccountIndex = acc.Index
+			}
+		} else {
+			member.AccountIndex = val.Id
+		}
+		if err := b.db.Create(&member).Error; err != nil {
+			return err
+		}
+		if genesis && val.Id != 0 && val.Power == 0 {
+			val.Power = v.VotingPower
+			val.JoinHeight = uint64(b.height)
+			if err := b.db.Save(&val).Error; err != nil {
+				return err
+			}
+			err := addMembershipEvent(b.db, MembershipEvent{
+				AccountIndex:    val.Id,
+				Address:         val.Address,
+				Height:          uint64(b.height),
+				EffectiveHeight: uint64(b.height),
+				Kind:            firstKind,
+				Stake:           val.Stake,
+				Power:           v.VotingPower,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return b.db.Save(&ValidatorSet{
+		Height:     uint64(b.height),
+		Hash:       hash,
+		Size:       b.vals.Size(),
+		TotalPower: b.vals.TotalVotingPower(),
+	}).Error
+}
+
+// getValidatorSetAt returns the snapshot in effect at height, the latest
+// one if height is 0.
+func (c *ChainIndexer) getValidatorSetAt(height uint64) (*ValidatorSet, []ValidatorSetMember, error) {
+	var set ValidatorSet
+	query := c.db.Order("height desc")
+	if height > 0 {
+		query = query.Where("height <= ?", height)
+	}
+	if err := query.First(&set).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	members := make([]ValidatorSetMember, 0)
+	err := c.db.Where("height = ?", set.Height).Order("power desc, address asc").Find(&members).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return &set, members, nil
+}
+
+func (c *ChainIndexer) getMembershipEvents(address string, page int, pageSize int) ([]MembershipEvent, uint64, error) {
+	events := make([]MembershipEvent, 0)
+	err := c.db.Where("address = ?", address).Order("height desc, id desc").Offset(page * pageSize).Limit(pageSize).Find(&events).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	var total uint64
+	if err := c.db.Model(&MembershipEvent{}).Where("address = ?", address).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	hac_types "github.com/calehh/hac-app/types"
+	abci "github.com/cometbft/cometbft/abci/types"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+func TestMembershipTimeline(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	genesis := chain.vals
+	vals := chain.addValidators(t, 20)
+	var joined *cmttypes.Validator
+	for _, v := range vals.Validators {
+		if !genesis.HasAddress(v.Address) {
+			joined = v
+		}
+	}
+	address := joined.Address.String()
+	acc, err := c.queryAccount(context.Background(), 0, address)
+	if err != nil || acc == nil {
+		t.Fatalf("account %v, %v", acc, err)
+	}
+	if err := c.db.Create(&ValidatorAgent{Id: acc.Index, Address: address, Stake: acc.Stake, Active: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	index := func(height int64, vals *cmttypes.ValidatorSet, events ...abci.Event) {
+		t.Helper()
+		b := &heightBatch{db: c.db, height: height, vals: vals}
+		for _, event := range events {
+			if err := c.handleEvent(ctx, b, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.recordValidatorSet(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update := func(power int64) abci.Event {
+		return hac_types.EncodeEventUpdateValiators(&hac_types.EventUpdateValiators{
+			Updates: []abci.ValidatorUpdate{abci.Ed25519ValidatorUpdate(joined.PubKey.Bytes(), power)},
+		})
+	}
+
+	index(1, genesis)
+	index(3, genesis, update(20))
+	// the update takes effect two heights later
+	index(5, vals)
+	index(6, vals)
+	index(8, vals, update(25))
+	index(9, vals, hac_types.EncodeEventUnStake(&hac_types.EventUnStake{Validator: acc.Index, Address: address, Amount: acc.Stake}))
+	index(9, vals, update(0))
+
+	events, total, err := c.getMembershipEvents(address, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MembershipEvent{
+		{Height: 9, EffectiveHeight: 11, Kind: MembershipExit, Power: 0, PrevPower: 25},
+		{Height: 9, EffectiveHeight: 9, Kind: MembershipRetract, Power: 25, PrevPower: 25},
+		{Height: 8, EffectiveHeight: 10, Kind: MembershipPower, Power: 25, PrevPower: 20},
+		{Height: 3, EffectiveHeight: 5, Kind: MembershipJoin, Power: 20, PrevPower: 0},
+	}
+	if total != uint64(len(want)) || len(events) != len(want) {
+		t.Fatalf("%d of %d events, want %d", len(events), total, len(want))
+	}
+	for i, ev := range events {
+		w := want[i]
+		if ev.Height != w.Height || ev.EffectiveHeight != w.EffectiveHeight || ev.Kind != w.Kind || ev.Power != w.Power || ev.PrevPower != w.PrevPower {
+			t.Fatalf("event %d is %+v, want %+v", i, ev, w)
+		}
+	}
+
+	var val ValidatorAgent
+	if err := c.db.First(&val, "address = ?", address).Error; err != nil {
+		t.Fatal(err)
+	}
+	if val.Active || val.Stake != 0 || val.Power != 0 || val.JoinHeight != 5 || val.ExitHeight != 11 {
+		t.Fatalf("validator %+v after the exit", val)
+	}
+
+	// snapshots are only taken when the set changes
+	for _, tc := range []struct {
+		at     uint64
+		height uint64
+		size   int
+	}{
+		{at: 1, height: 1, size: 1},
+		{at: 4, height: 1, size: 1},
+		{at: 6, height: 5, size: 2},
+		{at: 0, height: 5, size: 2},
+	} {
+		set, members, err := c.getValidatorSetAt(tc.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set == nil || set.Height != tc.height || set.Size != tc.size || len(members) != tc.size {
+			t.Fatalf("validator set at %d is %+v with %d members, want height %d of %d", tc.at, set, len(members), tc.height, tc.size)
+		}
+	}
+	if set, _, err := c.getValidatorSetAt(0); err != nil || set.TotalPower != 30 {
+		t.Fatalf("latest set %+v, %v", set, err)
+	}
+}
@@ -0,0 +1,407 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/calehh/hac-app/blob"
+	"github.com/calehh/hac-app/tx"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// interval between two agent status checks
+	MemoryStatusInterval = 30 * time.Second
+	// delay before a failed replay is retried, doubled on every failure
+	MemoryRetryDelay    = time.Second
+	MemoryMaxRetryDelay = time.Minute
+	// longest time a judgement off the consensus path waits for the replay
+	MemoryVoteTimeout = 3 * time.Second
+)
+
+var ErrAgentReplaying = errors.New("agent memory is being replayed")
+
+// AgentMemory keeps the memory of the local agent in step with the chain.
+// Proposals and discussions are delivered live while the agent is caught up.
+// When the agent restarts with an empty memory or is replaced, the history is
+// replayed from the indexer in height order, one request at a time. Until the
+// replay has finished the consensus votes fall back to a fixed answer and the
+// other judgements of the agent wait.
+type AgentMemory struct {
+	logger cmtlog.Logger
+	cli    Client
+	db     *gorm.DB
+	blobs  *blob.Fetcher
+
+	mtx        sync.Mutex
+	cursor     *AgentCursor
+	indexed    uint64
+	liveHeight uint64
+	ready      bool
+	readyCh    chan struct{}
+	notify     chan struct{}
+}
+
+func NewAgentMemory(logger cmtlog.Logger, cli Client) *AgentMemory {
+	return &AgentMemory{
+		logger:  logger.With("module", "memory"),
+		cli:     cli,
+		readyCh: make(chan struct{}),
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// Run checks the agent status and replays missing history until ctx is done.
+func (m *AgentMemory) Run(ctx context.Context) {
+	ticker := time.NewTicker(MemoryStatusInterval)
+	defer ticker.Stop()
+	delay := MemoryRetryDelay
+	for {
+		if err := m.checkStatus(ctx); err != nil {
+			m.logger.Error("check agent status fail", "err", err)
+		} else if err := m.replay(ctx); err != nil {
+			m.logger.Error("replay agent memory fail", "err", err, "retry", delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > MemoryMaxRetryDelay {
+				delay = MemoryMaxRetryDelay
+			}
+			continue
+		} else {
+			delay = MemoryRetryDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.notify:
+		}
+	}
+}
+
+// Ready reports whether the agent has received the history up to the
+// indexed height.
+func (m *AgentMemory) Ready() bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.ready
+}
+
+// WaitReady blocks until the agent is caught up or ctx is done.
+func (m *AgentMemory) WaitReady(ctx context.Context) error {
+	m.mtx.Lock()
+	ch := m.readyCh
+	m.mtx.Unlock()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ErrAgentReplaying
+	}
+}
+
+// BeginHeight is called by the indexer before the events of height are
+// handled. Events are delivered live only if the agent is caught up with the
+// previous height.
+func (m *AgentMemory) BeginHeight(height uint64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.liveHeight = 0
+	if m.cursor != nil && m.cursor.Height+1 == height && m.indexed+1 == height {
+		m.liveHeight = height
+	}
+}
+
+// Indexed is called by the indexer once height is stored.
+func (m *AgentMemory) Indexed(height uint64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.indexed = height
+	if m.liveHeight == height {
+		m.liveHeight = 0
+		m.cursor.Height = height
+		m.saveCursor()
+	}
+	m.updateReady()
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+// AddProposal delivers a proposal indexed at height if the agent is live.
+// Otherwise the replay delivers it later.
+func (m *AgentMemory) AddProposal(ctx context.Context, height uint64, proposal uint64, category string, proposer string, data string, contentHash string, actions string) {
+	m.deliverLive(height, func() error {
+		return m.cli.AddProposal(ctx, proposal, category, proposer, m.proposalText(ctx, data, contentHash, actions))
+	})
+}
+
+// AddProposalRevision delivers a revision indexed at height if the agent is
+// live.
+func (m *AgentMemory) AddProposalRevision(ctx context.Context, height uint64, rev ProposalRevision, proposer string) {
+	m.deliverLive(height, func() error {
+		return m.cli.AddProposalRevision(ctx, rev.Proposal, rev.Revision, proposer, m.proposalText(ctx, rev.Data, rev.ContentHash, rev.Actions), rev.Diff)
+	})
+}
+
+// AddDiscussion delivers a discussion indexed at height if the agent is live.
+func (m *AgentMemory) AddDiscussion(ctx context.Context, height uint64, discussion Discussion) {
+	m.deliverLive(height, func() error {
+		return m.cli.AddDiscussion(ctx, discussion)
+	})
+}
+
+func (m *AgentMemory) deliverLive(height uint64, deliver func() error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.liveHeight != height {
+		return
+	}
+	if err := deliver(); err != nil {
+		// the height is replayed once it is indexed
+		m.logger.Error("deliver to agent fail", "height", height, "err", err)
+		m.liveHeight = 0
+	}
+}
+
+// checkStatus detects an agent that lost its memory and rewinds its cursor.
+func (m *AgentMemory) checkStatus(ctx context.Context) error {
+	status, err := m.cli.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.cursor == nil || m.cursor.Agent != status.Id {
+		cursor := AgentCursor{Agent: status.Id}
+		if err := m.db.Where("agent = ?", status.Id).First(&cursor).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			m.logger.Info("new agent, replay history", "agent", status.Id)
+			cursor = AgentCursor{Agent: status.Id, Epoch: status.Epoch, Height: status.Height}
+		}
+		m.cursor = &cursor
+		m.liveHeight = 0
+	}
+	switch {
+	case m.cursor.Epoch != status.Epoch:
+		m.logger.Info("agent memory reset, replay history", "agent", status.Id, "epoch", status.Epoch, "from", status.Height)
+		m.cursor.Epoch = status.Epoch
+		m.cursor.Height = status.Height
+		m.liveHeight = 0
+	case status.Height > 0 && status.Height < m.cursor.Height:
+		m.logger.Info("agent memory behind, replay history", "agent", status.Id, "from", status.Height)
+		m.cursor.Height = status.Height
+		m.liveHeight = 0
+	}
+	m.saveCursor()
+	m.updateReady()
+	return nil
+}
+
+// replay delivers the indexed heights the agent has not seen, oldest first.
+// Every request waits for the agent to answer before the next one is sent.
+func (m *AgentMemory) replay(ctx context.Context) error {
+	for {
+		m.mtx.Lock()
+		if m.cursor == nil || m.cursor.Height >= m.indexed {
+			m.mtx.Unlock()
+			return nil
+		}
+		cursor := *m.cursor
+		m.mtx.Unlock()
+
+		height := cursor.Height + 1
+		if err := m.replayHeight(ctx, height); err != nil {
+			return err
+		}
+
+		m.mtx.Lock()
+		// the cursor may have been rewound meanwhile
+		if m.cursor.Agent == cursor.Agent && m.cursor.Epoch == cursor.Epoch && m.cursor.Height == cursor.Height {
+			m.cursor.Height = height
+			m.saveCursor()
+			m.updateReady()
+			if m.ready {
+				m.logger.Info("agent memory replayed", "agent", m.cursor.Agent, "height", height)
+			}
+		}
+		m.mtx.Unlock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *AgentMemory) replayHeight(ctx context.Context, height uint64) error {
+	var proposals []Proposal
+	if err := m.db.Where("new_height = ?", height).Order("id asc").Find(&proposals).Error; err != nil {
+		return err
+	}
+	for _, p := range proposals {
+		if p.Revision > 0 {
+			// the proposal as submitted, the revisions follow at their height
+			var initial ProposalRevision
+			if err := m.db.Where("proposal = ? AND revision = 0", p.Id).First(&initial).Error; err != nil {
+				return err
+			}
+			p.Data = initial.Data
+			p.ContentHash = initial.ContentHash
+		}
+		if err := m.cli.AddProposal(ctx, p.Id, p.Category, p.ProposerAddress, m.proposalText(ctx, p.Data, p.ContentHash, p.Actions)); err != nil {
+			return err
+		}
+	}
+	var revisions []ProposalRevision
+	if err := m.db.Where("height = ? AND revision > 0", height).Order("id asc").Find(&revisions).Error; err != nil {
+		return err
+	}
+	for _, r := range revisions {
+		var p Proposal
+		if err := m.db.Where("id = ?", r.Proposal).First(&p).Error; err != nil {
+			return err
+		}
+		if err := m.cli.AddProposalRevision(ctx, r.Proposal, r.Revision, p.ProposerAddress, m.proposalText(ctx, r.Data, r.ContentHash, r.Actions), r.Diff); err != nil {
+			return err
+		}
+	}
+	var discussions []Discussion
+	if err := m.db.Where("height = ?", height).Order("id asc").Find(&discussions).Error; err != nil {
+		return err
+	}
+	if err := loadDiscussionReferences(m.db, discussions); err != nil {
+		return err
+	}
+	for _, d := range discussions {
+		if err := m.cli.AddDiscussion(ctx, d); err != nil {
+			return err
+		}
+	}
+	if len(proposals)+len(revisions)+len(discussions) > 0 {
+		m.logger.Info("replay height", "height", height, "proposals", len(proposals), "revisions", len(revisions), "discussions", len(discussions))
+	}
+	return nil
+}
+
+// proposalText is the inline data of a proposal followed by the payload it
+// references in the blob store and by its actions. The agent gets the inline
+// data alone if the payload cannot be fetched.
+func (m *AgentMemory) proposalText(ctx context.Context, data string, contentHash string, actions string) string {
+	text := data
+	if contentHash != "" && m.blobs != nil {
+		content, err := m.blobs.Fetch(ctx, contentHash)
+		if err != nil {
+			m.logger.Error("fetch proposal content fail", "hash", contentHash, "err", err)
+		} else if text == "" {
+			text = string(content)
+		} else {
+			text += "\n\n" + string(content)
+		}
+	}
+	if described := tx.FormatProposalActions(decodeActions(actions)); described != "" {
+		text += "\n\n" + described
+	}
+	return text
+}
+
+func (m *AgentMemory) saveCursor() {
+	m.cursor.UpdatedAt = time.Now().Unix()
+	if err := m.db.Save(m.cursor).Error; err != nil {
+		m.logger.Error("save agent cursor fail", "err", err)
+	}
+}
+
+// updateReady opens or closes the vote gate, must be called with mtx held.
+func (m *AgentMemory) updateReady() {
+	ready := m.cursor != nil && m.cursor.Height >= m.indexed
+	if ready == m.ready {
+		return
+	}
+	m.ready = ready
+	if ready {
+		close(m.readyCh)
+	} else {
+		m.readyCh = make(chan struct{})
+	}
+}
+
+// GatedClient keeps the agent from voting without knowing the history while
+// its memory is being replayed. The consensus votes never wait, blocks must
+// not stall on the agent: they answer no at once, which every caller in
+// consensus turns into a fixed fallback vote. The judgements made off the
+// consensus path wait for the replay.
+type GatedClient struct {
+	Client
+	memory *AgentMemory
+}
+
+var _ Client = &GatedClient{}
+
+func NewGatedClient(cli Client, memory *AgentMemory) *GatedClient {
+	return &GatedClient{Client: cli, memory: memory}
+}
+
+func (g *GatedClient) wait(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, MemoryVoteTimeout)
+	defer cancel()
+	return g.memory.WaitReady(ctx)
+}
+
+// ready reports whether a consensus vote may ask the agent.
+func (g *GatedClient) ready(vote string) bool {
+	if g.memory.Ready() {
+		return true
+	}
+	g.memory.logger.Info("agent memory is being replayed, fallback vote", "vote", vote)
+	return false
+}
+
+func (g *GatedClient) IfProcessProposal(ctx context.Context, category string, data []byte) (bool, error) {
+	if !g.ready("process proposal") {
+		return false, nil
+	}
+	return g.Client.IfProcessProposal(ctx, category, data)
+}
+
+func (g *GatedClient) IfAcceptProposal(ctx context.Context, proposal uint64, revision uint64, voter string) (bool, error) {
+	if !g.ready("accept proposal") {
+		return false, nil
+	}
+	return g.Client.IfAcceptProposal(ctx, proposal, revision, voter)
+}
+
+func (g *GatedClient) IfGrantNewMember(ctx context.Context, validator uint64, proposer string, amount uint64, statement string) (bool, error) {
+	if !g.ready("grant new member") {
+		return false, nil
+	}
+	return g.Client.IfGrantNewMember(ctx, validator, proposer, amount, statement)
+}
+
+func (g *GatedClient) IfSponsorProposal(ctx context.Context, author string, text string) (bool, string, error) {
+	if err := g.wait(ctx); err != nil {
+		return false, "", err
+	}
+	return g.Client.IfSponsorProposal(ctx, author, text)
+}
+
+func (g *GatedClient) IfSettleProposal(ctx context.Context, proposal uint64, proposer string) (bool, error) {
+	if err := g.wait(ctx); err != nil {
+		return false, err
+	}
+	return g.Client.IfSettleProposal(ctx, proposal, proposer)
+}
+
+func (g *GatedClient) CommentPropoal(ctx context.Context, proposal uint64, speaker string) (string, error) {
+	if err := g.wait(ctx); err != nil {
+		return "", err
+	}
+	return g.Client.CommentPropoal(ctx, proposal, speaker)
+}
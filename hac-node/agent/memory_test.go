@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+// catchUp marks the agent as having received the history up to height.
+func catchUp(m *AgentMemory, height uint64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.cursor = &AgentCursor{Height: height}
+	m.indexed = height
+	m.updateReady()
+}
+
+func TestGatedClientReplaying(t *testing.T) {
+	memory := NewAgentMemory(cmtlog.NewNopLogger(), NewMockClient())
+	g := NewGatedClient(NewMockClient(), memory)
+
+	// consensus votes fall back to no at once
+	start := time.Now()
+	if pass, err := g.IfProcessProposal(context.Background(), "", nil); pass || err != nil {
+		t.Fatalf("process %v %v, want the fallback vote", pass, err)
+	}
+	if pass, err := g.IfAcceptProposal(context.Background(), 1, 0, "v"); pass || err != nil {
+		t.Fatalf("accept %v %v, want the fallback vote", pass, err)
+	}
+	if pass, err := g.IfGrantNewMember(context.Background(), 1, "p", 1, "s"); pass || err != nil {
+		t.Fatalf("grant %v %v, want the fallback vote", pass, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("consensus votes waited %v", d)
+	}
+
+	// judgements off the consensus path wait for the replay
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := g.IfSponsorProposal(ctx, "a", "text"); !errors.Is(err, ErrAgentReplaying) {
+		t.Fatalf("error %v, want %v", err, ErrAgentReplaying)
+	}
+}
+
+func TestGatedClientReady(t *testing.T) {
+	memory := NewAgentMemory(cmtlog.NewNopLogger(), NewMockClient())
+	g := NewGatedClient(NewMockClient(), memory)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := g.IfSponsorProposal(context.Background(), "a", "text")
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	catchUp(memory, 5)
+	if err := <-done; err != nil {
+		t.Fatalf("waiting judgement failed after the replay: %v", err)
+	}
+	if pass, err := g.IfAcceptProposal(context.Background(), 1, 0, "v"); !pass || err != nil {
+		t.Fatalf("accept %v %v, want the agent vote", pass, err)
+	}
+
+	// a new height indexed before the agent received it closes the gate
+	memory.mtx.Lock()
+	memory.indexed = 6
+	memory.updateReady()
+	memory.mtx.Unlock()
+	if pass, _ := g.IfProcessProposal(context.Background(), "", nil); pass {
+		t.Fatal("agent voted behind the indexer")
+	}
+	catchUp(memory, 6)
+	if pass, _ := g.IfProcessProposal(context.Background(), "", nil); !pass {
+		t.Fatal("agent did not vote once caught up")
+	}
+}
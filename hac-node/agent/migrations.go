@@ -0,0 +1,509 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SchemaMigration records a migration applied to the indexer database.
+type SchemaMigration struct {
+	Version   uint64 `gorm:"primary_key" json:"version"`
+	Name      string `json:"name"`
+	AppliedAt int64  `json:"applied_at"`
+}
+
+// migration is one versioned schema change. Up runs in a transaction and must
+// be idempotent: databases created by AutoMigrate before migrations existed
+// already have some of the tables, and Reset applies every migration again.
+type migration struct {
+	Version uint64
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// indexerMigrations are applied in order. Never edit a released migration,
+// append a new one.
+var indexerMigrations = []migration{
+	{
+		Version: 1,
+		Name:    "create tables",
+		Up: createTables(&v1Grant{}, &v1Discussion{}, &v1Proposal{}, &v1Height{}, &v1GrantVote{},
+			&v1ProposalVote{}, &v1ValidatorAgent{}, &v1IndexedBlock{}, &v1AgentCursor{}),
+	},
+	{
+		Version: 2,
+		Name:    "query indexes",
+		Up: createIndexes(
+			newIndex(&Proposal{}, "status"),
+			newIndex(&Proposal{}, "proposer_address"),
+			newIndex(&Proposal{}, "new_height"),
+			newIndex(&Proposal{}, "settle_height"),
+			newIndex(&Discussion{}, "proposal", "speaker_address"),
+			newIndex(&Discussion{}, "height"),
+			newIndex(&ProposalVote{}, "proposal"),
+			newIndex(&ProposalVote{}, "height", "voter_index"),
+			newIndex(&ProposalVote{}, "voter_address"),
+			newIndex(&GrantVote{}, "account_index"),
+			newIndex(&GrantVote{}, "height", "voter_index"),
+			newIndex(&GrantVote{}, "voter_address"),
+			newIndex(&Grant{}, "height"),
+			newIndex(&ValidatorAgent{}, "address"),
+		),
+	},
+	{
+		Version: 3,
+		Name:    "vote flags, power and tallies",
+		Up: chain(
+			addColumns(&ProposalVote{}, "Kind", "Flag", "Power"),
+			addColumns(&GrantVote{}, "Flag", "Power"),
+			createTables(&VoteTally{}),
+			createIndexes(
+				newIndex(&VoteTally{}, "kind", "subject"),
+			),
+		),
+	},
+	{
+		Version: 4,
+		Name:    "membership history",
+		Up: chain(
+			addColumns(&ValidatorAgent{}, "Active", "Power", "JoinHeight", "ExitHeight"),
+			createTables(&ValidatorSet{}, &ValidatorSetMember{}, &MembershipEvent{}),
+			func(tx *gorm.DB) error {
+				return tx.Model(&ValidatorAgent{}).Where("stake > ?", 0).Update("active", true).Error
+			},
+			createIndexes(
+				newIndex(&ValidatorSetMember{}, "address"),
+				newIndex(&MembershipEvent{}, "address", "height"),
+				newIndex(&MembershipEvent{}, "height"),
+			),
+		),
+	},
+	{
+		Version: 5,
+		Name:    "full-text search",
+		Up:      createSearchIndexes,
+	},
+	{
+		// heights indexed before are only covered after a reindex
+		Version: 6,
+		Name:    "block transactions",
+		Up: chain(
+			createTables(&IndexedTx{}),
+			createIndexes(
+				newIndex(&IndexedTx{}, "height", "index"),
+				newIndex(&IndexedTx{}, "signer_address", "height"),
+			),
+		),
+	},
+	{
+		Version: 7,
+		Name:    "broadcast outbox",
+		Up: chain(
+			createTables(&OutboxPost{}, &BroadcastCursor{}),
+			createIndexes(
+				newUniqueIndex(&OutboxPost{}, "key"),
+				newIndex(&OutboxPost{}, "status", "next_attempt"),
+			),
+		),
+	},
+	{
+		Version: 8,
+		Name:    "webhook subscriptions",
+		Up: chain(
+			createTables(&WebhookSubscription{}, &WebhookDelivery{}),
+			createIndexes(
+				newUniqueIndex(&WebhookDelivery{}, "subscription", "key"),
+				newIndex(&WebhookDelivery{}, "status", "next_attempt"),
+			),
+		),
+	},
+	{
+		Version: 9,
+		Name:    "community submissions",
+		Up: chain(
+			addColumns(&Proposal{}, "Author", "SubmissionHash"),
+			createTables(&CommunitySubmission{}),
+			createIndexes(
+				newUniqueIndex(&CommunitySubmission{}, "hash"),
+				newIndex(&CommunitySubmission{}, "status", "id"),
+			),
+		),
+	},
+	{
+		Version: 10,
+		Name:    "participants",
+		Up: chain(
+			addColumns(&Discussion{}, "Human"),
+			createTables(&Participant{}),
+			createIndexes(newUniqueIndex(&Participant{}, "address")),
+		),
+	},
+	{
+		Version: 11,
+		Name:    "discussion threads",
+		Up: chain(
+			addColumns(&Discussion{}, "ReplyTo"),
+			func(tx *gorm.DB) error {
+				return tx.Model(&Discussion{}).Where("reply_to IS NULL").Update("reply_to", 0).Error
+			},
+			createTables(&DiscussionReference{}),
+			createIndexes(
+				newIndex(&Discussion{}, "proposal", "reply_to"),
+				newIndex(&DiscussionReference{}, "discussion"),
+			),
+		),
+	},
+	{
+		Version: 12,
+		Name:    "proposal revisions",
+		Up: chain(
+			addColumns(&Proposal{}, "Revision"),
+			func(tx *gorm.DB) error {
+				return tx.Model(&Proposal{}).Where("revision IS NULL").Update("revision", 0).Error
+			},
+			createTables(&ProposalRevision{}),
+			createIndexes(newUniqueIndex(&ProposalRevision{}, "proposal", "revision")),
+			func(tx *gorm.DB) error {
+				var proposals []Proposal
+				if err := tx.Find(&proposals).Error; err != nil {
+					return err
+				}
+				for _, p := range proposals {
+					r := initialRevision(p)
+					if err := tx.Create(&r).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		),
+	},
+	{
+		Version: 13,
+		Name:    "proposal content hashes",
+		Up: chain(
+			addColumns(&Proposal{}, "ContentHash"),
+			addColumns(&ProposalRevision{}, "ContentHash"),
+		),
+	},
+	{
+		Version: 14,
+		Name:    "proposal categories",
+		Up: chain(
+			addColumns(&Proposal{}, "Category", "ExecutedHeight", "Execution"),
+			func(tx *gorm.DB) error {
+				return tx.Model(&Proposal{}).Where("category IS NULL OR category = ''").Update("category", "text").Error
+			},
+			func(tx *gorm.DB) error {
+				return tx.Model(&Proposal{}).Where("executed_height IS NULL").Update("executed_height", 0).Error
+			},
+			createIndexes(newIndex(&Proposal{}, "category", "status")),
+		),
+	},
+	{
+		Version: 15,
+		Name:    "proposal actions",
+		Up: chain(
+			addColumns(&Proposal{}, "Actions"),
+			addColumns(&ProposalRevision{}, "Actions"),
+			addColumns(&OutboxPost{}, "Url"),
+		),
+	},
+	{
+		Version: 16,
+		Name:    "pending votes",
+		Up: chain(
+			addColumns(&IndexedBlock{}, "VotesPending"),
+			func(tx *gorm.DB) error {
+				return tx.Model(&IndexedBlock{}).Where("votes_pending IS NULL").Update("votes_pending", false).Error
+			},
+			createIndexes(newIndex(&IndexedBlock{}, "votes_pending")),
+		),
+	},
+	{
+		// discussions were numbered by the database before their events
+		// carried the chain index. They are dropped and their heights are
+		// left to repairGaps, which numbers them as the chain did. Heights
+		// below the base of a pruned block store cannot be re-indexed.
+		Version: 17,
+		Name:    "discussion chain indexes",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Where("height IN (SELECT DISTINCT height FROM discussions)").Delete(&IndexedBlock{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&DiscussionReference{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&Discussion{}).Error
+		},
+	},
+	{
+		// the member table was keyed by height alone, so a set of more than
+		// one validator could not be recorded. The snapshots are dropped and
+		// their heights are left to repairGaps.
+		Version: 18,
+		Name:    "validator set member keys",
+		Up: chain(
+			func(tx *gorm.DB) error {
+				if err := tx.Where("height IN (SELECT height FROM validator_sets)").Delete(&IndexedBlock{}).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&ValidatorSet{}).Error; err != nil {
+					return err
+				}
+				return tx.DropTableIfExists(&ValidatorSetMember{}).Error
+			},
+			createTables(&ValidatorSetMember{}),
+			createIndexes(newIndex(&ValidatorSetMember{}, "address")),
+		),
+	},
+}
+
+// migratedModels are the tables created by indexerMigrations, except the
+// agent cursors. Reset drops them. The full-text search tables are rebuilt by
+// their migration.
+var migratedModels = []interface{}{&Grant{}, &Discussion{}, &Proposal{}, &Height{}, &GrantVote{}, &ProposalVote{}, &ValidatorAgent{},
+	&IndexedBlock{}, &VoteTally{}, &ValidatorSet{}, &ValidatorSetMember{}, &MembershipEvent{}, &IndexedTx{}, &OutboxPost{},
+	&BroadcastCursor{}, &WebhookSubscription{}, &WebhookDelivery{}, &CommunitySubmission{}, &Participant{},
+	&DiscussionReference{}, &ProposalRevision{}}
+
+// The tables of the first migration as they were released. Later columns are
+// only added by the migrations that introduced them, so the first migration
+// creates the same schema whatever the models have become.
+
+type v1Height struct {
+	Id     uint64 `gorm:"primaryKey"`
+	Height uint64
+}
+
+func (v1Height) TableName() string { return "heights" }
+
+type v1ValidatorAgent struct {
+	Id        uint64 `gorm:"primaryKey"`
+	Address   string
+	Stake     uint64
+	AgentUrl  string
+	Name      string
+	SelfIntro string
+	HeadPhoto string
+}
+
+func (v1ValidatorAgent) TableName() string { return "validator_agents" }
+
+type v1Proposal struct {
+	Id              uint64 `gorm:"primaryKey"`
+	ProposerIndex   uint64
+	ProposerAddress string
+	ProposerName    string
+	HeadPhoto       string
+	Data            string
+	NewHeight       uint64
+	SettleHeight    uint64
+	Status          uint64
+	Title           string
+	Link            string
+	ImageUrl        string
+	CreateTimestamp int64
+	ExpireTimestamp int64
+}
+
+func (v1Proposal) TableName() string { return "proposals" }
+
+type v1Grant struct {
+	Id              uint64 `gorm:"primaryKey"`
+	Address         string
+	Height          uint64
+	Stake           uint64
+	Proposer        uint64
+	ProposerAddress string
+	Grant           bool
+}
+
+func (v1Grant) TableName() string { return "grants" }
+
+type v1ProposalVote struct {
+	Id           uint64 `gorm:"primaryKey;autoIncrement"`
+	Proposal     uint64
+	VoterIndex   uint64
+	VoterAddress string
+	Height       uint64
+	Vote         uint64
+}
+
+func (v1ProposalVote) TableName() string { return "proposal_votes" }
+
+type v1GrantVote struct {
+	Id              uint64 `gorm:"primaryKey;autoIncrement"`
+	ProposerIndex   uint64
+	ProposerAddress string
+	AccountIndex    uint64
+	AccountAddr     string
+	VoterIndex      uint64
+	VoterAddress    string
+	Height          uint64
+	Vote            uint64
+}
+
+func (v1GrantVote) TableName() string { return "grant_votes" }
+
+type v1Discussion struct {
+	Id              uint64 `gorm:"primaryKey"`
+	Proposal        uint64
+	SpeakerIndex    uint64
+	SpeakerAddress  string
+	SpeakerName     string
+	HeadPhoto       string
+	Data            string
+	Height          uint64
+	CreateTimestamp int64
+}
+
+func (v1Discussion) TableName() string { return "discussions" }
+
+type v1AgentCursor struct {
+	Agent     string `gorm:"primary_key"`
+	Epoch     string
+	Height    uint64
+	UpdatedAt int64
+}
+
+func (v1AgentCursor) TableName() string { return "agent_cursors" }
+
+type v1IndexedBlock struct {
+	Height    uint64 `gorm:"primary_key"`
+	Hash      string
+	Txs       int
+	Timestamp int64
+}
+
+func (v1IndexedBlock) TableName() string { return "indexed_blocks" }
+
+// migrate applies the migrations newer than the schema version of db.
+func migrate(db *gorm.DB, migrations []migration) error {
+	if !db.HasTable(&SchemaMigration{}) {
+		if err := db.CreateTable(&SchemaMigration{}).Error; err != nil {
+			return err
+		}
+	}
+	var applied []uint64
+	if err := db.Model(&SchemaMigration{}).Pluck("version", &applied).Error; err != nil {
+		return err
+	}
+	done := make(map[uint64]bool, len(applied))
+	for _, v := range applied {
+		done[v] = true
+	}
+	for _, m := range migrations {
+		if done[m.Version] {
+			continue
+		}
+		tx := db.Begin()
+		if err := m.Up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+		rec := SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().Unix()}
+		if err := tx.Create(&rec).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit().Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTables creates the tables of models that do not exist yet.
+func createTables(models ...interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, model := range models {
+			if tx.HasTable(model) {
+				continue
+			}
+			if err := tx.CreateTable(model).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// chain runs steps one after another.
+func chain(steps ...func(tx *gorm.DB) error) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, step := range steps {
+			if err := step(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumns adds the columns of the named fields of model that do not exist
+// yet.
+func addColumns(model interface{}, fields ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		scope := tx.NewScope(model)
+		for _, name := range fields {
+			field, ok := scope.FieldByName(name)
+			if !ok {
+				return fmt.Errorf("%s has no field %s", scope.TableName(), name)
+			}
+			if scope.Dialect().HasColumn(scope.TableName(), field.DBName) {
+				continue
+			}
+			stmt := fmt.Sprintf("ALTER TABLE %s ADD %s %s",
+				scope.QuotedTableName(), scope.Quote(field.DBName), scope.Dialect().DataTypeOf(field.StructField))
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type index struct {
+	model   interface{}
+	columns []string
+	unique  bool
+}
+
+func newIndex(model interface{}, columns ...string) index {
+	return index{model: model, columns: columns}
+}
+
+func newUniqueIndex(model interface{}, columns ...string) index {
+	return index{model: model, columns: columns, unique: true}
+}
+
+func (i index) name(table string) string {
+	return fmt.Sprintf("idx_%s_%s", table, strings.Join(i.columns, "_"))
+}
+
+func createIndexes(indexes ...index) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, i := range indexes {
+			scope := tx.NewScope(i.model)
+			table := scope.TableName()
+			columns := make([]string, len(i.columns))
+			for n, c := range i.columns {
+				columns[n] = scope.Quote(c)
+			}
+			kind := "INDEX"
+			if i.unique {
+				kind = "UNIQUE INDEX"
+			}
+			stmt := fmt.Sprintf("CREATE %s IF NOT EXISTS %s ON %s (%s)",
+				kind, scope.Quote(i.name(table)), scope.Quote(table), strings.Join(columns, ", "))
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// remigrate applies the migrations from version again, as on a database
+// created before them.
+func remigrate(t *testing.T, db *gorm.DB, version uint64) {
+	t.Helper()
+	if err := db.Where("version >= ?", version).Delete(&SchemaMigration{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db, indexerMigrations); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateDiscussionChainIndexes(t *testing.T) {
+	db := openTestStore(t).DB()
+	for h := uint64(1); h <= 4; h++ {
+		if err := db.Create(&IndexedBlock{Height: h}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// numbered by the database, 5 and 6 were lost
+	for _, d := range []Discussion{{Id: 7, Height: 2}, {Id: 8, Height: 2}, {Id: 9, Height: 3}} {
+		if err := db.Create(&d).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Create(&DiscussionReference{Discussion: 9, Type: "discussion", Target: 7}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	remigrate(t, db, 17)
+	var cnt int
+	if err := db.Model(&Discussion{}).Count(&cnt).Error; err != nil || cnt != 0 {
+		t.Fatalf("%d discussions kept, %v", cnt, err)
+	}
+	if err := db.Model(&DiscussionReference{}).Count(&cnt).Error; err != nil || cnt != 0 {
+		t.Fatalf("%d references kept, %v", cnt, err)
+	}
+	var heights []uint64
+	if err := db.Model(&IndexedBlock{}).Order("height asc").Pluck("height", &heights).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 2 || heights[0] != 1 || heights[1] != 4 {
+		t.Fatalf("indexed heights %v, want the heights with discussions re-indexed", heights)
+	}
+}
+
+// columns returns the columns of every table of a sqlite database.
+func columns(t *testing.T, db *gorm.DB) map[string]map[string]bool {
+	t.Helper()
+	var tables []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table'").Pluck("name", &tables).Error; err != nil {
+		t.Fatal(err)
+	}
+	schema := make(map[string]map[string]bool, len(tables))
+	for _, table := range tables {
+		rows, err := db.Raw(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table)).Rows()
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema[table] = make(map[string]bool)
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			schema[table][name] = true
+		}
+		rows.Close()
+	}
+	return schema
+}
+
+func TestMigrateUpgradedSchema(t *testing.T) {
+	fresh := openTestStore(t).DB()
+
+	// created by AutoMigrate before migrations existed
+	upgraded, err := gorm.Open(IndexerDriverSqlite, filepath.Join(t.TempDir(), "indexer.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upgraded.Close()
+	err = upgraded.AutoMigrate(&v1Grant{}, &v1Discussion{}, &v1Proposal{}, &v1Height{}, &v1GrantVote{},
+		&v1ProposalVote{}, &v1ValidatorAgent{}, &v1IndexedBlock{}, &v1AgentCursor{}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(upgraded, indexerMigrations); err != nil {
+		t.Fatal(err)
+	}
+
+	want, got := columns(t, fresh), columns(t, upgraded)
+	if len(got) != len(want) {
+		t.Fatalf("%d tables after the upgrade, %d on a fresh database", len(got), len(want))
+	}
+	for table, cols := range want {
+		if len(got[table]) != len(cols) {
+			t.Fatalf("table %s has columns %v after the upgrade, want %v", table, got[table], cols)
+		}
+		for col := range cols {
+			if !got[table][col] {
+				t.Fatalf("table %s misses column %s after the upgrade", table, col)
+			}
+		}
+	}
+
+	// the migrations add a column for every field of the models
+	for _, model := range append(migratedModels, &AgentCursor{}) {
+		scope := fresh.NewScope(model)
+		for _, field := range scope.GetModelStruct().StructFields {
+			if field.IsIgnored || !field.IsNormal {
+				continue
+			}
+			if !want[scope.TableName()][field.DBName] {
+				t.Fatalf("no migration adds the column %s of %s", field.DBName, scope.TableName())
+			}
+		}
+	}
+}
+
+func TestResetDropsMigratedTables(t *testing.T) {
+	is := openTestStore(t)
+	db := is.DB()
+
+	dropped := make(map[string]bool)
+	for _, model := range migratedModels {
+		dropped[db.NewScope(model).TableName()] = true
+	}
+	for table := range columns(t, db) {
+		switch {
+		case dropped[table], table == "schema_migrations", table == "agent_cursors", strings.HasPrefix(table, "sqlite_"), strings.HasPrefix(table, "proposals_fts"), strings.HasPrefix(table, "discussions_fts"):
+		default:
+			t.Fatalf("table %s is not dropped by Reset", table)
+		}
+	}
+
+	rows := []interface{}{
+		&Proposal{Id: 1, Title: "t"},
+		&OutboxPost{Key: "k"},
+		&WebhookSubscription{Url: "http://hook"},
+		&CommunitySubmission{Hash: "h"},
+		&BroadcastCursor{Name: "x"},
+		&AgentCursor{Agent: "a", Height: 3},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := is.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows[:len(rows)-1] {
+		var cnt int
+		if err := db.Model(row).Count(&cnt).Error; err != nil || cnt != 0 {
+			t.Fatalf("%d rows of %T kept by Reset, %v", cnt, row, err)
+		}
+	}
+	var cursor AgentCursor
+	if err := db.First(&cursor, "agent = ?", "a").Error; err != nil || cursor.Height != 3 {
+		t.Fatalf("agent cursor %+v, %v", cursor, err)
+	}
+	// the search tables follow the new rows
+	if err := db.Create(&Proposal{Id: 1, Title: "fresh"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, total, err := is.Search(SearchQuery{Text: "fresh"}); err != nil || total != 1 {
+		t.Fatalf("%d results, %v", total, err)
+	}
+}
+
+func TestMigrateValidatorSetMemberKeys(t *testing.T) {
+	db := openTestStore(t).DB()
+	// as created before, keyed by height alone
+	if err := db.DropTable(&ValidatorSetMember{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(`CREATE TABLE "validator_set_members" ("height" integer primary key autoincrement,"address" varchar(255),"account_index" bigint,"power" bigint)`).Error; err != nil {
+		t.Fatal(err)
+	}
+	for h := uint64(1); h <= 3; h++ {
+		if err := db.Create(&IndexedBlock{Height: h}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Create(&ValidatorSet{Height: 2, Size: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&ValidatorSetMember{Height: 2, Address: "A1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	remigrate(t, db, 18)
+	var cnt int
+	if err := db.Model(&ValidatorSet{}).Count(&cnt).Error; err != nil || cnt != 0 {
+		t.Fatalf("%d snapshots kept, %v", cnt, err)
+	}
+	var heights []uint64
+	if err := db.Model(&IndexedBlock{}).Order("height asc").Pluck("height", &heights).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(heights) != 2 || heights[0] != 1 || heights[1] != 3 {
+		t.Fatalf("indexed heights %v, want the snapshot height re-indexed", heights)
+	}
+	for _, address := range []string{"A1", "A2"} {
+		if err := db.Create(&ValidatorSetMember{Height: 2, Address: address}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
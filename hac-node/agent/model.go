@@ -15,6 +15,13 @@ type ValidatorAgent struct {
 	Name      string `json:"name"`
 	SelfIntro string `json:"self_intro"`
 	HeadPhoto string `json:"head_photo"`
+
+	// membership: Active is false once the stake is retracted, Power is the
+	// voting power in the validator set, 0 outside of it
+	Active     bool   `json:"active"`
+	Power      int64  `json:"power"`
+	JoinHeight uint64 `json:"join_height"`
+	ExitHeight uint64 `json:"exit_height"`
 }
 
 type Proposal struct {
@@ -32,6 +39,39 @@ type Proposal struct {
 	ImageUrl        string `json:"image_url"`
 	CreateTimestamp int64  `json:"create_timestamp"`
 	ExpireTimestamp int64  `json:"expire_timestamp"`
+	// author and hash of the community submission a member sponsored
+	Author         string `json:"author"`
+	SubmissionHash string `json:"submission_hash"`
+	// latest revision, the content above is the one of this revision
+	Revision uint64 `json:"revision"`
+	// hex sha256 of the payload in the blob store, served by /api/blobs
+	ContentHash string `json:"content_hash"`
+	// proposal category, text for the proposals created before categories
+	Category string `json:"category"`
+	// height the accepted proposal was executed at, and what it did
+	ExecutedHeight uint64 `json:"executed_height"`
+	Execution      string `json:"execution"`
+	// JSON list of the actions executed when the proposal is accepted
+	Actions string `gorm:"type:text" json:"actions"`
+}
+
+// ProposalRevision is the content of a proposal at a revision, revision 0 is
+// the proposal as submitted. Diff is the unified diff against the previous
+// revision.
+type ProposalRevision struct {
+	Id              uint64 `gorm:"primaryKey" json:"-"`
+	Proposal        uint64 `json:"proposal"`
+	Revision        uint64 `json:"revision"`
+	Title           string `json:"title"`
+	Link            string `json:"link"`
+	ImageUrl        string `json:"image_url"`
+	Data            string `json:"data"`
+	ContentHash     string `json:"content_hash"`
+	Actions         string `gorm:"type:text" json:"actions"`
+	Note            string `json:"note"`
+	Diff            string `json:"diff"`
+	Height          uint64 `json:"height"`
+	CreateTimestamp int64  `json:"create_timestamp"`
 }
 
 type Grant struct {
@@ -47,10 +87,13 @@ type Grant struct {
 type ProposalVote struct {
 	Id           uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
 	Proposal     uint64 `json:"proposal"`
+	Kind         string `json:"kind"`
 	VoterIndex   uint64 `json:"voter_index"`
 	VoterAddress string `json:"voter_address"`
 	Height       uint64 `json:"height"`
 	Vote         uint64 `json:"vote"`
+	Flag         string `json:"flag"`
+	Power        int64  `json:"power"`
 }
 
 type GrantVote struct {
@@ -63,6 +106,8 @@ type GrantVote struct {
 	VoterAddress    string `json:"voter_address"`
 	Height          uint64 `json:"height"`
 	Vote            uint64 `json:"vote"`
+	Flag            string `json:"flag"`
+	Power           int64  `json:"power"`
 }
 
 type Discussion struct {
@@ -75,4 +120,207 @@ type Discussion struct {
 	Data            string `json:"data"`
 	Height          uint64 `json:"height"`
 	CreateTimestamp int64  `json:"create_timestamp"`
+
+	// Human is set when the speaker is a participant, not an agent
+	Human bool `json:"human"`
+
+	// ReplyTo is the discussion this one replies to, 0 for the start of a
+	// thread
+	ReplyTo    uint64                `json:"reply_to"`
+	References []DiscussionReference `gorm:"-" json:"references"`
+	Replies    []Discussion          `gorm:"-" json:"replies,omitempty"`
+}
+
+// DiscussionReference is a discussion quoted or a proposal cited by a
+// discussion.
+type DiscussionReference struct {
+	Id         uint64 `gorm:"primaryKey" json:"-"`
+	Discussion uint64 `json:"-"`
+	Type       string `json:"type"`
+	Target     uint64 `json:"index"`
+}
+
+func (d Discussion) speakerType() string {
+	if d.Human {
+		return SpeakerTypeHuman
+	}
+	return SpeakerTypeAgent
+}
+
+// Participant is a human account, it has no stake and no voting power and
+// only speaks in discussions.
+type Participant struct {
+	Id              uint64 `gorm:"primaryKey" json:"id"`
+	Address         string `json:"address"`
+	Name            string `json:"name"`
+	Height          uint64 `json:"height"`
+	CreateTimestamp int64  `json:"create_timestamp"`
+}
+
+// AgentCursor records up to which height the governance history has been
+// delivered to an agent, and the memory epoch the agent reported then.
+type AgentCursor struct {
+	Agent     string `gorm:"primary_key" json:"agent"`
+	Epoch     string `json:"epoch"`
+	Height    uint64 `json:"height"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// IndexedBlock marks a height whose events and votes are fully indexed.
+// VotesPending is set while the votes on the decision taken at the height
+// wait for the canonical commit, stored with the next block.
+type IndexedBlock struct {
+	Height       uint64 `gorm:"primary_key" json:"height"`
+	Hash         string `json:"hash"`
+	Txs          int    `json:"txs"`
+	Timestamp    int64  `json:"timestamp"`
+	VotesPending bool   `json:"votes_pending"`
+}
+
+// IndexedTx is a transaction of a block with its result. Data holds the tx
+// as sent, empty if it is not a HAC tx, Events the JSON of its result events.
+type IndexedTx struct {
+	Hash          string `gorm:"primary_key" json:"hash"`
+	Height        uint64 `json:"height"`
+	Index         int    `json:"index"`
+	Type          uint8  `json:"type"`
+	Signer        uint64 `json:"signer"`
+	SignerAddress string `json:"signer_address"`
+	Nonce         uint64 `json:"nonce"`
+	Code          uint32 `json:"code"`
+	Log           string `gorm:"type:text" json:"log"`
+	Data          string `gorm:"type:text" json:"data"`
+	Events        string `gorm:"type:text" json:"events"`
+}
+
+// VoteTally sums up the votes of the validator set on the decision taken at
+// a height. Subject is the proposal, or the account index for a grant.
+type VoteTally struct {
+	Height      uint64 `gorm:"primary_key" json:"height"`
+	Kind        string `json:"kind"`
+	Subject     uint64 `json:"subject"`
+	Validators  int    `json:"validators"`
+	Commits     int    `json:"commits"`
+	Absents     int    `json:"absents"`
+	Nils        int    `json:"nils"`
+	TotalPower  int64  `json:"total_power"`
+	CommitPower int64  `json:"commit_power"`
+	AbsentPower int64  `json:"absent_power"`
+	NilPower    int64  `json:"nil_power"`
+	YesPower    int64  `json:"yes_power"`
+	NoPower     int64  `json:"no_power"`
+}
+
+// ValidatorSet is a snapshot of the validator set, taken at every height
+// where the set differs from the one of the previous snapshot.
+type ValidatorSet struct {
+	Height     uint64 `gorm:"primary_key" json:"height"`
+	Hash       string `json:"hash"`
+	Size       int    `json:"size"`
+	TotalPower int64  `json:"total_power"`
+}
+
+// ValidatorSetMember is a validator of the snapshot taken at Height.
+type ValidatorSetMember struct {
+	Height       uint64 `gorm:"primary_key;auto_increment:false" json:"height"`
+	Address      string `gorm:"primary_key" json:"address"`
+	AccountIndex uint64 `json:"account_index"`
+	Power        int64  `json:"power"`
+}
+
+// MembershipEvent is an entry of the membership timeline of an agent.
+// Validator-set changes take effect at EffectiveHeight.
+type MembershipEvent struct {
+	Id              uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountIndex    uint64 `json:"account_index"`
+	Address         string `json:"address"`
+	Height          uint64 `json:"height"`
+	EffectiveHeight uint64 `json:"effective_height"`
+	Kind            string `json:"kind"`
+	Stake           uint64 `json:"stake"`
+	Power           int64  `json:"power"`
+	PrevPower       int64  `json:"prev_power"`
+}
+
+// OutboxPost is a post of the broadcaster waiting for, or done with,
+// delivery. Key identifies the governance event it narrates, so an event is
+// posted once.
+type OutboxPost struct {
+	Id          uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	Key         string `json:"key"`
+	Height      uint64 `json:"height"`
+	EventType   string `json:"event_type"`
+	Text        string `gorm:"type:text" json:"text"`
+	Status      string `json:"status"`
+	Attempts    int    `json:"attempts"`
+	NextAttempt int64  `json:"next_attempt"`
+	LastError   string `gorm:"type:text" json:"last_error"`
+	CreatedAt   int64  `json:"created_at"`
+	SentAt      int64  `json:"sent_at"`
+	// set for the webhook actions of proposals, which are posted there
+	// instead of to the sink
+	Url string `gorm:"type:text" json:"url"`
+}
+
+// BroadcastCursor is the last height whose events the broadcaster turned into
+// posts.
+type BroadcastCursor struct {
+	Name      string `gorm:"primary_key" json:"name"`
+	Height    uint64 `json:"height"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// WebhookSubscription is a webhook registered for the governance events.
+// Types is the comma separated list of the event types it receives, every
+// type if empty. Height is the last height whose events were queued for it.
+type WebhookSubscription struct {
+	Id        uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	Url       string `gorm:"type:text" json:"url"`
+	Types     string `json:"types"`
+	Proposal  uint64 `json:"proposal"`
+	Agent     string `json:"agent"`
+	Secret    string `json:"-"`
+	Active    bool   `json:"active"`
+	Height    uint64 `json:"height"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// WebhookDelivery is an event queued for, or delivered to, a webhook. Key
+// identifies the event, so an event is delivered once per subscription.
+type WebhookDelivery struct {
+	Id           uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	Subscription uint64 `json:"subscription"`
+	Key          string `json:"key"`
+	Height       uint64 `json:"height"`
+	EventType    string `json:"event_type"`
+	Payload      string `gorm:"type:text" json:"payload"`
+	Status       string `json:"status"`
+	Attempts     int    `json:"attempts"`
+	NextAttempt  int64  `json:"next_attempt"`
+	ResponseCode int    `json:"response_code"`
+	LastError    string `gorm:"type:text" json:"last_error"`
+	CreatedAt    int64  `json:"created_at"`
+	DeliveredAt  int64  `json:"delivered_at"`
+}
+
+// CommunitySubmission is a proposal submitted by a non-member, waiting for
+// the local agent to sponsor it. Hash is the hex sha256 of the submission
+// message, Author the address that signed it, empty if unsigned.
+type CommunitySubmission struct {
+	Id          uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	Hash        string `json:"hash"`
+	Title       string `json:"title"`
+	Link        string `json:"link"`
+	ImageUrl    string `json:"image_url"`
+	Data        string `gorm:"type:text" json:"data"`
+	Author      string `json:"author"`
+	Signature   string `json:"signature"`
+	Status      string `json:"status"`
+	Reason      string `gorm:"type:text" json:"reason"`
+	Submits     int    `json:"submits"`
+	Proposal    uint64 `json:"proposal"`
+	Height      uint64 `json:"height"`
+	CreatedAt   int64  `json:"created_at"`
+	DecidedAt   int64  `json:"decided_at"`
+	SubmittedAt int64  `json:"submitted_at"`
 }
@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/calehh/hac-app/tx"
+)
+
+// submitProposal queues a ProposalTx drafted by the proposer daemon. The
+// daemon proposes through the node so only the node's own sender signs with
+// the validator key, and a single proposal of the node is in flight.
+func (c *ChainIndexer) submitProposal(p *tx.ProposalTx) error {
+	if c.sender == nil {
+		return ErrObserverNode
+	}
+	if strings.TrimSpace(p.Title) == "" {
+		return errors.New("proposal title is empty")
+	}
+	return c.sender.SubmitIfIdle(tx.HACTxTypeProposal, p)
+}
+
+// proposalPending reports whether a proposal of the node is not on chain yet.
+func (c *ChainIndexer) proposalPending() (bool, error) {
+	if c.sender == nil {
+		return false, ErrObserverNode
+	}
+	return c.sender.IsPending(tx.HACTxTypeProposal, nil), nil
+}
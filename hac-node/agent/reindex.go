@@ -0,0 +1,214 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/calehh/hac-app/state"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	sm "github.com/cometbft/cometbft/state"
+	"github.com/cometbft/cometbft/store"
+)
+
+// interval between two progress reports of the reindexer
+const ReindexProgressInterval = 5 * time.Second
+
+// ReindexProgress is reported while the reindexer runs.
+type ReindexProgress struct {
+	From    int64
+	To      int64
+	Height  int64
+	Elapsed time.Duration
+}
+
+// Reindexer rebuilds the indexer database of a stopped node from its block
+// store, state store and app state. Heights are loaded in parallel but
+// applied one by one in height order, since the rows of a height depend on
+// the proposals and members indexed before it.
+type Reindexer struct {
+	logger  cmtlog.Logger
+	indexer *ChainIndexer
+	workers int
+}
+
+func NewReindexer(logger cmtlog.Logger, is IndexerStore, bs *store.BlockStore, ss sm.Store, accounts *state.StateDB, workers int) (*Reindexer, error) {
+	db := is.DB()
+	h, err := loadIndexedHeight(db)
+	if err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	c := &ChainIndexer{
+		logger:       logger.With("module", "reindex"),
+		Height:       int64(h.Height + 1),
+		store:        is,
+		db:           db,
+		stateStore:   ss,
+		elizaClients: make(map[string]Client),
+		BlockStore:   bs,
+		accounts:     accounts,
+	}
+	c.registerEventHandlers()
+	return &Reindexer{
+		logger:  c.logger,
+		indexer: c,
+		workers: workers,
+	}, nil
+}
+
+// Close closes the indexer store.
+func (r *Reindexer) Close() error {
+	return r.indexer.store.Close()
+}
+
+// IndexedHeight returns the height of the indexer cursor.
+func (r *Reindexer) IndexedHeight() int64 {
+	return r.indexer.Height - 1
+}
+
+// Reset drops every indexed table. Agent cursors are kept, so the agents are
+// not replayed the history they already know.
+func (r *Reindexer) Reset() error {
+	if err := r.indexer.store.Reset(); err != nil {
+		return err
+	}
+	r.indexer.Height = 1
+	return nil
+}
+
+// Run re-indexes the heights from..to. from may not be above the indexer
+// cursor + 1, heights up to the cursor are rewritten in place.
+func (r *Reindexer) Run(ctx context.Context, from, to int64, progress func(ReindexProgress)) error {
+	c := r.indexer
+	if base := c.BlockStore.Base(); from < base {
+		from = base
+	}
+	if from < 1 {
+		from = 1
+	}
+	if from > c.Height {
+		return fmt.Errorf("reindex from %d leaves a gap after indexed height %d", from, c.Height-1)
+	}
+	if to > c.BlockStore.Height() {
+		return fmt.Errorf("reindex to %d beyond block store height %d", to, c.BlockStore.Height())
+	}
+	if err := r.seedValidators(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type loaded struct {
+		data *heightData
+		err  error
+	}
+	type job struct {
+		height int64
+		out    chan loaded
+	}
+	jobs := make(chan job, r.workers*4)
+	slots := make(chan chan loaded, r.workers*4)
+	go func() {
+		defer close(jobs)
+		defer close(slots)
+		for h := from; h <= to; h++ {
+			out := make(chan loaded, 1)
+			select {
+			case slots <- out:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- job{height: h, out: out}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				d, err := c.loadHeight(j.height)
+				j.out <- loaded{data: d, err: err}
+			}
+		}()
+	}
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	start := time.Now()
+	last := start
+	report := func(height int64) {
+		if progress != nil {
+			progress(ReindexProgress{From: from, To: to, Height: height, Elapsed: time.Since(start)})
+		}
+	}
+	for out := range slots {
+		var l loaded
+		select {
+		case l = <-out:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if l.err != nil {
+			return l.err
+		}
+		if err := c.applyHeight(ctx, l.data); err != nil {
+			return fmt.Errorf("index height %d: %w", l.data.height, err)
+		}
+		if l.data.height == c.Height {
+			c.Height++
+		}
+		if time.Since(last) >= ReindexProgressInterval {
+			last = time.Now()
+			report(l.data.height)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	report(to)
+	return nil
+}
+
+// seedValidators records the validators that joined without a grant, e.g.
+// the genesis validators. The validator set of a freshly opened state is
+// only known once computed from the accounts.
+func (r *Reindexer) seedValidators() error {
+	st := r.indexer.accounts.State()
+	if _, err := st.Validators(); err != nil {
+		return err
+	}
+	accounts, _, err := st.ValidatorAccounts()
+	if err != nil {
+		return err
+	}
+	for _, acc := range accounts {
+		agent, err := r.indexer.getValidatorByAddress(acc.Address())
+		if err == nil && agent != nil && agent.Id != 0 {
+			continue
+		}
+		val := ValidatorAgent{
+			Id:       acc.Index,
+			Address:  acc.Address(),
+			Stake:    acc.Stake,
+			AgentUrl: acc.AgentUrl,
+			Name:     acc.Name,
+			Active:   acc.Stake > 0,
+		}
+		if err := r.indexer.db.Save(&val).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
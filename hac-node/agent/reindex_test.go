@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+func TestReindexFromGenesis(t *testing.T) {
+	chain := newTestChain(t)
+	chain.addBlocks(t, 3)
+	is := openTestStore(t)
+	// a stale row the reset drops
+	if err := is.DB().Create(&Discussion{Id: 1, Height: 2}).Error; err != nil {
+		t.Fatal(err)
+	}
+	chain.reopenAccounts(t)
+
+	r, err := NewReindexer(cmtlog.NewNopLogger(), is, chain.bs, chain.ss, chain.accounts, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Run(context.Background(), 1, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if h := r.IndexedHeight(); h != 3 {
+		t.Fatalf("indexed height %d, want 3", h)
+	}
+
+	var vals []ValidatorAgent
+	if err := is.DB().Find(&vals).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(vals) != 1 || vals[0].Name != "genesis" || !vals[0].Active {
+		t.Fatalf("validators %+v, want the genesis validator", vals)
+	}
+	// the genesis validator joined with the first validator set
+	var events []MembershipEvent
+	if err := is.DB().Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != MembershipGenesis || events[0].Height != 1 {
+		t.Fatalf("membership events %+v, want the genesis one", events)
+	}
+	var cnt int
+	if err := is.DB().Model(&Discussion{}).Count(&cnt).Error; err != nil || cnt != 0 {
+		t.Fatalf("%d discussions after the reset, %v", cnt, err)
+	}
+}
@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/jinzhu/gorm"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+var ErrRevisionNotFound = errors.New("proposal revision not found")
+
+// initialRevision is the revision 0 of an indexed proposal.
+func initialRevision(p Proposal) ProposalRevision {
+	return ProposalRevision{
+		Proposal:        p.Id,
+		Revision:        0,
+		Title:           p.Title,
+		Link:            p.Link,
+		ImageUrl:        p.ImageUrl,
+		Data:            p.Data,
+		ContentHash:     p.ContentHash,
+		Actions:         p.Actions,
+		Height:          p.NewHeight,
+		CreateTimestamp: p.CreateTimestamp,
+	}
+}
+
+// text is the content of the revision the diffs are computed on.
+func (r ProposalRevision) text() string {
+	data := r.Data
+	if !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	header := fmt.Sprintf("Title: %s\nLink: %s\nImage: %s\n", r.Title, r.Link, r.ImageUrl)
+	if r.ContentHash != "" {
+		header += fmt.Sprintf("Content: %s\n", r.ContentHash)
+	}
+	if actions := tx.FormatProposalActions(decodeActions(r.Actions)); actions != "" {
+		data += "\n" + actions + "\n"
+	}
+	return header + "\n" + data
+}
+
+// revisionDiff returns the unified diff from prev to r.
+func revisionDiff(prev ProposalRevision, r ProposalRevision) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(prev.text()),
+		B:        difflib.SplitLines(r.text()),
+		FromFile: fmt.Sprintf("revision %d", prev.Revision),
+		ToFile:   fmt.Sprintf("revision %d", r.Revision),
+		Context:  3,
+	})
+}
+
+// saveRevision stores r, replacing the record of an earlier indexing.
+func saveRevision(db *gorm.DB, r *ProposalRevision) error {
+	var existing ProposalRevision
+	err := db.Where("proposal = ? AND revision = ?", r.Proposal, r.Revision).First(&existing).Error
+	if err == nil {
+		r.Id = existing.Id
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return db.Save(r).Error
+}
+
+func (c *ChainIndexer) handleEventReviseProposal(ctx context.Context, b *heightBatch, event abci.Event) error {
+	ev := hac_types.DecodeEventReviseProposal(event)
+	if ev == nil {
+		return fmt.Errorf("decode revise proposal event fail: %v", event)
+	}
+	c.blobs.Prefetch(ev.ContentHash)
+	var proposal Proposal
+	if err := b.db.First(&proposal, ev.Proposal).Error; err != nil {
+		return err
+	}
+	var prev ProposalRevision
+	if err := b.db.Where("proposal = ? AND revision = ?", ev.Proposal, ev.Revision-1).First(&prev).Error; err != nil {
+		return err
+	}
+	rev := ProposalRevision{
+		Proposal:        ev.Proposal,
+		Revision:        ev.Revision,
+		Title:           ev.Title,
+		Link:            ev.Link,
+		ImageUrl:        ev.ImageUrl,
+		Data:            string(ev.Data),
+		ContentHash:     ev.ContentHash,
+		Actions:         encodeActions(ev.Actions),
+		Note:            ev.Note,
+		Height:          uint64(b.height),
+		CreateTimestamp: b.time.Unix(),
+	}
+	diff, err := revisionDiff(prev, rev)
+	if err != nil {
+		return err
+	}
+	rev.Diff = diff
+	if err := saveRevision(b.db, &rev); err != nil {
+		return err
+	}
+	// a later revision may be indexed already when repairing a gap
+	if proposal.Revision < ev.Revision {
+		proposal.Revision = ev.Revision
+		proposal.Title = ev.Title
+		proposal.Link = ev.Link
+		proposal.ImageUrl = ev.ImageUrl
+		proposal.Data = string(ev.Data)
+		proposal.ContentHash = ev.ContentHash
+		proposal.Actions = rev.Actions
+		if err := b.db.Save(&proposal).Error; err != nil {
+			return err
+		}
+	}
+	b.after = append(b.after, func() {
+		c.memory.AddProposalRevision(ctx, uint64(b.height), rev, ev.ProposerAddress)
+	})
+	return nil
+}
+
+// revisionHeight returns the height of the latest revision of a proposal, 0
+// if it was never revised.
+func (c *ChainIndexer) revisionHeight(p Proposal) (uint64, error) {
+	if p.Revision == 0 {
+		return 0, nil
+	}
+	var r ProposalRevision
+	if err := c.db.Where("proposal = ? AND revision = ?", p.Id, p.Revision).First(&r).Error; err != nil {
+		return 0, err
+	}
+	return r.Height, nil
+}
+
+// getProposalRevisions returns the revisions of a proposal, oldest first.
+func (c *ChainIndexer) getProposalRevisions(proposal uint64) ([]ProposalRevision, error) {
+	revisions := make([]ProposalRevision, 0)
+	if err := c.db.Where("proposal = ?", proposal).Order("revision asc").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, ErrRevisionNotFound
+	}
+	return revisions, nil
+}
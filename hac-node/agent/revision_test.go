@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	abci "github.com/cometbft/cometbft/abci/types"
+)
+
+func TestRevisionDiff(t *testing.T) {
+	prev := ProposalRevision{Revision: 0, Title: "Fund the docs", Link: "https://example.com", Data: "one\ntwo\nthree"}
+	rev := prev
+	rev.Revision = 1
+	rev.Data = "one\n2\nthree\n"
+	rev.Actions = encodeActions([]tx.ProposalAction{{Type: tx.ProposalActionSetParam, Data: json.RawMessage(`{"name":"max_proposal_revisions","value":4}`)}})
+	diff, err := revisionDiff(prev, rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "--- revision 0\n+++ revision 1\n" +
+		"@@ -3,6 +3,9 @@\n" +
+		" Image: \n" +
+		" \n" +
+		" one\n" +
+		"-two\n" +
+		"+2\n" +
+		" three\n" +
+		" \n" +
+		"+Actions executed if accepted:\n" +
+		"+1. set_param {\"name\":\"max_proposal_revisions\",\"value\":4}\n" +
+		"+\n"
+	if diff != want {
+		t.Fatalf("diff\n%s\nwant\n%s", diff, want)
+	}
+	if diff, err := revisionDiff(prev, prev); err != nil || diff != "" {
+		t.Fatalf("diff %q, %v of an unchanged revision", diff, err)
+	}
+}
+
+func TestHandleEventReviseProposal(t *testing.T) {
+	c := newTestIndexer(t, newTestChain(t), openTestStore(t))
+	ctx := context.Background()
+	index := func(height int64, events ...abci.Event) {
+		t.Helper()
+		b := &heightBatch{db: c.db, height: height, time: time.Unix(1700000000+height, 0)}
+		for _, event := range events {
+			if err := c.handleEvent(ctx, b, event); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	revise := func(revision uint64, title string) abci.Event {
+		return hac_types.EncodeEventReviseProposal(&hac_types.EventReviseProposal{
+			Proposal: 1, Revision: revision, Proposer: 1, ProposerAddress: "A1", Title: title, Data: []byte(title + " data"), Note: "note " + title,
+		})
+	}
+
+	index(1, hac_types.EncodeEventProposal(&hac_types.EventProposal{ProposalIndex: 1, Proposer: 1, ProposerAddress: "A1", Status: uint64(hac_types.ProposalStatusProcessing), Title: "v0", Data: []byte("v0 data")}))
+	index(5, revise(1, "v1"))
+	index(9, revise(2, "v2"))
+	// indexing an earlier revision again keeps the proposal at the latest one
+	index(5, revise(1, "v1"))
+
+	revisions, err := c.getProposalRevisions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("%d revisions, want 3", len(revisions))
+	}
+	for i, r := range revisions {
+		if r.Revision != uint64(i) || r.Title != []string{"v0", "v1", "v2"}[i] || r.Height != []uint64{1, 5, 9}[i] {
+			t.Fatalf("revision %d is %+v", i, r)
+		}
+	}
+	if revisions[0].Diff != "" || revisions[2].Note != "note v2" {
+		t.Fatalf("revisions %+v", revisions)
+	}
+	diff, err := revisionDiff(revisions[1], revisions[2])
+	if err != nil || revisions[2].Diff != diff || diff == "" {
+		t.Fatalf("diff %q, want %q, %v", revisions[2].Diff, diff, err)
+	}
+
+	var p Proposal
+	if err := c.db.First(&p, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if p.Revision != 2 || p.Title != "v2" || p.Data != "v2 data" {
+		t.Fatalf("proposal %+v, want revision 2", p)
+	}
+	if height, err := c.revisionHeight(p); err != nil || height != 9 {
+		t.Fatalf("revision height %d, %v, want 9", height, err)
+	}
+
+	if _, err := c.getProposalRevisions(2); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("revisions of an unknown proposal: %v", err)
+	}
+}
@@ -0,0 +1,439 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	SearchKindProposal   = "proposal"
+	SearchKindDiscussion = "discussion"
+
+	// markers around the matched terms of a result
+	SearchHighlightStart = "<mark>"
+	SearchHighlightEnd   = "</mark>"
+
+	MaxSearchPageSize = 100
+
+	// tokens of a snippet around the matched terms
+	searchSnippetTokens = 24
+
+	// text search configuration of postgres, the sqlite unicode61 tokenizer
+	// does not stem either
+	postgresSearchConfig = "simple"
+)
+
+// SearchQuery is a full-text search over proposal titles, proposal data and
+// discussion text. Status filters discussions by the status of their
+// proposal, Speaker matches the proposer of a proposal or the speaker of a
+// discussion.
+type SearchQuery struct {
+	Text       string
+	Kinds      []string
+	Status     *uint64
+	Speaker    string
+	FromHeight uint64
+	ToHeight   uint64
+	Page       int
+	PageSize   int
+}
+
+// SearchResult is a proposal or a discussion matching a search. Title and
+// Snippet carry the matched terms between the highlight markers.
+type SearchResult struct {
+	Kind        string  `json:"kind"`
+	Id          uint64  `json:"id"`
+	Proposal    uint64  `json:"proposal"`
+	Title       string  `json:"title"`
+	Snippet     string  `json:"snippet"`
+	Speaker     string  `json:"speaker"`
+	SpeakerName string  `json:"speaker_name"`
+	Status      uint64  `json:"status"`
+	Height      uint64  `json:"height"`
+	Timestamp   int64   `json:"timestamp"`
+	Rank        float64 `json:"rank"`
+}
+
+func (q SearchQuery) hasKind(kind string) bool {
+	if len(q.Kinds) == 0 {
+		return true
+	}
+	for _, k := range q.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// searchFilter collects the conditions shared by both backends.
+type searchFilter struct {
+	conds []string
+	args  []interface{}
+}
+
+func (f *searchFilter) add(cond string, args ...interface{}) {
+	f.conds = append(f.conds, cond)
+	f.args = append(f.args, args...)
+}
+
+func (f *searchFilter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(f.conds, " AND ")
+}
+
+// proposalFilter filters the proposals aliased p.
+func (q SearchQuery) proposalFilter() *searchFilter {
+	f := &searchFilter{}
+	if q.Status != nil {
+		f.add("p.status = ?", *q.Status)
+	}
+	if q.Speaker != "" {
+		f.add("p.proposer_address = ?", q.Speaker)
+	}
+	if q.FromHeight > 0 {
+		f.add("p.new_height >= ?", q.FromHeight)
+	}
+	if q.ToHeight > 0 {
+		f.add("p.new_height <= ?", q.ToHeight)
+	}
+	return f
+}
+
+// discussionFilter filters the discussions aliased d of the proposals
+// aliased p.
+func (q SearchQuery) discussionFilter() *searchFilter {
+	f := &searchFilter{}
+	if q.Status != nil {
+		f.add("p.status = ?", *q.Status)
+	}
+	if q.Speaker != "" {
+		f.add("d.speaker_address = ?", q.Speaker)
+	}
+	if q.FromHeight > 0 {
+		f.add("d.height >= ?", q.FromHeight)
+	}
+	if q.ToHeight > 0 {
+		f.add("d.height <= ?", q.ToHeight)
+	}
+	return f
+}
+
+// searchBackend runs the search of one kind, returning the first limit
+// results by rank and the number of matches.
+type searchBackend interface {
+	searchProposals(db *gorm.DB, q SearchQuery, limit int) ([]SearchResult, uint64, error)
+	searchDiscussions(db *gorm.DB, q SearchQuery, limit int) ([]SearchResult, uint64, error)
+}
+
+// search merges the results of the kinds of q by rank and returns the page
+// of q.
+func search(db *gorm.DB, backend searchBackend, q SearchQuery) ([]SearchResult, uint64, error) {
+	if q.PageSize <= 0 || q.PageSize > MaxSearchPageSize {
+		q.PageSize = MaxSearchPageSize
+	}
+	if q.Page < 0 {
+		q.Page = 0
+	}
+	limit := (q.Page + 1) * q.PageSize
+	results := make([]SearchResult, 0)
+	var total uint64
+	if q.hasKind(SearchKindProposal) {
+		res, n, err := backend.searchProposals(db, q, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, res...)
+		total += n
+	}
+	if q.hasKind(SearchKindDiscussion) {
+		res, n, err := backend.searchDiscussions(db, q, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, res...)
+		total += n
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Height > results[j].Height
+	})
+	from := q.Page * q.PageSize
+	if from >= len(results) {
+		return []SearchResult{}, total, nil
+	}
+	to := from + q.PageSize
+	if to > len(results) {
+		to = len(results)
+	}
+	return results[from:to], total, nil
+}
+
+func countRows(db *gorm.DB, stmt string, args []interface{}) (uint64, error) {
+	var total uint64
+	if err := db.Raw(stmt, args...).Row().Scan(&total); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func scanSearchResults(db *gorm.DB, kind string, stmt string, args []interface{}) ([]SearchResult, error) {
+	rows, err := db.Raw(stmt, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		r := SearchResult{Kind: kind}
+		err := rows.Scan(&r.Id, &r.Proposal, &r.Title, &r.Snippet, &r.Speaker, &r.SpeakerName, &r.Status, &r.Height, &r.Timestamp, &r.Rank)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// sqliteMatch turns free text into an FTS match expression of quoted terms,
+// so the operators of the FTS query syntax are never interpreted.
+func sqliteMatch(text string) string {
+	terms := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, t := range terms {
+		terms[i] = `"` + t + `"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// sqliteSearch searches the FTS5 tables, or the FTS4 tables of a sqlite
+// built without FTS5. FTS4 has no ranking, its results are ordered by height.
+type sqliteSearch struct {
+	fts5 bool
+}
+
+func (s sqliteSearch) searchProposals(db *gorm.DB, q SearchQuery, limit int) ([]SearchResult, uint64, error) {
+	match := sqliteMatch(q.Text)
+	if match == "" {
+		return nil, 0, nil
+	}
+	f := q.proposalFilter()
+	from := fmt.Sprintf(" FROM proposals_fts JOIN proposals p ON p.id = proposals_fts.rowid WHERE proposals_fts MATCH ?%s", f.where())
+	args := append([]interface{}{match}, f.args...)
+	total, err := countRows(db, "SELECT count(*)"+from, args)
+	if err != nil || total == 0 {
+		return nil, total, err
+	}
+	var title, snippet, rank, order string
+	if s.fts5 {
+		title = fmt.Sprintf("highlight(proposals_fts, 0, '%s', '%s')", SearchHighlightStart, SearchHighlightEnd)
+		snippet = fmt.Sprintf("snippet(proposals_fts, 1, '%s', '%s', '...', %d)", SearchHighlightStart, SearchHighlightEnd, searchSnippetTokens)
+		rank = "-bm25(proposals_fts)"
+		order = "ORDER BY bm25(proposals_fts), p.new_height DESC"
+	} else {
+		// FTS4 has no highlight, a snippet of the whole title does the same
+		title = fmt.Sprintf("snippet(proposals_fts, '%s', '%s', '', 0, 64)", SearchHighlightStart, SearchHighlightEnd)
+		snippet = fmt.Sprintf("snippet(proposals_fts, '%s', '%s', '...', 1, %d)", SearchHighlightStart, SearchHighlightEnd, searchSnippetTokens)
+		rank = "0"
+		order = "ORDER BY p.new_height DESC"
+	}
+	stmt := fmt.Sprintf("SELECT p.id, p.id, %s, %s, p.proposer_address, p.proposer_name, p.status, p.new_height, p.create_timestamp, %s%s %s LIMIT ?",
+		title, snippet, rank, from, order)
+	res, err := scanSearchResults(db, SearchKindProposal, stmt, append(args, limit))
+	return res, total, err
+}
+
+func (s sqliteSearch) searchDiscussions(db *gorm.DB, q SearchQuery, limit int) ([]SearchResult, uint64, error) {
+	match := sqliteMatch(q.Text)
+	if match == "" {
+		return nil, 0, nil
+	}
+	f := q.discussionFilter()
+	from := fmt.Sprintf(" FROM discussions_fts JOIN discussions d ON d.id = discussions_fts.rowid LEFT JOIN proposals p ON p.id = d.proposal WHERE discussions_fts MATCH ?%s", f.where())
+	args := append([]interface{}{match}, f.args...)
+	total, err := countRows(db, "SELECT count(*)"+from, args)
+	if err != nil || total == 0 {
+		return nil, total, err
+	}
+	var snippet, rank, order string
+	if s.fts5 {
+		snippet = fmt.Sprintf("snippet(discussions_fts, 0, '%s', '%s', '...', %d)", SearchHighlightStart, SearchHighlightEnd, searchSnippetTokens)
+		rank = "-bm25(discussions_fts)"
+		order = "ORDER BY bm25(discussions_fts), d.height DESC"
+	} else {
+		snippet = fmt.Sprintf("snippet(discussions_fts, '%s', '%s', '...', 0, %d)", SearchHighlightStart, SearchHighlightEnd, searchSnippetTokens)
+		rank = "0"
+		order = "ORDER BY d.height DESC"
+	}
+	stmt := fmt.Sprintf("SELECT d.id, d.proposal, coalesce(p.title, ''), %s, d.speaker_address, d.speaker_name, coalesce(p.status, 0), d.height, d.create_timestamp, %s%s %s LIMIT ?",
+		snippet, rank, from, order)
+	res, err := scanSearchResults(db, SearchKindDiscussion, stmt, append(args, limit))
+	return res, total, err
+}
+
+// postgresSearch searches the generated tsvector columns.
+type postgresSearch struct{}
+
+func (postgresSearch) headline(column string, fragments bool) string {
+	opts := fmt.Sprintf("StartSel=%s, StopSel=%s", SearchHighlightStart, SearchHighlightEnd)
+	if fragments {
+		opts += fmt.Sprintf(", MaxFragments=2, MaxWords=%d, MinWords=8, FragmentDelimiter=...", searchSnippetTokens)
+	} else {
+		opts += ", HighlightAll=true"
+	}
+	return fmt.Sprintf("ts_headline('%s', %s, q, '%s')", postgresSearchConfig, column, opts)
+}
+
+func (s postgresSearch) searchProposals(db *gorm.DB, q SearchQuery, limit int) ([]SearchResult, uint64, error) {
+	f := q.proposalFilter()
+	from := fmt.Sprintf(" FROM proposals p, websearch_to_tsquery('%s', ?) q WHERE p.search_vector @@ q%s", postgresSearchConfig, f.where())
+	args := append([]interface{}{q.Text}, f.args...)
+	total, err := countRows(db, "SELECT count(*)"+from, args)
+	if err != nil || total == 0 {
+		return nil, total, err
+	}
+	stmt := fmt.Sprintf("SELECT p.id, p.id, %s, %s, p.proposer_address, p.proposer_name, p.status, p.new_height, p.create_timestamp, ts_rank(p.search_vector, q)%s ORDER BY ts_rank(p.search_vector, q) DESC, p.new_height DESC LIMIT ?",
+		s.headline("p.title", false), s.headline("p.data", true), from)
+	res, err := scanSearchResults(db, SearchKindProposal, stmt, append(args, limit))
+	return res, total, err
+}
+
+func (s postgresSearch) searchDiscussions(db *gorm.DB, q SearchQuery, limit int) ([]SearchResult, uint64, error) {
+	f := q.discussionFilter()
+	from := fmt.Sprintf(" FROM discussions d LEFT JOIN proposals p ON p.id = d.proposal, websearch_to_tsquery('%s', ?) q WHERE d.search_vector @@ q%s", postgresSearchConfig, f.where())
+	args := append([]interface{}{q.Text}, f.args...)
+	total, err := countRows(db, "SELECT count(*)"+from, args)
+	if err != nil || total == 0 {
+		return nil, total, err
+	}
+	stmt := fmt.Sprintf("SELECT d.id, d.proposal, coalesce(p.title, ''), %s, d.speaker_address, d.speaker_name, coalesce(p.status, 0), d.height, d.create_timestamp, ts_rank(d.search_vector, q)%s ORDER BY ts_rank(d.search_vector, q) DESC, d.height DESC LIMIT ?",
+		s.headline("d.data", true), from)
+	res, err := scanSearchResults(db, SearchKindDiscussion, stmt, append(args, limit))
+	return res, total, err
+}
+
+// sqliteFTS5Table reports whether the virtual table was created with FTS5.
+func sqliteFTS5Table(db *gorm.DB, table string) (bool, error) {
+	var stmt string
+	err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Row().Scan(&stmt)
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(strings.ToLower(stmt), "using fts5"), nil
+}
+
+// sqliteFTS5 reports whether the linked sqlite was built with FTS5, see the
+// sqlite_fts5 build tag of go-sqlite3.
+func sqliteFTS5(db *gorm.DB) (bool, error) {
+	var used bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Row().Scan(&used); err != nil {
+		return false, err
+	}
+	return used, nil
+}
+
+// ftsTable is an external content FTS table over the text columns of a
+// model table.
+type ftsTable struct {
+	table   string
+	columns []string
+}
+
+var searchTables = []ftsTable{
+	{table: "proposals", columns: []string{"title", "data"}},
+	{table: "discussions", columns: []string{"data"}},
+}
+
+// createSearchIndexes creates the FTS tables kept in sync by triggers on
+// sqlite, and generated tsvector columns with GIN indexes on postgres. The
+// sqlite tables are rebuilt from scratch, so applying it again after a Reset
+// is safe.
+func createSearchIndexes(tx *gorm.DB) error {
+	switch tx.Dialect().GetName() {
+	case IndexerDriverPostgres:
+		for _, t := range searchTables {
+			parts := make([]string, len(t.columns))
+			for i, c := range t.columns {
+				parts[i] = fmt.Sprintf("coalesce(%s, '')", c)
+			}
+			stmts := []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (to_tsvector('%s', %s)) STORED",
+					t.table, postgresSearchConfig, strings.Join(parts, " || ' ' || ")),
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_search_vector ON %s USING GIN (search_vector)", t.table, t.table),
+			}
+			for _, stmt := range stmts {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case IndexerDriverSqlite:
+		fts5, err := sqliteFTS5(tx)
+		if err != nil {
+			return err
+		}
+		for _, t := range searchTables {
+			if err := createSqliteFTS(tx, t, fts5); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("full-text search not supported on %s", tx.Dialect().GetName())
+	}
+}
+
+func createSqliteFTS(tx *gorm.DB, t ftsTable, fts5 bool) error {
+	fts := t.table + "_fts"
+	cols := strings.Join(t.columns, ", ")
+	newCols := "new." + strings.Join(t.columns, ", new.")
+	oldCols := "old." + strings.Join(t.columns, ", old.")
+
+	var create string
+	var triggers []string
+	if fts5 {
+		create = fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s, content='%s', content_rowid='id')", fts, cols, t.table)
+		insert := fmt.Sprintf("INSERT INTO %s(rowid, %s) VALUES (new.id, %s);", fts, cols, newCols)
+		remove := fmt.Sprintf("INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.id, %s);", fts, fts, cols, oldCols)
+		triggers = []string{
+			fmt.Sprintf("CREATE TRIGGER %s_ai AFTER INSERT ON %s BEGIN %s END", fts, t.table, insert),
+			fmt.Sprintf("CREATE TRIGGER %s_ad AFTER DELETE ON %s BEGIN %s END", fts, t.table, remove),
+			fmt.Sprintf("CREATE TRIGGER %s_au AFTER UPDATE OF %s ON %s BEGIN %s %s END", fts, cols, t.table, remove, insert),
+		}
+	} else {
+		// FTS4 reads the old text from the content table, so rows leave the
+		// index before they change
+		create = fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts4(%s, content='%s')", fts, cols, t.table)
+		insert := fmt.Sprintf("INSERT INTO %s(docid, %s) VALUES (new.id, %s);", fts, cols, newCols)
+		remove := fmt.Sprintf("DELETE FROM %s WHERE docid = old.id;", fts)
+		triggers = []string{
+			fmt.Sprintf("CREATE TRIGGER %s_ai AFTER INSERT ON %s BEGIN %s END", fts, t.table, insert),
+			fmt.Sprintf("CREATE TRIGGER %s_bd BEFORE DELETE ON %s BEGIN %s END", fts, t.table, remove),
+			fmt.Sprintf("CREATE TRIGGER %s_bu BEFORE UPDATE OF %s ON %s BEGIN %s END", fts, cols, t.table, remove),
+			fmt.Sprintf("CREATE TRIGGER %s_au AFTER UPDATE OF %s ON %s BEGIN %s END", fts, cols, t.table, insert),
+		}
+	}
+	stmts := make([]string, 0)
+	for _, name := range []string{"ai", "ad", "au", "bd", "bu"} {
+		stmts = append(stmts, fmt.Sprintf("DROP TRIGGER IF EXISTS %s_%s", fts, name))
+	}
+	stmts = append(stmts, fmt.Sprintf("DROP TABLE IF EXISTS %s", fts), create)
+	stmts = append(stmts, triggers...)
+	stmts = append(stmts, fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", fts, fts))
+	for _, stmt := range stmts {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSqliteMatch(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want string
+	}{
+		{"treasury grant", `"treasury" "grant"`},
+		{`"quoted" OR NOT title:x*`, `"quoted" "OR" "NOT" "title" "x"`},
+		{"  --  ", ""},
+		{"über 2024", `"über" "2024"`},
+	} {
+		if got := sqliteMatch(tc.text); got != tc.want {
+			t.Errorf("sqliteMatch(%q) = %s, want %s", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	is := openTestStore(t)
+	db := is.DB()
+	rows := []interface{}{
+		&Proposal{Id: 1, Title: "Fund the treasury", Data: "move funds to the community treasury", ProposerAddress: "A1", Status: 1, NewHeight: 10},
+		&Proposal{Id: 2, Title: "Raise the block size", Data: "bigger blocks", ProposerAddress: "A2", Status: 2, NewHeight: 20},
+		&Discussion{Id: 1, Proposal: 1, Data: "the treasury is empty", SpeakerAddress: "A2", Height: 11},
+		&Discussion{Id: 2, Proposal: 2, Data: "blocks of this size hurt the treasury", SpeakerAddress: "A1", Height: 21},
+	}
+	for _, row := range rows {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	status := uint64(2)
+	for _, tc := range []struct {
+		name  string
+		q     SearchQuery
+		want  []string // any results of the page if nil
+		size  int
+		total uint64
+	}{
+		{"all kinds", SearchQuery{Text: "treasury"}, []string{"proposal 1", "discussion 1", "discussion 2"}, 3, 3},
+		{"proposals only", SearchQuery{Text: "treasury", Kinds: []string{SearchKindProposal}}, []string{"proposal 1"}, 1, 1},
+		{"status of the proposal", SearchQuery{Text: "treasury", Status: &status}, []string{"discussion 2"}, 1, 1},
+		{"speaker", SearchQuery{Text: "treasury", Speaker: "A2"}, []string{"discussion 1"}, 1, 1},
+		{"height range", SearchQuery{Text: "treasury", FromHeight: 11, ToHeight: 20}, []string{"discussion 1"}, 1, 1},
+		{"query syntax is literal", SearchQuery{Text: `treasury" OR "size`}, []string{}, 0, 0},
+		{"no terms", SearchQuery{Text: "--"}, []string{}, 0, 0},
+		{"second page", SearchQuery{Text: "treasury", Page: 1, PageSize: 2}, nil, 1, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, total, err := is.Search(tc.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tc.total {
+				t.Fatalf("total %d, want %d", total, tc.total)
+			}
+			if len(res) != tc.size {
+				t.Fatalf("%d results %+v, want %d", len(res), res, tc.size)
+			}
+			got := make(map[string]bool)
+			for _, r := range res {
+				got[fmt.Sprintf("%s %d", r.Kind, r.Id)] = true
+			}
+			for _, w := range tc.want {
+				if !got[w] {
+					t.Fatalf("results %+v, want %v", res, tc.want)
+				}
+			}
+		})
+	}
+
+	// matched terms are highlighted
+	res, _, err := is.Search(SearchQuery{Text: "treasury", Kinds: []string{SearchKindProposal}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mark := SearchHighlightStart + "treasury" + SearchHighlightEnd; !strings.Contains(res[0].Title, mark) || !strings.Contains(res[0].Snippet, mark) {
+		t.Fatalf("title %q snippet %q not highlighted", res[0].Title, res[0].Snippet)
+	}
+
+	// the search tables follow updates and deletes
+	if err := db.Model(&Proposal{}).Where("id = ?", 2).Update("title", "Shrink the blocks").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, total, err := is.Search(SearchQuery{Text: "raise"}); err != nil || total != 0 {
+		t.Fatalf("%d results for the old title, %v", total, err)
+	}
+	if _, total, err := is.Search(SearchQuery{Text: "shrink"}); err != nil || total != 1 {
+		t.Fatalf("%d results for the new title, %v", total, err)
+	}
+	if err := db.Delete(&Discussion{}, "id = ?", 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, total, err := is.Search(SearchQuery{Text: "empty"}); err != nil || total != 0 {
+		t.Fatalf("%d results for a deleted discussion, %v", total, err)
+	}
+}
@@ -0,0 +1,368 @@
+package agent
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/calehh/hac-app/crypto"
+	"github.com/calehh/hac-app/state"
+	"github.com/calehh/hac-app/tx"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/cometbft/cometbft/mempool"
+	rpcclient "github.com/cometbft/cometbft/rpc/client"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+const (
+	txSenderSubscriber = "hac-tx-sender"
+
+	// number of blocks a broadcast tx may stay unconfirmed before the
+	// sender checks whether it has been dropped
+	SenderResubmitBlocks = 3
+	// number of times a tx is rebroadcast or re-signed before giving up
+	SenderMaxAttempts = 5
+)
+
+var (
+	ErrSenderNotStarted = errors.New("tx sender not started")
+	ErrSenderNoAccount  = errors.New("tx sender account not found")
+	ErrSenderTxPending  = errors.New("a tx of this type is pending")
+)
+
+// PendingTx is an automated action waiting to be confirmed on chain.
+type PendingTx struct {
+	Type     tx.HACTxType
+	Tx       any
+	Nonce    uint64
+	Hash     string
+	Height   int64
+	Attempts int
+}
+
+// TxSender is the single path through which the node submits its own
+// transactions. It keeps a local pending nonce so several actions can be in
+// flight, follows confirmations through the event bus and rebroadcasts or
+// re-signs transactions that were dropped.
+type TxSender struct {
+	logger       cmtlog.Logger
+	cli          rpcclient.Client
+	chainId      string
+	pv           *crypto.PV
+	localAddress string
+
+	mtx      sync.Mutex
+	started  bool
+	index    uint64
+	nonce    uint64
+	height   int64
+	queue    []*PendingTx
+	inflight []*PendingTx
+}
+
+func NewTxSender(logger cmtlog.Logger, cli rpcclient.Client, chainId string, pv *crypto.PV) *TxSender {
+	return &TxSender{
+		logger:       logger.With("module", "sender"),
+		cli:          cli,
+		chainId:      chainId,
+		pv:           pv,
+		localAddress: pv.Address(),
+		queue:        make([]*PendingTx, 0),
+		inflight:     make([]*PendingTx, 0),
+	}
+}
+
+// Start subscribes to new blocks and committed txs and drives the queue
+// until ctx is done.
+func (s *TxSender) Start(ctx context.Context) error {
+	blocks, err := s.cli.Subscribe(ctx, txSenderSubscriber, cmttypes.EventQueryNewBlock.String(), 16)
+	if err != nil {
+		return err
+	}
+	txs, err := s.cli.Subscribe(ctx, txSenderSubscriber, cmttypes.EventQueryTx.String(), 256)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	s.started = true
+	s.mtx.Unlock()
+
+	go func() {
+		defer func() {
+			if err := s.cli.UnsubscribeAll(context.Background(), txSenderSubscriber); err != nil {
+				s.logger.Error("unsubscribe fail", "err", err)
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-txs:
+				if !ok {
+					return
+				}
+				if data, ok := ev.Data.(cmttypes.EventDataTx); ok {
+					s.confirm(data)
+				}
+			case ev, ok := <-blocks:
+				if !ok {
+					return
+				}
+				if data, ok := ev.Data.(cmttypes.EventDataNewBlock); ok {
+					s.onBlock(ctx, data.Block.Height)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Submit queues a tx of the given type. It is signed and broadcast on the
+// next block with the next free nonce of the node account.
+func (s *TxSender) Submit(txType tx.HACTxType, body any) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.started {
+		return ErrSenderNotStarted
+	}
+	s.queue = append(s.queue, &PendingTx{Type: txType, Tx: body})
+	return nil
+}
+
+// SubmitIfIdle queues a tx unless one of the same type is queued or
+// unconfirmed.
+func (s *TxSender) SubmitIfIdle(txType tx.HACTxType, body any) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.started {
+		return ErrSenderNotStarted
+	}
+	for _, ptxs := range [][]*PendingTx{s.queue, s.inflight} {
+		for _, p := range ptxs {
+			if p.Type == txType {
+				return ErrSenderTxPending
+			}
+		}
+	}
+	s.queue = append(s.queue, &PendingTx{Type: txType, Tx: body})
+	return nil
+}
+
+// IsPending reports whether a queued or unconfirmed tx of the given type
+// matches.
+func (s *TxSender) IsPending(txType tx.HACTxType, match func(body any) bool) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, ptxs := range [][]*PendingTx{s.queue, s.inflight} {
+		for _, p := range ptxs {
+			if p.Type == txType && (match == nil || match(p.Tx)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PendingCount returns the number of queued and unconfirmed txs.
+func (s *TxSender) PendingCount() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.queue) + len(s.inflight)
+}
+
+func (s *TxSender) confirm(data cmttypes.EventDataTx) {
+	hash := strings.ToUpper(hex.EncodeToString(cmttypes.Tx(data.Tx).Hash()))
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for i, p := range s.inflight {
+		if p.Hash == hash {
+			s.logger.Info("tx confirmed", "type", p.Type, "nonce", p.Nonce, "height", data.Height, "code", data.Result.Code)
+			s.inflight = append(s.inflight[:i], s.inflight[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *TxSender) onBlock(ctx context.Context, height int64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.height = height
+
+	chainNonce, err := s.syncAccount(ctx)
+	if err != nil {
+		s.logger.Error("sync account fail", "err", err)
+		return
+	}
+
+	// txs whose nonce is consumed without a confirmation were replaced by a
+	// tx signed elsewhere with the same key, txs that stay unconfirmed for
+	// too long were dropped from the mempool
+	inflight := make([]*PendingTx, 0, len(s.inflight))
+	resign := make([]*PendingTx, 0)
+	rebroadcast := make([]*PendingTx, 0)
+	// set when a tx is given up before its nonce was consumed
+	gap := false
+	for _, p := range s.inflight {
+		switch {
+		case p.Nonce < chainNonce:
+			// the Tx event may still be on its way, look the tx up before
+			// deciding it was replaced
+			if _, err := s.cli.Tx(ctx, mustDecodeHex(p.Hash), false); err == nil {
+				s.logger.Info("tx confirmed", "type", p.Type, "nonce", p.Nonce)
+				continue
+			}
+			if height-p.Height < SenderResubmitBlocks {
+				inflight = append(inflight, p)
+				continue
+			}
+			if p.Attempts >= SenderMaxAttempts {
+				// its nonce is consumed, giving up leaves no gap
+				s.logger.Error("tx dropped, give up", "type", p.Type, "nonce", p.Nonce)
+				continue
+			}
+			resign = append(resign, p)
+		case height-p.Height >= SenderResubmitBlocks:
+			if p.Attempts >= SenderMaxAttempts {
+				s.logger.Error("tx dropped, give up", "type", p.Type, "nonce", p.Nonce)
+				gap = true
+				continue
+			}
+			rebroadcast = append(rebroadcast, p)
+			inflight = append(inflight, p)
+		default:
+			inflight = append(inflight, p)
+		}
+	}
+
+	if gap {
+		// the nonce of a tx given up is never consumed, the txs signed
+		// above it can never execute and are re-signed in order from the
+		// chain nonce instead of being rebroadcast. inflight holds neither
+		// the txs given up nor the ones in resign, so none is signed twice.
+		kept := make([]*PendingTx, 0, len(inflight))
+		for _, p := range inflight {
+			if p.Nonce >= chainNonce {
+				resign = append(resign, p)
+			} else {
+				kept = append(kept, p)
+			}
+		}
+		inflight = kept
+		sort.SliceStable(resign, func(i, j int) bool { return resign[i].Nonce < resign[j].Nonce })
+	} else {
+		for _, p := range rebroadcast {
+			s.logger.Info("tx not confirmed, rebroadcast", "type", p.Type, "nonce", p.Nonce, "attempts", p.Attempts)
+			// its nonce stays free, a failed rebroadcast is retried with the
+			// same nonce until the tx is given up
+			if err := s.broadcast(ctx, p); err != nil {
+				s.logger.Error("rebroadcast fail", "type", p.Type, "err", err)
+			}
+		}
+	}
+	s.inflight = inflight
+
+	if len(resign) > 0 || gap {
+		// re-signed txs take the nonces above everything still in flight
+		s.nonce = chainNonce
+		for _, p := range s.inflight {
+			if p.Nonce >= s.nonce {
+				s.nonce = p.Nonce + 1
+			}
+		}
+		for _, p := range resign {
+			s.send(ctx, p)
+		}
+	}
+
+	queue := s.queue
+	s.queue = make([]*PendingTx, 0)
+	for _, p := range queue {
+		s.send(ctx, p)
+	}
+}
+
+// syncAccount loads the node account and moves the pending nonce forward
+// if the chain is ahead of it.
+func (s *TxSender) syncAccount(ctx context.Context) (uint64, error) {
+	addr, err := hex.DecodeString(s.localAddress)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.cli.ABCIQuery(ctx, "/accounts/", addr)
+	if err != nil {
+		return 0, err
+	}
+	if res.Response.Code != 0 {
+		return 0, ErrSenderNoAccount
+	}
+	var act state.Account
+	if err := act.UnmarshalJSON(res.Response.Value); err != nil {
+		return 0, err
+	}
+	s.index = act.Index
+	if act.Nonce > s.nonce {
+		s.nonce = act.Nonce
+	}
+	return act.Nonce, nil
+}
+
+func (s *TxSender) send(ctx context.Context, p *PendingTx) {
+	p.Nonce = s.nonce
+	if err := s.broadcast(ctx, p); err != nil {
+		s.logger.Error("broadcast tx fail", "type", p.Type, "nonce", p.Nonce, "err", err)
+		if p.Attempts < SenderMaxAttempts {
+			s.queue = append(s.queue, p)
+		}
+		return
+	}
+	s.nonce++
+	s.inflight = append(s.inflight, p)
+}
+
+func (s *TxSender) broadcast(ctx context.Context, p *PendingTx) error {
+	p.Attempts++
+	btx := tx.HACTx{
+		Version:   tx.HACTxVersion1,
+		Type:      p.Type,
+		Nonce:     p.Nonce,
+		Validator: s.index,
+		Tx:        p.Tx,
+	}
+	dat, err := btx.SigData([]byte(s.chainId))
+	if err != nil {
+		return err
+	}
+	sig, err := s.pv.Sign(dat)
+	if err != nil {
+		return err
+	}
+	btx.Sig = [][]byte{sig}
+	dat, err = json.Marshal(btx)
+	if err != nil {
+		return err
+	}
+	p.Hash = strings.ToUpper(hex.EncodeToString(cmttypes.Tx(dat).Hash()))
+	p.Height = s.height
+	res, err := s.cli.BroadcastTxSync(ctx, dat)
+	if err != nil {
+		// the mempool still holds the same bytes
+		if errors.Is(err, mempool.ErrTxInCache) || strings.Contains(err.Error(), mempool.ErrTxInCache.Error()) {
+			return nil
+		}
+		return err
+	}
+	if res.Code != 0 {
+		return errors.New(res.Log)
+	}
+	s.logger.Info("tx broadcast", "type", p.Type, "nonce", p.Nonce, "hash", p.Hash)
+	return nil
+}
+
+func mustDecodeHex(s string) []byte {
+	dat, _ := hex.DecodeString(s)
+	return dat
+}
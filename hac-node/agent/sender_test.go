@@ -0,0 +1,255 @@
+package agent
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/calehh/hac-app/crypto"
+	"github.com/calehh/hac-app/state"
+	"github.com/calehh/hac-app/tx"
+	"github.com/cometbft/cometbft/libs/bytes"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/cometbft/cometbft/privval"
+	rpcclient "github.com/cometbft/cometbft/rpc/client"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+// fakeChain is the part of the node the sender talks to. Txs are only
+// committed when a test says so.
+type fakeChain struct {
+	rpcclient.Client
+	nonce     uint64
+	committed map[string]bool
+	// broadcasts of the proposals in fail are refused
+	fail map[uint64]bool
+	// txs accepted by the mempool
+	sent int
+}
+
+func newFakeChain() *fakeChain {
+	return &fakeChain{committed: make(map[string]bool), fail: make(map[uint64]bool)}
+}
+
+func (c *fakeChain) ABCIQuery(ctx context.Context, path string, data bytes.HexBytes) (*ctypes.ResultABCIQuery, error) {
+	act := state.Account{Index: 65536, Nonce: c.nonce}
+	res := &ctypes.ResultABCIQuery{}
+	res.Response.Value, _ = act.MarshalJSON()
+	return res, nil
+}
+
+func (c *fakeChain) Tx(ctx context.Context, hash []byte, prove bool) (*ctypes.ResultTx, error) {
+	if c.committed[strings.ToUpper(hex.EncodeToString(hash))] {
+		return &ctypes.ResultTx{}, nil
+	}
+	return nil, errors.New("tx not found")
+}
+
+func (c *fakeChain) BroadcastTxSync(ctx context.Context, dat cmttypes.Tx) (*ctypes.ResultBroadcastTx, error) {
+	var btx struct {
+		Tx tx.DiscussionTx
+	}
+	if err := json.Unmarshal(dat, &btx); err != nil {
+		return nil, err
+	}
+	if c.fail[btx.Tx.Proposal] {
+		return nil, errors.New("mempool is full")
+	}
+	c.sent++
+	return &ctypes.ResultBroadcastTx{}, nil
+}
+
+// commit executes the in-flight tx of proposal.
+func (c *fakeChain) commit(t *testing.T, s *TxSender, proposal uint64) {
+	t.Helper()
+	p := inflightOf(t, s, proposal)
+	if p.Nonce != c.nonce {
+		t.Fatalf("tx of proposal %d has nonce %d, chain is at %d", proposal, p.Nonce, c.nonce)
+	}
+	c.committed[p.Hash] = true
+	c.nonce++
+}
+
+func newTestSender(t *testing.T, chain *fakeChain) *TxSender {
+	t.Helper()
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.json")
+	privval.GenFilePV(keyFile, filepath.Join(dir, "state.json")).Save()
+	s := NewTxSender(cmtlog.NewNopLogger(), chain, "test-chain", crypto.LoadFilePV(keyFile))
+	s.started = true
+	return s
+}
+
+func submit(t *testing.T, s *TxSender, proposals ...uint64) {
+	t.Helper()
+	for _, proposal := range proposals {
+		if err := s.Submit(tx.HACTxTypeDiscussion, &tx.DiscussionTx{Proposal: proposal}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func inflightOf(t *testing.T, s *TxSender, proposal uint64) *PendingTx {
+	t.Helper()
+	for _, p := range s.inflight {
+		if p.Tx.(*tx.DiscussionTx).Proposal == proposal {
+			return p
+		}
+	}
+	t.Fatalf("no tx of proposal %d in flight", proposal)
+	return nil
+}
+
+// inflightNonces returns the nonce of every tx in flight by proposal, failing
+// if a tx is in flight twice or two txs share a nonce.
+func inflightNonces(t *testing.T, s *TxSender) map[uint64]uint64 {
+	t.Helper()
+	nonces := make(map[uint64]uint64)
+	used := make(map[uint64]bool)
+	for _, p := range s.inflight {
+		proposal := p.Tx.(*tx.DiscussionTx).Proposal
+		if _, ok := nonces[proposal]; ok {
+			t.Fatalf("tx of proposal %d is in flight twice", proposal)
+		}
+		if used[p.Nonce] {
+			t.Fatalf("nonce %d is signed twice", p.Nonce)
+		}
+		nonces[proposal] = p.Nonce
+		used[p.Nonce] = true
+	}
+	return nonces
+}
+
+func TestTxSenderOnBlock(t *testing.T) {
+	cases := []struct {
+		name string
+		run  func(t *testing.T, chain *fakeChain, s *TxSender) int64
+		// nonce of every tx still in flight by proposal
+		want map[uint64]uint64
+		// txs broadcast at the last block
+		sent int
+	}{
+		{
+			name: "confirmed txs leave",
+			run: func(t *testing.T, chain *fakeChain, s *TxSender) int64 {
+				submit(t, s, 1, 2)
+				s.onBlock(context.Background(), 1)
+				chain.commit(t, s, 1)
+				chain.commit(t, s, 2)
+				return 2
+			},
+			want: map[uint64]uint64{},
+		},
+		{
+			name: "unconfirmed txs are rebroadcast with their nonce",
+			run: func(t *testing.T, chain *fakeChain, s *TxSender) int64 {
+				submit(t, s, 1, 2)
+				s.onBlock(context.Background(), 1)
+				return 1 + SenderResubmitBlocks
+			},
+			want: map[uint64]uint64{1: 0, 2: 1},
+			sent: 2,
+		},
+		{
+			name: "nonce taken elsewhere is re-signed above the txs in flight",
+			run: func(t *testing.T, chain *fakeChain, s *TxSender) int64 {
+				submit(t, s, 1, 2)
+				s.onBlock(context.Background(), 1)
+				// a tx signed with the same key took nonce 0
+				chain.nonce = 1
+				return 1 + SenderResubmitBlocks
+			},
+			want: map[uint64]uint64{1: 2, 2: 1},
+			sent: 2,
+		},
+		{
+			name: "a failed rebroadcast keeps its nonce",
+			run: func(t *testing.T, chain *fakeChain, s *TxSender) int64 {
+				submit(t, s, 1, 2, 3)
+				s.onBlock(context.Background(), 1)
+				chain.fail[1] = true
+				s.onBlock(context.Background(), 1+SenderResubmitBlocks)
+				chain.fail[1] = false
+				return 1 + 2*SenderResubmitBlocks
+			},
+			want: map[uint64]uint64{1: 0, 2: 1, 3: 2},
+			sent: 3,
+		},
+		{
+			name: "txs above a given up tx are re-signed from its nonce",
+			run: func(t *testing.T, chain *fakeChain, s *TxSender) int64 {
+				submit(t, s, 1, 2, 3)
+				s.onBlock(context.Background(), 1)
+				inflightOf(t, s, 1).Attempts = SenderMaxAttempts
+				return 1 + SenderResubmitBlocks
+			},
+			// re-signed once each, not rebroadcast under their old nonces
+			want: map[uint64]uint64{2: 0, 3: 1},
+			sent: 2,
+		},
+		{
+			name: "a given up tx stays given up",
+			run: func(t *testing.T, chain *fakeChain, s *TxSender) int64 {
+				submit(t, s, 1, 2, 3)
+				s.onBlock(context.Background(), 1)
+				inflightOf(t, s, 1).Attempts = SenderMaxAttempts
+				s.onBlock(context.Background(), 1+SenderResubmitBlocks)
+				chain.commit(t, s, 2)
+				submit(t, s, 5)
+				s.onBlock(context.Background(), 2+SenderResubmitBlocks)
+				// a later gap re-signs the txs in flight only
+				inflightOf(t, s, 3).Attempts = SenderMaxAttempts
+				return 2 + 2*SenderResubmitBlocks
+			},
+			want: map[uint64]uint64{5: 1},
+			sent: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			chain := newFakeChain()
+			s := newTestSender(t, chain)
+			height := c.run(t, chain, s)
+			inflightNonces(t, s)
+			sent := chain.sent
+			s.onBlock(context.Background(), height)
+			if got := chain.sent - sent; got != c.sent {
+				t.Fatalf("%d txs broadcast, want %d", got, c.sent)
+			}
+			got := inflightNonces(t, s)
+			if len(got) != len(c.want) {
+				t.Fatalf("in flight %v, want %v", got, c.want)
+			}
+			for proposal, nonce := range c.want {
+				if n, ok := got[proposal]; !ok || n != nonce {
+					t.Fatalf("in flight %v, want %v", got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTxSenderSubmitIfIdle(t *testing.T) {
+	chain := newFakeChain()
+	s := newTestSender(t, chain)
+	proposal := &tx.ProposalTx{Title: "t"}
+	if err := s.SubmitIfIdle(tx.HACTxTypeProposal, proposal); err != nil {
+		t.Fatal(err)
+	}
+	submit(t, s, 1)
+	if err := s.SubmitIfIdle(tx.HACTxTypeProposal, proposal); !errors.Is(err, ErrSenderTxPending) {
+		t.Fatalf("error %v, want %v", err, ErrSenderTxPending)
+	}
+	// a pending proposal does not block other types
+	if err := s.SubmitIfIdle(tx.HACTxTypeSettleProposal, &tx.SettleProposalTx{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.PendingCount(); n != 3 {
+		t.Fatalf("%d txs pending, want 3", n)
+	}
+}
@@ -1,12 +1,25 @@
 package agent
 
 import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/calehh/hac-app/blob"
+	app_config "github.com/calehh/hac-app/config"
 	"github.com/calehh/hac-app/tx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/jinzhu/gorm"
 )
 
 type Service struct {
@@ -29,9 +42,49 @@ func NewService(ListenAddr string, indexer *ChainIndexer) *Service {
 	g.POST("/agents", s.handleGetAgents)
 	g.POST("/agent-detail", s.handleGetAgentDetail)
 	g.POST("/proposal-detail", s.handleGetProposalDetail)
+	g.POST("/proposal-revisions", s.handleGetProposalRevisions)
 	g.GET("/manifesto", s.handleGetManifesto)
 	g.GET("/network-status", s.handleGetNetworkStatus)
 	g.GET("/latest-blocks", s.handleGetLatestBlocks)
+	g.GET("/settle-policy", s.handleGetSettlePolicy)
+	g.POST("/voter-votes", s.handleGetVoterVotes)
+	g.POST("/vote-tallies", s.handleGetVoteTallies)
+	g.POST("/validator-set", s.handleGetValidatorSet)
+	g.POST("/membership", s.handleGetMembership)
+	g.POST("/search", s.handleSearch)
+	g.GET("/analytics/participation", s.handleGetParticipation)
+	g.GET("/analytics/agreement", s.handleGetAgreement)
+	g.GET("/analytics/influence", s.handleGetInfluence)
+	g.POST("/analytics/speakers", s.handleGetSpeakerShares)
+	g.GET("/analytics/discussion-consensus", s.handleGetDiscussionConsensus)
+	g.GET("/blocks", s.handleGetBlocks)
+	g.GET("/blocks/:height", s.handleGetBlock)
+	g.GET("/accounts/:address/txs", s.handleGetAccountTxs)
+	g.GET("/stream", s.handleStream)
+	g.POST("/outbox", s.handleGetOutbox)
+	g.POST("/participants", s.handleGetParticipants)
+	g.POST("/blobs", s.bearerAuth(indexer.appConfig.App.Blobs.UploadToken, "upload token"), s.handlePutBlob)
+	g.GET("/blobs/:hash", s.handleGetBlob)
+	if indexer.appConfig.App.Webhooks.Enabled {
+		w := g.Group("/webhooks", s.bearerAuth(indexer.appConfig.App.Webhooks.AdminToken, "admin token"))
+		w.POST("", s.handleCreateWebhook)
+		w.GET("", s.handleGetWebhooks)
+		w.POST("/:id", s.handleUpdateWebhook)
+		w.DELETE("/:id", s.handleDeleteWebhook)
+		w.POST("/:id/deliveries", s.handleGetWebhookDeliveries)
+		w.POST("/:id/redeliver", s.handleRedeliverWebhook)
+	}
+	if indexer.appConfig.App.Proposer.Enabled {
+		p := g.Group("/proposer", s.bearerAuth(indexer.appConfig.App.Proposer.Token, "proposer token"))
+		p.GET("/pending", s.handleGetProposerPending)
+		p.POST("/proposals", s.handleSubmitProposerProposal)
+	}
+	if indexer.appConfig.App.Community.Enabled {
+		g.POST("/community/proposals", s.handleSubmitCommunityProposal)
+		g.POST("/community/proposals/message", s.handleGetCommunityMessage)
+		g.POST("/community/proposals/list", s.handleGetCommunityProposals)
+		g.GET("/community/proposals/:hash", s.handleGetCommunityProposal)
+	}
 	return s
 }
 
@@ -48,16 +101,19 @@ type VoteInfo struct {
 	VoterAddress string `json:"voter_address"`
 	Height       uint64 `json:"height"`
 	VoteCode     uint64 `json:"voteCode"`
+	Flag         string `json:"flag"`
+	Power        int64  `json:"power"`
 }
 type ProposalInfo struct {
-	Proposal       Proposal   `json:"proposal"`
-	DiscussoinCnt  int        `json:"discussionCnt"`
-	DraftVotes     []VoteInfo `json:"draftVotes"`
-	DraftPass      uint64     `json:"draftPass"`
-	DraftReject    uint64     `json:"draftReject"`
-	DecisionVote   []VoteInfo `json:"decisionVotes"`
-	DecisionPass   uint64     `json:"decisionPass"`
-	DecisionReject uint64     `json:"decisionReject"`
+	Proposal       Proposal    `json:"proposal"`
+	DiscussoinCnt  int         `json:"discussionCnt"`
+	DraftVotes     []VoteInfo  `json:"draftVotes"`
+	DraftPass      uint64      `json:"draftPass"`
+	DraftReject    uint64      `json:"draftReject"`
+	DecisionVote   []VoteInfo  `json:"decisionVotes"`
+	DecisionPass   uint64      `json:"decisionPass"`
+	DecisionReject uint64      `json:"decisionReject"`
+	Tallies        []VoteTally `json:"tallies"`
 }
 
 type ProposalDetail struct {
@@ -75,6 +131,7 @@ type DecisionStep struct {
 type GrantInfo struct {
 	Grant Grant      `json:"grant"`
 	Votes []VoteInfo `json:"votes"`
+	Tally *VoteTally `json:"tally"`
 }
 
 type AgentInfo struct {
@@ -141,7 +198,12 @@ type GetManifestoResponse struct {
 }
 
 func (s *Service) handleGetManifesto(c *gin.Context) {
-	c.JSON(http.StatusOK, GetManifestoResponse{Manifesto: MANIFESTO})
+	manifesto, err := s.indexer.getManifest()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetManifestoResponse{Manifesto: manifesto})
 }
 
 type GetNetworkStatusResponse struct {
@@ -275,9 +337,15 @@ func (s *Service) handleGetGrants(c *gin.Context) {
 			return
 		}
 		voteInfos := GrantVotesToVoteInfo(votes)
+		tally, err := s.indexer.getVoteTally(grant.Height)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		grantInfo := GrantInfo{
 			Grant: grant,
 			Votes: voteInfos,
+			Tally: tally,
 		}
 		response.Grants = append(response.Grants, grantInfo)
 		c.JSON(http.StatusOK, response)
@@ -298,9 +366,15 @@ func (s *Service) handleGetGrants(c *gin.Context) {
 			return
 		}
 		voteInfos := GrantVotesToVoteInfo(votes)
+		tally, err := s.indexer.getVoteTally(grant.Height)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		grantInfo := GrantInfo{
 			Grant: grant,
 			Votes: voteInfos,
+			Tally: tally,
 		}
 		response.Grants = append(response.Grants, grantInfo)
 	}
@@ -328,18 +402,14 @@ func (s *Service) handleGetDiscussions(c *gin.Context) {
 	}
 	requestData.Page -= 1
 	if requestData.ProposalId != 0 {
-		discussions, total, err := s.indexer.getDiscussionByProposal(requestData.ProposalId, requestData.Page, requestData.PageSize)
+		discussions, total, err := s.indexer.getDiscussionThreads(requestData.ProposalId, requestData.Page, requestData.PageSize)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		for i, _ := range discussions {
-			agent, err := s.indexer.getValidatorByAddress(discussions[i].SpeakerAddress)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-			discussions[i].HeadPhoto = agent.HeadPhoto
+		if err := s.fillHeadPhotos(discussions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 		response.Discussions = discussions
 		response.Total = total
@@ -350,6 +420,50 @@ func (s *Service) handleGetDiscussions(c *gin.Context) {
 	return
 }
 
+type GetProposalRevisionsReq struct {
+	ProposalId uint64 `json:"proposalId"`
+}
+
+type GetProposalRevisionsResponse struct {
+	Revisions []ProposalRevision `json:"revisions"`
+}
+
+func (s *Service) handleGetProposalRevisions(c *gin.Context) {
+	var requestData GetProposalRevisionsReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	revisions, err := s.indexer.getProposalRevisions(requestData.ProposalId)
+	if errors.Is(err, ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetProposalRevisionsResponse{Revisions: revisions})
+}
+
+// fillHeadPhotos sets the head photo of the agents speaking in a discussion
+// tree.
+func (s *Service) fillHeadPhotos(discussions []Discussion) error {
+	for i := range discussions {
+		if !discussions[i].Human {
+			agent, err := s.indexer.getValidatorByAddress(discussions[i].SpeakerAddress)
+			if err != nil {
+				return err
+			}
+			discussions[i].HeadPhoto = agent.HeadPhoto
+		}
+		if err := s.fillHeadPhotos(discussions[i].Replies); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type GetProposalDetailReq struct {
 	ProposalId uint64 `json:"proposalId"`
 }
@@ -380,13 +494,13 @@ func (s *Service) handleGetProposalDetail(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	for i, _ := range discussions {
-		agent, err := s.indexer.getValidatorByAddress(discussions[i].SpeakerAddress)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		discussions[i].HeadPhoto = agent.HeadPhoto
+	if err := loadDiscussionReferences(s.indexer.db, discussions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.fillHeadPhotos(discussions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 	votes := proposalInfo.DecisionVote
 	if len(votes) == 0 {
@@ -527,6 +641,10 @@ func (s *Service) getProposalInfoById(proposalId uint64) (ProposalInfo, error) {
 		return ProposalInfo{}, err
 	}
 	draftVotes, decisionVotes := ProposalVotesToVoteInfo(votes)
+	tallies, err := s.indexer.getProposalVoteTallies(proposalId)
+	if err != nil {
+		return ProposalInfo{}, err
+	}
 	proposalInfo := ProposalInfo{
 		Proposal:       proposal,
 		DiscussoinCnt:  int(total),
@@ -536,6 +654,7 @@ func (s *Service) getProposalInfoById(proposalId uint64) (ProposalInfo, error) {
 		DecisionVote:   decisionVotes,
 		DecisionPass:   0,
 		DecisionReject: 0,
+		Tallies:        tallies,
 	}
 	for _, vote := range draftVotes {
 		if vote.Pass {
@@ -570,6 +689,8 @@ func GrantVotesToVoteInfo(votes []GrantVote) []VoteInfo {
 				VoterAddress: vote.VoterAddress,
 				Height:       vote.Height,
 				VoteCode:     vote.Vote,
+				Flag:         vote.Flag,
+				Power:        vote.Power,
 			})
 		case uint64(tx.VoteRejectNewMember):
 			grantInfo.Votes = append(grantInfo.Votes, VoteInfo{
@@ -578,6 +699,8 @@ func GrantVotesToVoteInfo(votes []GrantVote) []VoteInfo {
 				VoterAddress: vote.VoterAddress,
 				Height:       vote.Height,
 				VoteCode:     vote.Vote,
+				Flag:         vote.Flag,
+				Power:        vote.Power,
 			})
 		}
 	}
@@ -599,6 +722,8 @@ func ProposalVotesToVoteInfo(votes []ProposalVote) ([]VoteInfo, []VoteInfo) {
 				VoterAddress: vote.VoterAddress,
 				Height:       vote.Height,
 				VoteCode:     vote.Vote,
+				Flag:         vote.Flag,
+				Power:        vote.Power,
 			})
 		case uint64(tx.VoteProcessProposal):
 			proposalInfo.DraftVotes = append(proposalInfo.DraftVotes, VoteInfo{
@@ -607,6 +732,8 @@ func ProposalVotesToVoteInfo(votes []ProposalVote) ([]VoteInfo, []VoteInfo) {
 				VoterAddress: vote.VoterAddress,
 				Height:       vote.Height,
 				VoteCode:     vote.Vote,
+				Flag:         vote.Flag,
+				Power:        vote.Power,
 			})
 		case uint64(tx.VoteRejectProposal):
 			proposalInfo.DecisionVote = append(proposalInfo.DecisionVote, VoteInfo{
@@ -615,6 +742,8 @@ func ProposalVotesToVoteInfo(votes []ProposalVote) ([]VoteInfo, []VoteInfo) {
 				VoterAddress: vote.VoterAddress,
 				Height:       vote.Height,
 				VoteCode:     vote.Vote,
+				Flag:         vote.Flag,
+				Power:        vote.Power,
 			})
 		case uint64(tx.VoteAcceptProposal):
 			proposalInfo.DecisionVote = append(proposalInfo.DecisionVote, VoteInfo{
@@ -623,8 +752,975 @@ func ProposalVotesToVoteInfo(votes []ProposalVote) ([]VoteInfo, []VoteInfo) {
 				VoterAddress: vote.VoterAddress,
 				Height:       vote.Height,
 				VoteCode:     vote.Vote,
+				Flag:         vote.Flag,
+				Power:        vote.Power,
 			})
 		}
 	}
 	return proposalInfo.DraftVotes, proposalInfo.DecisionVote
 }
+
+type GetSettlePolicyResponse struct {
+	Interval int64                              `json:"interval"`
+	Policies map[string]app_config.SettlePolicy `json:"policies"`
+	// lifecycle of each proposal category enforced on chain
+	Categories map[string]app_config.ProposalCategoryRule `json:"categories"`
+}
+
+func (s *Service) handleGetSettlePolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, GetSettlePolicyResponse{
+		Interval:   s.indexer.settle.Interval(),
+		Policies:   s.indexer.settle.Policies(),
+		Categories: app_config.ProposalCategoryRules(uint64(s.indexer.Height)),
+	})
+}
+
+type GetVoterVotesReq struct {
+	Address  string `json:"address"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+type GetVoterVotesResponse struct {
+	ProposalVotes []ProposalVote `json:"proposalVotes"`
+	GrantVotes    []GrantVote    `json:"grantVotes"`
+}
+
+func (s *Service) handleGetVoterVotes(c *gin.Context) {
+	var requestData GetVoterVotesReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if requestData.Address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address is required"})
+		return
+	}
+	requestData.Page -= 1
+	proposalVotes, err := s.indexer.getProposalVotesByVoter(requestData.Address, requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	grantVotes, err := s.indexer.getGrantVotesByVoter(requestData.Address, requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetVoterVotesResponse{
+		ProposalVotes: proposalVotes,
+		GrantVotes:    grantVotes,
+	})
+}
+
+type GetVoteTalliesReq struct {
+	ProposalId uint64 `json:"proposalId"`
+	GrantId    uint64 `json:"grantId"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"pageSize"`
+}
+
+type GetVoteTalliesResponse struct {
+	Tallies []VoteTally `json:"tallies"`
+	Total   uint64      `json:"total"`
+}
+
+func (s *Service) handleGetVoteTallies(c *gin.Context) {
+	var requestData GetVoteTalliesReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	requestData.Page -= 1
+	var (
+		tallies []VoteTally
+		total   uint64
+		err     error
+	)
+	switch {
+	case requestData.ProposalId != 0:
+		tallies, err = s.indexer.getProposalVoteTallies(requestData.ProposalId)
+		total = uint64(len(tallies))
+	case requestData.GrantId != 0:
+		tallies, err = s.indexer.getGrantVoteTallies(requestData.GrantId)
+		total = uint64(len(tallies))
+	default:
+		tallies, total, err = s.indexer.getVoteTallies(requestData.Page, requestData.PageSize)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetVoteTalliesResponse{Tallies: tallies, Total: total})
+}
+
+type GetValidatorSetReq struct {
+	Height uint64 `json:"height"`
+}
+
+type GetValidatorSetResponse struct {
+	Height     uint64               `json:"height"`
+	SetHeight  uint64               `json:"setHeight"`
+	Hash       string               `json:"hash"`
+	TotalPower int64                `json:"totalPower"`
+	Validators []ValidatorSetMember `json:"validators"`
+}
+
+func (s *Service) handleGetValidatorSet(c *gin.Context) {
+	var requestData GetValidatorSetReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	set, members, err := s.indexer.getValidatorSetAt(requestData.Height)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if set == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validator set not indexed"})
+		return
+	}
+	c.JSON(http.StatusOK, GetValidatorSetResponse{
+		Height:     requestData.Height,
+		SetHeight:  set.Height,
+		Hash:       set.Hash,
+		TotalPower: set.TotalPower,
+		Validators: members,
+	})
+}
+
+type GetMembershipReq struct {
+	Address  string `json:"address"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+type GetMembershipResponse struct {
+	Agent  *ValidatorAgent   `json:"agent"`
+	Events []MembershipEvent `json:"events"`
+	Total  uint64            `json:"total"`
+}
+
+func (s *Service) handleGetMembership(c *gin.Context) {
+	var requestData GetMembershipReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if requestData.Address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address is required"})
+		return
+	}
+	requestData.Page -= 1
+	agent, err := s.indexer.getValidatorByAddress(requestData.Address)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	events, total, err := s.indexer.getMembershipEvents(requestData.Address, requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetMembershipResponse{Agent: agent, Events: events, Total: total})
+}
+
+type SearchReq struct {
+	Query      string   `json:"query"`
+	Kinds      []string `json:"kinds"`
+	Status     *uint64  `json:"status"`
+	Speaker    string   `json:"speaker"`
+	FromHeight uint64   `json:"fromHeight"`
+	ToHeight   uint64   `json:"toHeight"`
+	Page       int      `json:"page"`
+	PageSize   int      `json:"pageSize"`
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Total   uint64         `json:"total"`
+}
+
+func (s *Service) handleSearch(c *gin.Context) {
+	var requestData SearchReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(requestData.Query) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+	for _, kind := range requestData.Kinds {
+		if kind != SearchKindProposal && kind != SearchKindDiscussion {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown kind %s", kind)})
+			return
+		}
+	}
+	requestData.Page -= 1
+	results, total, err := s.indexer.store.Search(SearchQuery{
+		Text:       requestData.Query,
+		Kinds:      requestData.Kinds,
+		Status:     requestData.Status,
+		Speaker:    requestData.Speaker,
+		FromHeight: requestData.FromHeight,
+		ToHeight:   requestData.ToHeight,
+		Page:       requestData.Page,
+		PageSize:   requestData.PageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, SearchResponse{Results: results, Total: total})
+}
+
+type GetParticipationResponse struct {
+	Height uint64               `json:"height"`
+	Agents []AgentParticipation `json:"agents"`
+}
+
+func (s *Service) handleGetParticipation(c *gin.Context) {
+	agents, height, err := s.indexer.analytics.Participation()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetParticipationResponse{Height: height, Agents: agents})
+}
+
+type GetAgreementResponse struct {
+	Height uint64           `json:"height"`
+	Pairs  []AgentAgreement `json:"pairs"`
+}
+
+func (s *Service) handleGetAgreement(c *gin.Context) {
+	pairs, height, err := s.indexer.analytics.Agreement()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetAgreementResponse{Height: height, Pairs: pairs})
+}
+
+type GetInfluenceResponse struct {
+	Height    uint64              `json:"height"`
+	Proposers []ProposerInfluence `json:"proposers"`
+}
+
+func (s *Service) handleGetInfluence(c *gin.Context) {
+	proposers, height, err := s.indexer.analytics.Influence()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetInfluenceResponse{Height: height, Proposers: proposers})
+}
+
+type GetSpeakerSharesReq struct {
+	Proposal uint64 `json:"proposal"`
+}
+
+type GetSpeakerSharesResponse struct {
+	Height   uint64         `json:"height"`
+	Speakers []SpeakerShare `json:"speakers"`
+}
+
+func (s *Service) handleGetSpeakerShares(c *gin.Context) {
+	var requestData GetSpeakerSharesReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	speakers, height, err := s.indexer.analytics.SpeakerShares(requestData.Proposal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetSpeakerSharesResponse{Height: height, Speakers: speakers})
+}
+
+type GetDiscussionConsensusResponse struct {
+	Height    uint64                `json:"height"`
+	Proposals []DiscussionConsensus `json:"proposals"`
+	Decided   uint64                `json:"decided"`
+	Matched   uint64                `json:"matched"`
+	MatchRate float64               `json:"matchRate"`
+}
+
+func (s *Service) handleGetDiscussionConsensus(c *gin.Context) {
+	proposals, height, err := s.indexer.analytics.DiscussionConsensus()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	res := GetDiscussionConsensusResponse{Height: height, Proposals: proposals}
+	for _, p := range proposals {
+		res.Decided++
+		if p.Matched {
+			res.Matched++
+		}
+	}
+	res.MatchRate = rate(res.Matched, res.Decided)
+	c.JSON(http.StatusOK, res)
+}
+
+type ExplorerPageReq struct {
+	Page     int `form:"page"`
+	PageSize int `form:"pageSize"`
+}
+
+// bindExplorerPage reads the page of a GET request, the first page of
+// DefaultExplorerPageSize entries if absent.
+func bindExplorerPage(c *gin.Context) (ExplorerPageReq, error) {
+	var req ExplorerPageReq
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return req, err
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize <= 0 || req.PageSize > MaxExplorerPageSize {
+		req.PageSize = DefaultExplorerPageSize
+	}
+	req.Page -= 1
+	return req, nil
+}
+
+type GetBlocksResponse struct {
+	Blocks []BlockSummary `json:"blocks"`
+	Total  uint64         `json:"total"`
+}
+
+func (s *Service) handleGetBlocks(c *gin.Context) {
+	requestData, err := bindExplorerPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	blocks, total, err := s.indexer.getBlocks(requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetBlocksResponse{Blocks: blocks, Total: total})
+}
+
+func (s *Service) handleGetBlock(c *gin.Context) {
+	height, err := strconv.ParseInt(c.Param("height"), 10, 64)
+	if err != nil || height <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid height"})
+		return
+	}
+	block, err := s.indexer.getBlock(c.Request.Context(), height)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if block == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "block not found"})
+		return
+	}
+	c.JSON(http.StatusOK, block)
+}
+
+type GetAccountTxsResponse struct {
+	Txs   []TxInfo `json:"txs"`
+	Total uint64   `json:"total"`
+}
+
+func (s *Service) handleGetAccountTxs(c *gin.Context) {
+	requestData, err := bindExplorerPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	address := strings.ToUpper(strings.TrimPrefix(c.Param("address"), "0x"))
+	txs, total, err := s.indexer.getAccountTxs(address, requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetAccountTxsResponse{Txs: txs, Total: total})
+}
+
+const (
+	// interval of the keep-alive messages of a stream
+	StreamPingInterval = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+// the api is public and read only, any dashboard origin may stream
+var streamUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// StreamReq selects the events of a stream. From is the height to resume
+// from, an SSE client resuming with Last-Event-ID continues right after the
+// last event it received.
+type StreamReq struct {
+	Proposal uint64 `form:"proposal"`
+	Agent    string `form:"agent"`
+	Types    string `form:"types"`
+	From     uint64 `form:"from"`
+}
+
+func (s *Service) handleStream(c *gin.Context) {
+	var requestData StreamReq
+	if err := c.ShouldBindQuery(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := StreamFilter{
+		Proposal: requestData.Proposal,
+		Agent:    strings.ToUpper(strings.TrimPrefix(requestData.Agent, "0x")),
+		Types:    make(map[string]bool),
+	}
+	if requestData.Types != "" {
+		for _, t := range strings.Split(requestData.Types, ",") {
+			if _, ok := streamEventOrder[t]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unknown event type %s", t)})
+				return
+			}
+			filter.Types[t] = true
+		}
+	}
+	cursor := StreamCursor{Height: requestData.From}
+	if id := c.GetHeader("Last-Event-ID"); id != "" {
+		var height uint64
+		var seq int
+		if _, err := fmt.Sscanf(id, "%d-%d", &height, &seq); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		cursor = StreamCursor{Height: height, Seq: seq + 1}
+	}
+
+	sub := s.indexer.stream.Subscribe(filter)
+	defer s.indexer.stream.Unsubscribe(sub)
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		s.streamWebSocket(c, sub, cursor)
+	} else {
+		s.streamSSE(c, sub, cursor)
+	}
+}
+
+func (s *Service) streamSSE(c *gin.Context, sub *StreamSubscription, cursor StreamCursor) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	send := func(ev StreamEvent) error {
+		id := fmt.Sprintf("%d-%d", ev.Height, ev.Seq)
+		if ev.Type == StreamEventResync {
+			// keep the position of the client
+			id = ""
+		}
+		err := sse.Encode(c.Writer, sse.Event{
+			Id:    id,
+			Event: ev.Type,
+			Data:  ev,
+		})
+		if err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return ctx.Err()
+	}
+	if err := s.indexer.stream.Replay(sub, cursor, send); err != nil {
+		return
+	}
+	ticker := time.NewTicker(StreamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+func (s *Service) streamWebSocket(c *gin.Context, sub *StreamSubscription, cursor StreamCursor) {
+	conn, err := streamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	// the client sends nothing, reading only notices when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(ev StreamEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(ev)
+	}
+	if err := s.indexer.stream.Replay(sub, cursor, send); err != nil {
+		return
+	}
+	ticker := time.NewTicker(StreamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case ev, ok := <-sub.Events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber too slow, resume from cursor"), time.Now().Add(streamWriteTimeout))
+				return
+			}
+			if err := send(ev); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+type GetOutboxReq struct {
+	Status   string `json:"status"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+type GetOutboxResponse struct {
+	Posts []OutboxPost `json:"posts"`
+	Total uint64       `json:"total"`
+}
+
+func (s *Service) handleGetOutbox(c *gin.Context) {
+	var requestData GetOutboxReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	requestData.Page -= 1
+	posts, total, err := s.indexer.getOutboxPosts(requestData.Status, requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetOutboxResponse{Posts: posts, Total: total})
+}
+
+type GetParticipantsReq struct {
+	Page     int `json:"page"`
+	PageSize int `json:"pageSize"`
+}
+
+type GetParticipantsResponse struct {
+	Participants []Participant `json:"participants"`
+	Total        uint64        `json:"total"`
+}
+
+func (s *Service) handleGetParticipants(c *gin.Context) {
+	var requestData GetParticipantsReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	requestData.Page -= 1
+	participants, total, err := s.indexer.getParticipants(requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetParticipantsResponse{Participants: participants, Total: total})
+}
+
+// bearerAuth rejects the requests without the token, if one is set. name
+// tells which token is expected.
+func (s *Service) bearerAuth(token string, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			return
+		}
+		auth := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid " + name})
+		}
+	}
+}
+
+func webhookStatus(err error) int {
+	if errors.Is(err, ErrWebhookNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func bindWebhookId(c *gin.Context) (uint64, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook id"})
+		return 0, false
+	}
+	return id, true
+}
+
+type CreateWebhookReq struct {
+	WebhookParams
+	Secret     string `json:"secret"`
+	FromHeight uint64 `json:"fromHeight"`
+}
+
+// CreateWebhookResponse carries the signing secret, it is not returned again.
+type CreateWebhookResponse struct {
+	Subscription *WebhookSubscription `json:"subscription"`
+	Secret       string               `json:"secret"`
+}
+
+func (s *Service) handleCreateWebhook(c *gin.Context) {
+	var requestData CreateWebhookReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := requestData.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub, err := s.indexer.createWebhook(requestData.WebhookParams, requestData.Secret, requestData.FromHeight)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, CreateWebhookResponse{Subscription: sub, Secret: sub.Secret})
+}
+
+type GetWebhooksResponse struct {
+	Subscriptions []WebhookSubscription `json:"subscriptions"`
+}
+
+func (s *Service) handleGetWebhooks(c *gin.Context) {
+	subs, err := s.indexer.getWebhooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetWebhooksResponse{Subscriptions: subs})
+}
+
+type UpdateWebhookReq struct {
+	WebhookParams
+	Active bool `json:"active"`
+}
+
+func (s *Service) handleUpdateWebhook(c *gin.Context) {
+	id, ok := bindWebhookId(c)
+	if !ok {
+		return
+	}
+	var requestData UpdateWebhookReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := requestData.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub, err := s.indexer.updateWebhook(id, requestData.WebhookParams, requestData.Active)
+	if err != nil {
+		c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+func (s *Service) handleDeleteWebhook(c *gin.Context) {
+	id, ok := bindWebhookId(c)
+	if !ok {
+		return
+	}
+	if err := s.indexer.deleteWebhook(id); err != nil {
+		c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+type GetWebhookDeliveriesReq struct {
+	Status   string `json:"status"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+type GetWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Total      uint64            `json:"total"`
+}
+
+func (s *Service) handleGetWebhookDeliveries(c *gin.Context) {
+	id, ok := bindWebhookId(c)
+	if !ok {
+		return
+	}
+	var requestData GetWebhookDeliveriesReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	requestData.Page -= 1
+	deliveries, total, err := s.indexer.getWebhookDeliveries(id, requestData.Status, requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetWebhookDeliveriesResponse{Deliveries: deliveries, Total: total})
+}
+
+type RedeliverWebhookReq struct {
+	Delivery uint64 `json:"delivery"`
+}
+
+func (s *Service) handleRedeliverWebhook(c *gin.Context) {
+	id, ok := bindWebhookId(c)
+	if !ok {
+		return
+	}
+	var requestData RedeliverWebhookReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.indexer.redeliverWebhook(id, requestData.Delivery); err != nil {
+		c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivery": requestData.Delivery})
+}
+
+type GetProposerPendingResponse struct {
+	Pending bool `json:"pending"`
+}
+
+func (s *Service) handleGetProposerPending(c *gin.Context) {
+	pending, err := s.indexer.proposalPending()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetProposerPendingResponse{Pending: pending})
+}
+
+// SubmitProposerProposalReq is a proposal the proposer daemon asks the node
+// to submit.
+type SubmitProposerProposalReq struct {
+	Title    string `json:"title"`
+	Link     string `json:"link"`
+	ImageUrl string `json:"imageUrl"`
+	Data     string `json:"data"`
+}
+
+func (s *Service) handleSubmitProposerProposal(c *gin.Context) {
+	var requestData SubmitProposerProposalReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := s.indexer.submitProposal(&tx.ProposalTx{
+		ImageUrl: requestData.ImageUrl,
+		Title:    requestData.Title,
+		Link:     requestData.Link,
+		Data:     []byte(requestData.Data),
+	})
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrSenderTxPending):
+			status = http.StatusConflict
+		case errors.Is(err, ErrObserverNode), errors.Is(err, ErrSenderNotStarted):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+type SubmitCommunityProposalReq struct {
+	CommunityProposal
+	// ethereum address of the author, recovered from the signature if empty
+	Author string `json:"author"`
+	// hex personal_sign signature of the submission message
+	Signature string `json:"signature"`
+}
+
+func (s *Service) handleSubmitCommunityProposal(c *gin.Context) {
+	var requestData SubmitCommunityProposalReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub, err := s.indexer.submitCommunityProposal(requestData.CommunityProposal, requestData.Author, requestData.Signature)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrCommunityQueueFull):
+			status = http.StatusTooManyRequests
+		case errors.Is(err, ErrObserverNode):
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+type GetCommunityMessageReq struct {
+	CommunityProposal
+	// ethereum address of the author, empty for an unsigned submission
+	Author string `json:"author"`
+}
+
+type GetCommunityMessageResponse struct {
+	Message string `json:"message"`
+	Hash    string `json:"hash"`
+}
+
+// handleGetCommunityMessage returns the message an author signs for a
+// submission, and the hash the submission gets.
+func (s *Service) handleGetCommunityMessage(c *gin.Context) {
+	var requestData GetCommunityMessageReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := requestData.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	author := requestData.Author
+	if author != "" {
+		if !common.IsHexAddress(author) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid author address"})
+			return
+		}
+		author = common.HexToAddress(author).Hex()
+	}
+	c.JSON(http.StatusOK, GetCommunityMessageResponse{Message: requestData.Message(), Hash: requestData.Hash(author)})
+}
+
+type GetCommunityProposalsReq struct {
+	Status   string `json:"status"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+type GetCommunityProposalsResponse struct {
+	Submissions []CommunitySubmission `json:"submissions"`
+	Total       uint64                `json:"total"`
+}
+
+func (s *Service) handleGetCommunityProposals(c *gin.Context) {
+	var requestData GetCommunityProposalsReq
+	if err := c.ShouldBindJSON(&requestData); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	requestData.Page -= 1
+	subs, total, err := s.indexer.getCommunitySubmissions(requestData.Status, requestData.Page, requestData.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, GetCommunityProposalsResponse{Submissions: subs, Total: total})
+}
+
+func (s *Service) handleGetCommunityProposal(c *gin.Context) {
+	sub, err := s.indexer.getCommunitySubmission(c.Param("hash"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrSubmissionNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sub)
+}
+
+type PutBlobResponse struct {
+	Hash string `json:"hash"`
+	Size int    `json:"size"`
+}
+
+// handlePutBlob stores the raw request body in the blob store, a proposal
+// then references it by the returned hash.
+func (s *Service) handlePutBlob(c *gin.Context) {
+	store := s.indexer.blobs.Store()
+	body := io.Reader(c.Request.Body)
+	if max := store.MaxSize(); max > 0 {
+		body = io.LimitReader(c.Request.Body, max+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty blob"})
+		return
+	}
+	hash, err := store.Put(data)
+	if errors.Is(err, blob.ErrTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, PutBlobResponse{Hash: hash, Size: len(data)})
+}
+
+// handleGetBlob serves a blob held by the node, other nodes fetch the
+// content of proposals from here. Only the local store is read.
+func (s *Service) handleGetBlob(c *gin.Context) {
+	data, err := s.indexer.blobs.Store().Get(c.Param("hash"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, blob.ErrHashInvalid):
+			status = http.StatusBadRequest
+		case errors.Is(err, blob.ErrNotFound):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Data(http.StatusOK, "application/octet-stream", data)
+}
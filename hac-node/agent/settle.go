@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"fmt"
+
+	app_config "github.com/calehh/hac-app/config"
+)
+
+// ProposalActivity summarises the discussion on a proposal for the settle
+// policy.
+type ProposalActivity struct {
+	Discussions          uint64 `json:"discussions"`
+	Speakers             uint64 `json:"speakers"`
+	LastDiscussionHeight uint64 `json:"lastDiscussionHeight"`
+	// discussions of members, the ones the category rules count
+	MemberDiscussions uint64 `json:"memberDiscussions"`
+}
+
+// SettlePolicyEngine decides when the node settles its own proposals. Each
+// proposal category may have its own policy, categories without one fall
+// back to the default policy.
+type SettlePolicyEngine struct {
+	interval int64
+	policies map[string]app_config.SettlePolicy
+}
+
+func NewSettlePolicyEngine(cfg *app_config.HACAppConfig) *SettlePolicyEngine {
+	e := &SettlePolicyEngine{
+		interval: cfg.SettleInterval,
+		policies: make(map[string]app_config.SettlePolicy),
+	}
+	if e.interval <= 0 {
+		e.interval = app_config.DefaultSettleInterval
+	}
+	for category, policy := range cfg.SettlePolicies {
+		e.policies[category] = policy
+	}
+	if _, ok := e.policies[app_config.DefaultSettlePolicyCategory]; !ok {
+		e.policies[app_config.DefaultSettlePolicyCategory] = app_config.DefaultSettlePolicies()[app_config.DefaultSettlePolicyCategory]
+	}
+	return e
+}
+
+// Interval is the number of blocks between two settle checks.
+func (e *SettlePolicyEngine) Interval() int64 {
+	return e.interval
+}
+
+// Policies returns the configured policies keyed by category.
+func (e *SettlePolicyEngine) Policies() map[string]app_config.SettlePolicy {
+	policies := make(map[string]app_config.SettlePolicy, len(e.policies))
+	for category, policy := range e.policies {
+		policies[category] = policy
+	}
+	return policies
+}
+
+// Policy returns the policy of the category or the default policy.
+func (e *SettlePolicyEngine) Policy(category string) app_config.SettlePolicy {
+	if policy, ok := e.policies[category]; ok {
+		return policy
+	}
+	return e.policies[app_config.DefaultSettlePolicyCategory]
+}
+
+// Evaluate reports whether a proposal created at newHeight and last revised
+// at revisionHeight, 0 if never, should be settled at height, and why. early
+// is set when the local agent asked to settle the proposal before the
+// discussion thresholds are met.
+func (e *SettlePolicyEngine) Evaluate(category string, newHeight uint64, revisionHeight uint64, height uint64, activity ProposalActivity, early bool) (bool, string) {
+	policy := e.Policy(category)
+	var age uint64
+	if height > newHeight {
+		age = height - newHeight
+	}
+	// the chain refuses to settle before the lifecycle of the category allows
+	rule := app_config.ProposalCategoryRules(height)[category]
+	since, blocks := app_config.DiscussionPeriod(rule, height, newHeight, revisionHeight)
+	if height < since+blocks {
+		return false, fmt.Sprintf("discussed since height %d, %d blocks required by category %s", since, blocks, category)
+	}
+	if activity.MemberDiscussions < rule.MinDiscussions {
+		return false, fmt.Sprintf("member discussions %d below %d required by category %s", activity.MemberDiscussions, rule.MinDiscussions, category)
+	}
+	if age < policy.MinBlockAge {
+		return false, fmt.Sprintf("block age %d below %d", age, policy.MinBlockAge)
+	}
+	if policy.MaxBlockAge > 0 && age >= policy.MaxBlockAge {
+		return true, fmt.Sprintf("block age %d reached %d", age, policy.MaxBlockAge)
+	}
+	if early {
+		return true, "requested by agent"
+	}
+	if activity.Discussions < policy.MinDiscussions {
+		return false, fmt.Sprintf("discussions %d below %d", activity.Discussions, policy.MinDiscussions)
+	}
+	if activity.Speakers < policy.MinSpeakers {
+		return false, fmt.Sprintf("speakers %d below %d", activity.Speakers, policy.MinSpeakers)
+	}
+	if policy.QuietBlocks > 0 {
+		last := activity.LastDiscussionHeight
+		if last < newHeight {
+			last = newHeight
+		}
+		if height < last+policy.QuietBlocks {
+			return false, fmt.Sprintf("discussion active at height %d", last)
+		}
+		return true, fmt.Sprintf("no discussion for %d blocks", height-last)
+	}
+	return true, "discussion thresholds met"
+}
+
+// ExpireSeconds is the validity of the settle vote of the category.
+func (e *SettlePolicyEngine) ExpireSeconds(category string) int64 {
+	expire := e.Policy(category).ExpireSeconds
+	if expire == 0 {
+		expire = app_config.DefaultSettlePolicies()[app_config.DefaultSettlePolicyCategory].ExpireSeconds
+	}
+	return int64(expire)
+}
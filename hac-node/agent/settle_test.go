@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"testing"
+
+	app_config "github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+)
+
+func TestSettlePolicyEngineEvaluate(t *testing.T) {
+	e := NewSettlePolicyEngine(&app_config.HACAppConfig{
+		SettlePolicies: map[string]app_config.SettlePolicy{
+			"quiet":                     {MinBlockAge: 5, QuietBlocks: 10},
+			"aged":                      {MinDiscussions: 100, MaxBlockAge: 50},
+			tx.ProposalCategoryText:     {MinDiscussions: 2, MinSpeakers: 2},
+			tx.ProposalCategoryTreasury: {},
+		},
+	})
+	upgraded := uint64(app_config.GovernanceUpgradeHeight)
+	cases := []struct {
+		name                      string
+		category                  string
+		newHeight, revisionHeight uint64
+		height                    uint64
+		activity                  ProposalActivity
+		early                     bool
+		want                      bool
+	}{
+		{name: "too young", category: "quiet", newHeight: 10, height: 14},
+		{name: "quiet since created", category: "quiet", newHeight: 10, height: 20, want: true},
+		{name: "discussion still active", category: "quiet", newHeight: 10, height: 25, activity: ProposalActivity{LastDiscussionHeight: 20}},
+		{name: "quiet since last discussion", category: "quiet", newHeight: 10, height: 30, activity: ProposalActivity{LastDiscussionHeight: 20}, want: true},
+		{name: "max age settles without discussion", category: "aged", newHeight: 10, height: 60, want: true},
+		{name: "early request", category: "aged", newHeight: 10, height: 20, early: true, want: true},
+		{name: "few speakers", category: tx.ProposalCategoryText, newHeight: 10, height: 20, activity: ProposalActivity{Discussions: 3, Speakers: 1}},
+		{name: "thresholds met", category: tx.ProposalCategoryText, newHeight: 10, height: 20, activity: ProposalActivity{Discussions: 3, Speakers: 2}, want: true},
+		{name: "unknown category uses the default", category: "lottery", newHeight: 10, height: 20, activity: ProposalActivity{Discussions: 14}},
+		// the chain rules of the category hold even if the policy is empty
+		{name: "category discussion blocks", category: tx.ProposalCategoryTreasury, newHeight: upgraded, height: upgraded + 99, activity: ProposalActivity{MemberDiscussions: 5}, early: true},
+		{name: "category member discussions", category: tx.ProposalCategoryTreasury, newHeight: upgraded, height: upgraded + 100, activity: ProposalActivity{Discussions: 9, MemberDiscussions: 4}, early: true},
+		{name: "category rules met", category: tx.ProposalCategoryTreasury, newHeight: upgraded, height: upgraded + 100, activity: ProposalActivity{MemberDiscussions: 5}, want: true},
+		{name: "revision restarts the discussion", category: tx.ProposalCategoryTreasury, newHeight: upgraded, revisionHeight: upgraded + 95, height: upgraded + 100, activity: ProposalActivity{MemberDiscussions: 5}, early: true},
+		{name: "no revision period before the upgrade", category: tx.ProposalCategoryTreasury, newHeight: 10, revisionHeight: 15, height: 20, early: true, want: true},
+		{name: "no category rules before the upgrade", category: tx.ProposalCategoryTreasury, newHeight: 10, height: 11, early: true, want: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, reason := e.Evaluate(c.category, c.newHeight, c.revisionHeight, c.height, c.activity, c.early)
+			if got != c.want {
+				t.Fatalf("settle %v (%s), want %v", got, reason, c.want)
+			}
+		})
+	}
+}
+
+func TestSettlePolicyEngineDefaults(t *testing.T) {
+	e := NewSettlePolicyEngine(&app_config.HACAppConfig{
+		SettlePolicies: map[string]app_config.SettlePolicy{"fast": {ExpireSeconds: 30}, "slow": {}},
+	})
+	if e.Interval() != app_config.DefaultSettleInterval {
+		t.Fatalf("interval %d, want %d", e.Interval(), app_config.DefaultSettleInterval)
+	}
+	def := app_config.DefaultSettlePolicies()[app_config.DefaultSettlePolicyCategory]
+	if e.Policy("lottery") != def {
+		t.Fatalf("policy %+v, want the default %+v", e.Policy("lottery"), def)
+	}
+	if n := len(e.Policies()); n != 3 {
+		t.Fatalf("%d policies, want 3", n)
+	}
+	if got := e.ExpireSeconds("fast"); got != 30 {
+		t.Fatalf("expire %d, want 30", got)
+	}
+	if got := e.ExpireSeconds("slow"); got != int64(def.ExpireSeconds) {
+		t.Fatalf("expire %d, want the default %d", got, def.ExpireSeconds)
+	}
+}
@@ -0,0 +1,155 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+const (
+	IndexerDriverSqlite   = "sqlite3"
+	IndexerDriverPostgres = "postgres"
+
+	// how long a sqlite connection waits for the write lock
+	sqliteBusyTimeout = 5 * time.Second
+
+	postgresMaxOpenConns    = 32
+	postgresMaxIdleConns    = 8
+	postgresConnMaxLifetime = 30 * time.Minute
+)
+
+// IndexerStore is the database behind the indexer. Queries are written with
+// gorm and stay portable, a store only knows how to open its database, keep
+// its schema migrated and run the full-text search of its dialect.
+type IndexerStore interface {
+	// Driver is the gorm dialect of the store.
+	Driver() string
+	// DB returns the handle queries run on.
+	DB() *gorm.DB
+	// Migrate applies the pending schema migrations.
+	Migrate() error
+	// Reset drops every migrated table, the broadcast outbox, webhook
+	// subscriptions and community submissions included, and migrates the
+	// database again. Agent cursors are kept.
+	Reset() error
+	// Search runs a full-text search over proposals and discussions.
+	Search(q SearchQuery) ([]SearchResult, uint64, error)
+	Close() error
+}
+
+// OpenIndexerStore opens the store for driver and migrates its schema. An
+// empty sqlite3 dsn stands for indexer.db in home.
+func OpenIndexerStore(driver, dsn, home string) (IndexerStore, error) {
+	var (
+		s   IndexerStore
+		err error
+	)
+	switch driver {
+	case "", IndexerDriverSqlite:
+		if dsn == "" {
+			dsn = path.Join(home, "indexer.db")
+		}
+		s, err = NewSqliteStore(dsn)
+	case IndexerDriverPostgres:
+		s, err = NewPostgresStore(dsn)
+	default:
+		return nil, fmt.Errorf("unknown indexer driver %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Migrate(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+type gormStore struct {
+	driver string
+	db     *gorm.DB
+}
+
+func (s *gormStore) Driver() string {
+	return s.driver
+}
+
+func (s *gormStore) DB() *gorm.DB {
+	return s.db
+}
+
+func (s *gormStore) Migrate() error {
+	return migrate(s.db, indexerMigrations)
+}
+
+func (s *gormStore) Reset() error {
+	if err := s.db.DropTableIfExists(migratedModels...).Error; err != nil {
+		return err
+	}
+	// every migration is idempotent, so they are simply applied again
+	if err := s.db.Delete(&SchemaMigration{}).Error; err != nil {
+		return err
+	}
+	return s.Migrate()
+}
+
+func (s *gormStore) Close() error {
+	return s.db.Close()
+}
+
+// SqliteStore keeps the index in a local sqlite file. The file is opened in
+// WAL mode so the api server can read while the indexer writes.
+type SqliteStore struct {
+	gormStore
+}
+
+func NewSqliteStore(dbPath string) (*SqliteStore, error) {
+	dsn := dbPath
+	if !strings.Contains(dsn, "?") {
+		dsn = fmt.Sprintf("%s?_journal_mode=WAL&_busy_timeout=%d", dsn, sqliteBusyTimeout.Milliseconds())
+	}
+	db, err := gorm.Open(IndexerDriverSqlite, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &SqliteStore{gormStore{driver: IndexerDriverSqlite, db: db}}, nil
+}
+
+// Search uses the FTS5 tables, or the FTS4 tables the migration falls back to
+// on a sqlite built without FTS5.
+func (s *SqliteStore) Search(q SearchQuery) ([]SearchResult, uint64, error) {
+	fts5, err := sqliteFTS5Table(s.db, "proposals_fts")
+	if err != nil {
+		return nil, 0, err
+	}
+	return search(s.db, sqliteSearch{fts5: fts5}, q)
+}
+
+// PostgresStore keeps the index in a PostgreSQL database shared by the
+// explorer readers.
+type PostgresStore struct {
+	gormStore
+}
+
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("postgres indexer needs a dsn")
+	}
+	db, err := gorm.Open(IndexerDriverPostgres, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.DB().SetMaxOpenConns(postgresMaxOpenConns)
+	db.DB().SetMaxIdleConns(postgresMaxIdleConns)
+	db.DB().SetConnMaxLifetime(postgresConnMaxLifetime)
+	return &PostgresStore{gormStore{driver: IndexerDriverPostgres, db: db}}, nil
+}
+
+func (s *PostgresStore) Search(q SearchQuery) ([]SearchResult, uint64, error) {
+	return search(s.db, postgresSearch{}, q)
+}
@@ -0,0 +1,401 @@
+package agent
+
+import (
+	"sort"
+	"sync"
+
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// types of the events pushed on the governance stream, in the order they
+	// are sent within a height
+	StreamEventProposal     = "proposal"
+	StreamEventRevision     = "revision"
+	StreamEventDiscussion   = "discussion"
+	StreamEventDraftTally   = "draft_tally"
+	StreamEventSettle       = "settle"
+	StreamEventGrant        = "grant"
+	StreamEventRetract      = "retract"
+	StreamEventValidatorSet = "validator_set"
+
+	// sent instead of the events of heights below the stream that were
+	// indexed again, the client has to resume from Height
+	StreamEventResync = "resync"
+
+	// events buffered for a subscriber, a subscriber falling further behind
+	// is dropped and has to resume from its cursor
+	streamBufferSize = 256
+	// heights loaded at once while replaying
+	streamReplayBatch = 500
+)
+
+var streamEventOrder = map[string]int{
+	StreamEventProposal:     0,
+	StreamEventRevision:     1,
+	StreamEventDiscussion:   2,
+	StreamEventDraftTally:   3,
+	StreamEventSettle:       4,
+	StreamEventGrant:        5,
+	StreamEventRetract:      6,
+	StreamEventValidatorSet: 7,
+}
+
+// StreamEvent is a governance event pushed to stream clients. Seq numbers
+// the events of a height, so a client can resume exactly after the last event
+// it received. Agents are the addresses of the agents involved.
+type StreamEvent struct {
+	Height   uint64   `json:"height"`
+	Seq      int      `json:"seq"`
+	Type     string   `json:"type"`
+	Proposal uint64   `json:"proposal,omitempty"`
+	Agents   []string `json:"agents"`
+	Data     any      `json:"data"`
+}
+
+type StreamVotes struct {
+	Tally *VoteTally     `json:"tally"`
+	Votes []ProposalVote `json:"votes"`
+}
+
+type StreamSettle struct {
+	Status uint64         `json:"status"`
+	Tally  *VoteTally     `json:"tally"`
+	Votes  []ProposalVote `json:"votes"`
+}
+
+type StreamGrant struct {
+	Grant Grant       `json:"grant"`
+	Tally *VoteTally  `json:"tally"`
+	Votes []GrantVote `json:"votes"`
+}
+
+type StreamValidatorSet struct {
+	Set     ValidatorSet         `json:"set"`
+	Members []ValidatorSetMember `json:"members"`
+}
+
+// StreamFilter selects the events of a subscriber. Empty fields match every
+// event.
+type StreamFilter struct {
+	Proposal uint64
+	Agent    string
+	Types    map[string]bool
+}
+
+func (f StreamFilter) match(ev StreamEvent) bool {
+	if len(f.Types) > 0 && !f.Types[ev.Type] {
+		return false
+	}
+	if f.Proposal != 0 && ev.Proposal != f.Proposal {
+		return false
+	}
+	if f.Agent != "" {
+		for _, a := range ev.Agents {
+			if a == f.Agent {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// StreamCursor is the position of a client in the stream: the events of
+// Height from Seq on are still to be sent.
+type StreamCursor struct {
+	Height uint64
+	Seq    int
+}
+
+func (c StreamCursor) before(ev StreamEvent) bool {
+	return ev.Height > c.Height || (ev.Height == c.Height && ev.Seq >= c.Seq)
+}
+
+// streamHeight returns the height up to which every height is indexed with
+// its votes. The votes of a height are indexed once the next block stores
+// its canonical commit, its events are streamed only then.
+func streamHeight(db *gorm.DB) (uint64, error) {
+	h, err := loadIndexedHeight(db)
+	if err != nil {
+		return 0, err
+	}
+	var pending IndexedBlock
+	err = db.Where("votes_pending = ? AND height <= ?", true, h.Height).Order("height asc").First(&pending).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return h.Height, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return pending.Height - 1, nil
+}
+
+// loadStreamEvents builds the events of the heights from..to from the indexed
+// rows, so replayed and live events are the same.
+func loadStreamEvents(db *gorm.DB, from, to uint64) ([]StreamEvent, error) {
+	events := make([]StreamEvent, 0)
+	inRange := db.Where("height >= ? AND height <= ?", from, to)
+
+	var proposals []Proposal
+	if err := db.Where("new_height >= ? AND new_height <= ?", from, to).Find(&proposals).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range proposals {
+		events = append(events, StreamEvent{Height: p.NewHeight, Type: StreamEventProposal, Proposal: p.Id, Agents: []string{p.ProposerAddress}, Data: p})
+	}
+
+	var revisions []ProposalRevision
+	if err := inRange.Where("revision > 0").Order("id asc").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range revisions {
+		var p Proposal
+		if err := db.Where("id = ?", r.Proposal).First(&p).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+		events = append(events, StreamEvent{Height: r.Height, Type: StreamEventRevision, Proposal: r.Proposal, Agents: []string{p.ProposerAddress}, Data: r})
+	}
+
+	var discussions []Discussion
+	if err := inRange.Order("id asc").Find(&discussions).Error; err != nil {
+		return nil, err
+	}
+	if err := loadDiscussionReferences(db, discussions); err != nil {
+		return nil, err
+	}
+	for _, d := range discussions {
+		events = append(events, StreamEvent{Height: d.Height, Type: StreamEventDiscussion, Proposal: d.Proposal, Agents: []string{d.SpeakerAddress}, Data: d})
+	}
+
+	var tallies []VoteTally
+	if err := inRange.Find(&tallies).Error; err != nil {
+		return nil, err
+	}
+	var pvs []ProposalVote
+	if err := inRange.Order("id asc").Find(&pvs).Error; err != nil {
+		return nil, err
+	}
+	var gvs []GrantVote
+	if err := inRange.Order("id asc").Find(&gvs).Error; err != nil {
+		return nil, err
+	}
+	var grants []Grant
+	if err := inRange.Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	votesAt := make(map[uint64][]ProposalVote)
+	for _, v := range pvs {
+		votesAt[v.Height] = append(votesAt[v.Height], v)
+	}
+	grantVotesAt := make(map[uint64][]GrantVote)
+	for _, v := range gvs {
+		grantVotesAt[v.Height] = append(grantVotesAt[v.Height], v)
+	}
+	tallyAt := make(map[uint64]*VoteTally)
+	for i := range tallies {
+		tallyAt[tallies[i].Height] = &tallies[i]
+	}
+	for _, t := range tallies {
+		votes := votesAt[t.Height]
+		agents := make([]string, 0, len(votes))
+		for _, v := range votes {
+			agents = append(agents, v.VoterAddress)
+		}
+		tally := tallyAt[t.Height]
+		switch t.Kind {
+		case VoteKindProcess:
+			events = append(events, StreamEvent{Height: t.Height, Type: StreamEventDraftTally, Proposal: t.Subject, Agents: agents,
+				Data: StreamVotes{Tally: tally, Votes: votes}})
+		case VoteKindSettle:
+			var p Proposal
+			if err := db.Where("id = ?", t.Subject).First(&p).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+				return nil, err
+			}
+			events = append(events, StreamEvent{Height: t.Height, Type: StreamEventSettle, Proposal: t.Subject, Agents: agents,
+				Data: StreamSettle{Status: p.Status, Tally: tally, Votes: votes}})
+		}
+	}
+	for _, g := range grants {
+		votes := grantVotesAt[g.Height]
+		agents := []string{g.Address, g.ProposerAddress}
+		for _, v := range votes {
+			agents = append(agents, v.VoterAddress)
+		}
+		events = append(events, StreamEvent{Height: g.Height, Type: StreamEventGrant, Agents: agents,
+			Data: StreamGrant{Grant: g, Tally: tallyAt[g.Height], Votes: votes}})
+	}
+
+	var retracts []MembershipEvent
+	if err := inRange.Where("kind = ?", MembershipRetract).Order("id asc").Find(&retracts).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range retracts {
+		events = append(events, StreamEvent{Height: r.Height, Type: StreamEventRetract, Agents: []string{r.Address}, Data: r})
+	}
+
+	var sets []ValidatorSet
+	if err := inRange.Find(&sets).Error; err != nil {
+		return nil, err
+	}
+	for _, set := range sets {
+		members := make([]ValidatorSetMember, 0)
+		if err := db.Where("height = ?", set.Height).Order("power desc, address asc").Find(&members).Error; err != nil {
+			return nil, err
+		}
+		agents := make([]string, 0, len(members))
+		for _, m := range members {
+			agents = append(agents, m.Address)
+		}
+		events = append(events, StreamEvent{Height: set.Height, Type: StreamEventValidatorSet, Agents: agents,
+			Data: StreamValidatorSet{Set: set, Members: members}})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Height != events[j].Height {
+			return events[i].Height < events[j].Height
+		}
+		return streamEventOrder[events[i].Type] < streamEventOrder[events[j].Type]
+	})
+	for i := range events {
+		if i > 0 && events[i].Height == events[i-1].Height {
+			events[i].Seq = events[i-1].Seq + 1
+		}
+	}
+	return events, nil
+}
+
+// StreamSubscription receives the live events of a StreamHub. Events is
+// closed when the subscriber falls behind or unsubscribes.
+type StreamSubscription struct {
+	Events <-chan StreamEvent
+	// height the hub was at when subscribing, replay covers the heights up
+	// to it and later events arrive live
+	Height uint64
+
+	ch     chan StreamEvent
+	filter StreamFilter
+}
+
+// StreamHub pushes the events of every height indexed with its votes to its
+// subscribers, see streamHeight.
+type StreamHub struct {
+	logger cmtlog.Logger
+	db     *gorm.DB
+
+	mtx    sync.Mutex
+	height uint64
+	subs   map[*StreamSubscription]struct{}
+}
+
+func NewStreamHub(logger cmtlog.Logger, db *gorm.DB, height uint64) *StreamHub {
+	return &StreamHub{
+		logger: logger.With("module", "stream"),
+		db:     db,
+		height: height,
+		subs:   make(map[*StreamSubscription]struct{}),
+	}
+}
+
+func (h *StreamHub) Subscribe(filter StreamFilter) *StreamSubscription {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	ch := make(chan StreamEvent, streamBufferSize)
+	sub := &StreamSubscription{Events: ch, Height: h.height, ch: ch, filter: filter}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *StreamHub) Unsubscribe(sub *StreamSubscription) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Indexed pushes the events of the heights above the stream up to height.
+func (h *StreamHub) Indexed(height uint64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if height <= h.height {
+		return
+	}
+	from := h.height + 1
+	h.height = height
+	if len(h.subs) == 0 {
+		return
+	}
+	events, err := loadStreamEvents(h.db, from, height)
+	if err != nil {
+		h.logger.Error("load stream events fail", "from", from, "to", height, "err", err)
+		return
+	}
+	for sub := range h.subs {
+		for _, ev := range events {
+			if !sub.filter.match(ev) {
+				continue
+			}
+			if !h.push(sub, ev) {
+				break
+			}
+		}
+	}
+}
+
+// Reindexed tells every subscriber to resume from height if the heights from
+// it on were already streamed before they were indexed again.
+func (h *StreamHub) Reindexed(height uint64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if height > h.height {
+		return
+	}
+	for sub := range h.subs {
+		h.push(sub, StreamEvent{Height: height, Type: StreamEventResync, Agents: []string{}})
+	}
+}
+
+// push sends ev to sub, or drops sub if it is too slow.
+func (h *StreamHub) push(sub *StreamSubscription, ev StreamEvent) bool {
+	select {
+	case sub.ch <- ev:
+		return true
+	default:
+		h.logger.Info("drop slow stream subscriber", "height", ev.Height)
+		delete(h.subs, sub)
+		close(sub.ch)
+		return false
+	}
+}
+
+// Replay sends the events of the heights from cursor up to the height of sub
+// to send, in order.
+func (h *StreamHub) Replay(sub *StreamSubscription, cursor StreamCursor, send func(StreamEvent) error) error {
+	from := cursor.Height
+	if from == 0 {
+		from = sub.Height + 1
+	}
+	for from <= sub.Height {
+		to := from + streamReplayBatch - 1
+		if to > sub.Height {
+			to = sub.Height
+		}
+		events, err := loadStreamEvents(h.db, from, to)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if !cursor.before(ev) || !sub.filter.match(ev) {
+				continue
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+		from = to + 1
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	hac_types "github.com/calehh/hac-app/types"
+	abci "github.com/cometbft/cometbft/abci/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+// received returns the events buffered for sub.
+func received(sub *StreamSubscription) []StreamEvent {
+	var events []StreamEvent
+	for {
+		select {
+		case ev := <-sub.Events:
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestStreamHeight(t *testing.T) {
+	db := openTestStore(t).DB()
+	createRows(t, db, &Height{Id: 1, Height: 5}, &IndexedBlock{Height: 5}, &IndexedBlock{Height: 4, VotesPending: true})
+	if h, err := streamHeight(db); err != nil || h != 3 {
+		t.Fatalf("stream height %d, %v, want the height below the pending votes", h, err)
+	}
+	if err := db.Model(&IndexedBlock{}).Where("height = ?", 4).Update("votes_pending", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if h, err := streamHeight(db); err != nil || h != 5 {
+		t.Fatalf("stream height %d, %v, want the cursor", h, err)
+	}
+}
+
+func TestStreamHubIndexed(t *testing.T) {
+	db := openTestStore(t).DB()
+	createRows(t, db,
+		&Proposal{Id: 1, NewHeight: 1, ProposerAddress: "A"},
+		&Proposal{Id: 2, NewHeight: 2, ProposerAddress: "B"},
+		&Proposal{Id: 3, NewHeight: 3, ProposerAddress: "A"},
+	)
+	hub := NewStreamHub(cmtlog.NewNopLogger(), db, 0)
+	all := hub.Subscribe(StreamFilter{})
+	byA := hub.Subscribe(StreamFilter{Agent: "A"})
+
+	// every height above the stream is pushed, not only the last one
+	hub.Indexed(2)
+	if events := received(all); len(events) != 2 || events[0].Proposal != 1 || events[1].Proposal != 2 {
+		t.Fatalf("events %+v, want proposals 1 and 2", events)
+	}
+	if events := received(byA); len(events) != 1 || events[0].Proposal != 1 {
+		t.Fatalf("filtered events %+v, want proposal 1", events)
+	}
+	hub.Indexed(2)
+	hub.Indexed(1)
+	if events := received(all); len(events) != 0 {
+		t.Fatalf("events %+v pushed again", events)
+	}
+	hub.Indexed(3)
+	if events := received(all); len(events) != 1 || events[0].Proposal != 3 || events[0].Seq != 0 {
+		t.Fatalf("events %+v, want proposal 3", events)
+	}
+	received(byA)
+
+	// heights above the stream are streamed anyway, the ones below need a
+	// resync
+	hub.Reindexed(4)
+	if events := received(all); len(events) != 0 {
+		t.Fatalf("events %+v, want none", events)
+	}
+	hub.Reindexed(2)
+	for _, sub := range []*StreamSubscription{all, byA} {
+		if events := received(sub); len(events) != 1 || events[0].Type != StreamEventResync || events[0].Height != 2 {
+			t.Fatalf("events %+v, want a resync from 2", events)
+		}
+	}
+}
+
+func TestStreamVotesOfCommittedHeights(t *testing.T) {
+	chain := newTestChain(t)
+	c := newTestIndexer(t, chain, openTestStore(t))
+	c.stream = NewStreamHub(cmtlog.NewNopLogger(), c.db, 0)
+	sub := c.stream.Subscribe(StreamFilter{})
+	ctx := context.Background()
+
+	chain.addBlocks(t, 1)
+	proposal := hac_types.EncodeEventProposal(&hac_types.EventProposal{ProposalIndex: 1, Status: uint64(hac_types.ProposalStatusProcessing), Title: "t"})
+	chain.addBlock(t, []cmttypes.Tx{cmttypes.Tx("tx")}, []*abci.ExecTxResult{{Events: []abci.Event{proposal}}})
+	c.catchUp(ctx)
+	// the votes on the proposal are in the commit of the next block
+	if events := received(sub); len(events) != 1 || events[0].Height != 1 || events[0].Type != StreamEventValidatorSet {
+		t.Fatalf("events %+v, want only the validator set of height 1", events)
+	}
+
+	chain.addBlocks(t, 1)
+	c.catchUp(ctx)
+	events := received(sub)
+	if len(events) != 2 {
+		t.Fatalf("events %+v, want the proposal and its tally", events)
+	}
+	if events[0].Type != StreamEventProposal || events[1].Type != StreamEventDraftTally || events[1].Height != 2 || events[1].Seq != 1 {
+		t.Fatalf("events %+v", events)
+	}
+	if votes := events[1].Data.(StreamVotes); votes.Tally == nil || len(votes.Votes) != 1 {
+		t.Fatalf("tally %+v", votes)
+	}
+
+	// repaired heights were streamed without their rows
+	if err := c.db.Where("height = ?", 1).Delete(&IndexedBlock{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := c.repairGaps(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if events := received(sub); len(events) != 1 || events[0].Type != StreamEventResync || events[0].Height != 1 {
+		t.Fatalf("events %+v, want a resync from 1", events)
+	}
+}
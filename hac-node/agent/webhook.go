@@ -0,0 +1,472 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	app_config "github.com/calehh/hac-app/config"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// headers of a webhook request
+	WebhookHeaderEvent     = "X-HAC-Event"
+	WebhookHeaderDelivery  = "X-HAC-Delivery"
+	WebhookHeaderTimestamp = "X-HAC-Timestamp"
+	// hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the subscription
+	// secret, prefixed with "sha256="
+	WebhookHeaderSignature = "X-HAC-Signature"
+
+	// delay before the first retry of a delivery, doubled on every failure
+	WebhookRetryDelay    = 10 * time.Second
+	WebhookMaxRetryDelay = time.Hour
+	// heights queued at once
+	webhookQueueBatch = 100
+	// deliveries attempted in one round
+	webhookDeliverBatch = 100
+)
+
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+
+// webhookPayload is the body of a webhook request.
+type webhookPayload struct {
+	Id           string      `json:"id"`
+	Subscription uint64      `json:"subscription"`
+	Event        StreamEvent `json:"event"`
+}
+
+func streamEventKey(ev StreamEvent) string {
+	return fmt.Sprintf("%d-%d-%s", ev.Height, ev.Seq, ev.Type)
+}
+
+// signWebhook returns the signature of a webhook body sent at timestamp.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s WebhookSubscription) filter() StreamFilter {
+	f := StreamFilter{Proposal: s.Proposal, Agent: s.Agent}
+	if s.Types != "" {
+		f.Types = make(map[string]bool)
+		for _, t := range strings.Split(s.Types, ",") {
+			f.Types[t] = true
+		}
+	}
+	return f
+}
+
+// WebhookDispatcher queues the indexed governance events for the webhook
+// subscriptions and delivers them. A delivery is retried with a growing delay
+// until the endpoint answers 2xx, so an event may arrive more than once and
+// receivers dedup by the delivery id.
+type WebhookDispatcher struct {
+	logger      cmtlog.Logger
+	db          *gorm.DB
+	client      *http.Client
+	maxAttempts int
+	notify      chan struct{}
+}
+
+func NewWebhookDispatcher(logger cmtlog.Logger, db *gorm.DB, cfg app_config.WebhookConfig) *WebhookDispatcher {
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = app_config.DefaultWebhookMaxAttempts
+	}
+	return &WebhookDispatcher{
+		logger:      logger.With("module", "webhook"),
+		db:          db,
+		client:      &http.Client{Timeout: webhookTimeout},
+		maxAttempts: maxAttempts,
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+// Indexed wakes the dispatcher up after a height was committed.
+func (d *WebhookDispatcher) Indexed(height uint64) {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run queues and delivers events until ctx is done.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(BroadcastInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.queue(ctx); err != nil {
+			d.logger.Error("queue webhook deliveries fail", "err", err)
+		}
+		if err := d.deliver(ctx); err != nil {
+			d.logger.Error("webhook deliveries fail", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.notify:
+		}
+	}
+}
+
+// queue turns the events of the heights indexed since the cursor of every
+// active subscription into pending deliveries. Heights are queued once their
+// votes are indexed, see streamHeight.
+func (d *WebhookDispatcher) queue(ctx context.Context) error {
+	indexed, err := streamHeight(d.db)
+	if err != nil {
+		return err
+	}
+	var subs []WebhookSubscription
+	if err := d.db.Where("active = ? AND height < ?", true, indexed).Find(&subs).Error; err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	from := indexed
+	for _, sub := range subs {
+		if sub.Height < from {
+			from = sub.Height
+		}
+	}
+	from++
+	for from <= indexed {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		to := from + webhookQueueBatch - 1
+		if to > indexed {
+			to = indexed
+		}
+		events, err := loadStreamEvents(d.db, from, to)
+		if err != nil {
+			return err
+		}
+		for i := range subs {
+			if subs[i].Height >= to {
+				continue
+			}
+			if err := d.queueEvents(&subs[i], events, to); err != nil {
+				return err
+			}
+		}
+		from = to + 1
+	}
+	return nil
+}
+
+// queueEvents queues the events after the cursor of sub and moves the cursor
+// to height, in one transaction.
+func (d *WebhookDispatcher) queueEvents(sub *WebhookSubscription, events []StreamEvent, height uint64) error {
+	filter := sub.filter()
+	now := time.Now().Unix()
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		for _, ev := range events {
+			if ev.Height <= sub.Height || !filter.match(ev) {
+				continue
+			}
+			key := streamEventKey(ev)
+			var cnt uint64
+			if err := tx.Model(&WebhookDelivery{}).Where("subscription = ? AND key = ?", sub.Id, key).Count(&cnt).Error; err != nil {
+				return err
+			}
+			if cnt > 0 {
+				continue
+			}
+			payload, err := json.Marshal(webhookPayload{Id: key, Subscription: sub.Id, Event: ev})
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&WebhookDelivery{
+				Subscription: sub.Id,
+				Key:          key,
+				Height:       ev.Height,
+				EventType:    ev.Type,
+				Payload:      string(payload),
+				Status:       OutboxPending,
+				NextAttempt:  now,
+				CreatedAt:    now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&WebhookSubscription{}).Where("id = ?", sub.Id).Update("height", height).Error
+	})
+	if err != nil {
+		return err
+	}
+	sub.Height = height
+	return nil
+}
+
+// deliver sends a round of due deliveries. After a failure the remaining
+// deliveries of the same subscription wait for the next round.
+func (d *WebhookDispatcher) deliver(ctx context.Context) error {
+	var deliveries []WebhookDelivery
+	err := d.db.Where("status = ? AND next_attempt <= ?", OutboxPending, time.Now().Unix()).
+		Order("id asc").Limit(webhookDeliverBatch).Find(&deliveries).Error
+	if err != nil {
+		return err
+	}
+	subs := make(map[uint64]*WebhookSubscription)
+	failed := make(map[uint64]bool)
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if failed[delivery.Subscription] {
+			continue
+		}
+		sub, ok := subs[delivery.Subscription]
+		if !ok {
+			sub = &WebhookSubscription{}
+			if err := d.db.Where("id = ?", delivery.Subscription).First(sub).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+				sub = nil
+			}
+			subs[delivery.Subscription] = sub
+		}
+		if sub == nil || !sub.Active {
+			continue
+		}
+		delivery.Attempts++
+		code, err := d.send(ctx, sub, delivery)
+		delivery.ResponseCode = code
+		if err != nil {
+			failed[sub.Id] = true
+			delivery.LastError = err.Error()
+			if delivery.Attempts >= d.maxAttempts {
+				delivery.Status = OutboxFailed
+				d.logger.Error("give up webhook delivery", "subscription", sub.Id, "key", delivery.Key, "attempts", delivery.Attempts, "err", err)
+			} else {
+				delay := retryDelay(WebhookRetryDelay, WebhookMaxRetryDelay, delivery.Attempts)
+				delivery.NextAttempt = time.Now().Add(delay).Unix()
+				d.logger.Info("webhook delivery fail, retry", "subscription", sub.Id, "key", delivery.Key, "attempts", delivery.Attempts, "retry", delay, "err", err)
+			}
+		} else {
+			delivery.Status = OutboxSent
+			delivery.DeliveredAt = time.Now().Unix()
+			delivery.LastError = ""
+		}
+		if err := d.db.Save(&delivery).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send posts a delivery to its subscription and returns the response code.
+func (d *WebhookDispatcher) send(ctx context.Context, sub *WebhookSubscription, delivery WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderEvent, delivery.EventType)
+	req.Header.Set(WebhookHeaderDelivery, delivery.Key)
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookHeaderSignature, signWebhook(sub.Secret, timestamp, body))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("webhook: %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+// WebhookParams are the settable fields of a subscription.
+type WebhookParams struct {
+	Url      string   `json:"url"`
+	Types    []string `json:"types"`
+	Proposal uint64   `json:"proposal"`
+	Agent    string   `json:"agent"`
+}
+
+func (p WebhookParams) validate() error {
+	u, err := url.Parse(p.Url)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook url must be an absolute http(s) url")
+	}
+	for _, t := range p.Types {
+		if _, ok := streamEventOrder[t]; !ok {
+			return fmt.Errorf("unknown event type %s", t)
+		}
+	}
+	return nil
+}
+
+func (p WebhookParams) types() string {
+	types := append([]string{}, p.Types...)
+	sort.Slice(types, func(i, j int) bool { return streamEventOrder[types[i]] < streamEventOrder[types[j]] })
+	return strings.Join(types, ",")
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// createWebhook registers a subscription receiving the events from the height
+// fromHeight on, or from the next indexed height if it is 0. A random secret is
+// generated if secret is empty.
+func (c *ChainIndexer) createWebhook(params WebhookParams, secret string, fromHeight uint64) (*WebhookSubscription, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	height := fromHeight
+	if height > 0 {
+		height--
+	} else {
+		var err error
+		if height, err = streamHeight(c.db); err != nil {
+			return nil, err
+		}
+	}
+	sub := &WebhookSubscription{
+		Url:       params.Url,
+		Types:     params.types(),
+		Proposal:  params.Proposal,
+		Agent:     params.Agent,
+		Secret:    secret,
+		Active:    true,
+		Height:    height,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := c.db.Create(sub).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (c *ChainIndexer) getWebhook(id uint64) (*WebhookSubscription, error) {
+	var sub WebhookSubscription
+	if err := c.db.Where("id = ?", id).First(&sub).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (c *ChainIndexer) getWebhooks() ([]WebhookSubscription, error) {
+	subs := make([]WebhookSubscription, 0)
+	if err := c.db.Order("id asc").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// updateWebhook replaces the parameters of a subscription and pauses or
+// resumes it. A resumed subscription also receives the events indexed while it
+// was paused.
+func (c *ChainIndexer) updateWebhook(id uint64, params WebhookParams, active bool) (*WebhookSubscription, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	sub, err := c.getWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	sub.Url = params.Url
+	sub.Types = params.types()
+	sub.Proposal = params.Proposal
+	sub.Agent = params.Agent
+	sub.Active = active
+	if err := c.db.Save(sub).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// deleteWebhook removes a subscription together with its delivery history.
+func (c *ChainIndexer) deleteWebhook(id uint64) error {
+	if _, err := c.getWebhook(id); err != nil {
+		return err
+	}
+	return c.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription = ?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&WebhookSubscription{}).Error
+	})
+}
+
+// getWebhookDeliveries returns the deliveries of a subscription, newest first.
+func (c *ChainIndexer) getWebhookDeliveries(id uint64, status string, page int, pageSize int) ([]WebhookDelivery, uint64, error) {
+	if _, err := c.getWebhook(id); err != nil {
+		return nil, 0, err
+	}
+	query := c.db.Model(&WebhookDelivery{}).Where("subscription = ?", id)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total uint64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	deliveries := make([]WebhookDelivery, 0)
+	if err := query.Order("id desc").Offset(page * pageSize).Limit(pageSize).Find(&deliveries).Error; err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// redeliverWebhook queues a delivered or failed delivery again.
+func (c *ChainIndexer) redeliverWebhook(id uint64, deliveryId uint64) error {
+	res := c.db.Model(&WebhookDelivery{}).Where("id = ? AND subscription = ?", deliveryId, id).Updates(map[string]interface{}{
+		"status":       OutboxPending,
+		"attempts":     0,
+		"next_attempt": time.Now().Unix(),
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	if c.webhooks != nil {
+		c.webhooks.Indexed(0)
+	}
+	return nil
+}
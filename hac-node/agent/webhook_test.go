@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	app_config "github.com/calehh/hac-app/config"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"id":"1-0-proposal"}`)
+	sig := signWebhook("secret", 1700000000, body)
+	// echo -n '1700000000.{"id":"1-0-proposal"}' | openssl dgst -sha256 -hmac secret
+	if want := "sha256=a329b44301751f430a69756bb8ea4ba5e80c16c7e3e8f4307f48c362eba0ecfa"; sig != want {
+		t.Fatalf("signature %q, want %q", sig, want)
+	}
+	for name, other := range map[string]string{
+		"secret":    signWebhook("other", 1700000000, body),
+		"timestamp": signWebhook("secret", 1700000001, body),
+		"body":      signWebhook("secret", 1700000000, []byte(`{"id":"1-1-proposal"}`)),
+	} {
+		if other == sig {
+			t.Errorf("signature ignores the %s", name)
+		}
+	}
+}
+
+func TestWebhookParams(t *testing.T) {
+	for _, tc := range []struct {
+		params WebhookParams
+		ok     bool
+	}{
+		{WebhookParams{Url: "https://example.com/hook"}, true},
+		{WebhookParams{Url: "http://localhost:8080", Types: []string{"settle", "proposal"}}, true},
+		{WebhookParams{Url: "/hook"}, false},
+		{WebhookParams{Url: "ftp://example.com"}, false},
+		{WebhookParams{Url: "https://example.com", Types: []string{"resync"}}, false},
+	} {
+		if err := tc.params.validate(); (err == nil) != tc.ok {
+			t.Errorf("validate %+v: %v", tc.params, err)
+		}
+	}
+	if got := (WebhookParams{Types: []string{"grant", "settle", "proposal"}}).types(); got != "proposal,settle,grant" {
+		t.Errorf("types %q", got)
+	}
+}
+
+func TestWebhookQueue(t *testing.T) {
+	db := openTestStore(t).DB()
+	createRows(t, db,
+		&Height{Id: 1, Height: 3},
+		&Proposal{Id: 1, NewHeight: 1, ProposerAddress: "A1"},
+		&Proposal{Id: 2, NewHeight: 2, ProposerAddress: "A2"},
+		&Proposal{Id: 3, NewHeight: 3, ProposerAddress: "A1"},
+		&IndexedBlock{Height: 3, VotesPending: true},
+	)
+	c := &ChainIndexer{db: db}
+	all, err := c.createWebhook(WebhookParams{Url: "https://example.com/all"}, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.Height != 0 || len(all.Secret) != 64 {
+		t.Fatalf("subscription %+v", all)
+	}
+	agent, err := c.createWebhook(WebhookParams{Url: "https://example.com/a1", Agent: "A1", Types: []string{"proposal"}}, "s", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a subscription from the next height starts after the votes of height 2
+	next, err := c.createWebhook(WebhookParams{Url: "https://example.com/next"}, "s", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Height != 2 {
+		t.Fatalf("next subscription starts after %d, want 2", next.Height)
+	}
+
+	d := NewWebhookDispatcher(cmtlog.NewNopLogger(), db, app_config.WebhookConfig{})
+	queued := func(sub uint64) []string {
+		t.Helper()
+		var deliveries []WebhookDelivery
+		if err := db.Where("subscription = ?", sub).Order("id asc").Find(&deliveries).Error; err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, delivery := range deliveries {
+			keys = append(keys, delivery.Key)
+		}
+		return keys
+	}
+	equal := func(got []string, want ...string) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.queue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got := queued(all.Id); !equal(got, "1-0-proposal", "2-0-proposal") {
+			t.Fatalf("all queued %v", got)
+		}
+		if got := queued(agent.Id); !equal(got, "1-0-proposal") {
+			t.Fatalf("agent queued %v", got)
+		}
+		if got := queued(next.Id); len(got) != 0 {
+			t.Fatalf("next queued %v", got)
+		}
+	}
+
+	// height 3 is queued once its votes are indexed
+	if err := db.Model(&IndexedBlock{}).Where("height = ?", 3).Update("votes_pending", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.queue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := queued(agent.Id); !equal(got, "1-0-proposal", "3-0-proposal") {
+		t.Fatalf("agent queued %v", got)
+	}
+	if got := queued(next.Id); !equal(got, "3-0-proposal") {
+		t.Fatalf("next queued %v", got)
+	}
+	var payload webhookPayload
+	var delivery WebhookDelivery
+	if err := db.Where("subscription = ? AND key = ?", next.Id, "3-0-proposal").First(&delivery).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil || payload.Id != delivery.Key || payload.Subscription != next.Id || payload.Event.Proposal != 3 {
+		t.Fatalf("payload %+v, %v", payload, err)
+	}
+}
+
+func TestWebhookDeliver(t *testing.T) {
+	var requests []*http.Request
+	var bodies [][]byte
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	db := openTestStore(t).DB()
+	now := time.Now().Unix()
+	createRows(t, db,
+		&WebhookSubscription{Id: 1, Url: srv.URL, Secret: "secret", Active: true},
+		&WebhookSubscription{Id: 2, Url: srv.URL, Secret: "secret", Active: false},
+		&WebhookDelivery{Subscription: 1, Key: "1-0-proposal", EventType: "proposal", Payload: `{"id":"1-0-proposal"}`, Status: OutboxPending, NextAttempt: now},
+		&WebhookDelivery{Subscription: 1, Key: "2-0-proposal", EventType: "proposal", Payload: `{"id":"2-0-proposal"}`, Status: OutboxPending, NextAttempt: now},
+		&WebhookDelivery{Subscription: 2, Key: "1-0-proposal", EventType: "proposal", Payload: `{"id":"1-0-proposal"}`, Status: OutboxPending, NextAttempt: now},
+	)
+	d := NewWebhookDispatcher(cmtlog.NewNopLogger(), db, app_config.WebhookConfig{MaxAttempts: 2})
+	load := func(sub uint64, key string) WebhookDelivery {
+		t.Helper()
+		var delivery WebhookDelivery
+		if err := db.Where("subscription = ? AND key = ?", sub, key).First(&delivery).Error; err != nil {
+			t.Fatal(err)
+		}
+		return delivery
+	}
+
+	// a failure holds back the later deliveries of the subscription
+	if err := d.deliver(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(requests))
+	}
+	first := load(1, "1-0-proposal")
+	if first.Status != OutboxPending || first.Attempts != 1 || first.ResponseCode != http.StatusInternalServerError ||
+		first.NextAttempt < now+int64(WebhookRetryDelay/time.Second) {
+		t.Fatalf("delivery %+v after a failure", first)
+	}
+	if second := load(1, "2-0-proposal"); second.Attempts != 0 {
+		t.Fatalf("delivery %+v attempted after a failure", second)
+	}
+	if inactive := load(2, "1-0-proposal"); inactive.Attempts != 0 {
+		t.Fatalf("delivery %+v to an inactive subscription", inactive)
+	}
+
+	// given up after the last attempt
+	if err := db.Model(&first).Update("next_attempt", now).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.deliver(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if first = load(1, "1-0-proposal"); first.Status != OutboxFailed || first.Attempts != 2 {
+		t.Fatalf("delivery %+v, want it given up", first)
+	}
+
+	status = http.StatusNoContent
+	requests, bodies = nil, nil
+	if err := d.deliver(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(requests))
+	}
+	second := load(1, "2-0-proposal")
+	if second.Status != OutboxSent || second.DeliveredAt == 0 || second.ResponseCode != http.StatusNoContent {
+		t.Fatalf("delivery %+v, want it sent", second)
+	}
+	r := requests[0]
+	if r.Header.Get(WebhookHeaderEvent) != "proposal" || r.Header.Get(WebhookHeaderDelivery) != "2-0-proposal" || string(bodies[0]) != second.Payload {
+		t.Fatalf("request headers %v body %s", r.Header, bodies[0])
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(WebhookHeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hmac.Equal([]byte(r.Header.Get(WebhookHeaderSignature)), []byte(signWebhook("secret", timestamp, bodies[0]))) {
+		t.Fatalf("signature %s does not verify", r.Header.Get(WebhookHeaderSignature))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 
 	"github.com/calehh/hac-app/agent"
+	"github.com/calehh/hac-app/blob"
 	"github.com/calehh/hac-app/config"
 	"github.com/calehh/hac-app/state"
 	"github.com/calehh/hac-app/tx"
@@ -37,6 +38,8 @@ type HACApp struct {
 	lastBlk  finalizeBlock
 	txHdlrs  map[tx.HACTxType]handler.TxHandler
 	queriers map[string]Querier
+	// content of proposals referenced by hash, fetched before the agent votes
+	blobs *blob.Fetcher
 
 	st *state.State
 }
@@ -49,6 +52,10 @@ func NewHACApp(cfg *config.HACAppConfig, agentClient agent.Client, logger cmtlog
 	if err != nil {
 		return nil, err
 	}
+	blobs, err := blob.Open(logger, cfg.Home, cfg.Blobs)
+	if err != nil {
+		return nil, err
+	}
 
 	app = &HACApp{
 		cfg:      cfg,
@@ -56,6 +63,7 @@ func NewHACApp(cfg *config.HACAppConfig, agentClient agent.Client, logger cmtlog
 		db:       db,
 		txHdlrs:  make(map[tx.HACTxType]handler.TxHandler),
 		queriers: make(map[string]Querier),
+		blobs:    blobs,
 	}
 	app.registerTxHandler()
 	app.registerQuerier()
@@ -89,14 +97,22 @@ func (app *HACApp) registerTxHandler() {
 		tx.HACTxTypeProposal:       handler.NewProposalTxHandler(app.logger),
 		tx.HACTxTypeDiscussion:     handler.NewDiscussionTxHandler(app.logger),
 		tx.HACTxTypeGrant:          handler.NewGrantTxHandler(app.logger),
+
+		tx.HACTxTypeRegisterParticipant: handler.NewRegisterParticipantTxHandler(app.logger),
+		tx.HACTxTypeReviseProposal:      handler.NewReviseProposalTxHandler(app.logger),
 	}
 }
 
 func (app *HACApp) registerQuerier() {
 	aq := NewAccountQuerier(app.db, app.logger)
 	vq := NewValidatorQuerier(app.db, app.logger)
+	pq := NewProposalQuerier(app.db, app.logger)
 	app.queriers["/accounts/"] = aq
 	app.queriers["/validators/"] = vq
+	app.queriers["/proposals/"] = pq
+	app.queriers["/executions/"] = NewExecutionQuerier(app.db, app.logger)
+	app.queriers["/upgrade/"] = NewUpgradeQuerier(app.db, app.logger)
+	app.queriers["/treasury/"] = NewTreasuryQuerier(app.db, app.logger)
 }
 
 func (app *HACApp) InitChain(_ context.Context, chain *abcitypes.RequestInitChain) (res *abcitypes.ResponseInitChain, err error) {
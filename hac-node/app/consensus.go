@@ -63,11 +63,23 @@ func (app *HACApp) CheckTx(ctx context.Context, check *abcitypes.RequestCheckTx)
 		res.Code = 1
 		res.Log = err.Error()
 		err = nil
+		return
 	}
-
+	app.prefetchContent(btx)
 	return
 }
 
+// prefetchContent fetches the payload a proposal or a revision references
+// while it waits in the mempool, the votes on it only read the blob store.
+func (app *HACApp) prefetchContent(btx *tx.HACTx) {
+	switch stx := btx.Tx.(type) {
+	case *tx.ProposalTx:
+		app.blobs.Prefetch(stx.ContentHash)
+	case *tx.ReviseProposalTx:
+		app.blobs.Prefetch(stx.ContentHash)
+	}
+}
+
 func (app *HACApp) PrepareProposal(ctx context.Context, proposal *abcitypes.RequestPrepareProposal) (res *abcitypes.ResponsePrepareProposal, err error) {
 	app.logger.Info("PrepareProposal")
 	st := app.getState(nil)
@@ -317,7 +329,17 @@ func (app *HACApp) getCode(ctx context.Context, st *state.State, txs [][]byte) (
 			}
 			proposerAct = true
 			stx := btx.Tx.(*tx.ProposalTx)
-			pass, err := agent.ElizaCli.IfProcessProposal(ctx, stx.Data)
+			data, err := app.proposalContent(stx.Data, stx.ContentHash)
+			if err != nil {
+				// every validator without the content votes the same way
+				app.logger.Error("proposal content unavailable, ignore proposal", "hash", stx.ContentHash, "err", err)
+				code = tx.VoteIgnoreProposal
+				continue
+			}
+			if actions := tx.FormatProposalActions(stx.Actions); actions != "" {
+				data = append(append(append([]byte{}, data...), "\n\n"...), actions...)
+			}
+			pass, err := agent.ElizaCli.IfProcessProposal(ctx, tx.NormalizeCategory(stx.Category), data)
 			if err != nil {
 				return 0, err
 			}
@@ -341,7 +363,18 @@ func (app *HACApp) getCode(ctx context.Context, st *state.State, txs [][]byte) (
 				code = tx.VoteRejectProposal
 				continue
 			}
-			pass, err := agent.ElizaCli.IfAcceptProposal(ctx, stx.Proposal, voterAct.Address())
+			proposal, err := st.GetProposal(stx.Proposal)
+			if err != nil {
+				return 0, err
+			}
+			if proposal.ContentHash != "" && !app.blobs.Store().Has(proposal.ContentHash) {
+				// the agent cannot judge a revision it never received
+				app.logger.Error("proposal content unavailable, reject proposal", "hash", proposal.ContentHash)
+				app.blobs.Prefetch(proposal.ContentHash)
+				code = tx.VoteRejectProposal
+				continue
+			}
+			pass, err := agent.ElizaCli.IfAcceptProposal(ctx, stx.Proposal, stx.Revision, voterAct.Address())
 			if err != nil {
 				return 0, err
 			}
@@ -355,3 +388,21 @@ func (app *HACApp) getCode(ctx context.Context, st *state.State, txs [][]byte) (
 	}
 	return
 }
+
+// proposalContent returns the inline data of a proposal followed by the
+// payload it references in the local blob store, if any. Nothing is fetched
+// while voting, a missing payload is fetched in the background for later.
+func (app *HACApp) proposalContent(data []byte, hash string) ([]byte, error) {
+	if hash == "" {
+		return data, nil
+	}
+	content, err := app.blobs.Store().Get(hash)
+	if err != nil {
+		app.blobs.Prefetch(hash)
+		return nil, err
+	}
+	if len(data) == 0 {
+		return content, nil
+	}
+	return append(append(append([]byte{}, data...), "\n\n"...), content...), nil
+}
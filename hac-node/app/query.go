@@ -89,3 +89,148 @@ func (q *ValidatorQuerier) Query(ctx context.Context, req *abcitypes.RequestQuer
 	res.Value, _ = json.Marshal(validators)
 	return
 }
+
+// MaxProposalsPerQuery bounds the number of proposals returned by one
+// /proposals/ query.
+const MaxProposalsPerQuery = 100
+
+type ProposalQuerier struct {
+	db     *state.StateDB
+	logger cmtlog.Logger
+}
+
+func NewProposalQuerier(db *state.StateDB, logger cmtlog.Logger) (q *ProposalQuerier) {
+	q = &ProposalQuerier{
+		db:     db,
+		logger: logger,
+	}
+	return
+}
+
+// Query returns the proposals starting at the big-endian index in req.Data.
+func (q *ProposalQuerier) Query(ctx context.Context, req *abcitypes.RequestQuery) (res *abcitypes.ResponseQuery, err error) {
+	res = &abcitypes.ResponseQuery{}
+	if len(req.Data) > 8 {
+		res.Code = 1
+		return
+	}
+	var from uint64
+	for _, v := range req.Data {
+		from <<= 8
+		from |= uint64(v)
+	}
+	proposals, height, err := q.db.GetProposals(from, MaxProposalsPerQuery)
+	if err != nil {
+		res.Code = 1
+		return
+	}
+	res.Height = int64(height)
+	res.Value, _ = json.Marshal(proposals)
+	return
+}
+
+// queryIndex decodes the big-endian index in the data of a query.
+func queryIndex(data []byte) (uint64, bool) {
+	if len(data) > 8 {
+		return 0, false
+	}
+	var idx uint64
+	for _, v := range data {
+		idx <<= 8
+		idx |= uint64(v)
+	}
+	return idx, true
+}
+
+type ExecutionQuerier struct {
+	db     *state.StateDB
+	logger cmtlog.Logger
+}
+
+func NewExecutionQuerier(db *state.StateDB, logger cmtlog.Logger) (q *ExecutionQuerier) {
+	q = &ExecutionQuerier{
+		db:     db,
+		logger: logger,
+	}
+	return
+}
+
+// Query returns the execution of the proposal at the big-endian index in
+// req.Data.
+func (q *ExecutionQuerier) Query(ctx context.Context, req *abcitypes.RequestQuery) (res *abcitypes.ResponseQuery, err error) {
+	res = &abcitypes.ResponseQuery{}
+	proposal, ok := queryIndex(req.Data)
+	if !ok {
+		res.Code = 1
+		return
+	}
+	execution, height, err := q.db.GetExecution(proposal)
+	if err != nil || execution == nil {
+		err = nil
+		res.Code = 1
+		return
+	}
+	res.Height = int64(height)
+	res.Value, _ = json.Marshal(execution)
+	return
+}
+
+type UpgradeQuerier struct {
+	db     *state.StateDB
+	logger cmtlog.Logger
+}
+
+func NewUpgradeQuerier(db *state.StateDB, logger cmtlog.Logger) (q *UpgradeQuerier) {
+	q = &UpgradeQuerier{
+		db:     db,
+		logger: logger,
+	}
+	return
+}
+
+// Query returns the upgrade plan scheduled by the last accepted upgrade.
+func (q *UpgradeQuerier) Query(ctx context.Context, req *abcitypes.RequestQuery) (res *abcitypes.ResponseQuery, err error) {
+	res = &abcitypes.ResponseQuery{}
+	plan, height, err := q.db.GetUpgradePlan()
+	if err != nil || plan == nil {
+		err = nil
+		res.Code = 1
+		return
+	}
+	res.Height = int64(height)
+	res.Value, _ = json.Marshal(plan)
+	return
+}
+
+type TreasuryQuerier struct {
+	db     *state.StateDB
+	logger cmtlog.Logger
+}
+
+func NewTreasuryQuerier(db *state.StateDB, logger cmtlog.Logger) (q *TreasuryQuerier) {
+	q = &TreasuryQuerier{
+		db:     db,
+		logger: logger,
+	}
+	return
+}
+
+// Query returns the treasury spends authorized by the proposal at the
+// big-endian index in req.Data.
+func (q *TreasuryQuerier) Query(ctx context.Context, req *abcitypes.RequestQuery) (res *abcitypes.ResponseQuery, err error) {
+	res = &abcitypes.ResponseQuery{}
+	proposal, ok := queryIndex(req.Data)
+	if !ok {
+		res.Code = 1
+		return
+	}
+	spends, height, err := q.db.GetTreasurySpends(proposal)
+	if err != nil {
+		err = nil
+		res.Code = 1
+		return
+	}
+	res.Height = int64(height)
+	res.Value, _ = json.Marshal(spends)
+	return
+}
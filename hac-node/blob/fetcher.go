@@ -0,0 +1,140 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/calehh/hac-app/config"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+// Fetcher resolves blobs from the local store, falling back to the
+// /api/blobs endpoint of the configured peers. A fetched blob is verified
+// against its hash before it is stored.
+type Fetcher struct {
+	logger  cmtlog.Logger
+	store   *Store
+	peers   []string
+	timeout time.Duration
+	client  *http.Client
+
+	mtx      sync.Mutex
+	inflight map[string]struct{}
+}
+
+func NewFetcher(logger cmtlog.Logger, store *Store, peers []string, timeout time.Duration) *Fetcher {
+	return &Fetcher{
+		logger:   logger.With("module", "blob"),
+		store:    store,
+		peers:    peers,
+		timeout:  timeout,
+		client:   &http.Client{},
+		inflight: make(map[string]struct{}),
+	}
+}
+
+func (f *Fetcher) Store() *Store {
+	return f.store
+}
+
+// Fetch returns the blob with hash, asking the peers in order if it is not
+// held locally. The whole lookup is bounded by the fetch timeout.
+func (f *Fetcher) Fetch(ctx context.Context, hash string) ([]byte, error) {
+	data, err := f.store.Get(hash)
+	if !errors.Is(err, ErrNotFound) {
+		return data, err
+	}
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	for _, peer := range f.peers {
+		data, err := f.fetchPeer(ctx, peer, hash)
+		if err != nil {
+			f.logger.Error("fetch blob fail", "peer", peer, "hash", hash, "err", err)
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if err := f.store.PutHash(hash, data); err != nil {
+			return nil, err
+		}
+		f.logger.Info("blob fetched", "peer", peer, "hash", hash, "size", len(data))
+		return data, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Prefetch fetches the blob with hash in the background if it is not held
+// locally, so it is there once the validators vote on what references it.
+// Consensus only reads the local store.
+func (f *Fetcher) Prefetch(hash string) {
+	if !ValidHash(hash) || f.store.Has(hash) {
+		return
+	}
+	f.mtx.Lock()
+	if _, ok := f.inflight[hash]; ok {
+		f.mtx.Unlock()
+		return
+	}
+	f.inflight[hash] = struct{}{}
+	f.mtx.Unlock()
+	go func() {
+		defer func() {
+			f.mtx.Lock()
+			delete(f.inflight, hash)
+			f.mtx.Unlock()
+		}()
+		if _, err := f.Fetch(context.Background(), hash); err != nil {
+			f.logger.Error("prefetch blob fail", "hash", hash, "err", err)
+		}
+	}()
+}
+
+func (f *Fetcher) fetchPeer(ctx context.Context, peer string, hash string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(peer, "/")+"/api/blobs/"+hash, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %v", resp.StatusCode)
+	}
+	body := io.Reader(resp.Body)
+	if max := f.store.MaxSize(); max > 0 {
+		body = io.LimitReader(resp.Body, max+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if max := f.store.MaxSize(); max > 0 && int64(len(data)) > max {
+		return nil, ErrTooLarge
+	}
+	if Hash(data) != hash {
+		return nil, ErrHashMismatch
+	}
+	return data, nil
+}
+
+// Open returns the fetcher over the blob store in the data directory of home.
+func Open(logger cmtlog.Logger, home string, cfg config.BlobConfig) (*Fetcher, error) {
+	store, err := NewStore(filepath.Join(home, "data", "blobs"), cfg.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	return NewFetcher(logger, store, cfg.Peers, time.Duration(cfg.FetchTimeout)*time.Second), nil
+}
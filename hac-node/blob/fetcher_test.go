@@ -0,0 +1,68 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+// peer serves body for every blob, or status if it is not 200.
+func peer(t *testing.T, status int, body []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/blobs/") {
+			t.Errorf("request to %s", r.URL.Path)
+		}
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetcher(t *testing.T) {
+	data := []byte("proposal content")
+	hash := Hash(data)
+	store, err := NewStore(t.TempDir(), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := []string{
+		peer(t, http.StatusNotFound, nil).URL,
+		peer(t, http.StatusOK, []byte("forged content")).URL,
+		peer(t, http.StatusOK, bytes.Repeat([]byte("x"), 33)).URL,
+		peer(t, http.StatusOK, data).URL + "/",
+	}
+	f := NewFetcher(cmtlog.NewNopLogger(), store, peers, 0)
+
+	// the peers that do not serve the blob are skipped
+	got, err := f.Fetch(context.Background(), hash)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("fetch %q, %v", got, err)
+	}
+	if !store.Has(hash) {
+		t.Fatal("fetched blob not stored")
+	}
+
+	f = NewFetcher(cmtlog.NewNopLogger(), store, peers[:3], 0)
+	if _, err := f.Fetch(context.Background(), Hash([]byte("missing"))); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("fetch of a blob no peer holds: %v", err)
+	}
+	for status, body := range map[int][]byte{http.StatusOK: []byte("forged content"), http.StatusNotFound: nil} {
+		if _, err := f.fetchPeer(context.Background(), peer(t, status, body).URL, hash); err == nil {
+			t.Errorf("peer answering %d %q trusted", status, body)
+		}
+	}
+	if _, err := f.fetchPeer(context.Background(), peers[1], Hash([]byte("forged content"))); err != nil {
+		t.Fatalf("fetch from a peer holding the blob: %v", err)
+	}
+	if _, err := f.fetchPeer(context.Background(), peers[2], Hash(bytes.Repeat([]byte("x"), 33))); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("fetch of a large blob: %v", err)
+	}
+}
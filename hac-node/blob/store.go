@@ -0,0 +1,123 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrNotFound     = errors.New("blob not found")
+	ErrHashMismatch = errors.New("blob hash mismatch")
+	ErrHashInvalid  = errors.New("blob hash invalid")
+	ErrTooLarge     = errors.New("blob too large")
+)
+
+// Hash returns the hex sha256 blobs are addressed by.
+func Hash(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// ValidHash reports whether hash is a lowercase hex sha256.
+func ValidHash(hash string) bool {
+	b, err := hex.DecodeString(hash)
+	return err == nil && len(b) == sha256.Size && hash == hex.EncodeToString(b)
+}
+
+// Store keeps blobs in a directory, one file per blob named after its hash.
+// Files are written to a temporary name first, so a blob is either complete
+// or missing.
+type Store struct {
+	dir     string
+	maxSize int64
+}
+
+func NewStore(dir string, maxSize int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, maxSize: maxSize}, nil
+}
+
+func (s *Store) MaxSize() int64 {
+	return s.maxSize
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// Put stores data and returns its hash.
+func (s *Store) Put(data []byte) (string, error) {
+	if s.maxSize > 0 && int64(len(data)) > s.maxSize {
+		return "", ErrTooLarge
+	}
+	hash := Hash(data)
+	if s.Has(hash) {
+		return hash, nil
+	}
+	p := s.path(hash)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), hash+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// PutHash stores data expected to hash to hash.
+func (s *Store) PutHash(hash string, data []byte) error {
+	if Hash(data) != hash {
+		return ErrHashMismatch
+	}
+	_, err := s.Put(data)
+	return err
+}
+
+func (s *Store) Has(hash string) bool {
+	if !ValidHash(hash) {
+		return false
+	}
+	_, err := os.Stat(s.path(hash))
+	return err == nil
+}
+
+// Get returns the blob after checking it still matches its hash.
+func (s *Store) Get(hash string) ([]byte, error) {
+	if !ValidHash(hash) {
+		return nil, ErrHashInvalid
+	}
+	f, err := os.Open(s.path(hash))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if Hash(data) != hash {
+		return nil, ErrHashMismatch
+	}
+	return data, nil
+}
@@ -0,0 +1,80 @@
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidHash(t *testing.T) {
+	hash := Hash([]byte("blob"))
+	for _, tc := range []struct {
+		hash string
+		ok   bool
+	}{
+		{hash, true},
+		{strings.ToUpper(hash), false},
+		{hash[:62], false},
+		{hash + "00", false},
+		{"zz" + hash[2:], false},
+		{"", false},
+		{"../" + hash[3:], false},
+	} {
+		if ValidHash(tc.hash) != tc.ok {
+			t.Errorf("ValidHash(%q) is %v", tc.hash, !tc.ok)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, err := NewStore(t.TempDir(), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("proposal content")
+	hash, err := s.Put(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != Hash(data) || !s.Has(hash) {
+		t.Fatalf("blob %s not stored", hash)
+	}
+	// storing it again is a no-op
+	if again, err := s.Put(data); err != nil || again != hash {
+		t.Fatalf("second put %s, %v", again, err)
+	}
+	got, err := s.Get(hash)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("get %q, %v", got, err)
+	}
+
+	if _, err := s.Put(make([]byte, 17)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("put of a large blob: %v", err)
+	}
+	other := []byte("other")
+	if err := s.PutHash(hash, other); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("put under another hash: %v", err)
+	}
+	if err := s.PutHash(Hash(other), other); err != nil || !s.Has(Hash(other)) {
+		t.Fatalf("put under its hash: %v", err)
+	}
+	if _, err := s.Get(Hash([]byte("missing"))); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get of a missing blob: %v", err)
+	}
+	if _, err := s.Get(strings.ToUpper(hash)); !errors.Is(err, ErrHashInvalid) {
+		t.Fatalf("get of an invalid hash: %v", err)
+	}
+	if s.Has("..") {
+		t.Fatal("invalid hash held")
+	}
+
+	// a blob changed on disk is not served
+	if err := os.WriteFile(s.path(hash), []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(hash); !errors.Is(err, ErrHashMismatch) {
+		t.Fatalf("get of a tampered blob: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/calehh/hac-app/tx"
+)
+
+// readActions reads the list of proposal actions in the JSON file at path,
+// none if path is empty.
+func readActions(path string) ([]tx.ProposalAction, error) {
+	if path == "" {
+		return nil, nil
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var actions []tx.ProposalAction
+	if err := json.Unmarshal(dat, &actions); err != nil {
+		return nil, err
+	}
+	if _, err := tx.DecodeProposalActions(actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
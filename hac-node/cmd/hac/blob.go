@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/calehh/hac-app/agent"
+	"github.com/calehh/hac-app/blob"
+)
+
+// uploadContent puts the file at path into the blob store of the node
+// behind api and returns its hash.
+func uploadContent(api string, token string, path string) (string, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(api, "/")+"/api/blobs", bytes.NewReader(dat))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upload status %v: %s", resp.StatusCode, body)
+	}
+	var res agent.PutBlobResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", err
+	}
+	if res.Hash != blob.Hash(dat) {
+		return "", blob.ErrHashMismatch
+	}
+	return res.Hash, nil
+}
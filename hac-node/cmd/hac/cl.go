@@ -6,29 +6,30 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"net/url"
 	"os"
 	"os/signal"
-	"path"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/calehh/hac-app/agent"
 	"github.com/calehh/hac-app/app"
-	app_config "github.com/calehh/hac-app/config"
 	cmtconfig "github.com/cometbft/cometbft/config"
+	"github.com/cometbft/cometbft/crypto/ed25519"
 	cmtflags "github.com/cometbft/cometbft/libs/cli/flags"
 	cmtlog "github.com/cometbft/cometbft/libs/log"
 	nm "github.com/cometbft/cometbft/node"
 	"github.com/cometbft/cometbft/p2p"
 	"github.com/cometbft/cometbft/privval"
 	"github.com/cometbft/cometbft/proxy"
+	"github.com/cometbft/cometbft/rpc/client/local"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
-var homeDir string
+var (
+	homeDir  string
+	observer bool
+)
 
 var clCmd = &cobra.Command{
 	Use:   "hac-cl",
@@ -42,6 +43,7 @@ var clCmd = &cobra.Command{
 
 func init() {
 	clCmd.Flags().StringVarP(&homeDir, "homedir", "d", "", "home directory")
+	clCmd.Flags().BoolVarP(&observer, "observer", "", false, "run without validator key and agent, overrides the config")
 }
 
 func run(cmd *cobra.Command, args []string) {
@@ -49,28 +51,22 @@ func run(cmd *cobra.Command, args []string) {
 		homeDir = os.ExpandEnv("$HOME/.hac")
 	}
 
-	appConfig := &app_config.Config{
-		Config: app_config.DefaultHACCometConfig(),
-		App:    app_config.DefaultHACAppConfig(homeDir),
+	appConfig := loadAppConfig(homeDir)
+	if observer {
+		appConfig.App.Observer = true
 	}
 
-	appConfig.SetRoot(homeDir)
-	viper.SetConfigFile(fmt.Sprintf("%s/%s", homeDir, "config/config.toml"))
-
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Reading config: %v", err)
-	}
-	if err := viper.Unmarshal(appConfig); err != nil {
-		log.Fatalf("Decoding config: %v", err)
+	var pv *privval.FilePV
+	if appConfig.App.Observer {
+		// a throwaway key outside the validator set, the node never signs
+		// and no key file is read or written
+		pv = privval.NewFilePV(ed25519.GenPrivKey(), "", "")
+	} else {
+		pv = privval.LoadFilePV(
+			appConfig.PrivValidatorKeyFile(),
+			appConfig.PrivValidatorStateFile(),
+		)
 	}
-	if err := appConfig.ValidateBasic(); err != nil {
-		log.Fatalf("Invalid configuration data: %v", err)
-	}
-
-	pv := privval.LoadFilePV(
-		appConfig.PrivValidatorKeyFile(),
-		appConfig.PrivValidatorStateFile(),
-	)
 
 	nodeKey, err := p2p.LoadNodeKey(appConfig.NodeKeyFile())
 	if err != nil {
@@ -84,15 +80,24 @@ func run(cmd *cobra.Command, args []string) {
 		log.Fatalf("failed to parse log level: %v", err)
 	}
 
-	//new agent client
-	agentUrl := strings.TrimRight(appConfig.App.AgentUrl, "/")
-	logger.Info("agent url: %s", agentUrl)
-	agent.ElizaCli, err = agent.NewElizaClient(agentUrl, logger)
-	if err != nil {
-		fmt.Printf("ERROR:new eliza client err %s\n", err.Error())
+	var memory *agent.AgentMemory
+	if appConfig.App.Observer {
+		logger.Info("observer mode, no validator key and no agent")
+		agent.ElizaCli = agent.NewObserverClient()
+	} else {
+		//new agent client
+		agentUrl := strings.TrimRight(appConfig.App.AgentUrl, "/")
+		logger.Info("agent url: %s", agentUrl)
+		agent.ElizaCli, err = agent.NewElizaClient(agentUrl, logger)
+		if err != nil {
+			fmt.Printf("ERROR:new eliza client err %s\n", err.Error())
+		}
+		fmt.Println("Using mock eliza client!")
+		agent.ElizaCli = &agent.MockClient{}
+		// votes of the agent wait until its memory is replayed by the indexer
+		memory = agent.NewAgentMemory(logger, agent.ElizaCli)
+		agent.ElizaCli = agent.NewGatedClient(agent.ElizaCli, memory)
 	}
-	fmt.Println("Using mock eliza client!")
-	agent.ElizaCli = &agent.MockClient{}
 
 	// new app
 	appConfig.App.Home = homeDir
@@ -128,15 +133,15 @@ func run(cmd *cobra.Command, args []string) {
 		log.Fatal("comet node unable to run")
 	}
 	// start indexer
-	agent.DiscussionRate = appConfig.App.DiscussionRate
-	rpcUrl, err := url.Parse(appConfig.Config.RPC.ListenAddress)
+	env, err := node.ConfigureRPC()
+	if err != nil {
+		log.Fatalf("configure rpc env err %s", err.Error())
+	}
+	indexerStore, err := agent.OpenIndexerStore(appConfig.App.IndexerDriver, appConfig.App.IndexerDSN, appConfig.RootDir)
 	if err != nil {
-		log.Fatalf("new parse url err %s", err.Error())
+		log.Fatalf("open indexer store err %s", err.Error())
 	}
-	rpcUrl.Scheme = "http"
-	dbPath := path.Join(appConfig.RootDir, "indexer.db")
-	node.BlockStore()
-	indexer, err := agent.NewChainIndexer(logger, dbPath, rpcUrl.String(), node.BlockStore(), appConfig)
+	indexer, err := agent.NewChainIndexer(logger, indexerStore, node.BlockStore(), env.StateStore, appConfig, local.New(node), memory)
 	if err != nil {
 		log.Fatalf("new chain indexer err %s", err.Error())
 	}
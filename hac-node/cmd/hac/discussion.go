@@ -21,6 +21,9 @@ type discussionArguments struct {
 	Proposal uint64
 	NoSend   bool
 	Sig      string
+	ReplyTo  uint64
+	Quotes   []uint
+	Cites    []uint
 }
 
 var discussionArgs discussionArguments
@@ -41,6 +44,9 @@ func init() {
 	discussionCmd.Flags().Uint64VarP(&discussionArgs.Proposal, "proposal", "p", 0, "proposal index")
 	discussionCmd.Flags().BoolVarP(&discussionArgs.NoSend, "nosend", "", false, "not send transaction but print signature")
 	discussionCmd.Flags().StringVarP(&discussionArgs.Sig, "sig", "", "", "transaction signatures")
+	discussionCmd.Flags().Uint64VarP(&discussionArgs.ReplyTo, "replyTo", "r", 0, "index of the discussion replied to")
+	discussionCmd.Flags().UintSliceVarP(&discussionArgs.Quotes, "quote", "", nil, "indexes of the discussions quoted")
+	discussionCmd.Flags().UintSliceVarP(&discussionArgs.Cites, "cite", "", nil, "indexes of the proposals cited")
 }
 
 func discussionRun(cmd *cobra.Command, args []string) {
@@ -72,6 +78,13 @@ func discussionRun(cmd *cobra.Command, args []string) {
 	stx := &tx.DiscussionTx{
 		Proposal: discussionArgs.Proposal,
 		Data:     []byte(discussionArgs.Data),
+		ReplyTo:  discussionArgs.ReplyTo,
+	}
+	for _, index := range discussionArgs.Quotes {
+		stx.References = append(stx.References, tx.Reference{Type: tx.ReferenceQuote, Index: uint64(index)})
+	}
+	for _, index := range discussionArgs.Cites {
+		stx.References = append(stx.References, tx.Reference{Type: tx.ReferenceCite, Index: uint64(index)})
 	}
 	btx.Tx = stx
 	btx.Type = tx.HACTxTypeDiscussion
@@ -5,3 +5,16 @@ import "github.com/spf13/cobra"
 func urlFlag(cmd *cobra.Command, url *string) {
 	cmd.Flags().StringVarP(url, "url", "u", "http://127.0.0.1:26657", "hac-cl service url")
 }
+
+func apiFlag(cmd *cobra.Command, api *string) {
+	cmd.Flags().StringVarP(api, "api", "", "http://127.0.0.1:8631", "hac api url")
+}
+
+func contentFlags(cmd *cobra.Command, path *string, token *string) {
+	cmd.Flags().StringVarP(path, "content", "", "", "file uploaded to the blob store and referenced by hash")
+	cmd.Flags().StringVarP(token, "uploadToken", "", "", "bearer token of the blob upload")
+}
+
+func actionsFlag(cmd *cobra.Command, path *string) {
+	cmd.Flags().StringVarP(path, "actions", "", "", "json file with the actions executed when the proposal is accepted")
+}
@@ -12,6 +12,7 @@ import (
 	app_config "github.com/calehh/hac-app/config"
 	"github.com/calehh/hac-app/types"
 	"github.com/cometbft/cometbft/crypto"
+	"github.com/cometbft/cometbft/p2p"
 	cmttypes "github.com/cometbft/cometbft/types"
 	"github.com/spf13/cobra"
 )
@@ -57,11 +58,15 @@ func init() {
 	initCmd.Flags().BoolP(types.FlagOverwrite, "o", false, "overwrite the genesis.json file")
 	initCmd.Flags().String(types.FlagChainID, "", "genesis file chain-id, if left blank will be randomly created")
 	initCmd.Flags().String(types.FlagHome, "", "config")
+	initCmd.Flags().Bool(types.FlagObserver, false, "initialize an observer node without validator key, copy the genesis file of the network afterwards")
 }
 
 func initRun(cmd *cobra.Command, args []string) error {
 	home, _ := cmd.Flags().GetString(types.FlagHome)
 	chainID, _ := cmd.Flags().GetString(types.FlagChainID)
+	if observer, _ := cmd.Flags().GetBool(types.FlagObserver); observer {
+		return initObserver(home)
+	}
 	var (
 		genesisTime time.Time
 		pk          crypto.PubKey
@@ -117,3 +122,18 @@ func initRun(cmd *cobra.Command, args []string) error {
 	toPrint := newPrintInfo("", chainID, "", "", appGenesis.AppState)
 	return displayInfo(toPrint)
 }
+
+// initObserver writes the config and the node key of an observer node. The
+// node joins an existing network, so no genesis is created.
+func initObserver(home string) error {
+	appConfig := app_config.NewHACConfig(home)
+	appConfig.App.Observer = true
+	config.InitializeNodeOnly(appConfig)
+	app_config.WriteConfigFile(filepath.Join(appConfig.RootDir, "config", "config.toml"), appConfig)
+	nodeKey, err := p2p.LoadNodeKey(appConfig.NodeKeyFile())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "observer node %s initialized, copy the genesis file of the network to %s\n", nodeKey.ID(), appConfig.GenesisFile())
+	return nil
+}
@@ -10,11 +10,15 @@ func main() {
 	clCmd.AddCommand(initCmd)
 	clCmd.AddCommand(versionCmd)
 	clCmd.AddCommand(newProposalCmd)
+	clCmd.AddCommand(newProposerCmd)
 	clCmd.AddCommand(discussionCmd)
+	clCmd.AddCommand(participantCmd)
 	clCmd.AddCommand(settleCmd)
+	clCmd.AddCommand(reviseCmd)
 	clCmd.AddCommand(grantCmd)
 	clCmd.AddCommand(pubkeyCmd)
 	clCmd.AddCommand(signCmd)
+	clCmd.AddCommand(reindexCmd)
 	if err := clCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/calehh/hac-app/crypto"
+	"github.com/calehh/hac-app/tx"
+	"github.com/cometbft/cometbft/rpc/client/http"
+	"github.com/spf13/cobra"
+)
+
+type participantArguments struct {
+	Url  string
+	Skey string
+	Name string
+}
+
+var participantArgs participantArguments
+
+var participantCmd = &cobra.Command{
+	Use:   "participant",
+	Short: "register a human participant account",
+	Long:  `register the key as a participant account, it has no stake and can only post discussions, with the discussion command`,
+	Run:   participantRun,
+}
+
+func init() {
+	urlFlag(participantCmd, &participantArgs.Url)
+	participantCmd.Flags().StringVarP(&participantArgs.Skey, "skeyPath", "s", "./config/priv_validator_key.json", "private key path")
+	participantCmd.Flags().StringVarP(&participantArgs.Name, "name", "", "", "participant name")
+}
+
+func participantRun(cmd *cobra.Command, args []string) {
+	cli, err := http.New(participantArgs.Url, "/websocket")
+	if err != nil {
+		fmt.Printf("new client err:%v\n", err)
+		return
+	}
+	ctx := context.Background()
+	gres, err := cli.Genesis(ctx)
+	if err != nil {
+		fmt.Printf("get chain genesis err:%v\n", err)
+		return
+	}
+	chainId := gres.Genesis.ChainID
+	pv := crypto.LoadFilePV(participantArgs.Skey)
+	btx := tx.HACTx{
+		Version: tx.HACTxVersion1,
+		Type:    tx.HACTxTypeRegisterParticipant,
+		Tx: &tx.RegisterParticipantTx{
+			PubKey: pv.PublicKey(),
+			Name:   participantArgs.Name,
+		},
+	}
+	dat, err := btx.SigData([]byte(chainId))
+	if err != nil {
+		fmt.Printf("tx sign data err:%v\n", err)
+		return
+	}
+	sig, err := pv.Sign(dat)
+	if err != nil {
+		fmt.Printf("sign tx err:%v\n", err)
+		return
+	}
+	println("pubkey:", hex.EncodeToString(pv.PublicKey()))
+	println("address:", pv.Address())
+	btx.Sig = [][]byte{sig}
+	dat, err = json.Marshal(btx)
+	if err != nil {
+		fmt.Printf("encode tx err:%v\n", err)
+		return
+	}
+	res, err := cli.BroadcastTxSync(ctx, dat)
+	if err != nil {
+		fmt.Printf("broadcast tx err:%v\n", err)
+		return
+	}
+	dat, _ = json.Marshal(res)
+	fmt.Printf("%v\n", string(dat))
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 
+	"github.com/calehh/hac-app/agent"
 	"github.com/calehh/hac-app/crypto"
 	"github.com/calehh/hac-app/tx"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
 	"github.com/cometbft/cometbft/rpc/client/http"
 	"github.com/spf13/cobra"
 )
@@ -22,6 +25,11 @@ type newProposalArguments struct {
 	Sig      string
 	Title    string
 	AgentUrl string
+	Api      string
+	Content  string
+	Token    string
+	Actions  string
+	Category string
 }
 
 var newProposalArgs newProposalArguments
@@ -39,10 +47,14 @@ func init() {
 	newProposalCmd.Flags().Uint64VarP(&newProposalArgs.Nonce, "nonce", "n", 0, "account nonce")
 	newProposalCmd.Flags().StringVarP(&newProposalArgs.Skey, "skeyPath", "s", "./config/priv_validator_key.json", "private key path")
 	newProposalCmd.Flags().StringVarP(&newProposalArgs.Data, "data", "d", "", "proposal data")
+	newProposalCmd.Flags().StringVarP(&newProposalArgs.Category, "category", "c", tx.ProposalCategoryText, "proposal category, the data of non-text categories is json")
 	newProposalCmd.Flags().BoolVarP(&newProposalArgs.NoSend, "nosend", "", false, "not send transaction but print signature")
 	newProposalCmd.Flags().StringVarP(&newProposalArgs.Sig, "sig", "", "", "transaction signatures")
 	newProposalCmd.Flags().StringVarP(&newProposalArgs.Title, "title", "t", "New Proposal", "proposal title")
-	newProposalCmd.Flags().StringVarP(&newProposerArgs.AgentUrl, "agent", "a", "http://127.0.0.1/3000/proposal_title", "agent")
+	newProposalCmd.Flags().StringVarP(&newProposalArgs.AgentUrl, "agent", "a", "http://127.0.0.1:3000", "agent url drafting the title if it is empty")
+	apiFlag(newProposalCmd, &newProposalArgs.Api)
+	contentFlags(newProposalCmd, &newProposalArgs.Content, &newProposalArgs.Token)
+	actionsFlag(newProposalCmd, &newProposalArgs.Actions)
 }
 
 func newProposalRun(cmd *cobra.Command, args []string) {
@@ -72,7 +84,12 @@ func newProposalRun(cmd *cobra.Command, args []string) {
 		Validator: newProposalArgs.Index,
 	}
 	if newProposalArgs.Title == "" {
-		newProposalArgs.Title, err = summarizePR(PR{Data: newProposalArgs.Data})
+		eliza, err := agent.NewElizaClient(strings.TrimRight(newProposalArgs.AgentUrl, "/"), cmtlog.NewNopLogger())
+		if err != nil {
+			fmt.Printf("new agent client err:%v\n", err)
+			return
+		}
+		newProposalArgs.Title, _, err = eliza.DraftProposal(ctx, newProposalArgs.Data)
 		if err != nil {
 			fmt.Printf("summarize proposal err:%v\n", err)
 			return
@@ -84,6 +101,20 @@ func newProposalRun(cmd *cobra.Command, args []string) {
 		Title:     newProposalArgs.Title,
 		Link:      "",
 		Data:      []byte(newProposalArgs.Data),
+		Category:  newProposalArgs.Category,
+	}
+	if newProposalArgs.Content != "" {
+		stx.ContentHash, err = uploadContent(newProposalArgs.Api, newProposalArgs.Token, newProposalArgs.Content)
+		if err != nil {
+			fmt.Printf("upload proposal content err:%v\n", err)
+			return
+		}
+		println("content hash:", stx.ContentHash)
+	}
+	stx.Actions, err = readActions(newProposalArgs.Actions)
+	if err != nil {
+		fmt.Printf("read proposal actions err:%v\n", err)
+		return
 	}
 	btx.Tx = stx
 	btx.Type = tx.HACTxTypeProposal
@@ -1,172 +1,114 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	htp "net/http"
-
-	"github.com/calehh/hac-app/crypto"
-	"github.com/calehh/hac-app/tx"
+	"github.com/calehh/hac-app/agent"
+	"github.com/calehh/hac-app/proposer"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
 	"github.com/cometbft/cometbft/rpc/client/http"
 	"github.com/spf13/cobra"
 )
 
 type newProposerArguments struct {
-	Url       string
-	Index     uint64
-	Nonce     uint64
-	Skey      string
-	NoSend    bool
-	Sig       string
-	SourceUrl string
-	Duration  uint64
-	AgentUrl  string
+	Url        string
+	Api        string
+	Token      string
+	Duration   uint64
+	AgentUrl   string
+	MockAgent  bool
+	Dir        string
+	Feed       string
+	GitRepo    string
+	GitLink    string
+	GitLimit   int
+	LogVerbose bool
 }
 
 var newProposerArgs newProposerArguments
 
 var newProposerCmd = &cobra.Command{
-	Use:   "newProposer",
-	Short: "",
-	Long:  ``,
-	Run:   newProposerRun,
+	Use:   "proposer",
+	Short: "run a daemon that drafts and submits proposals from local sources",
+	Long: `Watch a directory of markdown proposals, an RSS/Atom file and a git
+repository log. Every interval the first item whose link is not on chain yet
+is drafted by the agent and submitted to the node, which signs the proposal
+with its validator key. The node needs app.proposer enabled.`,
+	Run: newProposerRun,
 }
 
 func init() {
 	urlFlag(newProposerCmd, &newProposerArgs.Url)
-	newProposerCmd.Flags().Uint64VarP(&newProposerArgs.Index, "index", "i", 0, "account index")
-	newProposerCmd.Flags().Uint64VarP(&newProposerArgs.Nonce, "nonce", "n", 0, "account nonce")
-	newProposerCmd.Flags().StringVarP(&newProposerArgs.Skey, "skeyPath", "s", "./config/priv_validator_key.json", "private key path")
-	newProposerCmd.Flags().BoolVarP(&newProposerArgs.NoSend, "nosend", "", false, "not send transaction but print signature")
-	newProposerCmd.Flags().StringVarP(&newProposerArgs.Sig, "sig", "", "", "transaction signatures")
-	newProposerCmd.Flags().StringVarP(&newProposerArgs.SourceUrl, "source", "o", "", "source url")
-	newProposerCmd.Flags().Uint64VarP(&newProposerArgs.Duration, "duration", "t", 60, "duration")
-	newProposerCmd.Flags().StringVarP(&newProposerArgs.AgentUrl, "agent", "a", "http://127.0.0.1/3000", "agent")
-}
-
-type PR struct {
-	Title    string `json:"title"`
-	Data     string `json:"data"`
-	Link     string `json:"link"`
-	ImageUrl string `json:"imageUrl"`
+	apiFlag(newProposerCmd, &newProposerArgs.Api)
+	newProposerCmd.Flags().StringVarP(&newProposerArgs.Token, "token", "", "", "bearer token of the node proposer api")
+	newProposerCmd.Flags().Uint64VarP(&newProposerArgs.Duration, "duration", "t", 60, "minutes between two proposals")
+	newProposerCmd.Flags().StringVarP(&newProposerArgs.AgentUrl, "agent", "a", "http://127.0.0.1:3000", "agent url")
+	newProposerCmd.Flags().BoolVarP(&newProposerArgs.MockAgent, "mock", "", false, "draft proposals without an agent")
+	newProposerCmd.Flags().StringVarP(&newProposerArgs.Dir, "dir", "d", "", "directory of markdown proposals")
+	newProposerCmd.Flags().StringVarP(&newProposerArgs.Feed, "feed", "f", "", "RSS or Atom file")
+	newProposerCmd.Flags().StringVarP(&newProposerArgs.GitRepo, "git", "g", "", "git repository")
+	newProposerCmd.Flags().StringVarP(&newProposerArgs.GitLink, "git-link", "", "", "commit link format, e.g. https://github.com/org/repo/commit/%s")
+	newProposerCmd.Flags().IntVarP(&newProposerArgs.GitLimit, "git-limit", "", 20, "number of recent commits considered")
+	newProposerCmd.Flags().BoolVarP(&newProposerArgs.LogVerbose, "verbose", "v", false, "debug log")
 }
 
-func getLatestPR() (PR, error) {
-	return PR{}, nil
-}
-
-type SummarizeResp struct {
-	Title string `json:"title"`
-}
+func newProposerRun(cmd *cobra.Command, args []string) {
+	logger := cmtlog.NewTMLogger(cmtlog.NewSyncWriter(os.Stdout))
+	if !newProposerArgs.LogVerbose {
+		logger = cmtlog.NewFilter(logger, cmtlog.AllowInfo())
+	}
 
-func summarizePR(pr PR) (string, error) {
-	// post request agent url
-	data := map[string]interface{}{
-		"text": pr.Data,
+	sources := make([]proposer.Source, 0)
+	if newProposerArgs.Dir != "" {
+		sources = append(sources, proposer.NewMarkdownSource(newProposerArgs.Dir))
 	}
-	d, _ := json.Marshal(data)
-	resp, err := htp.Post(newProposerArgs.AgentUrl, "application/json", bytes.NewBuffer(d))
-	if err != nil {
-		return "", err
+	if newProposerArgs.Feed != "" {
+		sources = append(sources, proposer.NewFeedSource(newProposerArgs.Feed))
 	}
-	defer resp.Body.Close()
-	var sr SummarizeResp
-	err = json.NewDecoder(resp.Body).Decode(&sr)
-	if err != nil {
-		return "", err
+	if newProposerArgs.GitRepo != "" {
+		sources = append(sources, proposer.NewGitSource(newProposerArgs.GitRepo, newProposerArgs.GitLink, newProposerArgs.GitLimit))
+	}
+	if len(sources) == 0 {
+		fmt.Println("no proposal source, set --dir, --feed or --git")
+		return
 	}
-	return sr.Title, nil
-}
 
-func newProposerRun(cmd *cobra.Command, args []string) {
-	ticker := time.NewTicker(time.Duration(newProposerArgs.Duration) * time.Minute)
-	for {
-		<-ticker.C
-		cli, err := http.New(newProposerArgs.Url, "/websocket")
-		if err != nil {
-			fmt.Printf("new client err:%v\n", err)
-			return
-		}
-		ctx := context.Background()
-		gres, err := cli.Genesis(ctx)
-		if err != nil {
-			fmt.Printf("get chain genesis err:%v\n", err)
-			return
-		}
-		chainId := gres.Genesis.ChainID
-		nonce := newProposerArgs.Nonce
-		if nonce == 0 {
-			act, err := queryAccount(newProposerArgs.Url, newProposerArgs.Index, "")
-			if err != nil {
-				return
-			}
-			nonce = act.Nonce
-		}
-		btx := tx.HACTx{
-			Version:   tx.HACTxVersion1,
-			Nonce:     nonce,
-			Validator: newProposerArgs.Index,
-		}
-		pr, err := getLatestPR()
-		if err != nil {
-			fmt.Printf("get latest pr err:%v\n", err)
-			continue
-		}
-		title, err := summarizePR(pr)
-		if err != nil {
-			fmt.Printf("summarize pr err:%v\n", err)
-			continue
-		}
-		stx := &tx.ProposalTx{
-			EndHeight: 0,
-			ImageUrl:  pr.ImageUrl,
-			Title:     title,
-			Link:      pr.Link,
-			Data:      []byte(pr.Data),
-		}
-		btx.Tx = stx
-		btx.Type = tx.HACTxTypeProposal
-		dat, err := btx.SigData([]byte(chainId))
-		if err != nil {
-			fmt.Printf("tx sign data err:%v\n", err)
-			return
-		}
-		println("data signed:", hex.EncodeToString(dat))
-		sigs := [][]byte{}
-		pv := crypto.LoadFilePV(newProposerArgs.Skey)
-		sig, err := pv.Sign(dat)
-		if err != nil {
-			fmt.Printf("sign tx err:%v\n", err)
-			return
-		}
-		println("pubkey:", hex.EncodeToString(pv.PublicKey()))
-		println("address:", pv.Address())
-		sigs = append(sigs, sig)
-		if newProposerArgs.NoSend {
-			fmt.Println("transaction signatures:")
-			for _, sig := range sigs {
-				fmt.Println(hex.EncodeToString(sig))
-			}
-			return
-		}
-		btx.Sig = sigs
-		dat, err = json.Marshal(btx)
-		if err != nil {
-			fmt.Printf("rlp encode tx err:%v\n", err)
-			return
-		}
-		fmt.Printf("tx:%x btx:%#v\n", dat, btx)
-		res, err := cli.BroadcastTxSync(ctx, dat)
+	var agentCli agent.Client
+	if newProposerArgs.MockAgent {
+		agentCli = agent.NewMockClient()
+	} else {
+		eliza, err := agent.NewElizaClient(strings.TrimRight(newProposerArgs.AgentUrl, "/"), logger)
 		if err != nil {
-			fmt.Printf("broadcast tx err:%v\n", err)
+			fmt.Printf("new agent client err:%v\n", err)
 			return
 		}
-		dat, _ = json.Marshal(res)
-		fmt.Printf("%v\n", string(dat))
+		agentCli = eliza
+	}
+
+	cli, err := http.New(newProposerArgs.Url, "/websocket")
+	if err != nil {
+		fmt.Printf("new client err:%v\n", err)
+		return
+	}
+	if err := cli.Start(); err != nil {
+		fmt.Printf("start client err:%v\n", err)
+		return
+	}
+	defer cli.Stop()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	node := proposer.NewNodeSubmitter(newProposerArgs.Api, newProposerArgs.Token)
+
+	interval := time.Duration(newProposerArgs.Duration) * time.Minute
+	p := proposer.NewProposer(logger, cli, agentCli, node, sources, interval)
+	if err := p.Run(ctx); err != nil && err != context.Canceled {
+		fmt.Printf("proposer err:%v\n", err)
 	}
 }
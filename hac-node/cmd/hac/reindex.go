@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/calehh/hac-app/agent"
+	app_config "github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/state"
+	cmtconfig "github.com/cometbft/cometbft/config"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	sm "github.com/cometbft/cometbft/state"
+	"github.com/cometbft/cometbft/store"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type reindexArguments struct {
+	Home    string
+	Driver  string
+	DSN     string
+	From    int64
+	To      int64
+	Workers int
+	Reset   bool
+}
+
+var reindexArgs reindexArguments
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "rebuild the indexer database from the block store",
+	Long: `Rebuild the indexer database from the block store, the ABCI results store and the
+app state of a stopped node. With --reset every table but the agent cursors is
+dropped, the broadcast outbox, webhook subscriptions and community submissions
+included, and the whole chain is indexed again, otherwise the given height
+range is rewritten in place.`,
+	Run: reindexRun,
+}
+
+func init() {
+	reindexCmd.Flags().StringVarP(&reindexArgs.Home, "homedir", "d", "", "home directory")
+	reindexCmd.Flags().StringVarP(&reindexArgs.Driver, "driver", "", "", "indexer database driver, sqlite3 or postgres, defaults to the config")
+	reindexCmd.Flags().StringVarP(&reindexArgs.DSN, "dsn", "", "", "indexer database dsn, defaults to the config")
+	reindexCmd.Flags().Int64VarP(&reindexArgs.From, "from", "f", 1, "first height")
+	reindexCmd.Flags().Int64VarP(&reindexArgs.To, "to", "t", 0, "last height, 0 for the latest height")
+	reindexCmd.Flags().IntVarP(&reindexArgs.Workers, "workers", "w", runtime.NumCPU(), "number of heights loaded in parallel")
+	reindexCmd.Flags().BoolVarP(&reindexArgs.Reset, "reset", "", false, "drop the indexer tables and index from the first height")
+}
+
+func loadAppConfig(home string) *app_config.Config {
+	appConfig := &app_config.Config{
+		Config: app_config.DefaultHACCometConfig(),
+		App:    app_config.DefaultHACAppConfig(home),
+	}
+
+	appConfig.SetRoot(home)
+	viper.SetConfigFile(fmt.Sprintf("%s/%s", home, "config/config.toml"))
+
+	if err := viper.ReadInConfig(); err != nil {
+		log.Fatalf("Reading config: %v", err)
+	}
+	if err := viper.Unmarshal(appConfig); err != nil {
+		log.Fatalf("Decoding config: %v", err)
+	}
+	if err := appConfig.ValidateBasic(); err != nil {
+		log.Fatalf("Invalid configuration data: %v", err)
+	}
+	return appConfig
+}
+
+func reindexRun(cmd *cobra.Command, args []string) {
+	home := reindexArgs.Home
+	if home == "" {
+		home = os.ExpandEnv("$HOME/.hac")
+	}
+	appConfig := loadAppConfig(home)
+	logger := cmtlog.NewFilter(cmtlog.NewTMLogger(cmtlog.NewSyncWriter(os.Stdout)), cmtlog.AllowInfo())
+
+	blockStoreDB, err := cmtconfig.DefaultDBProvider(&cmtconfig.DBContext{ID: "blockstore", Config: appConfig.Config})
+	if err != nil {
+		log.Fatalf("open block store err:%v (is the node still running?)", err)
+	}
+	defer blockStoreDB.Close()
+	bs := store.NewBlockStore(blockStoreDB)
+
+	stateDB, err := cmtconfig.DefaultDBProvider(&cmtconfig.DBContext{ID: "state", Config: appConfig.Config})
+	if err != nil {
+		log.Fatalf("open state store err:%v", err)
+	}
+	defer stateDB.Close()
+	ss := sm.NewStore(stateDB, sm.StoreOptions{DiscardABCIResponses: appConfig.Storage.DiscardABCIResponses})
+
+	accounts, err := state.NewStateDB(home+"/data", logger)
+	if err != nil {
+		log.Fatalf("open app state err:%v", err)
+	}
+	defer accounts.Close()
+
+	driver, dsn := appConfig.App.IndexerDriver, appConfig.App.IndexerDSN
+	if reindexArgs.Driver != "" {
+		driver, dsn = reindexArgs.Driver, ""
+	}
+	if reindexArgs.DSN != "" {
+		dsn = reindexArgs.DSN
+	}
+	indexerStore, err := agent.OpenIndexerStore(driver, dsn, appConfig.RootDir)
+	if err != nil {
+		log.Fatalf("open indexer store err:%v", err)
+	}
+	r, err := agent.NewReindexer(logger, indexerStore, bs, ss, accounts, reindexArgs.Workers)
+	if err != nil {
+		log.Fatalf("open indexer db err:%v", err)
+	}
+	defer r.Close()
+
+	from, to := reindexArgs.From, reindexArgs.To
+	if reindexArgs.Reset {
+		if err := r.Reset(); err != nil {
+			log.Fatalf("reset indexer db err:%v", err)
+		}
+		from = 1
+	}
+	if to <= 0 {
+		to = bs.Height()
+	}
+	if from > to {
+		fmt.Printf("nothing to reindex, from %d to %d\n", from, to)
+		return
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	fmt.Printf("reindex %s from %d to %d with %d workers, indexed height %d\n", driver, from, to, reindexArgs.Workers, r.IndexedHeight())
+	err = r.Run(ctx, from, to, func(p agent.ReindexProgress) {
+		done := p.Height - p.From + 1
+		total := p.To - p.From + 1
+		rate := float64(done) / p.Elapsed.Seconds()
+		eta := time.Duration(0)
+		if rate > 0 {
+			eta = time.Duration(float64(total-done)/rate) * time.Second
+		}
+		fmt.Printf("height %d/%d (%.1f%%) %.1f blocks/s eta %s\n", p.Height, p.To, float64(done)*100/float64(total), rate, eta.Round(time.Second))
+	})
+	if err != nil {
+		log.Fatalf("reindex err:%v", err)
+	}
+	fmt.Printf("reindex done, indexed height %d\n", r.IndexedHeight())
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/calehh/hac-app/crypto"
+	"github.com/calehh/hac-app/tx"
+	"github.com/cometbft/cometbft/rpc/client/http"
+	"github.com/spf13/cobra"
+)
+
+type reviseArguments struct {
+	Url      string
+	Index    uint64
+	Nonce    uint64
+	Skey     string
+	Proposal uint64
+	Title    string
+	Link     string
+	ImageUrl string
+	DataPath string
+	Note     string
+	NoSend   bool
+	Api      string
+	Content  string
+	Token    string
+	Actions  string
+}
+
+var reviseArgs reviseArguments
+
+var reviseCmd = &cobra.Command{
+	Use:   "revise",
+	Short: "revise a processing proposal of the account",
+	Long:  `replace the content of a processing proposal with a new revision, only the proposer may revise it`,
+	Run:   reviseRun,
+}
+
+func init() {
+	urlFlag(reviseCmd, &reviseArgs.Url)
+	reviseCmd.Flags().Uint64VarP(&reviseArgs.Index, "index", "i", 0, "account index")
+	reviseCmd.Flags().Uint64VarP(&reviseArgs.Nonce, "nonce", "n", 0, "account nonce")
+	reviseCmd.Flags().StringVarP(&reviseArgs.Skey, "skeyPath", "s", "./config/priv_validator_key.json", "private key path")
+	reviseCmd.Flags().Uint64VarP(&reviseArgs.Proposal, "proposal", "p", 0, "proposal index")
+	reviseCmd.Flags().StringVarP(&reviseArgs.Title, "title", "t", "", "proposal title")
+	reviseCmd.Flags().StringVarP(&reviseArgs.Link, "link", "l", "", "proposal link")
+	reviseCmd.Flags().StringVarP(&reviseArgs.ImageUrl, "image", "", "", "proposal image url")
+	reviseCmd.Flags().StringVarP(&reviseArgs.DataPath, "data", "d", "", "proposal data file")
+	reviseCmd.Flags().StringVarP(&reviseArgs.Note, "note", "", "", "what changed in the revision")
+	reviseCmd.Flags().BoolVarP(&reviseArgs.NoSend, "nosend", "", false, "not send transaction but print signature")
+	apiFlag(reviseCmd, &reviseArgs.Api)
+	contentFlags(reviseCmd, &reviseArgs.Content, &reviseArgs.Token)
+	actionsFlag(reviseCmd, &reviseArgs.Actions)
+}
+
+func reviseRun(cmd *cobra.Command, args []string) {
+	cli, err := http.New(reviseArgs.Url, "/websocket")
+	if err != nil {
+		fmt.Printf("new client err:%v\n", err)
+		return
+	}
+	ctx := context.Background()
+	gres, err := cli.Genesis(ctx)
+	if err != nil {
+		fmt.Printf("get chain genesis err:%v\n", err)
+		return
+	}
+	chainId := gres.Genesis.ChainID
+	nonce := reviseArgs.Nonce
+	if nonce == 0 {
+		act, err := queryAccount(reviseArgs.Url, reviseArgs.Index, "")
+		if err != nil {
+			return
+		}
+		nonce = act.Nonce
+	}
+	btx := tx.HACTx{
+		Version:   tx.HACTxVersion1,
+		Nonce:     nonce,
+		Validator: reviseArgs.Index,
+	}
+	var dat []byte
+	if reviseArgs.DataPath != "" || reviseArgs.Content == "" {
+		dat, err = os.ReadFile(reviseArgs.DataPath)
+		if err != nil {
+			fmt.Printf("read proposal data err:%v\n", err)
+			return
+		}
+	}
+	stx := &tx.ReviseProposalTx{
+		Proposal: reviseArgs.Proposal,
+		ImageUrl: reviseArgs.ImageUrl,
+		Title:    reviseArgs.Title,
+		Link:     reviseArgs.Link,
+		Data:     dat,
+		Note:     reviseArgs.Note,
+	}
+	if reviseArgs.Content != "" {
+		stx.ContentHash, err = uploadContent(reviseArgs.Api, reviseArgs.Token, reviseArgs.Content)
+		if err != nil {
+			fmt.Printf("upload proposal content err:%v\n", err)
+			return
+		}
+		println("content hash:", stx.ContentHash)
+	}
+	stx.Actions, err = readActions(reviseArgs.Actions)
+	if err != nil {
+		fmt.Printf("read proposal actions err:%v\n", err)
+		return
+	}
+	btx.Tx = stx
+	btx.Type = tx.HACTxTypeReviseProposal
+	dat, err = btx.SigData([]byte(chainId))
+	if err != nil {
+		fmt.Printf("tx sign data err:%v\n", err)
+		return
+	}
+	println("data to sign:", string(dat))
+	println("data signed:", hex.EncodeToString(dat))
+	sigs := [][]byte{}
+	pv := crypto.LoadFilePV(reviseArgs.Skey)
+	sig, err := pv.Sign(dat)
+	if err != nil {
+		fmt.Printf("sign tx err:%v\n", err)
+		return
+	}
+	println("pubkey:", hex.EncodeToString(pv.PublicKey()))
+	println("address:", pv.Address())
+	sigs = append(sigs, sig)
+	if reviseArgs.NoSend {
+		fmt.Println("transaction signatures:")
+		for _, sig := range sigs {
+			fmt.Println(hex.EncodeToString(sig))
+		}
+		return
+	}
+	btx.Sig = sigs
+	dat, err = json.Marshal(btx)
+	if err != nil {
+		fmt.Printf("rlp encode tx err:%v\n", err)
+		return
+	}
+	fmt.Printf("tx:%x btx:%#v\n", dat, btx)
+	res, err := cli.BroadcastTxSync(ctx, dat)
+	if err != nil {
+		fmt.Printf("broadcast tx err:%v\n", err)
+		return
+	}
+	dat, _ = json.Marshal(res)
+	fmt.Printf("%v\n", string(dat))
+}
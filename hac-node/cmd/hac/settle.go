@@ -21,6 +21,7 @@ type settleArguments struct {
 	Proposal uint64
 	NoSend   bool
 	Sig      string
+	Revision uint64
 }
 
 var settleArgs settleArguments
@@ -40,6 +41,7 @@ func init() {
 	settleCmd.Flags().Uint64VarP(&settleArgs.Proposal, "proposal", "p", 0, "proposal index")
 	settleCmd.Flags().BoolVarP(&settleArgs.NoSend, "nosend", "", false, "not send transaction but print signature")
 	settleCmd.Flags().StringVarP(&settleArgs.Sig, "sig", "", "", "transaction signatures")
+	settleCmd.Flags().Uint64VarP(&settleArgs.Revision, "revision", "r", 0, "latest revision of the proposal")
 }
 
 func settleRun(cmd *cobra.Command, args []string) {
@@ -71,6 +73,7 @@ func settleRun(cmd *cobra.Command, args []string) {
 	stx := &tx.SettleProposalTx{
 		Proposal:        settleArgs.Proposal,
 		ExpireTimestamp: uint(time.Now().Unix() + 60*3),
+		Revision:        settleArgs.Revision,
 	}
 	btx.Tx = stx
 	btx.Type = tx.HACTxTypeSettleProposal
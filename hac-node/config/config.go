@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/calehh/hac-app/tx"
 	"github.com/cometbft/cometbft/config"
 	"github.com/cometbft/cometbft/crypto"
 	"github.com/cometbft/cometbft/p2p"
@@ -14,25 +15,207 @@ import (
 	eth_crypto "github.com/ethereum/go-ethereum/crypto"
 )
 
+const (
+	DefaultDiscussionPerProposal = 15
+	DefaultDiscussionPerBlock    = 1
+
+	DefaultSettleInterval       = 5
+	DefaultSettlePolicyCategory = "default"
+
+	DefaultIndexerDriver = "sqlite3"
+
+	BroadcastSinkWebhook        = "webhook"
+	BroadcastSinkFile           = "file"
+	DefaultBroadcastRate        = 6
+	DefaultBroadcastMaxAttempts = 5
+
+	DefaultWebhookMaxAttempts = 8
+
+	DefaultCommunityMaxPending = 100
+
+	DefaultBlobMaxSize      = 8 << 20
+	DefaultBlobFetchTimeout = 3
+)
+
+// SettlePolicy decides when the node settles its own processing proposals.
+// Zero values disable the corresponding rule.
+type SettlePolicy struct {
+	// minimum number of discussions on the proposal
+	MinDiscussions uint64 `mapstructure:"min_discussions" json:"minDiscussions"`
+	// minimum number of distinct speakers on the proposal
+	MinSpeakers uint64 `mapstructure:"min_speakers" json:"minSpeakers"`
+	// blocks since the proposal was created before it may be settled
+	MinBlockAge uint64 `mapstructure:"min_block_age" json:"minBlockAge"`
+	// blocks since the proposal was created after which it is settled
+	// regardless of the discussion
+	MaxBlockAge uint64 `mapstructure:"max_block_age" json:"maxBlockAge"`
+	// settle once no discussion has been posted for this many blocks
+	QuietBlocks uint64 `mapstructure:"quiet_blocks" json:"quietBlocks"`
+	// seconds the settle vote stays valid after it is submitted
+	ExpireSeconds uint64 `mapstructure:"expire_seconds" json:"expireSeconds"`
+}
+
+func DefaultSettlePolicies() map[string]SettlePolicy {
+	return map[string]SettlePolicy{
+		DefaultSettlePolicyCategory: {
+			MinDiscussions: 15,
+			ExpireSeconds:  60 * 3,
+		},
+	}
+}
+
+// BroadcastConfig narrates the indexed governance events to an external
+// platform. Posts are rendered from text/template templates keyed by stream
+// event type and delivered from a persistent outbox. The outbox also
+// delivers the webhook actions of executed proposals, a node with the
+// broadcaster disabled queues them without firing them.
+type BroadcastConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// "webhook" or "file"
+	Sink       string `mapstructure:"sink"`
+	WebhookURL string `mapstructure:"webhook_url"`
+	// file the file sink appends to, stdout if empty
+	FilePath string `mapstructure:"file_path"`
+	// posts delivered per minute at most
+	RatePerMinute int `mapstructure:"rate_per_minute"`
+	// delivery attempts before a post is given up
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// let the local agent rewrite the rendered post in its own voice
+	AgentWrite bool `mapstructure:"agent_write"`
+	// an event type without a template, or with an empty one, is not posted
+	Templates map[string]string `mapstructure:"templates"`
+}
+
+func DefaultBroadcastTemplates() map[string]string {
+	return map[string]string{
+		"proposal":      `New proposal #{{.Proposal}} by {{.Data.ProposerName}}: {{truncate .Data.Title 120}}`,
+		"revision":      `Proposal #{{.Proposal}} was revised (revision {{.Data.Revision}}){{if .Data.Note}}: {{truncate .Data.Note 200}}{{end}}`,
+		"discussion":    `{{.Data.SpeakerName}} on proposal #{{.Proposal}}: {{truncate .Data.Data 200}}`,
+		"draft_tally":   `Proposal #{{.Proposal}} draft vote: {{percent .Data.Tally.YesPower .Data.Tally.TotalPower}} of the voting power wants to process it`,
+		"settle":        `Proposal #{{.Proposal}} is {{status .Data.Status}} with {{percent .Data.Tally.YesPower .Data.Tally.TotalPower}} of the voting power in favour`,
+		"grant":         `{{if .Data.Grant.Grant}}{{short .Data.Grant.Address}} joins the council{{else}}{{short .Data.Grant.Address}} was not admitted to the council{{end}}`,
+		"retract":       `{{short .Data.Address}} retracted its stake and leaves the council`,
+		"validator_set": `The council now has {{.Data.Set.Size}} members with a voting power of {{.Data.Set.TotalPower}}`,
+	}
+}
+
+func DefaultBroadcastConfig() BroadcastConfig {
+	return BroadcastConfig{
+		Sink:          BroadcastSinkFile,
+		RatePerMinute: DefaultBroadcastRate,
+		MaxAttempts:   DefaultBroadcastMaxAttempts,
+		Templates:     DefaultBroadcastTemplates(),
+	}
+}
+
+// WebhookConfig controls the webhook subscriptions managed through the api.
+type WebhookConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// bearer token required to manage subscriptions, none if empty
+	AdminToken string `mapstructure:"admin_token"`
+	// delivery attempts before a delivery is given up
+	MaxAttempts int `mapstructure:"max_attempts"`
+}
+
+// CommunityConfig controls the proposals non-members submit through the api
+// for the local agent to sponsor.
+type CommunityConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// reject submissions that are not signed with an ethereum key
+	RequireSignature bool `mapstructure:"require_signature"`
+	// submissions waiting for the agent at most, further ones are refused
+	MaxPending int `mapstructure:"max_pending"`
+}
+
+// ProposerConfig lets the proposer daemon submit proposals through the api,
+// signed by the node's own sender.
+type ProposerConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// bearer token required to submit proposals, none if empty
+	Token string `mapstructure:"token"`
+}
+
+// BlobConfig controls the content-addressed store holding the payloads
+// proposals reference by hash.
+type BlobConfig struct {
+	// api addresses of the nodes missing blobs are fetched from
+	Peers []string `mapstructure:"peers"`
+	// seconds a fetch from the peers may take, votes never wait for it
+	FetchTimeout int `mapstructure:"fetch_timeout"`
+	// bytes of a blob at most
+	MaxSize int64 `mapstructure:"max_size"`
+	// bearer token required to upload blobs, none if empty
+	UploadToken string `mapstructure:"upload_token"`
+}
+
+func DefaultBlobConfig() BlobConfig {
+	return BlobConfig{
+		FetchTimeout: DefaultBlobFetchTimeout,
+		MaxSize:      DefaultBlobMaxSize,
+	}
+}
+
 type HACAppConfig struct {
 	Home           string `mapstructure:"-"`
 	TimeoutCommit  uint64 `mapstructure:"-"`
 	AgentUrl       string `mapstructure:"agent_url"`
 	ServiceAddress string `mapstructure:"service_address"`
 	DiscussionRate int    `mapstructure:"discussion_rate"`
+
+	// limits for discussions authored by the local agent
+	DiscussionPerProposal int `mapstructure:"discussion_per_proposal"`
+	DiscussionPerBlock    int `mapstructure:"discussion_per_block"`
+
+	// settlement of the node's own proposals, policies are keyed by
+	// proposal category
+	SettleInterval int64                   `mapstructure:"settle_interval"`
+	SettlePolicies map[string]SettlePolicy `mapstructure:"settle_policy"`
+
+	// indexer database, "sqlite3" or "postgres". An empty sqlite3 dsn
+	// stands for indexer.db in the home directory.
+	IndexerDriver string `mapstructure:"indexer_driver"`
+	IndexerDSN    string `mapstructure:"indexer_dsn"`
+
+	// an observer node runs the chain, the indexer and the api without a
+	// validator key or an agent
+	Observer bool `mapstructure:"observer"`
+
+	Broadcast BroadcastConfig `mapstructure:"broadcast"`
+	Webhooks  WebhookConfig   `mapstructure:"webhooks"`
+	Community CommunityConfig `mapstructure:"community"`
+	Proposer  ProposerConfig  `mapstructure:"proposer"`
+	Blobs     BlobConfig      `mapstructure:"blobs"`
 }
 
 func DefaultHACAppConfig(home string) *HACAppConfig {
 	return &HACAppConfig{
-		Home:     home,
-		AgentUrl: "http://127.0.0.1:3000",
+		Home:                  home,
+		AgentUrl:              "http://127.0.0.1:3000",
+		DiscussionPerProposal: DefaultDiscussionPerProposal,
+		DiscussionPerBlock:    DefaultDiscussionPerBlock,
+		SettleInterval:        DefaultSettleInterval,
+		SettlePolicies:        DefaultSettlePolicies(),
+		IndexerDriver:         DefaultIndexerDriver,
+		Broadcast:             DefaultBroadcastConfig(),
+		Webhooks:              WebhookConfig{MaxAttempts: DefaultWebhookMaxAttempts},
+		Community:             CommunityConfig{MaxPending: DefaultCommunityMaxPending},
+		Blobs:                 DefaultBlobConfig(),
 	}
 
 }
 func NewHACAppConfig(home string) *HACAppConfig {
 	return &HACAppConfig{
-		Home:     home,
-		AgentUrl: "http://127.0.0.1:3000",
+		Home:                  home,
+		AgentUrl:              "http://127.0.0.1:3000",
+		DiscussionPerProposal: DefaultDiscussionPerProposal,
+		DiscussionPerBlock:    DefaultDiscussionPerBlock,
+		SettleInterval:        DefaultSettleInterval,
+		SettlePolicies:        DefaultSettlePolicies(),
+		IndexerDriver:         DefaultIndexerDriver,
+		Broadcast:             DefaultBroadcastConfig(),
+		Webhooks:              WebhookConfig{MaxAttempts: DefaultWebhookMaxAttempts},
+		Community:             CommunityConfig{MaxPending: DefaultCommunityMaxPending},
+		Blobs:                 DefaultBlobConfig(),
 	}
 }
 
@@ -44,6 +227,86 @@ func PowerPerStake(stake uint64, height uint64) int64 {
 	return int64(stake / GWeiPerPower(height))
 }
 
+// GovernanceUpgradeHeight is the first height where discussions are kept in
+// state, counted per proposal and threaded, where proposals have categories
+// with their lifecycle and actions, and where participants register. Blocks
+// below it are replayed as they were committed.
+const GovernanceUpgradeHeight = 1200000
+
+func GovernanceUpgraded(height uint64) bool {
+	return height >= GovernanceUpgradeHeight
+}
+
+const (
+	// bytes of a discussion posted by a participant at most
+	MaxParticipantPostSize = 2000
+	MaxParticipantNameLen  = 64
+	// participant registrations in a block at most
+	MaxRegistrationsPerBlock = 10
+	// references of a discussion at most
+	MaxDiscussionReferences = 8
+	// revisions of a proposal at most
+	MaxProposalRevisions = 16
+	// blocks a revised proposal is discussed at least before it is settled
+	MinRevisionDiscussionBlocks = 10
+)
+
+// ProposalCategoryRule is the lifecycle of the proposals of a category,
+// enforced on chain when they are settled. The discussion blocks of a revised
+// proposal are counted from its latest revision.
+type ProposalCategoryRule struct {
+	// blocks a proposal is discussed at least before it is settled
+	MinDiscussionBlocks uint64 `json:"minDiscussionBlocks"`
+	// discussions of members on a proposal at least before it is settled
+	MinDiscussions uint64 `json:"minDiscussions"`
+}
+
+// ProposalCategoryRules returns the rules keyed by proposal category at
+// height. Text proposals keep the lifecycle proposals had before categories,
+// which every category has below GovernanceUpgradeHeight.
+func ProposalCategoryRules(height uint64) map[string]ProposalCategoryRule {
+	rules := map[string]ProposalCategoryRule{
+		tx.ProposalCategoryText:       {},
+		tx.ProposalCategoryManifest:   {MinDiscussionBlocks: 100, MinDiscussions: 5},
+		tx.ProposalCategoryParameter:  {MinDiscussionBlocks: 50, MinDiscussions: 3},
+		tx.ProposalCategoryMembership: {MinDiscussionBlocks: 100, MinDiscussions: 5},
+		tx.ProposalCategoryTreasury:   {MinDiscussionBlocks: 100, MinDiscussions: 5},
+		tx.ProposalCategoryUpgrade:    {MinDiscussionBlocks: 200, MinDiscussions: 5},
+	}
+	if !GovernanceUpgraded(height) {
+		for category := range rules {
+			rules[category] = ProposalCategoryRule{}
+		}
+	}
+	return rules
+}
+
+// DiscussionPeriod returns the height the discussion of a proposal created at
+// proposalHeight started at and the blocks it lasts at least under rule, when
+// settled at height. A revision restarts it from the governance upgrade on.
+func DiscussionPeriod(rule ProposalCategoryRule, height uint64, proposalHeight uint64, revisionHeight uint64) (since uint64, blocks uint64) {
+	if revisionHeight == 0 || !GovernanceUpgraded(height) {
+		return proposalHeight, rule.MinDiscussionBlocks
+	}
+	return revisionHeight, max(rule.MinDiscussionBlocks, MinRevisionDiscussionBlocks)
+}
+
+// GovernableParams are the limits parameter proposals may change, with
+// their values until a proposal changes them.
+func GovernableParams() map[string]uint64 {
+	return map[string]uint64{
+		"max_proposal_revisions":      MaxProposalRevisions,
+		"max_discussion_references":   MaxDiscussionReferences,
+		"max_registrations_per_block": MaxRegistrationsPerBlock,
+	}
+}
+
+// ParticipantPostLimit returns how many discussions a participant may post
+// within a window of blocks.
+func ParticipantPostLimit() (posts uint64, window uint64) {
+	return 5, 100
+}
+
 type Config struct {
 	*config.Config `mapstructure:",squash"`
 
@@ -0,0 +1,119 @@
+package proposer
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"os"
+	"strings"
+)
+
+var ErrFeedFormat = errors.New("unknown feed format")
+
+// FeedSource reads proposals from an RSS 2.0 or Atom file.
+type FeedSource struct {
+	path string
+}
+
+func NewFeedSource(path string) *FeedSource {
+	return &FeedSource{path: path}
+}
+
+func (s *FeedSource) Name() string {
+	return "feed"
+}
+
+type rssFeed struct {
+	Items []struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Guid        string `xml:"guid"`
+		Description string `xml:"description"`
+		Enclosure   struct {
+			Url  string `xml:"url,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"enclosure"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		Id    string `xml:"id"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+	} `xml:"entry"`
+}
+
+func (s *FeedSource) Items(ctx context.Context) ([]Item, error) {
+	dat, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(dat, &root); err != nil {
+		return nil, err
+	}
+
+	items := make([]Item, 0)
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(dat, &feed); err != nil {
+			return nil, err
+		}
+		for _, it := range feed.Items {
+			item := Item{
+				Title: strings.TrimSpace(it.Title),
+				Text:  strings.TrimSpace(it.Description),
+				Link:  strings.TrimSpace(it.Link),
+			}
+			if item.Link == "" {
+				item.Link = strings.TrimSpace(it.Guid)
+			}
+			if strings.HasPrefix(it.Enclosure.Type, "image/") {
+				item.ImageUrl = it.Enclosure.Url
+			}
+			items = append(items, item)
+		}
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(dat, &feed); err != nil {
+			return nil, err
+		}
+		for _, e := range feed.Entries {
+			item := Item{
+				Title: strings.TrimSpace(e.Title),
+				Text:  strings.TrimSpace(e.Content),
+				Link:  strings.TrimSpace(e.Id),
+			}
+			if item.Text == "" {
+				item.Text = strings.TrimSpace(e.Summary)
+			}
+			for _, l := range e.Links {
+				switch {
+				case (l.Rel == "" || l.Rel == "alternate") && l.Href != "":
+					item.Link = l.Href
+				case l.Rel == "enclosure" && strings.HasPrefix(l.Type, "image/"):
+					item.ImageUrl = l.Href
+				}
+			}
+			items = append(items, item)
+		}
+	default:
+		return nil, ErrFeedFormat
+	}
+
+	// feeds list the newest entry first
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
@@ -0,0 +1,59 @@
+package proposer
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GitSource reads proposals from the commit log of a git repository. Each
+// commit is a candidate, linked through linkFormat which receives the commit
+// hash, e.g. https://github.com/org/repo/commit/%s.
+type GitSource struct {
+	repo       string
+	linkFormat string
+	limit      int
+}
+
+func NewGitSource(repo string, linkFormat string, limit int) *GitSource {
+	if linkFormat == "" {
+		linkFormat = "git:%s"
+	}
+	return &GitSource{
+		repo:       repo,
+		linkFormat: linkFormat,
+		limit:      limit,
+	}
+}
+
+func (s *GitSource) Name() string {
+	return "git"
+}
+
+func (s *GitSource) Items(ctx context.Context) ([]Item, error) {
+	args := []string{"-C", s.repo, "log", "--reverse", "--format=%H%x1f%s%x1f%b%x1e"}
+	if s.limit > 0 {
+		args = append(args, fmt.Sprintf("--max-count=%d", s.limit))
+	}
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log: %w", err)
+	}
+	items := make([]Item, 0)
+	for _, rec := range strings.Split(string(out), "\x1e") {
+		fields := strings.SplitN(strings.TrimSpace(rec), "\x1f", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		item := Item{
+			Title: strings.TrimSpace(fields[1]),
+			Link:  fmt.Sprintf(s.linkFormat, fields[0]),
+		}
+		if len(fields) == 3 {
+			item.Text = strings.TrimSpace(fields[2])
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,105 @@
+package proposer
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MarkdownSource reads proposals from the *.md files of a directory. The
+// first level one heading is used as the title. A front matter block may set
+// link and image, otherwise the file URL is used as the link.
+type MarkdownSource struct {
+	dir string
+}
+
+func NewMarkdownSource(dir string) *MarkdownSource {
+	return &MarkdownSource{dir: dir}
+}
+
+func (s *MarkdownSource) Name() string {
+	return "markdown"
+}
+
+func (s *MarkdownSource) Items(ctx context.Context) ([]Item, error) {
+	dir, err := filepath.Abs(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		path    string
+		modTime int64
+	}
+	files := make([]file, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".md") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file{path: filepath.Join(dir, e.Name()), modTime: info.ModTime().UnixNano()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime < files[j].modTime
+	})
+
+	items := make([]Item, 0, len(files))
+	for _, f := range files {
+		dat, err := os.ReadFile(f.path)
+		if err != nil {
+			return nil, err
+		}
+		item := parseMarkdown(string(dat))
+		if item.Link == "" {
+			item.Link = (&url.URL{Scheme: "file", Path: filepath.ToSlash(f.path)}).String()
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func parseMarkdown(text string) Item {
+	var item Item
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if strings.HasPrefix(text, "---\n") {
+		if end := strings.Index(text[4:], "\n---"); end >= 0 {
+			for _, line := range strings.Split(text[4:4+end], "\n") {
+				key, val, ok := strings.Cut(line, ":")
+				if !ok {
+					continue
+				}
+				val = strings.Trim(strings.TrimSpace(val), `"'`)
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "title":
+					item.Title = val
+				case "link":
+					item.Link = val
+				case "image":
+					item.ImageUrl = val
+				}
+			}
+			text = strings.TrimSpace(text[4+end+4:])
+		}
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "# ") {
+			if item.Title == "" {
+				item.Title = strings.TrimSpace(line[2:])
+			}
+			lines = append(lines[:i], lines[i+1:]...)
+			break
+		}
+	}
+	item.Text = strings.TrimSpace(strings.Join(lines, "\n"))
+	return item
+}
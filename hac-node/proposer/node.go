@@ -0,0 +1,91 @@
+package proposer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/calehh/hac-app/agent"
+)
+
+var ErrProposalPending = errors.New("a proposal of the node is pending")
+
+// Submitter hands drafted proposals to the node that signs them.
+type Submitter interface {
+	// Pending reports whether a proposal of the node is not on chain yet.
+	Pending(ctx context.Context) (bool, error)
+	// Submit returns ErrProposalPending if the node has a proposal in
+	// flight.
+	Submit(ctx context.Context, proposal agent.SubmitProposerProposalReq) error
+}
+
+// NodeSubmitter submits proposals through the proposer api of a node, which
+// signs them with its own sender. The daemon never holds the validator key,
+// so it cannot race the node for its nonces.
+type NodeSubmitter struct {
+	api   string
+	token string
+	cli   *http.Client
+}
+
+func NewNodeSubmitter(api string, token string) *NodeSubmitter {
+	return &NodeSubmitter{api: strings.TrimRight(api, "/"), token: token, cli: http.DefaultClient}
+}
+
+func (n *NodeSubmitter) Pending(ctx context.Context) (bool, error) {
+	var res agent.GetProposerPendingResponse
+	if err := n.do(ctx, http.MethodGet, "/api/proposer/pending", nil, &res); err != nil {
+		return false, err
+	}
+	return res.Pending, nil
+}
+
+func (n *NodeSubmitter) Submit(ctx context.Context, proposal agent.SubmitProposerProposalReq) error {
+	return n.do(ctx, http.MethodPost, "/api/proposer/proposals", proposal, nil)
+}
+
+func (n *NodeSubmitter) do(ctx context.Context, method string, path string, body any, res any) error {
+	var reqBody io.Reader
+	if body != nil {
+		dat, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(dat)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, n.api+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	resp, err := n.cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return ErrProposalPending
+	default:
+		return fmt.Errorf("%s %s status %v: %s", method, path, resp.StatusCode, dat)
+	}
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(dat, res)
+}
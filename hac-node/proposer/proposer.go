@@ -0,0 +1,161 @@
+package proposer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/calehh/hac-app/agent"
+	hac_types "github.com/calehh/hac-app/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	rpcclient "github.com/cometbft/cometbft/rpc/client"
+)
+
+var ErrDraftEmpty = errors.New("agent drafted an empty title")
+
+// Proposer polls its sources on a schedule and submits the first item that
+// is not on chain yet to the node. At most one proposal of the node is in
+// flight at any time, so the node never competes with itself for the single
+// proposal slot of a block.
+type Proposer struct {
+	logger   cmtlog.Logger
+	cli      rpcclient.Client
+	agent    agent.Client
+	node     Submitter
+	sources  []Source
+	interval time.Duration
+
+	// links submitted by this process, kept until they show up on chain
+	submitted map[string]bool
+}
+
+func NewProposer(logger cmtlog.Logger, cli rpcclient.Client, agentCli agent.Client, node Submitter, sources []Source, interval time.Duration) *Proposer {
+	return &Proposer{
+		logger:    logger.With("module", "proposer"),
+		cli:       cli,
+		agent:     agentCli,
+		node:      node,
+		sources:   sources,
+		interval:  interval,
+		submitted: make(map[string]bool),
+	}
+}
+
+// Run proposes on every tick until ctx is done.
+func (p *Proposer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.propose(ctx); err != nil {
+			p.logger.Error("propose fail", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Proposer) propose(ctx context.Context) error {
+	pending, err := p.node.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if pending {
+		p.logger.Info("proposal still pending, skip round")
+		return nil
+	}
+	onChain, err := p.chainLinks(ctx)
+	if err != nil {
+		return err
+	}
+	for link := range p.submitted {
+		if onChain[link] {
+			delete(p.submitted, link)
+		}
+	}
+
+	for _, src := range p.sources {
+		items, err := src.Items(ctx)
+		if err != nil {
+			p.logger.Error("read source fail", "source", src.Name(), "err", err)
+			continue
+		}
+		for _, item := range items {
+			if item.Link == "" || onChain[item.Link] || p.submitted[item.Link] {
+				continue
+			}
+			if err := p.submit(ctx, src, item); err != nil {
+				return err
+			}
+			return nil
+		}
+	}
+	p.logger.Debug("no new proposal")
+	return nil
+}
+
+func (p *Proposer) submit(ctx context.Context, src Source, item Item) error {
+	title, summary, err := p.agent.DraftProposal(ctx, itemText(item))
+	if err != nil {
+		return err
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return ErrDraftEmpty
+	}
+	if strings.TrimSpace(summary) == "" {
+		summary = item.Text
+	}
+	err = p.node.Submit(ctx, agent.SubmitProposerProposalReq{
+		ImageUrl: item.ImageUrl,
+		Title:    title,
+		Link:     item.Link,
+		Data:     summary,
+	})
+	if errors.Is(err, ErrProposalPending) {
+		p.logger.Info("node proposal pending, skip round")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.submitted[item.Link] = true
+	p.logger.Info("proposal submitted", "source", src.Name(), "title", title, "link", item.Link)
+	return nil
+}
+
+// chainLinks returns the links of all proposals on chain.
+func (p *Proposer) chainLinks(ctx context.Context) (map[string]bool, error) {
+	links := make(map[string]bool)
+	from := uint64(1)
+	for {
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, from)
+		res, err := p.cli.ABCIQuery(ctx, "/proposals/", key)
+		if err != nil {
+			return nil, err
+		}
+		if res.Response.Code != 0 {
+			return nil, fmt.Errorf("query proposals: code %d %s", res.Response.Code, res.Response.Log)
+		}
+		var proposals []*hac_types.Proposal
+		if err := json.Unmarshal(res.Response.Value, &proposals); err != nil {
+			return nil, err
+		}
+		if len(proposals) == 0 {
+			return links, nil
+		}
+		for _, proposal := range proposals {
+			if proposal.Link != "" {
+				links[proposal.Link] = true
+			}
+			from = proposal.Index + 1
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package proposer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/calehh/hac-app/agent"
+	hac_types "github.com/calehh/hac-app/types"
+	"github.com/cometbft/cometbft/libs/bytes"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	rpcclient "github.com/cometbft/cometbft/rpc/client"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+)
+
+// fakeChain serves the proposals on chain, a page of one per query.
+type fakeChain struct {
+	rpcclient.Client
+	links []string
+}
+
+func (c *fakeChain) ABCIQuery(ctx context.Context, path string, data bytes.HexBytes) (*ctypes.ResultABCIQuery, error) {
+	from := binary.BigEndian.Uint64(data)
+	proposals := make([]*hac_types.Proposal, 0)
+	if from <= uint64(len(c.links)) {
+		proposals = append(proposals, &hac_types.Proposal{Index: from, Link: c.links[from-1]})
+	}
+	res := &ctypes.ResultABCIQuery{}
+	res.Response.Value, _ = json.Marshal(proposals)
+	return res, nil
+}
+
+type fakeNode struct {
+	pending   bool
+	submitted []agent.SubmitProposerProposalReq
+}
+
+func (n *fakeNode) Pending(ctx context.Context) (bool, error) {
+	return n.pending, nil
+}
+
+func (n *fakeNode) Submit(ctx context.Context, proposal agent.SubmitProposerProposalReq) error {
+	if n.pending {
+		return ErrProposalPending
+	}
+	n.submitted = append(n.submitted, proposal)
+	return nil
+}
+
+type fakeSource []Item
+
+func (s fakeSource) Name() string {
+	return "fake"
+}
+
+func (s fakeSource) Items(ctx context.Context) ([]Item, error) {
+	return s, nil
+}
+
+func TestProposerPropose(t *testing.T) {
+	ctx := context.Background()
+	chain := &fakeChain{links: []string{"a"}}
+	node := &fakeNode{}
+	src := fakeSource{
+		{Title: "on chain", Link: "a"},
+		{Title: "no link"},
+		{Title: "first", Text: "body", Link: "b"},
+		{Title: "second", Link: "c"},
+	}
+	p := NewProposer(cmtlog.NewNopLogger(), chain, agent.NewMockClient(), node, []Source{src}, 0)
+
+	if err := p.propose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.submitted) != 1 || node.submitted[0].Link != "b" || node.submitted[0].Title != "first" {
+		t.Fatalf("submitted %+v, want item b", node.submitted)
+	}
+
+	// nothing is drafted while the node has a proposal in flight
+	node.pending = true
+	if err := p.propose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.submitted) != 1 {
+		t.Fatalf("submitted %+v while pending", node.submitted)
+	}
+
+	// the submitted item is skipped until it shows up on chain
+	node.pending = false
+	if err := p.propose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.submitted) != 2 || node.submitted[1].Link != "c" {
+		t.Fatalf("submitted %+v, want item c next", node.submitted)
+	}
+	chain.links = append(chain.links, "b", "c")
+	if err := p.propose(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.submitted) != 2 || len(p.submitted) != 0 {
+		t.Fatalf("submitted %+v, kept %v", node.submitted, p.submitted)
+	}
+}
+
+func TestNodeSubmitter(t *testing.T) {
+	var pending bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/proposer/pending":
+			json.NewEncoder(w).Encode(agent.GetProposerPendingResponse{Pending: pending})
+		case "/api/proposer/proposals":
+			if pending {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			pending = true
+			w.Write([]byte("{}"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	n := NewNodeSubmitter(srv.URL+"/", "secret")
+	if err := n.Submit(ctx, agent.SubmitProposerProposalReq{Title: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := n.Pending(ctx); err != nil || !got {
+		t.Fatalf("pending %v %v, want true", got, err)
+	}
+	if err := n.Submit(ctx, agent.SubmitProposerProposalReq{Title: "t"}); !errors.Is(err, ErrProposalPending) {
+		t.Fatalf("error %v, want %v", err, ErrProposalPending)
+	}
+	if _, err := NewNodeSubmitter(srv.URL, "").Pending(ctx); err == nil {
+		t.Fatal("request without the token accepted")
+	}
+}
@@ -0,0 +1,30 @@
+package proposer
+
+import (
+	"context"
+	"strings"
+)
+
+// Item is a candidate proposal read from a source. Link identifies the item
+// and is used to deduplicate against on-chain proposals.
+type Item struct {
+	Title    string
+	Text     string
+	Link     string
+	ImageUrl string
+}
+
+// Source produces candidate proposals. Sources are polled on every round of
+// the proposer and should return their items oldest first.
+type Source interface {
+	Name() string
+	Items(ctx context.Context) ([]Item, error)
+}
+
+// itemText joins the title and the body handed to the agent for drafting.
+func itemText(item Item) string {
+	if item.Title == "" {
+		return item.Text
+	}
+	return strings.TrimSpace(item.Title + "\n\n" + item.Text)
+}
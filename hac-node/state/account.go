@@ -7,23 +7,34 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	AccountKindMember      uint32 = 0
+	AccountKindParticipant uint32 = 1
+)
+
 type accountSt struct {
-	Index    uint64         `json:"index"`
-	PubKey   ed25519.PubKey `json:"pubKey"`
-	Stake    uint64         `json:"stake"`
-	AgentUrl string         `json:"agentUrl"`
-	Name     string         `json:"name"`
-	Nonce    uint64         `json:"nonce"`
+	Index      uint64         `json:"index"`
+	PubKey     ed25519.PubKey `json:"pubKey"`
+	Stake      uint64         `json:"stake"`
+	AgentUrl   string         `json:"agentUrl"`
+	Name       string         `json:"name"`
+	Nonce      uint64         `json:"nonce"`
+	Kind       uint32         `json:"kind,omitempty"`
+	PostHeight uint64         `json:"postHeight,omitempty"`
+	Posts      uint64         `json:"posts,omitempty"`
 }
 
 func (a *Account) MarshalJSON() (dat []byte, err error) {
 	o := accountSt{
-		Index:    a.Index,
-		PubKey:   a.PubKey,
-		Stake:    a.Stake,
-		Nonce:    a.Nonce,
-		Name:     a.Name,
-		AgentUrl: a.AgentUrl,
+		Index:      a.Index,
+		PubKey:     a.PubKey,
+		Stake:      a.Stake,
+		Nonce:      a.Nonce,
+		Name:       a.Name,
+		AgentUrl:   a.AgentUrl,
+		Kind:       a.Kind,
+		PostHeight: a.PostHeight,
+		Posts:      a.Posts,
 	}
 	return json.Marshal(o)
 }
@@ -40,9 +51,18 @@ func (a *Account) UnmarshalJSON(dat []byte) (err error) {
 	a.AgentUrl = o.AgentUrl
 	a.Nonce = o.Nonce
 	a.Name = o.Name
+	a.Kind = o.Kind
+	a.PostHeight = o.PostHeight
+	a.Posts = o.Posts
 	return
 }
 
+// IsParticipant reports whether the account belongs to a human participant,
+// who may discuss but holds no stake and no voting power.
+func (a *Account) IsParticipant() bool {
+	return a.Kind == AccountKindParticipant
+}
+
 func (a *Account) Clone() *Account {
 	n := proto.Clone(a)
 	return n.(*Account)
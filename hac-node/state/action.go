@@ -0,0 +1,344 @@
+package state
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	abci_types "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/ethereum/go-ethereum/common"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	KeyExecution = "x%v"
+)
+
+var (
+	ErrMembershipExists = errors.New("membership grant target is already a member")
+	ErrMembershipLast   = errors.New("the last member is kept")
+)
+
+// Execution is the outcome of an accepted proposal, Results holds the result
+// of every action when it was executed and Error why nothing was otherwise.
+type Execution struct {
+	Proposal uint64   `json:"proposal"`
+	Height   uint64   `json:"height"`
+	Executed bool     `json:"executed"`
+	Results  []string `json:"results,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (s *State) GetExecution(proposal uint64) (*Execution, error) {
+	val, err := s.get(fmt.Sprintf(KeyExecution, proposal))
+	if err != nil || val == nil {
+		return nil, err
+	}
+	execution := new(Execution)
+	if err := json.Unmarshal(val, execution); err != nil {
+		return nil, err
+	}
+	return execution, nil
+}
+
+// proposalActions returns the actions an accepted proposal executes, the one
+// of its category first.
+func proposalActions(proposal *hac_types.Proposal) []tx.ProposalAction {
+	actions := make([]tx.ProposalAction, 0, len(proposal.Actions)+1)
+	if action, ok := tx.CategoryAction(proposal.Category, proposal.Data); ok {
+		actions = append(actions, action)
+	}
+	return append(actions, proposal.Actions...)
+}
+
+// checkActions validates the actions of a proposal when it is submitted or
+// revised. The state may change until it is accepted, so they are checked
+// again when executed.
+func (s *State) checkActions(actions []tx.ProposalAction) error {
+	payloads, err := tx.DecodeProposalActions(actions)
+	if err != nil {
+		return err
+	}
+	for i, payload := range payloads {
+		if err := s.checkPayload(payload); err != nil {
+			return fmt.Errorf("action %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// checkPayload validates the payload of a category or of an action against
+// the state.
+func (s *State) checkPayload(payload any) error {
+	switch p := payload.(type) {
+	case *tx.ParameterChange:
+		if _, ok := config.GovernableParams()[p.Name]; !ok {
+			return ErrParamUnknown
+		}
+	case *tx.MembershipGrant:
+		pk, _ := hex.DecodeString(p.PubKey)
+		exist, err := s.existPubkey(pk)
+		if err != nil || !exist {
+			return err
+		}
+		a, err := s.FindAccount(ed25519.PubKey(pk).Address())
+		if err != nil {
+			return err
+		}
+		// created in this block, or a participant
+		if a == nil || a.IsParticipant() {
+			return ErrAccountAlreadyExists
+		}
+		if a.Stake != 0 {
+			return ErrMembershipExists
+		}
+	case *tx.MembershipChange:
+		a, err := s.GetAccount(p.Validator)
+		if err != nil && !errors.Is(err, ErrAccountNoexists) && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if a == nil || a.Stake == 0 {
+			return ErrMembershipTarget
+		}
+	case *tx.TreasurySpend:
+		if !common.IsHexAddress(p.Recipient) {
+			return ErrTreasuryRecipient
+		}
+	case *tx.SoftwareUpgrade:
+		if p.Height <= s.header.Height {
+			return ErrUpgradeHeight
+		}
+	}
+	return nil
+}
+
+// poweredMembers returns the number of members with voting power in the
+// working state, the accounts changed in the block over the committed ones,
+// so removals earlier in the block are accounted for.
+func (s *State) poweredMembers() (int, error) {
+	start := []byte(fmt.Sprintf(KeyAccountBody, ""))
+	it, err := s.db.Iterator(start, PrefixEndBytes(start), false)
+	if err != nil {
+		return 0, err
+	}
+	defer it.Close()
+	count := 0
+	committed := make(map[uint64]bool)
+	for ; it.Valid(); it.Next() {
+		a := new(Account)
+		if err := proto.Unmarshal(it.Value(), a); err != nil {
+			return 0, err
+		}
+		committed[a.Index] = true
+		if cached := s.acnts[a.Index]; cached != nil {
+			a = cached
+		}
+		if config.PowerPerStake(a.Stake, s.header.Height) > 0 {
+			count += 1
+		}
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	for idx, a := range s.acnts {
+		if !committed[idx] && a != nil && config.PowerPerStake(a.Stake, s.header.Height) > 0 {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+// stateSnapshot holds what the actions of a proposal may change, to undo
+// them when one fails.
+type stateSnapshot struct {
+	header        *StateHeader
+	idxs          map[string]uint64
+	acnts         map[uint64]*Account
+	modifiedAcnts map[uint64]uint32
+	writes        map[string][]byte
+}
+
+func (s *State) snapshot() *stateSnapshot {
+	return &stateSnapshot{
+		header:        proto.Clone(s.header).(*StateHeader),
+		idxs:          deepCopyMap(s.idxs),
+		acnts:         deepCopyMap(s.acnts),
+		modifiedAcnts: deepCopyMap(s.modifiedAcnts),
+		writes:        deepCopyMap(s.writes),
+	}
+}
+
+func (s *State) restore(snap *stateSnapshot) {
+	s.header = snap.header
+	s.idxs = snap.idxs
+	s.acnts = snap.acnts
+	s.modifiedAcnts = snap.modifiedAcnts
+	s.writes = snap.writes
+}
+
+// executeProposal applies the actions of an accepted proposal in order.
+// Execution is atomic: when an action fails, e.g. a member who left
+// meanwhile, the proposal stays accepted and none of its actions apply. The
+// outcome is recorded in state and reported by an execute event, which
+// follows the events of the effects. Proposals settled before the governance
+// upgrade have no effect.
+func (s *State) executeProposal(proposal *hac_types.Proposal) (events []abci_types.Event, err error) {
+	if !config.GovernanceUpgraded(s.header.Height) {
+		return nil, nil
+	}
+	actions := proposalActions(proposal)
+	if len(actions) == 0 {
+		return nil, nil
+	}
+	execution := &Execution{
+		Proposal: proposal.Index,
+		Height:   s.header.Height,
+	}
+	snap := s.snapshot()
+	for i, action := range actions {
+		result, evs, err := s.applyAction(proposal, uint64(i), action)
+		if err != nil {
+			s.restore(snap)
+			events = nil
+			execution.Results = nil
+			execution.Error = fmt.Sprintf("action %d %s: %v", i, action.Type, err)
+			break
+		}
+		events = append(events, evs...)
+		execution.Results = append(execution.Results, result)
+	}
+	execution.Executed = execution.Error == ""
+	val, _ := json.Marshal(execution)
+	s.set(fmt.Sprintf(KeyExecution, proposal.Index), val)
+
+	event := &hac_types.EventExecuteProposal{
+		Proposal: proposal.Index,
+		Category: tx.NormalizeCategory(proposal.Category),
+		Executed: execution.Executed,
+		Actions:  uint64(len(actions)),
+		Result:   strings.Join(execution.Results, "; "),
+	}
+	if !execution.Executed {
+		event.Result = execution.Error
+	}
+	events = append(events, hac_types.EncodeEventExecuteProposal(event))
+	return events, nil
+}
+
+// applyAction applies the action at index of a proposal and returns what it
+// did along with the events of its effects.
+func (s *State) applyAction(proposal *hac_types.Proposal, index uint64, action tx.ProposalAction) (result string, events []abci_types.Event, err error) {
+	payload, err := tx.DecodeProposalAction(action)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.checkPayload(payload); err != nil {
+		return "", nil, err
+	}
+	switch p := payload.(type) {
+	case string:
+		s.set(KeyManifest, []byte(p))
+		result = "manifest replaced"
+	case *tx.ParameterChange:
+		s.set(fmt.Sprintf(KeyParam, p.Name), new(big.Int).SetUint64(p.Value).Bytes())
+		result = fmt.Sprintf("%s set to %d", p.Name, p.Value)
+	case *tx.MembershipGrant:
+		pk, _ := hex.DecodeString(p.PubKey)
+		a, err := s.FindAccount(ed25519.PubKey(pk).Address())
+		if err != nil {
+			return "", nil, err
+		}
+		if a == nil {
+			a = &Account{
+				PubKey:   pk,
+				Stake:    p.Stake,
+				AgentUrl: p.AgentUrl,
+				Name:     p.Name,
+			}
+			if err := s.AddAccount(a); err != nil {
+				return "", nil, err
+			}
+		} else {
+			a.Stake = p.Stake
+			a.AgentUrl = p.AgentUrl
+			a.Name = p.Name
+			v := s.modifiedAcnts[a.Index]
+			v |= ModifiedFlagMod
+			s.modifiedAcnts[a.Index] = v
+			s.acnts[a.Index] = a.Clone()
+		}
+		events = append(events, hac_types.EncodeEventGrant(&hac_types.EventGrant{
+			Validator:       a.Index,
+			Address:         a.Address(),
+			Amount:          a.Stake,
+			AgentUrl:        a.AgentUrl,
+			Name:            a.Name,
+			Nonce:           a.Nonce,
+			Grant:           true,
+			ProposerIndex:   proposal.Proposer,
+			ProposerAddress: proposal.ProposerAddress,
+		}))
+		result = fmt.Sprintf("%s admitted to the council", a.Address())
+	case *tx.MembershipChange:
+		a, err := s.GetAccount(p.Validator)
+		if err != nil {
+			return "", nil, err
+		}
+		members, err := s.poweredMembers()
+		if err != nil {
+			return "", nil, err
+		}
+		if config.PowerPerStake(a.Stake, s.header.Height) > 0 && members <= 1 {
+			return "", nil, ErrMembershipLast
+		}
+		unstake := &hac_types.EventUnStake{
+			Validator: a.Index,
+			Address:   a.Address(),
+			Amount:    a.Stake,
+		}
+		a.Stake = 0
+		v := s.modifiedAcnts[a.Index]
+		v |= ModifiedFlagMod
+		s.modifiedAcnts[a.Index] = v
+		s.acnts[a.Index] = a.Clone()
+		events = append(events, hac_types.EncodeEventUnStake(unstake))
+		result = fmt.Sprintf("%s removed from the council", a.Address())
+	case *tx.TreasurySpend:
+		spend := TreasurySpend{
+			Proposal:  proposal.Index,
+			Recipient: p.Recipient,
+			Amount:    p.Amount,
+			Purpose:   p.Purpose,
+			Height:    s.header.Height,
+		}
+		val, _ := json.Marshal(spend)
+		s.set(fmt.Sprintf(KeyTreasurySpend, proposal.Index, index), val)
+		result = fmt.Sprintf("%d authorized to %s", p.Amount, p.Recipient)
+	case *tx.SoftwareUpgrade:
+		plan := UpgradePlan{
+			Proposal: proposal.Index,
+			Name:     p.Name,
+			Height:   p.Height,
+			Info:     p.Info,
+		}
+		val, _ := json.Marshal(plan)
+		s.set(KeyUpgradePlan, val)
+		result = fmt.Sprintf("upgrade %s scheduled at height %d", p.Name, p.Height)
+	case *tx.WebhookCall:
+		events = append(events, hac_types.EncodeEventProposalWebhook(&hac_types.EventProposalWebhook{
+			Proposal: proposal.Index,
+			Action:   index,
+			Url:      p.Url,
+			Payload:  string(p.Payload),
+		}))
+		result = fmt.Sprintf("webhook %s queued", p.Url)
+	}
+	return result, events, nil
+}
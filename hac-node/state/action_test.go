@@ -0,0 +1,178 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+	"github.com/cosmos/iavl"
+	dbm "github.com/cosmos/iavl/db"
+)
+
+// newTestState returns the state of the block after the one committing
+// members with the stakes, their account indexes in order.
+func newTestState(t *testing.T, stakes ...uint64) (*State, []uint64) {
+	t.Helper()
+	logger := cmtlog.NewNopLogger()
+	s := newState(iavl.NewMutableTree(dbm.NewMemDB(), 128, true, Cometbft2CosmosLogger(logger)), logger)
+	idxs := make([]uint64, 0, len(stakes))
+	for _, stake := range stakes {
+		a := &Account{PubKey: ed25519.GenPrivKey().PubKey().Bytes(), Stake: stake}
+		if err := s.AddAccount(a); err != nil {
+			t.Fatal(err)
+		}
+		idxs = append(idxs, a.Index)
+	}
+	if _, err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	return s.nextState(), idxs
+}
+
+// upgrade moves the state to the governance upgrade height.
+func upgrade(s *State) {
+	s.header.Height = config.GovernanceUpgradeHeight
+}
+
+func revokeActions(idxs ...uint64) []tx.ProposalAction {
+	actions := make([]tx.ProposalAction, 0, len(idxs))
+	for _, idx := range idxs {
+		actions = append(actions, tx.ProposalAction{
+			Type: tx.ProposalActionRevokeMembership,
+			Data: json.RawMessage(fmt.Sprintf(`{"validator":%d}`, idx)),
+		})
+	}
+	return actions
+}
+
+func stakeOf(t *testing.T, s *State, idx uint64) uint64 {
+	t.Helper()
+	a, err := s.GetAccount(idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.Stake
+}
+
+func TestExecuteRevokesKeepLastMember(t *testing.T) {
+	stake := config.GWeiPerPower(0)
+	s, idxs := newTestState(t, stake, stake)
+	upgrade(s)
+
+	// both revokes are checked against the committed set of two members,
+	// the second one must see the first
+	proposal := &hac_types.Proposal{Index: 1, Actions: revokeActions(idxs...)}
+	if _, err := s.executeProposal(proposal); err != nil {
+		t.Fatal(err)
+	}
+	execution, err := s.GetExecution(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if execution.Executed || !strings.Contains(execution.Error, ErrMembershipLast.Error()) {
+		t.Fatalf("execution %+v, want the last member kept", execution)
+	}
+	for _, idx := range idxs {
+		if stakeOf(t, s, idx) != stake {
+			t.Fatalf("member %d lost its stake", idx)
+		}
+	}
+
+	proposal = &hac_types.Proposal{Index: 2, Actions: revokeActions(idxs[0])}
+	if _, err := s.executeProposal(proposal); err != nil {
+		t.Fatal(err)
+	}
+	if execution, _ = s.GetExecution(2); !execution.Executed {
+		t.Fatalf("execution %+v, want one of two members removed", execution)
+	}
+	if stakeOf(t, s, idxs[0]) != 0 {
+		t.Fatalf("member %d kept its stake", idxs[0])
+	}
+}
+
+func TestPoweredMembers(t *testing.T) {
+	stake := config.GWeiPerPower(0)
+	// a stake below one power is a member outside the validator set
+	s, idxs := newTestState(t, stake, stake, 1)
+	upgrade(s)
+	count, err := s.poweredMembers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("%d powered members, want 2", count)
+	}
+
+	// changes of the block override the committed accounts
+	a, err := s.GetAccount(idxs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Stake = 0
+	if err := s.AddAccount(&Account{PubKey: ed25519.GenPrivKey().PubKey().Bytes(), Stake: 3 * stake}); err != nil {
+		t.Fatal(err)
+	}
+	if count, err = s.poweredMembers(); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("%d powered members, want 2", count)
+	}
+
+	// removing the member below one power does not shrink the validator set
+	a, err = s.GetAccount(idxs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Stake = 0
+	proposal := &hac_types.Proposal{Index: 1, Actions: revokeActions(idxs[2])}
+	if _, err := s.executeProposal(proposal); err != nil {
+		t.Fatal(err)
+	}
+	if execution, _ := s.GetExecution(1); !execution.Executed {
+		t.Fatalf("execution %+v, want the member below one power removed", execution)
+	}
+}
+
+func TestActionsBeforeUpgrade(t *testing.T) {
+	stake := config.GWeiPerPower(0)
+	s, idxs := newTestState(t, stake, stake)
+
+	for name, ptx := range map[string]tx.ProposalTx{
+		"category": {Title: "t", Category: tx.ProposalCategoryText},
+		"actions":  {Title: "t", Actions: revokeActions(idxs[1])},
+	} {
+		if _, err := s.Proposal(&ptx, idxs[0], true, tx.VoteProcessProposal); !errors.Is(err, ErrGovernanceNotUpgraded) {
+			t.Errorf("proposal with %s before the upgrade: %v", name, err)
+		}
+	}
+	if _, err := s.Proposal(&tx.ProposalTx{Title: "t"}, idxs[0], false, tx.VoteProcessProposal); err != nil {
+		t.Fatal(err)
+	}
+	s = commit(t, s, s.header.Height+1)
+	if _, err := s.ReviseProposal(&tx.ReviseProposalTx{Proposal: 1, Title: "t", Actions: revokeActions(idxs[1])}, idxs[0], true); !errors.Is(err, ErrGovernanceNotUpgraded) {
+		t.Fatalf("revision with actions before the upgrade: %v", err)
+	}
+
+	// accepted before the upgrade, the actions of a proposal have no effect
+	events, err := s.executeProposal(&hac_types.Proposal{Index: 1, Actions: revokeActions(idxs[1])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 || stakeOf(t, s, idxs[1]) != stake {
+		t.Fatalf("events %v, stake %d, want nothing executed", events, stakeOf(t, s, idxs[1]))
+	}
+	if execution, err := s.GetExecution(1); err != nil || execution != nil {
+		t.Fatalf("execution %+v, %v recorded", execution, err)
+	}
+}
@@ -0,0 +1,219 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+)
+
+var (
+	KeyParam           = "param%s"
+	KeyDiscussionCount = "pd%v"
+	KeyTreasurySpend   = "t%v-%v"
+	KeyUpgradePlan     = "upgrade"
+)
+
+var (
+	ErrParamUnknown          = errors.New("parameter unknown")
+	ErrMembershipTarget      = errors.New("membership target is not a member")
+	ErrTreasuryRecipient     = errors.New("treasury recipient invalid")
+	ErrUpgradeHeight         = errors.New("upgrade height already passed")
+	ErrSettleTooEarly        = errors.New("proposal discussed for too few blocks")
+	ErrSettleFewDiscussions  = errors.New("proposal has too few discussions")
+	ErrCategoryDataInContent = errors.New("proposal data of the category must be inline")
+)
+
+// UpgradePlan is the software upgrade scheduled by the last accepted upgrade
+// proposal. It is a record for the operators, the chain does not halt at its
+// height.
+type UpgradePlan struct {
+	Proposal uint64 `json:"proposal"`
+	Name     string `json:"name"`
+	Height   uint64 `json:"height"`
+	Info     string `json:"info"`
+}
+
+// TreasurySpend is a payment authorized by an accepted treasury proposal.
+type TreasurySpend struct {
+	Proposal  uint64 `json:"proposal"`
+	Recipient string `json:"recipient"`
+	Amount    uint64 `json:"amount"`
+	Purpose   string `json:"purpose"`
+	Height    uint64 `json:"height"`
+}
+
+// set buffers a write until the state is updated.
+func (s *State) set(key string, val []byte) {
+	s.writes[key] = val
+}
+
+// get reads a key through the buffered writes.
+func (s *State) get(key string) ([]byte, error) {
+	if val, ok := s.writes[key]; ok {
+		return val, nil
+	}
+	return s.db.Get([]byte(key))
+}
+
+// flushWrites writes the buffered writes in key order.
+func (s *State) flushWrites() error {
+	keys := make([]string, 0, len(s.writes))
+	for key := range s.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := s.db.Set([]byte(key), s.writes[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Param returns the value of a governable parameter.
+func (s *State) Param(name string) (uint64, error) {
+	def, ok := config.GovernableParams()[name]
+	if !ok {
+		return 0, ErrParamUnknown
+	}
+	val, err := s.get(fmt.Sprintf(KeyParam, name))
+	if err != nil {
+		return 0, err
+	}
+	if val == nil {
+		return def, nil
+	}
+	return new(big.Int).SetBytes(val).Uint64(), nil
+}
+
+// Params returns all the governable parameters.
+func (s *State) Params() (map[string]uint64, error) {
+	params := make(map[string]uint64)
+	for name := range config.GovernableParams() {
+		val, err := s.Param(name)
+		if err != nil {
+			return nil, err
+		}
+		params[name] = val
+	}
+	return params, nil
+}
+
+func (s *State) GetUpgradePlan() (*UpgradePlan, error) {
+	val, err := s.get(KeyUpgradePlan)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	plan := new(UpgradePlan)
+	if err := json.Unmarshal(val, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// GetTreasurySpends returns the payments authorized by an accepted proposal,
+// in the order of its actions.
+func (s *State) GetTreasurySpends(proposal uint64) ([]TreasurySpend, error) {
+	spends := make([]TreasurySpend, 0)
+	// the action of the category comes before the listed ones
+	for i := 0; i <= tx.MaxProposalActions; i++ {
+		val, err := s.get(fmt.Sprintf(KeyTreasurySpend, proposal, i))
+		if err != nil {
+			return nil, err
+		}
+		if val == nil {
+			continue
+		}
+		var spend TreasurySpend
+		if err := json.Unmarshal(val, &spend); err != nil {
+			return nil, err
+		}
+		spends = append(spends, spend)
+	}
+	return spends, nil
+}
+
+// discussionCount returns the discussions of members on a proposal recorded
+// since config.GovernanceUpgradeHeight, those of the current block included.
+// Participants register freely, their posts do not count.
+func (s *State) discussionCount(proposal uint64) (uint64, error) {
+	val, err := s.get(fmt.Sprintf(KeyDiscussionCount, proposal))
+	if err != nil {
+		return 0, err
+	}
+	count := new(big.Int).SetBytes(val).Uint64()
+	if !config.GovernanceUpgraded(s.header.Height) {
+		return count, nil
+	}
+	for _, d := range s.newDiscussions {
+		if d.Proposal == proposal && !d.Human {
+			count += 1
+		}
+	}
+	return count, nil
+}
+
+// countDiscussions adds the discussions of members in the block to the
+// counters of their proposals, must be called before the block is flushed.
+func (s *State) countDiscussions() error {
+	if !config.GovernanceUpgraded(s.header.Height) {
+		return nil
+	}
+	counts := make(map[uint64]uint64)
+	for _, d := range s.newDiscussions {
+		if !d.Human {
+			counts[d.Proposal] += 1
+		}
+	}
+	for proposal, n := range counts {
+		key := fmt.Sprintf(KeyDiscussionCount, proposal)
+		val, err := s.get(key)
+		if err != nil {
+			return err
+		}
+		count := new(big.Int).SetBytes(val).Uint64() + n
+		s.set(key, new(big.Int).SetUint64(count).Bytes())
+	}
+	return nil
+}
+
+// checkCategory validates the data of a proposal against its category.
+// Only text proposals may keep their content in the blob store, the others
+// are executed from their inline data.
+func (s *State) checkCategory(category string, data []byte, contentHash string) error {
+	payload, err := tx.DecodeProposalData(category, data)
+	if err != nil {
+		return err
+	}
+	if tx.NormalizeCategory(category) != tx.ProposalCategoryText && contentHash != "" {
+		return ErrCategoryDataInContent
+	}
+	return s.checkPayload(payload)
+}
+
+// checkLifecycle enforces the discussion rules of the category of a proposal
+// before it is settled.
+func (s *State) checkLifecycle(proposal *hac_types.Proposal) error {
+	rule := config.ProposalCategoryRules(s.header.Height)[tx.NormalizeCategory(proposal.Category)]
+	since, blocks := config.DiscussionPeriod(rule, s.header.Height, proposal.Height, proposal.RevisionHeight)
+	if s.header.Height < since+blocks {
+		return fmt.Errorf("%w: %d blocks since height %d required", ErrSettleTooEarly, blocks, since)
+	}
+	if rule.MinDiscussions == 0 {
+		return nil
+	}
+	count, err := s.discussionCount(proposal.Index)
+	if err != nil {
+		return err
+	}
+	if count < rule.MinDiscussions {
+		return fmt.Errorf("%w: %d of %d", ErrSettleFewDiscussions, count, rule.MinDiscussions)
+	}
+	return nil
+}
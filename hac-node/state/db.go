@@ -3,6 +3,7 @@ package state
 import (
 	"sync"
 
+	hac_types "github.com/calehh/hac-app/types"
 	cmtlog "github.com/cometbft/cometbft/libs/log"
 	"github.com/cosmos/iavl"
 	dbm "github.com/cosmos/iavl/db"
@@ -112,3 +113,50 @@ func (db *StateDB) GetAccountByAddress(addr []byte) (acnt *Account, height uint6
 
 	return
 }
+
+// GetProposals returns up to limit proposals with an index not below from.
+func (db *StateDB) GetProposals(from uint64, limit int) (proposals []*hac_types.Proposal, height uint64, err error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	if from == 0 {
+		from = 1
+	}
+	proposals = make([]*hac_types.Proposal, 0, limit)
+	for idx := from; idx <= db.state.getProposalMax() && len(proposals) < limit; idx++ {
+		var proposal *hac_types.Proposal
+		proposal, err = db.state.getProposal(idx)
+		if err != nil {
+			return
+		}
+		proposals = append(proposals, proposal)
+	}
+	height = db.state.header.Height
+	return
+}
+
+// GetExecution returns the outcome of an accepted proposal, nil if it was
+// not executed.
+func (db *StateDB) GetExecution(proposal uint64) (execution *Execution, height uint64, err error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	execution, err = db.state.GetExecution(proposal)
+	height = db.state.header.Height
+	return
+}
+
+// GetUpgradePlan returns the upgrade plan, nil if none was scheduled.
+func (db *StateDB) GetUpgradePlan() (plan *UpgradePlan, height uint64, err error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	plan, err = db.state.GetUpgradePlan()
+	height = db.state.header.Height
+	return
+}
+
+func (db *StateDB) GetTreasurySpends(proposal uint64) (spends []TreasurySpend, height uint64, err error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+	spends, err = db.state.GetTreasurySpends(proposal)
+	height = db.state.header.Height
+	return
+}
@@ -0,0 +1,71 @@
+package state
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+)
+
+func TestDiscussionThread(t *testing.T) {
+	s, idxs := newTestState(t, config.GWeiPerPower(0))
+	member := idxs[0]
+
+	// below the upgrade the thread of a discussion is dropped unchecked
+	event, err := s.Dicussion(&tx.DiscussionTx{Data: []byte("old"), ReplyTo: 9, References: []tx.Reference{{Type: "link", Index: 1}}}, member, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ReplyTo != 0 || len(event.References) != 0 {
+		t.Fatalf("event %+v keeps the thread below the upgrade", event)
+	}
+	old := event.Index
+	if _, err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	s = s.nextState()
+	upgrade(s)
+	s.proposalMaxIndex = 2
+
+	event, err = s.Dicussion(&tx.DiscussionTx{Proposal: 1, Data: []byte("root")}, member, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := event.Index
+	event, err = s.Dicussion(&tx.DiscussionTx{Proposal: 1, Data: []byte("reply"), ReplyTo: root, References: []tx.Reference{
+		{Type: tx.ReferenceQuote, Index: root},
+		{Type: tx.ReferenceCite, Index: 2},
+	}}, member, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ReplyTo != root || len(event.References) != 2 || event.References[0].Index != root || event.References[1].Index != 2 {
+		t.Fatalf("event %+v, want the thread kept", event)
+	}
+
+	tooMany := make([]tx.Reference, config.MaxDiscussionReferences+1)
+	for i := range tooMany {
+		tooMany[i] = tx.Reference{Type: tx.ReferenceCite, Index: 1}
+	}
+	for name, tc := range map[string]struct {
+		tx  tx.DiscussionTx
+		err error
+	}{
+		"reply before the upgrade": {tx.DiscussionTx{ReplyTo: old}, ErrDiscussionBeforeUpgrade},
+		"quote before the upgrade": {tx.DiscussionTx{References: []tx.Reference{{Type: tx.ReferenceQuote, Index: old}}}, ErrDiscussionBeforeUpgrade},
+		"reply to nothing":         {tx.DiscussionTx{Proposal: 1, ReplyTo: 99}, ErrDiscussionNoexists},
+		"reply across proposals":   {tx.DiscussionTx{Proposal: 2, ReplyTo: root}, ErrReplyProposalUnmatched},
+		"quote of nothing":         {tx.DiscussionTx{References: []tx.Reference{{Type: tx.ReferenceQuote, Index: 99}}}, ErrDiscussionNoexists},
+		"cite of nothing":          {tx.DiscussionTx{References: []tx.Reference{{Type: tx.ReferenceCite, Index: 3}}}, ErrTxProposalNoexists},
+		"unknown reference":        {tx.DiscussionTx{References: []tx.Reference{{Type: "link", Index: 1}}}, ErrReferenceInvalid},
+		"too many references":      {tx.DiscussionTx{References: tooMany}, ErrTooManyReferences},
+	} {
+		if _, err := s.Dicussion(&tc.tx, member, true); !errors.Is(err, tc.err) {
+			t.Errorf("%s: %v, want %v", name, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+)
+
+func TestRegisterParticipant(t *testing.T) {
+	s, _ := newTestState(t, config.GWeiPerPower(0))
+	pubkey := ed25519.GenPrivKey().PubKey().Bytes()
+	if _, err := s.RegisterParticipant(&tx.RegisterParticipantTx{PubKey: pubkey, Name: "alice"}, true); !errors.Is(err, ErrGovernanceNotUpgraded) {
+		t.Fatalf("registration before the upgrade: %v", err)
+	}
+
+	upgrade(s)
+	if _, err := s.RegisterParticipant(&tx.RegisterParticipantTx{PubKey: pubkey, Name: strings.Repeat("a", config.MaxParticipantNameLen+1)}, true); !errors.Is(err, ErrParticipantNameTooLong) {
+		t.Fatalf("long name: %v", err)
+	}
+	event, err := s.RegisterParticipant(&tx.RegisterParticipantTx{PubKey: pubkey, Name: "alice"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.GetAccount(event.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.IsParticipant() || a.Stake != 0 || a.Name != "alice" || !bytes.Equal(a.PubKey, pubkey) {
+		t.Fatalf("account %+v", a)
+	}
+	if _, err := s.RegisterParticipant(&tx.RegisterParticipantTx{PubKey: pubkey, Name: "again"}, true); !errors.Is(err, ErrAccountAlreadyExists) {
+		t.Fatalf("second registration: %v", err)
+	}
+}
+
+func TestParticipantPostLimit(t *testing.T) {
+	s, idxs := newTestState(t, config.GWeiPerPower(0))
+	upgrade(s)
+	event, err := s.RegisterParticipant(&tx.RegisterParticipantTx{PubKey: ed25519.GenPrivKey().PubKey().Bytes(), Name: "alice"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := event.Index
+	post := &tx.DiscussionTx{Data: []byte("hello")}
+
+	if _, err := s.Dicussion(&tx.DiscussionTx{Data: make([]byte, config.MaxParticipantPostSize+1)}, alice, true); !errors.Is(err, ErrParticipantPostTooLarge) {
+		t.Fatalf("large post: %v", err)
+	}
+	limit, window := config.ParticipantPostLimit()
+	start := s.header.Height
+	for i := uint64(0); i < limit; i++ {
+		// the window runs from the first post
+		s.header.Height = start + i
+		event, err := s.Dicussion(post, alice, false)
+		if err != nil {
+			t.Fatalf("post %d: %v", i, err)
+		}
+		if !event.Human {
+			t.Fatalf("post %d is not a participant post", i)
+		}
+	}
+	for _, checkOnly := range []bool{true, false} {
+		if _, err := s.Dicussion(post, alice, checkOnly); !errors.Is(err, ErrParticipantRateLimited) {
+			t.Fatalf("post beyond the limit, check only %v: %v", checkOnly, err)
+		}
+	}
+	s.header.Height = start + window - 1
+	if _, err := s.Dicussion(post, alice, true); !errors.Is(err, ErrParticipantRateLimited) {
+		t.Fatalf("post at the end of the window: %v", err)
+	}
+	s.header.Height = start + window
+	if _, err := s.Dicussion(post, alice, false); err != nil {
+		t.Fatalf("post in a new window: %v", err)
+	}
+	a, err := s.GetAccount(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.PostHeight != start+window || a.Posts != 1 {
+		t.Fatalf("window from %d with %d posts, want from %d with 1", a.PostHeight, a.Posts, start+window)
+	}
+
+	// members post without a limit
+	member := idxs[0]
+	for i := uint64(0); i <= limit; i++ {
+		event, err := s.Dicussion(post, member, false)
+		if err != nil {
+			t.Fatalf("member post %d: %v", i, err)
+		}
+		if event.Human {
+			t.Fatalf("member post %d is a participant post", i)
+		}
+	}
+
+	// below the upgrade a participant is not a member
+	s.header.Height = config.GovernanceUpgradeHeight - 1
+	if _, err := s.Dicussion(post, alice, true); !errors.Is(err, ErrTxNotMembership) {
+		t.Fatalf("participant post before the upgrade: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package state
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/calehh/hac-app/config"
+	"github.com/calehh/hac-app/tx"
+	hac_types "github.com/calehh/hac-app/types"
+)
+
+// commit saves the block of s and returns the state of the next one at height.
+func commit(t *testing.T, s *State, height uint64) *State {
+	t.Helper()
+	if _, err := s.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	n := s.nextState()
+	n.header.Height = height
+	return n
+}
+
+func TestReviseProposal(t *testing.T) {
+	stake := config.GWeiPerPower(0)
+	s, idxs := newTestState(t, stake, stake)
+	proposer, other := idxs[0], idxs[1]
+	upgraded := uint64(config.GovernanceUpgradeHeight)
+	upgrade(s)
+	event, err := s.Proposal(&tx.ProposalTx{Category: tx.ProposalCategoryText, Title: "v0"}, proposer, false, tx.VoteProcessProposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := event.ProposalIndex
+	s = commit(t, s, upgraded+5)
+
+	for name, tc := range map[string]struct {
+		tx        tx.ReviseProposalTx
+		validator uint64
+	}{
+		"revised by another member": {tx.ReviseProposalTx{Proposal: index, Title: "v1"}, other},
+		"empty title":               {tx.ReviseProposalTx{Proposal: index}, proposer},
+		"unknown proposal":          {tx.ReviseProposalTx{Proposal: index + 1, Title: "v1"}, proposer},
+		"invalid content hash":      {tx.ReviseProposalTx{Proposal: index, Title: "v1", ContentHash: "00"}, proposer},
+	} {
+		if _, err := s.ReviseProposal(&tc.tx, tc.validator, true); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+	revised, err := s.ReviseProposal(&tx.ReviseProposalTx{Proposal: index, Title: "v1", Data: []byte("new"), Note: "why"}, proposer, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revised.Revision != 1 || revised.Title != "v1" || revised.Note != "why" {
+		t.Fatalf("event %+v", revised)
+	}
+	if _, err := s.ReviseProposal(&tx.ReviseProposalTx{Proposal: index, Title: "v2"}, proposer, true); !errors.Is(err, ErrTxMoreThanOneProposal) {
+		t.Fatalf("second revision in a block: %v", err)
+	}
+	s = commit(t, s, upgraded+6)
+
+	// the revision restarts the discussion
+	proposal, err := s.getProposal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proposal.Revision != 1 || proposal.RevisionHeight != upgraded+5 || proposal.Title != "v1" || string(proposal.Data) != "new" {
+		t.Fatalf("proposal %+v", proposal)
+	}
+	s.header.Height = upgraded + 5 + config.MinRevisionDiscussionBlocks - 1
+	if err := s.checkLifecycle(proposal); !errors.Is(err, ErrSettleTooEarly) {
+		t.Fatalf("settle in the revision period: %v", err)
+	}
+	s.header.Height++
+	if err := s.checkLifecycle(proposal); err != nil {
+		t.Fatalf("settle after the revision period: %v", err)
+	}
+
+	// below the upgrade a revision does not restart it
+	s.header.Height = 20
+	if err := s.checkLifecycle(&hac_types.Proposal{Height: 10, RevisionHeight: 15}); err != nil {
+		t.Fatalf("settle of a revised proposal before the upgrade: %v", err)
+	}
+
+	s.header.Height = upgraded + 6
+	for i := proposal.Revision; i < config.MaxProposalRevisions; i++ {
+		if _, err := s.ReviseProposal(&tx.ReviseProposalTx{Proposal: index, Title: "again"}, proposer, false); err != nil {
+			t.Fatalf("revision %d: %v", i+1, err)
+		}
+		s = commit(t, s, s.header.Height+1)
+	}
+	if _, err := s.ReviseProposal(&tx.ReviseProposalTx{Proposal: index, Title: "again"}, proposer, true); !errors.Is(err, ErrTooManyRevisions) {
+		t.Fatalf("revision beyond the limit: %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package state
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +12,7 @@ import (
 
 	"container/heap"
 
+	"github.com/calehh/hac-app/blob"
 	"github.com/calehh/hac-app/config"
 	"github.com/calehh/hac-app/tx"
 	txtypes "github.com/calehh/hac-app/tx"
@@ -71,6 +74,20 @@ var (
 	ErrTxMoreThanOneProposal        = errors.New("more than one proposal")
 	ErrTxVoteCodeInvalid            = errors.New("vote code invalid")
 	ErrOneActionInOneBlock          = errors.New("one action in one block")
+	ErrSubmissionHashInvalid        = errors.New("submission hash invalid")
+	ErrSubmissionAuthorInvalid      = errors.New("submission author invalid")
+	ErrParticipantPostTooLarge      = errors.New("participant post too large")
+	ErrParticipantRateLimited       = errors.New("participant post rate limited")
+	ErrParticipantNameTooLong       = errors.New("participant name too long")
+	ErrDiscussionNoexists           = errors.New("discussion noexists")
+	ErrReplyProposalUnmatched       = errors.New("reply to a discussion of another proposal")
+	ErrDiscussionBeforeUpgrade      = errors.New("discussion posted before the governance upgrade")
+	ErrReferenceInvalid             = errors.New("reference invalid")
+	ErrTooManyReferences            = errors.New("too many references")
+	ErrProposalRevisionStale        = errors.New("proposal revision stale")
+	ErrTooManyRevisions             = errors.New("too many proposal revisions")
+	ErrContentHashInvalid           = errors.New("content hash invalid")
+	ErrGovernanceNotUpgraded        = errors.New("not allowed before the governance upgrade")
 )
 
 type State struct {
@@ -88,6 +105,8 @@ type State struct {
 	discussionMaxIndex uint64
 	modProposal        *hac_types.Proposal
 	newDiscussions     map[uint64]hac_types.Discussion
+	// keys written by executed proposals, flushed on update
+	writes map[string][]byte
 }
 
 func newState(db *iavl.MutableTree, logger cmtlog.Logger) *State {
@@ -104,6 +123,7 @@ func newState(db *iavl.MutableTree, logger cmtlog.Logger) *State {
 		discussionMaxIndex: 0,
 		modProposal:        nil,
 		newDiscussions:     map[uint64]hac_types.Discussion{},
+		writes:             map[string][]byte{},
 	}
 	s.header.AccountIdx = StartAccountIdx
 	return s
@@ -120,6 +140,7 @@ func (s *State) nextState() *State {
 		proposalMaxIndex:   s.proposalMaxIndex,
 		discussionMaxIndex: s.discussionMaxIndex,
 		newDiscussions:     make(map[uint64]hac_types.Discussion),
+		writes:             make(map[string][]byte),
 	}
 	n.header = proto.Clone(s.header).(*StateHeader)
 	if s.header.GetHash() != nil {
@@ -177,6 +198,7 @@ func (s *State) Clone() *State {
 		discussionMaxIndex: s.discussionMaxIndex,
 		modProposal:        s.modProposal,
 		newDiscussions:     deepCopyMap(s.newDiscussions),
+		writes:             deepCopyMap(s.writes),
 	}
 	n.header = proto.Clone(s.header).(*StateHeader)
 	if s.header.GetHash() != nil {
@@ -252,12 +274,35 @@ func (s *State) Update() (h common.Hash, err error) {
 		return
 	}
 
+	if err = s.countDiscussions(); err != nil {
+		return
+	}
+	if err = s.flushWrites(); err != nil {
+		return
+	}
+
 	if len(s.newDiscussions) != 0 {
 		_, err = s.db.Set([]byte(KeyDiscussionIndex), big.NewInt(int64(s.discussionMaxIndex)).Bytes())
 		if err != nil {
 			return
 		}
-		//todo: record discussion in state
+	}
+	if len(s.newDiscussions) != 0 && config.GovernanceUpgraded(s.header.Height) {
+		idxs := make([]uint64, 0, len(s.newDiscussions))
+		for idx := range s.newDiscussions {
+			idxs = append(idxs, idx)
+		}
+		sort.Slice(idxs, func(i, j int) bool {
+			return idxs[i] < idxs[j]
+		})
+		for _, idx := range idxs {
+			key := fmt.Sprintf(KeyDiscussionBody, idx)
+			disBz, _ := json.Marshal(s.newDiscussions[idx])
+			_, err = s.db.Set([]byte(key), disBz)
+			if err != nil {
+				return
+			}
+		}
 	}
 
 	if s.modProposal != nil {
@@ -363,6 +408,76 @@ func (s *State) getDiscussionByIndex(index uint64) (*hac_types.Discussion, error
 	return &dis, nil
 }
 
+// getDiscussion returns the discussion at idx, including the ones of the
+// current block. Discussions posted before config.GovernanceUpgradeHeight
+// exist without a body, nil is returned for them.
+func (s *State) getDiscussion(idx uint64) (*hac_types.Discussion, error) {
+	if idx == 0 || idx > s.discussionMaxIndex {
+		return nil, ErrDiscussionNoexists
+	}
+	if dis, ok := s.newDiscussions[idx]; ok {
+		return &dis, nil
+	}
+	val, err := s.db.Get([]byte(fmt.Sprintf(KeyDiscussionBody, idx)))
+	if err != nil || val == nil {
+		return nil, err
+	}
+	var dis hac_types.Discussion
+	if err := json.Unmarshal(val, &dis); err != nil {
+		return nil, err
+	}
+	return &dis, nil
+}
+
+// checkThread checks the discussion replied to and the references of tx. The
+// threads exist from the governance upgrade on, below it they are dropped.
+// Discussions posted before the upgrade have no body to check against, they
+// can not be replied to or quoted.
+func (s *State) checkThread(tx *tx.DiscussionTx) (replyTo uint64, refs []hac_types.Reference, err error) {
+	if !config.GovernanceUpgraded(s.header.Height) {
+		return 0, nil, nil
+	}
+	if tx.ReplyTo != 0 {
+		dis, err := s.getDiscussion(tx.ReplyTo)
+		if err != nil {
+			return 0, nil, err
+		}
+		if dis == nil {
+			return 0, nil, ErrDiscussionBeforeUpgrade
+		}
+		if dis.Proposal != tx.Proposal {
+			return 0, nil, ErrReplyProposalUnmatched
+		}
+	}
+	maxReferences, err := s.Param("max_discussion_references")
+	if err != nil {
+		return 0, nil, err
+	}
+	if uint64(len(tx.References)) > maxReferences {
+		return 0, nil, ErrTooManyReferences
+	}
+	for _, ref := range tx.References {
+		switch ref.Type {
+		case txtypes.ReferenceQuote:
+			dis, err := s.getDiscussion(ref.Index)
+			if err != nil {
+				return 0, nil, err
+			}
+			if dis == nil {
+				return 0, nil, ErrDiscussionBeforeUpgrade
+			}
+		case txtypes.ReferenceCite:
+			if ref.Index == 0 || ref.Index > s.getProposalMax() {
+				return 0, nil, ErrTxProposalNoexists
+			}
+		default:
+			return 0, nil, ErrReferenceInvalid
+		}
+		refs = append(refs, hac_types.Reference{Type: ref.Type, Index: ref.Index})
+	}
+	return tx.ReplyTo, refs, nil
+}
+
 func (s *State) getProposal(idx uint64) (proposal *hac_types.Proposal, err error) {
 	if idx > s.proposalMaxIndex {
 		err = ErrProposaNoexists
@@ -382,6 +497,11 @@ func (s *State) getProposal(idx uint64) (proposal *hac_types.Proposal, err error
 	return
 }
 
+// GetProposal returns the latest revision of a proposal.
+func (s *State) GetProposal(idx uint64) (*hac_types.Proposal, error) {
+	return s.getProposal(idx)
+}
+
 func (s *State) GetAccount(idx uint64) (acnt *Account, err error) {
 	if idx >= s.header.AccountIdx {
 		err = ErrAccountNoexists
@@ -468,7 +588,7 @@ func (s *State) SetManifest(manifest string) error {
 }
 
 func (s *State) GetManifest() (manifest string, err error) {
-	val, err := s.db.Get([]byte(KeyManifest))
+	val, err := s.get(KeyManifest)
 	if err != nil {
 		if err != leveldb.ErrNotFound {
 			return "", err
@@ -524,6 +644,9 @@ func (s *State) AddAccount(acnt *Account) (err error) {
 }
 
 func (s *State) Verify(tx *tx.HACTx, allowNonceGap bool) (succ bool, err error) {
+	if tx.Type == txtypes.HACTxTypeRegisterParticipant {
+		return s.verifyRegistration(tx)
+	}
 	a, err := s.GetAccount(tx.Validator)
 	if err != nil {
 		return succ, err
@@ -547,6 +670,26 @@ func (s *State) Verify(tx *tx.HACTx, allowNonceGap bool) (succ bool, err error)
 	return
 }
 
+// verifyRegistration checks a participant registration, which is signed by
+// the key it registers as the account does not exist yet.
+func (s *State) verifyRegistration(btx *tx.HACTx) (succ bool, err error) {
+	rtx, ok := btx.Tx.(*txtypes.RegisterParticipantTx)
+	if !ok || len(rtx.PubKey) != ed25519.PubKeySize {
+		return false, txtypes.ErrInvalidTx
+	}
+	if btx.Validator != 0 || btx.Nonce != 0 {
+		return false, ErrTxNonceInvalid
+	}
+	dat, err := btx.SigData([]byte(s.header.ChainId))
+	if err != nil {
+		return false, err
+	}
+	if len(btx.Sig) != 1 || !ed25519.PubKey(rtx.PubKey).VerifySignature(dat, btx.Sig[0]) {
+		return false, ErrTxSigInvalid
+	}
+	return true, nil
+}
+
 func (s *State) Proposal(tx *tx.ProposalTx, validator uint64, checkOnly bool, code tx.VoteCode) (event *hac_types.EventProposal, err error) {
 	if code != txtypes.VoteIgnoreProposal && code != txtypes.VoteProcessProposal {
 		return nil, ErrTxVoteCodeInvalid
@@ -572,6 +715,23 @@ func (s *State) Proposal(tx *tx.ProposalTx, validator uint64, checkOnly bool, co
 		err = errors.New("proposal title is empty")
 		return
 	}
+	// categories and actions exist from the governance upgrade on
+	if (tx.Category != "" || len(tx.Actions) != 0) && !config.GovernanceUpgraded(s.header.Height) {
+		err = ErrGovernanceNotUpgraded
+		return
+	}
+	if err = checkSubmission(tx); err != nil {
+		return
+	}
+	if err = checkContentHash(tx.ContentHash); err != nil {
+		return
+	}
+	if err = s.checkCategory(tx.Category, tx.Data, tx.ContentHash); err != nil {
+		return
+	}
+	if err = s.checkActions(tx.Actions); err != nil {
+		return
+	}
 	if !checkOnly {
 		s.proposalMaxIndex += 1
 		proposal := hac_types.Proposal{
@@ -584,6 +744,11 @@ func (s *State) Proposal(tx *tx.ProposalTx, validator uint64, checkOnly bool, co
 			ImageUrl:        tx.ImageUrl,
 			Title:           tx.Title,
 			Link:            tx.Link,
+			Author:          tx.Author,
+			SubmissionHash:  tx.SubmissionHash,
+			ContentHash:     tx.ContentHash,
+			Category:        tx.Category,
+			Actions:         tx.Actions,
 		}
 		if code == txtypes.VoteIgnoreProposal {
 			proposal.Status = hac_types.ProposalStatusIgnore
@@ -608,14 +773,52 @@ func (s *State) Proposal(tx *tx.ProposalTx, validator uint64, checkOnly bool, co
 			Title:           proposal.Title,
 			Link:            proposal.Link,
 			ImageUrl:        proposal.ImageUrl,
+			Author:          proposal.Author,
+			SubmissionHash:  proposal.SubmissionHash,
+			ContentHash:     proposal.ContentHash,
+			Category:        proposal.Category,
+			Actions:         proposal.Actions,
 		}
 	}
 	return
 }
 
-func (s *State) SettleProposal(tx *tx.SettleProposalTx, validator uint64, checkOnly bool, code tx.VoteCode) (event *hac_types.EventSettleProposal, err error) {
+// checkSubmission validates the community submission a sponsored proposal
+// records. The author is optional, a submission hash is required with it.
+func checkSubmission(tx *tx.ProposalTx) error {
+	if tx.SubmissionHash == "" {
+		if tx.Author != "" {
+			return ErrSubmissionHashInvalid
+		}
+		return nil
+	}
+	if b, err := hex.DecodeString(tx.SubmissionHash); err != nil || len(b) != sha256.Size {
+		return ErrSubmissionHashInvalid
+	}
+	if tx.Author != "" && !common.IsHexAddress(tx.Author) {
+		return ErrSubmissionAuthorInvalid
+	}
+	return nil
+}
+
+// checkContentHash validates the hash of a payload kept in the blob store,
+// the payload itself is never part of the state.
+func checkContentHash(hash string) error {
+	if hash == "" {
+		return nil
+	}
+	if !blob.ValidHash(hash) {
+		return ErrContentHashInvalid
+	}
+	return nil
+}
+
+// SettleProposal decides a processing proposal once the lifecycle of its
+// category allows it. An accepted proposal is executed, executed holds the
+// events of its effects.
+func (s *State) SettleProposal(tx *tx.SettleProposalTx, validator uint64, checkOnly bool, code tx.VoteCode) (event *hac_types.EventSettleProposal, executed []abci_types.Event, err error) {
 	if code != txtypes.VoteAcceptProposal && code != txtypes.VoteRejectProposal {
-		return nil, ErrTxVoteCodeInvalid
+		return nil, nil, ErrTxVoteCodeInvalid
 	}
 	s.logger.Debug("apply settle proposal", "validator", validator, "height", s.header.Height)
 	if s.modProposal != nil && s.modProposal.Index != 0 {
@@ -624,7 +827,7 @@ func (s *State) SettleProposal(tx *tx.SettleProposalTx, validator uint64, checkO
 	}
 	a, err := s.GetAccount(validator)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if a == nil {
 		err = ErrTxValidatorNoexists
@@ -632,13 +835,19 @@ func (s *State) SettleProposal(tx *tx.SettleProposalTx, validator uint64, checkO
 	}
 	proposal, err := s.getProposal(tx.Proposal)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if proposal.Proposer != validator {
-		return nil, fmt.Errorf("proposal not settle by proposer")
+		return nil, nil, fmt.Errorf("proposal not settle by proposer")
 	}
 	if proposal.Status != hac_types.ProposalStatusProcessing {
-		return nil, fmt.Errorf("proposal not processing status is %v", proposal.Status)
+		return nil, nil, fmt.Errorf("proposal not processing status is %v", proposal.Status)
+	}
+	if tx.Revision != proposal.Revision {
+		return nil, nil, ErrProposalRevisionStale
+	}
+	if err = s.checkLifecycle(proposal); err != nil {
+		return
 	}
 	if !checkOnly {
 		if code == txtypes.VoteAcceptProposal {
@@ -654,10 +863,104 @@ func (s *State) SettleProposal(tx *tx.SettleProposalTx, validator uint64, checkO
 		s.modifiedAcnts[a.Index] = v
 		s.acnts[a.Index] = a.Clone()
 
+		// executed after the proposer is updated, it may be the member removed
+		if code == txtypes.VoteAcceptProposal {
+			executed, err = s.executeProposal(proposal)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		event = &hac_types.EventSettleProposal{
 			Proposer: proposal.Proposer,
 			Proposal: tx.Proposal,
 			State:    int64(proposal.Status),
+			Revision: proposal.Revision,
+		}
+	}
+	return
+}
+
+// ReviseProposal replaces the content of a processing proposal by its
+// proposer. Only the latest revision is kept in state.
+func (s *State) ReviseProposal(tx *tx.ReviseProposalTx, validator uint64, checkOnly bool) (event *hac_types.EventReviseProposal, err error) {
+	s.logger.Debug("apply revise proposal", "validator", validator, "height", s.header.Height)
+	if s.modProposal != nil && s.modProposal.Index != 0 {
+		err = ErrTxMoreThanOneProposal
+		return
+	}
+	a, err := s.GetAccount(validator)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		err = ErrTxValidatorNoexists
+		return
+	}
+	proposal, err := s.getProposal(tx.Proposal)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Proposer != validator {
+		return nil, fmt.Errorf("proposal not revised by proposer")
+	}
+	if proposal.Status != hac_types.ProposalStatusProcessing {
+		return nil, fmt.Errorf("proposal not processing status is %v", proposal.Status)
+	}
+	maxRevisions, err := s.Param("max_proposal_revisions")
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Revision >= maxRevisions {
+		err = ErrTooManyRevisions
+		return
+	}
+	if tx.Title == "" {
+		err = errors.New("proposal title is empty")
+		return
+	}
+	if len(tx.Actions) != 0 && !config.GovernanceUpgraded(s.header.Height) {
+		err = ErrGovernanceNotUpgraded
+		return
+	}
+	if err = checkContentHash(tx.ContentHash); err != nil {
+		return
+	}
+	if err = s.checkCategory(proposal.Category, tx.Data, tx.ContentHash); err != nil {
+		return
+	}
+	if err = s.checkActions(tx.Actions); err != nil {
+		return
+	}
+	if !checkOnly {
+		proposal.Revision += 1
+		proposal.RevisionHeight = s.header.Height
+		proposal.ImageUrl = tx.ImageUrl
+		proposal.Title = tx.Title
+		proposal.Link = tx.Link
+		proposal.Data = tx.Data
+		proposal.ContentHash = tx.ContentHash
+		proposal.Actions = tx.Actions
+		s.modProposal = proposal
+
+		a.Nonce += 1
+		v := s.modifiedAcnts[a.Index]
+		v |= ModifiedFlagMod
+		s.modifiedAcnts[a.Index] = v
+		s.acnts[a.Index] = a.Clone()
+
+		event = &hac_types.EventReviseProposal{
+			Proposal:        proposal.Index,
+			Revision:        proposal.Revision,
+			Proposer:        a.Index,
+			ProposerAddress: a.Address(),
+			ImageUrl:        proposal.ImageUrl,
+			Title:           proposal.Title,
+			Link:            proposal.Link,
+			Data:            proposal.Data,
+			Note:            tx.Note,
+			ContentHash:     proposal.ContentHash,
+			Actions:         proposal.Actions,
 		}
 	}
 	return
@@ -673,7 +976,9 @@ func (s *State) Dicussion(tx *tx.DiscussionTx, validator uint64, checkOnly bool)
 		err = ErrTxValidatorNoexists
 		return
 	}
-	if a.Stake == 0 {
+	// participants exist from the governance upgrade on
+	human := a.IsParticipant() && config.GovernanceUpgraded(s.header.Height)
+	if a.Stake == 0 && !human {
 		err = ErrTxNotMembership
 		return
 	}
@@ -681,6 +986,24 @@ func (s *State) Dicussion(tx *tx.DiscussionTx, validator uint64, checkOnly bool)
 		err = ErrTxProposalNoexists
 		return
 	}
+	replyTo, refs, err := s.checkThread(tx)
+	if err != nil {
+		return nil, err
+	}
+	// participants post at a limited rate, in windows starting at their first
+	// post after the previous window ended
+	limit, window := config.ParticipantPostLimit()
+	newWindow := a.PostHeight == 0 || s.header.Height >= a.PostHeight+window
+	if human {
+		if len(tx.Data) > config.MaxParticipantPostSize {
+			err = ErrParticipantPostTooLarge
+			return
+		}
+		if !newWindow && a.Posts >= limit {
+			err = ErrParticipantRateLimited
+			return
+		}
+	}
 
 	if !checkOnly {
 		s.discussionMaxIndex += 1
@@ -691,9 +1014,19 @@ func (s *State) Dicussion(tx *tx.DiscussionTx, validator uint64, checkOnly bool)
 			SpeakerAddress: a.Address(),
 			Data:           tx.Data,
 			Height:         s.header.Height,
+			Human:          human,
+			ReplyTo:        replyTo,
+			References:     refs,
 		}
 		s.newDiscussions[s.discussionMaxIndex] = dis
 
+		if human {
+			if newWindow {
+				a.PostHeight = s.header.Height
+				a.Posts = 0
+			}
+			a.Posts += 1
+		}
 		a.Nonce += 1
 		v := s.modifiedAcnts[a.Index]
 		v |= ModifiedFlagMod
@@ -701,10 +1034,52 @@ func (s *State) Dicussion(tx *tx.DiscussionTx, validator uint64, checkOnly bool)
 		s.acnts[a.Index] = a.Clone()
 
 		event = &hac_types.EventDiscussion{
+			Index:          dis.Index,
 			Speaker:        a.Index,
 			SpeakerAddress: a.Address(),
 			Proposal:       tx.Proposal,
 			Data:           dis.Data,
+			Human:          human,
+			ReplyTo:        replyTo,
+			References:     refs,
+		}
+	}
+	return
+}
+
+// RegisterParticipant creates the account of a participant, without stake
+// and without voting power, from the governance upgrade on.
+func (s *State) RegisterParticipant(tx *tx.RegisterParticipantTx, checkOnly bool) (event *hac_types.EventRegisterParticipant, err error) {
+	s.logger.Debug("apply register participant", "height", s.header.Height)
+	if !config.GovernanceUpgraded(s.header.Height) {
+		err = ErrGovernanceNotUpgraded
+		return
+	}
+	if len(tx.Name) > config.MaxParticipantNameLen {
+		err = ErrParticipantNameTooLong
+		return
+	}
+	exist, err := s.existPubkey(tx.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		err = ErrAccountAlreadyExists
+		return
+	}
+	if !checkOnly {
+		a := &Account{
+			PubKey: tx.PubKey,
+			Name:   tx.Name,
+			Kind:   AccountKindParticipant,
+		}
+		if err = s.AddAccount(a); err != nil {
+			return nil, err
+		}
+		event = &hac_types.EventRegisterParticipant{
+			Index:   a.Index,
+			Address: a.Address(),
+			Name:    a.Name,
 		}
 	}
 	return
@@ -0,0 +1,171 @@
+package tx
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Proposal action types. The actions of an accepted proposal are executed in
+// order after the payload of its category, either all of them apply or none.
+const (
+	// Data is the new manifest as a JSON string
+	ProposalActionUpdateManifest = "update_manifest"
+	// Data is a ParameterChange
+	ProposalActionSetParam = "set_param"
+	// Data is a MembershipGrant
+	ProposalActionGrantMembership = "grant_membership"
+	// Data is a MembershipChange, its action defaults to remove
+	ProposalActionRevokeMembership = "revoke_membership"
+	// Data is a TreasurySpend
+	ProposalActionTreasurySpend = "treasury_spend"
+	// Data is a SoftwareUpgrade, recorded as the upgrade plan only
+	ProposalActionScheduleUpgrade = "schedule_upgrade"
+	// Data is a WebhookCall, the nodes deliver it through their outbox
+	ProposalActionWebhook = "webhook"
+)
+
+const MaxProposalActions = 16
+
+var (
+	ErrProposalActionUnknown  = errors.New("proposal action unknown")
+	ErrProposalActionInvalid  = errors.New("proposal action invalid")
+	ErrTooManyProposalActions = errors.New("too many proposal actions")
+)
+
+type ProposalAction struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MembershipGrant admits a new member, or restores the stake of a former one.
+type MembershipGrant struct {
+	// hex ed25519 public key of the member
+	PubKey   string `json:"pubkey"`
+	Stake    uint64 `json:"stake"`
+	AgentUrl string `json:"agentUrl"`
+	Name     string `json:"name"`
+}
+
+// WebhookCall is posted as JSON to Url once the proposal is executed.
+type WebhookCall struct {
+	Url     string          `json:"url"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// DecodeProposalActions checks the actions of a proposal against the schema
+// of their types and returns the decoded payloads in order, see
+// DecodeProposalAction.
+func DecodeProposalActions(actions []ProposalAction) ([]any, error) {
+	if len(actions) > MaxProposalActions {
+		return nil, ErrTooManyProposalActions
+	}
+	payloads := make([]any, 0, len(actions))
+	for i, action := range actions {
+		payload, err := DecodeProposalAction(action)
+		if err != nil {
+			return nil, fmt.Errorf("action %d: %w", i, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
+
+// DecodeProposalAction returns the payload of an action: the manifest string
+// for update_manifest, a *ParameterChange, *MembershipGrant,
+// *MembershipChange, *TreasurySpend, *SoftwareUpgrade or *WebhookCall
+// otherwise. Checks that need the state are left to the state.
+func DecodeProposalAction(action ProposalAction) (any, error) {
+	switch action.Type {
+	case ProposalActionUpdateManifest:
+		var manifest string
+		if err := decodeStrict(action.Data, &manifest); err != nil {
+			return nil, err
+		}
+		return DecodeProposalData(ProposalCategoryManifest, []byte(manifest))
+	case ProposalActionSetParam:
+		return DecodeProposalData(ProposalCategoryParameter, action.Data)
+	case ProposalActionGrantMembership:
+		var g MembershipGrant
+		if err := decodeStrict(action.Data, &g); err != nil {
+			return nil, err
+		}
+		if pk, err := hex.DecodeString(g.PubKey); err != nil || len(pk) != 32 {
+			return nil, fmt.Errorf("%w: membership grant needs an ed25519 public key", ErrProposalActionInvalid)
+		}
+		if g.Stake == 0 {
+			return nil, fmt.Errorf("%w: membership grant needs a stake", ErrProposalActionInvalid)
+		}
+		return &g, nil
+	case ProposalActionRevokeMembership:
+		var m MembershipChange
+		if err := decodeStrict(action.Data, &m); err != nil {
+			return nil, err
+		}
+		if m.Action == "" {
+			m.Action = MembershipActionRemove
+		}
+		if m.Action != MembershipActionRemove {
+			return nil, fmt.Errorf("%w: membership action %q", ErrProposalActionInvalid, m.Action)
+		}
+		return &m, nil
+	case ProposalActionTreasurySpend:
+		return DecodeProposalData(ProposalCategoryTreasury, action.Data)
+	case ProposalActionScheduleUpgrade:
+		return DecodeProposalData(ProposalCategoryUpgrade, action.Data)
+	case ProposalActionWebhook:
+		var w WebhookCall
+		if err := decodeStrict(action.Data, &w); err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(w.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: webhook needs an http url", ErrProposalActionInvalid)
+		}
+		if len(w.Payload) != 0 && !json.Valid(w.Payload) {
+			return nil, fmt.Errorf("%w: webhook payload is not json", ErrProposalActionInvalid)
+		}
+		return &w, nil
+	}
+	return nil, ErrProposalActionUnknown
+}
+
+// CategoryAction returns the action executing the data of a proposal of the
+// category, false for text proposals which execute nothing.
+func CategoryAction(category string, data []byte) (ProposalAction, bool) {
+	var typ string
+	switch NormalizeCategory(category) {
+	case ProposalCategoryManifest:
+		// the manifest is kept as a JSON string like in update_manifest
+		data, _ = json.Marshal(string(data))
+		typ = ProposalActionUpdateManifest
+	case ProposalCategoryParameter:
+		typ = ProposalActionSetParam
+	case ProposalCategoryMembership:
+		typ = ProposalActionRevokeMembership
+	case ProposalCategoryTreasury:
+		typ = ProposalActionTreasurySpend
+	case ProposalCategoryUpgrade:
+		typ = ProposalActionScheduleUpgrade
+	default:
+		return ProposalAction{}, false
+	}
+	return ProposalAction{Type: typ, Data: data}, true
+}
+
+// FormatProposalActions describes the actions of a proposal for the agents
+// voting on it, one per line, empty if there are none.
+func FormatProposalActions(actions []ProposalAction) string {
+	if len(actions) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, len(actions)+1)
+	lines = append(lines, "Actions executed if accepted:")
+	for i, action := range actions {
+		lines = append(lines, fmt.Sprintf("%d. %s %s", i+1, action.Type, action.Data))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,147 @@
+package tx
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPubKey = "3b6a27bcceb6a42d62a3a8d02a6f0d73653215771de243a63ac048a18b59da29"
+
+func TestDecodeProposalAction(t *testing.T) {
+	cases := []struct {
+		name   string
+		action ProposalAction
+		want   any
+		err    error
+	}{
+		{
+			name:   "manifest is a json string",
+			action: ProposalAction{Type: ProposalActionUpdateManifest, Data: json.RawMessage(`"be kind"`)},
+			want:   "be kind",
+		},
+		{
+			name:   "manifest not a string",
+			action: ProposalAction{Type: ProposalActionUpdateManifest, Data: json.RawMessage(`{"text":"be kind"}`)},
+			err:    ErrProposalDataInvalid,
+		},
+		{
+			name:   "set param",
+			action: ProposalAction{Type: ProposalActionSetParam, Data: json.RawMessage(`{"name":"max_discussion_references","value":2}`)},
+			want:   &ParameterChange{Name: "max_discussion_references", Value: 2},
+		},
+		{
+			name:   "grant membership",
+			action: ProposalAction{Type: ProposalActionGrantMembership, Data: json.RawMessage(`{"pubkey":"` + testPubKey + `","stake":1,"name":"bob"}`)},
+			want:   &MembershipGrant{PubKey: testPubKey, Stake: 1, Name: "bob"},
+		},
+		{
+			name:   "grant membership short key",
+			action: ProposalAction{Type: ProposalActionGrantMembership, Data: json.RawMessage(`{"pubkey":"3b6a","stake":1}`)},
+			err:    ErrProposalActionInvalid,
+		},
+		{
+			name:   "grant membership without stake",
+			action: ProposalAction{Type: ProposalActionGrantMembership, Data: json.RawMessage(`{"pubkey":"` + testPubKey + `"}`)},
+			err:    ErrProposalActionInvalid,
+		},
+		{
+			name:   "revoke defaults to remove",
+			action: ProposalAction{Type: ProposalActionRevokeMembership, Data: json.RawMessage(`{"validator":65538}`)},
+			want:   &MembershipChange{Action: MembershipActionRemove, Validator: 65538},
+		},
+		{
+			name:   "revoke other action",
+			action: ProposalAction{Type: ProposalActionRevokeMembership, Data: json.RawMessage(`{"action":"add","validator":65538}`)},
+			err:    ErrProposalActionInvalid,
+		},
+		{
+			name:   "schedule upgrade",
+			action: ProposalAction{Type: ProposalActionScheduleUpgrade, Data: json.RawMessage(`{"name":"v2","height":1000}`)},
+			want:   &SoftwareUpgrade{Name: "v2", Height: 1000},
+		},
+		{
+			name:   "webhook",
+			action: ProposalAction{Type: ProposalActionWebhook, Data: json.RawMessage(`{"url":"https://example.com/hook","payload":{"ok":true}}`)},
+			want:   &WebhookCall{Url: "https://example.com/hook", Payload: json.RawMessage(`{"ok":true}`)},
+		},
+		{
+			name:   "webhook not http",
+			action: ProposalAction{Type: ProposalActionWebhook, Data: json.RawMessage(`{"url":"file:///etc/passwd"}`)},
+			err:    ErrProposalActionInvalid,
+		},
+		{
+			name:   "unknown type",
+			action: ProposalAction{Type: "mint", Data: json.RawMessage(`{}`)},
+			err:    ErrProposalActionUnknown,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := DecodeProposalAction(c.action)
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("error %v, want %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("payload %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDecodeProposalActions(t *testing.T) {
+	actions := []ProposalAction{
+		{Type: ProposalActionSetParam, Data: json.RawMessage(`{"name":"max_proposal_revisions","value":4}`)},
+		{Type: ProposalActionRevokeMembership, Data: json.RawMessage(`{"validator":65538}`)},
+	}
+	payloads, err := DecodeProposalActions(actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("%d payloads, want 2", len(payloads))
+	}
+	if _, ok := payloads[1].(*MembershipChange); !ok {
+		t.Fatalf("payload 1 is %T", payloads[1])
+	}
+
+	actions = append(actions, ProposalAction{Type: "mint"})
+	_, err = DecodeProposalActions(actions)
+	if !errors.Is(err, ErrProposalActionUnknown) || !strings.HasPrefix(err.Error(), "action 2:") {
+		t.Fatalf("error %v, want the index of the unknown action", err)
+	}
+
+	many := make([]ProposalAction, MaxProposalActions+1)
+	for i := range many {
+		many[i] = actions[0]
+	}
+	if _, err := DecodeProposalActions(many); !errors.Is(err, ErrTooManyProposalActions) {
+		t.Fatalf("error %v, want %v", err, ErrTooManyProposalActions)
+	}
+}
+
+func TestCategoryAction(t *testing.T) {
+	if _, ok := CategoryAction("", []byte("hello")); ok {
+		t.Fatal("text proposals execute nothing")
+	}
+	// the manifest of a category proposal decodes like update_manifest
+	action, ok := CategoryAction(ProposalCategoryManifest, []byte(`say "hi"`))
+	if !ok || action.Type != ProposalActionUpdateManifest {
+		t.Fatalf("action %+v", action)
+	}
+	got, err := DecodeProposalAction(action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != `say "hi"` {
+		t.Fatalf("manifest %q", got)
+	}
+}
@@ -0,0 +1,144 @@
+package tx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Proposal categories. A proposal without a category is a text proposal.
+const (
+	// a statement or signal without effect on the chain
+	ProposalCategoryText = "text"
+	// replaces the manifest of the council with Data
+	ProposalCategoryManifest = "manifest"
+	// changes a governable parameter, Data is a ParameterChange
+	ProposalCategoryParameter = "parameter"
+	// removes a member from the council, Data is a MembershipChange
+	ProposalCategoryMembership = "membership"
+	// authorizes a payment from the treasury, Data is a TreasurySpend
+	ProposalCategoryTreasury = "treasury"
+	// records a software upgrade plan for the operators, the chain does not
+	// halt at its height, Data is a SoftwareUpgrade
+	ProposalCategoryUpgrade = "upgrade"
+)
+
+var ProposalCategories = []string{
+	ProposalCategoryText,
+	ProposalCategoryManifest,
+	ProposalCategoryParameter,
+	ProposalCategoryMembership,
+	ProposalCategoryTreasury,
+	ProposalCategoryUpgrade,
+}
+
+var (
+	ErrProposalCategoryUnknown = errors.New("proposal category unknown")
+	ErrProposalDataInvalid     = errors.New("proposal data invalid")
+)
+
+const (
+	MembershipActionRemove = "remove"
+)
+
+type ParameterChange struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+type MembershipChange struct {
+	Action string `json:"action"`
+	// account index of the member
+	Validator uint64 `json:"validator"`
+	Reason    string `json:"reason"`
+}
+
+// TreasurySpend is an authorized payment, the chain records it and the
+// treasury keepers pay it out.
+type TreasurySpend struct {
+	Recipient string `json:"recipient"`
+	Amount    uint64 `json:"amount"`
+	Purpose   string `json:"purpose"`
+}
+
+type SoftwareUpgrade struct {
+	Name string `json:"name"`
+	// height from which the nodes must run the new software
+	Height uint64 `json:"height"`
+	Info   string `json:"info"`
+}
+
+// NormalizeCategory maps the empty category of older proposals to text.
+func NormalizeCategory(category string) string {
+	if category == "" {
+		return ProposalCategoryText
+	}
+	return category
+}
+
+// DecodeProposalData checks data against the schema of the category and
+// returns the decoded payload: the text for text and manifest proposals, a
+// *ParameterChange, *MembershipChange, *TreasurySpend or *SoftwareUpgrade
+// otherwise. Checks that need the state are left to the state.
+func DecodeProposalData(category string, data []byte) (any, error) {
+	switch NormalizeCategory(category) {
+	case ProposalCategoryText:
+		return string(data), nil
+	case ProposalCategoryManifest:
+		if len(bytes.TrimSpace(data)) == 0 || !utf8.Valid(data) {
+			return nil, fmt.Errorf("%w: manifest must be non-empty text", ErrProposalDataInvalid)
+		}
+		return string(data), nil
+	case ProposalCategoryParameter:
+		var p ParameterChange
+		if err := decodeStrict(data, &p); err != nil {
+			return nil, err
+		}
+		if p.Name == "" {
+			return nil, fmt.Errorf("%w: parameter name is empty", ErrProposalDataInvalid)
+		}
+		return &p, nil
+	case ProposalCategoryMembership:
+		var m MembershipChange
+		if err := decodeStrict(data, &m); err != nil {
+			return nil, err
+		}
+		if m.Action != MembershipActionRemove {
+			return nil, fmt.Errorf("%w: membership action %q", ErrProposalDataInvalid, m.Action)
+		}
+		return &m, nil
+	case ProposalCategoryTreasury:
+		var t TreasurySpend
+		if err := decodeStrict(data, &t); err != nil {
+			return nil, err
+		}
+		if t.Recipient == "" || t.Amount == 0 {
+			return nil, fmt.Errorf("%w: treasury spend needs a recipient and an amount", ErrProposalDataInvalid)
+		}
+		return &t, nil
+	case ProposalCategoryUpgrade:
+		var u SoftwareUpgrade
+		if err := decodeStrict(data, &u); err != nil {
+			return nil, err
+		}
+		if u.Name == "" || u.Height == 0 {
+			return nil, fmt.Errorf("%w: upgrade needs a name and a height", ErrProposalDataInvalid)
+		}
+		return &u, nil
+	}
+	return nil, ErrProposalCategoryUnknown
+}
+
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrProposalDataInvalid, err)
+	}
+	if dec.More() {
+		return fmt.Errorf("%w: trailing data", ErrProposalDataInvalid)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package tx
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeProposalData(t *testing.T) {
+	cases := []struct {
+		name     string
+		category string
+		data     string
+		want     any
+		err      error
+	}{
+		{name: "empty category is text", category: "", data: "hello", want: "hello"},
+		{name: "text keeps any data", category: ProposalCategoryText, data: "{not json", want: "{not json"},
+		{name: "manifest", category: ProposalCategoryManifest, data: "be kind", want: "be kind"},
+		{name: "empty manifest", category: ProposalCategoryManifest, data: " \n", err: ErrProposalDataInvalid},
+		{name: "manifest not utf8", category: ProposalCategoryManifest, data: "\xff\xfe", err: ErrProposalDataInvalid},
+		{
+			name:     "parameter",
+			category: ProposalCategoryParameter,
+			data:     `{"name":"max_proposal_revisions","value":4}`,
+			want:     &ParameterChange{Name: "max_proposal_revisions", Value: 4},
+		},
+		{name: "parameter without name", category: ProposalCategoryParameter, data: `{"value":4}`, err: ErrProposalDataInvalid},
+		{name: "parameter unknown field", category: ProposalCategoryParameter, data: `{"name":"a","value":4,"extra":1}`, err: ErrProposalDataInvalid},
+		{name: "parameter trailing data", category: ProposalCategoryParameter, data: `{"name":"a","value":4}{}`, err: ErrProposalDataInvalid},
+		{
+			name:     "membership",
+			category: ProposalCategoryMembership,
+			data:     `{"action":"remove","validator":65538,"reason":"idle"}`,
+			want:     &MembershipChange{Action: MembershipActionRemove, Validator: 65538, Reason: "idle"},
+		},
+		{name: "membership needs remove", category: ProposalCategoryMembership, data: `{"validator":65538}`, err: ErrProposalDataInvalid},
+		{
+			name:     "treasury",
+			category: ProposalCategoryTreasury,
+			data:     `{"recipient":"0x0000000000000000000000000000000000000001","amount":10,"purpose":"audit"}`,
+			want:     &TreasurySpend{Recipient: "0x0000000000000000000000000000000000000001", Amount: 10, Purpose: "audit"},
+		},
+		{name: "treasury without amount", category: ProposalCategoryTreasury, data: `{"recipient":"0x01"}`, err: ErrProposalDataInvalid},
+		{
+			name:     "upgrade",
+			category: ProposalCategoryUpgrade,
+			data:     `{"name":"v2","height":1000}`,
+			want:     &SoftwareUpgrade{Name: "v2", Height: 1000},
+		},
+		{name: "upgrade without height", category: ProposalCategoryUpgrade, data: `{"name":"v2"}`, err: ErrProposalDataInvalid},
+		{name: "unknown category", category: "lottery", data: "{}", err: ErrProposalCategoryUnknown},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := DecodeProposalData(c.category, []byte(c.data))
+			if c.err != nil {
+				if !errors.Is(err, c.err) {
+					t.Fatalf("error %v, want %v", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("payload %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/calehh/hac-app/state"
+	"github.com/calehh/hac-app/tx"
+	"github.com/calehh/hac-app/types"
+	abcitypes "github.com/cometbft/cometbft/abci/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+var ErrTooManyRegistrations = errors.New("too many participant registrations in one block")
+
+type RegisterParticipantTxHandler struct {
+	logger cmtlog.Logger
+
+	registered uint64
+}
+
+func NewRegisterParticipantTxHandler(logger cmtlog.Logger) (h *RegisterParticipantTxHandler) {
+	logger = logger.With("module", "participantTx")
+	h = &RegisterParticipantTxHandler{
+		logger: logger,
+	}
+	return
+}
+
+func (h *RegisterParticipantTxHandler) Check(ctx context.Context, st *state.State, btx *tx.HACTx) (res *abcitypes.ResponseCheckTx, err error) {
+	res = &abcitypes.ResponseCheckTx{Code: 0}
+	rtx := btx.Tx.(*tx.RegisterParticipantTx)
+	_, err1 := st.RegisterParticipant(rtx, true)
+	if err1 != nil {
+		h.logger.Info("CheckTx register participant fail", "err", err1)
+		res.Code = 1
+		res.Log = err1.Error()
+	}
+	return
+}
+
+func (h *RegisterParticipantTxHandler) NewContext(ctx context.Context) {
+	h.registered = 0
+}
+
+func (h *RegisterParticipantTxHandler) handle(ctx context.Context, st *state.State, btx *tx.HACTx) (res *abcitypes.ExecTxResult, err error) {
+	maxRegistrations, err := st.Param("max_registrations_per_block")
+	if err != nil {
+		return nil, err
+	}
+	if h.registered >= maxRegistrations {
+		return nil, ErrTooManyRegistrations
+	}
+	rtx := btx.Tx.(*tx.RegisterParticipantTx)
+	event, err := st.RegisterParticipant(rtx, false)
+	if err != nil {
+		return nil, err
+	}
+	h.registered++
+	res = &abcitypes.ExecTxResult{}
+	if event != nil {
+		res.Events = []abcitypes.Event{types.EncodeEventRegisterParticipant(event)}
+	}
+	return
+}
+
+func (h *RegisterParticipantTxHandler) Prepare(ctx context.Context, st *state.State, btx *tx.HACTx, code tx.VoteCode) (res *abcitypes.ExecTxResult, err error) {
+	return h.handle(ctx, st, btx)
+}
+
+func (h *RegisterParticipantTxHandler) Process(ctx context.Context, st *state.State, btx *tx.HACTx, code tx.VoteCode) (res *abcitypes.ExecTxResult, err error) {
+	return h.handle(ctx, st, btx)
+}
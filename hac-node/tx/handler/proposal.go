@@ -27,6 +27,14 @@ func NewProposalTxHandler(logger cmtlog.Logger) (h *ProposalTxHandler) {
 
 func (h *ProposalTxHandler) Check(ctx context.Context, st *state.State, btx *tx.HACTx) (res *abcitypes.ResponseCheckTx, err error) {
 	res = &abcitypes.ResponseCheckTx{Code: 0}
+	ptx := btx.Tx.(*tx.ProposalTx)
+	err1 := checkProposalSchema(ptx)
+	if err1 != nil {
+		h.logger.Info("CheckTx ProposalTx fail", "err", err1)
+		res.Code = 1
+		res.Log = err1.Error()
+		return
+	}
 	// stx := btx.Tx.(*tx.ProposalTx)
 	// _, err1 := st.Proposal(stx, btx.Validator, true, tx.VoteIgnoreProposal)
 	// if err1 != nil {
@@ -43,6 +51,16 @@ func (h *ProposalTxHandler) Check(ctx context.Context, st *state.State, btx *tx.
 	return
 }
 
+// checkProposalSchema checks the category data and the actions of a proposal
+// without the state, which is checked when the proposal is voted.
+func checkProposalSchema(ptx *tx.ProposalTx) error {
+	if _, err := tx.DecodeProposalData(ptx.Category, ptx.Data); err != nil {
+		return err
+	}
+	_, err := tx.DecodeProposalActions(ptx.Actions)
+	return err
+}
+
 func (h *ProposalTxHandler) NewContext(ctx context.Context) {
 	h.validatorSet = make(map[uint64]bool)
 }
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/calehh/hac-app/state"
+	"github.com/calehh/hac-app/tx"
+	"github.com/calehh/hac-app/types"
+	abcitypes "github.com/cometbft/cometbft/abci/types"
+	cmtlog "github.com/cometbft/cometbft/libs/log"
+)
+
+type ReviseProposalTxHandler struct {
+	logger cmtlog.Logger
+}
+
+func NewReviseProposalTxHandler(logger cmtlog.Logger) (h *ReviseProposalTxHandler) {
+	logger = logger.With("module", "reviseTx")
+	h = &ReviseProposalTxHandler{
+		logger: logger,
+	}
+	return
+}
+
+func (h *ReviseProposalTxHandler) Check(ctx context.Context, st *state.State, btx *tx.HACTx) (res *abcitypes.ResponseCheckTx, err error) {
+	res = &abcitypes.ResponseCheckTx{Code: 0}
+	rtx := btx.Tx.(*tx.ReviseProposalTx)
+	_, err1 := st.ReviseProposal(rtx, btx.Validator, true)
+	if err1 != nil {
+		h.logger.Info("CheckTx ReviseProposalTx fail", "err", err1)
+		res.Code = 1
+		res.Log = err1.Error()
+	}
+	return
+}
+
+func (h *ReviseProposalTxHandler) NewContext(ctx context.Context) {
+}
+
+func (h *ReviseProposalTxHandler) handle(ctx context.Context, st *state.State, btx *tx.HACTx) (res *abcitypes.ExecTxResult, err error) {
+	rtx := btx.Tx.(*tx.ReviseProposalTx)
+	event, err := st.ReviseProposal(rtx, btx.Validator, false)
+	if err != nil {
+		return nil, err
+	}
+	res = &abcitypes.ExecTxResult{}
+	if event != nil {
+		res.Events = []abcitypes.Event{types.EncodeEventReviseProposal(event)}
+	}
+	return
+}
+
+func (h *ReviseProposalTxHandler) Prepare(ctx context.Context, st *state.State, btx *tx.HACTx, code tx.VoteCode) (res *abcitypes.ExecTxResult, err error) {
+	return h.handle(ctx, st, btx)
+}
+
+func (h *ReviseProposalTxHandler) Process(ctx context.Context, st *state.State, btx *tx.HACTx, code tx.VoteCode) (res *abcitypes.ExecTxResult, err error) {
+	return h.handle(ctx, st, btx)
+}
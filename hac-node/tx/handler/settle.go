@@ -28,13 +28,13 @@ func NewSettleProposalTxHandler(logger cmtlog.Logger) (h *SettleProposalTxHandle
 func (h *SettleProposalTxHandler) Check(ctx context.Context, st *state.State, btx *tx.HACTx) (res *abcitypes.ResponseCheckTx, err error) {
 	res = &abcitypes.ResponseCheckTx{Code: 0}
 	stx := btx.Tx.(*tx.SettleProposalTx)
-	_, err1 := st.SettleProposal(stx, btx.Validator, true, tx.VoteAcceptProposal)
+	_, _, err1 := st.SettleProposal(stx, btx.Validator, true, tx.VoteAcceptProposal)
 	if err1 != nil {
 		h.logger.Info("CheckTx SettleProposalTx fail", "err", err1)
 		res.Code = 1
 		res.Log = err1.Error()
 	}
-	_, err1 = st.SettleProposal(stx, btx.Validator, true, tx.VoteRejectProposal)
+	_, _, err1 = st.SettleProposal(stx, btx.Validator, true, tx.VoteRejectProposal)
 	if err1 != nil {
 		h.logger.Info("CheckTx SettleProposalTx fail", "err", err1)
 		res.Code = 1
@@ -52,7 +52,7 @@ func (h *SettleProposalTxHandler) handle(ctx context.Context, st *state.State, b
 		return nil, state.ErrOneActionInOneBlock
 	}
 	wtx := btx.Tx.(*tx.SettleProposalTx)
-	event, err := st.SettleProposal(wtx, btx.Validator, false, code)
+	event, executed, err := st.SettleProposal(wtx, btx.Validator, false, code)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +61,7 @@ func (h *SettleProposalTxHandler) handle(ctx context.Context, st *state.State, b
 	if event != nil {
 		res.Events = []abcitypes.Event{types.EncodeEventSettleProposal(event)}
 	}
+	res.Events = append(res.Events, executed...)
 	return
 }
 
@@ -2,8 +2,6 @@ package handler
 
 import (
 	"context"
-	"fmt"
-	"strconv"
 
 	"github.com/calehh/hac-app/state"
 	"github.com/calehh/hac-app/tx"
@@ -55,14 +53,7 @@ func (h *UnStakeTxHandler) handle(ctx context.Context, st *state.State, btx *tx.
 
 	h.validatorSet[btx.Validator] = true
 	res = &abcitypes.ExecTxResult{}
-	res.Events = append(res.Events, abcitypes.Event{
-		Type: types.EventUnStakeType,
-		Attributes: []abcitypes.EventAttribute{
-			{Key: "validator", Value: strconv.FormatUint(event.Validator, 10), Index: true},
-			{Key: "amount", Value: fmt.Sprintf("%d", event.Amount), Index: false},
-			{Key: "addr", Value: fmt.Sprintf("%v", event.Address), Index: false},
-		},
-	})
+	res.Events = append(res.Events, types.EncodeEventUnStake(event))
 	return
 }
 
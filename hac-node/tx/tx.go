@@ -36,25 +36,77 @@ func (d *GrantSt) Equal(grant GrantSt) bool {
 type DiscussionTx struct {
 	Proposal uint64 `json:"proposal"`
 	Data     []byte `json:"data"`
+	// index of the discussion of the same proposal this one replies to
+	ReplyTo    uint64      `json:"replyTo,omitempty"`
+	References []Reference `json:"references,omitempty"`
+}
+
+const (
+	// quote a discussion
+	ReferenceQuote = "quote"
+	// cite a proposal
+	ReferenceCite = "cite"
+)
+
+// Reference points a discussion to another discussion or proposal.
+type Reference struct {
+	Type  string `json:"type"`
+	Index uint64 `json:"index"`
 }
 
 type ProposalTx struct {
+	// one of ProposalCategories, empty for a text proposal
+	Category  string `json:"category,omitempty"`
 	EndHeight uint64 `json:"endHeight"`
 	ImageUrl  string `json:"imageUrl"`
 	Title     string `json:"title"`
 	Link      string `json:"link"`
 	Data      []byte `json:"data"`
+	// set when a member sponsors a proposal submitted by the community:
+	// the address of the original author, empty for an unsigned submission,
+	// and the hex sha256 of the submission
+	Author         string `json:"author,omitempty"`
+	SubmissionHash string `json:"submissionHash,omitempty"`
+	// hex sha256 of a payload held in the blob store, for content too
+	// large to be embedded in Data
+	ContentHash string `json:"contentHash,omitempty"`
+	// executed in order when the proposal is accepted
+	Actions []ProposalAction `json:"actions,omitempty"`
 }
 
 type SettleProposalTx struct {
 	Proposal        uint64 `json:"proposal"`
 	ExpireTimestamp uint   `json:"expire_timestamp"`
+	// the revision of the proposal voted on, it must be the latest
+	Revision uint64 `json:"revision,omitempty"`
+}
+
+// ReviseProposalTx replaces the content of a processing proposal of the
+// sender with a new revision.
+type ReviseProposalTx struct {
+	Proposal uint64 `json:"proposal"`
+	ImageUrl string `json:"imageUrl"`
+	Title    string `json:"title"`
+	Link     string `json:"link"`
+	Data     []byte `json:"data"`
+	// what changed and why
+	Note        string `json:"note,omitempty"`
+	ContentHash string `json:"contentHash,omitempty"`
+	// replace the actions of the proposal
+	Actions []ProposalAction `json:"actions,omitempty"`
 }
 
 type RetractTx struct {
 	Amount uint64 `json:"amount"`
 }
 
+// RegisterParticipantTx registers an account for a human without stake or
+// voting power. The tx is signed by PubKey, Validator and Nonce are 0.
+type RegisterParticipantTx struct {
+	PubKey []byte `json:"pubkey"`
+	Name   string `json:"name"`
+}
+
 type hacTxTmpl[Tx any] struct {
 	Version   uint8     `json:"version"`
 	Type      HACTxType `json:"type"`
@@ -111,6 +163,10 @@ func UnmarshalHACTx(dat []byte) (btx *HACTx, err error) {
 		return unmarshalHACTx[RetractTx](dat)
 	case HACTxTypeSettleProposal:
 		return unmarshalHACTx[SettleProposalTx](dat)
+	case HACTxTypeRegisterParticipant:
+		return unmarshalHACTx[RegisterParticipantTx](dat)
+	case HACTxTypeReviseProposal:
+		return unmarshalHACTx[ReviseProposalTx](dat)
 	default:
 		err = ErrUnsupportedTxType
 	}
@@ -28,10 +28,36 @@ const (
 	HACTxTypeGrant          HACTxType = 3
 	HACTxTypeRetract        HACTxType = 4
 	HACTxTypeSettleProposal HACTxType = 5
+	// registers a participant account, signed by the key it registers
+	HACTxTypeRegisterParticipant HACTxType = 6
+	HACTxTypeReviseProposal      HACTxType = 7
 
 	HACTxTypeGeneric HACTxType = 255
 )
 
+func (t HACTxType) String() string {
+	switch t {
+	case HACTxTypeProposal:
+		return "proposal"
+	case HACTxTypeDiscussion:
+		return "discussion"
+	case HACTxTypeGrant:
+		return "grant"
+	case HACTxTypeRetract:
+		return "retract"
+	case HACTxTypeSettleProposal:
+		return "settle_proposal"
+	case HACTxTypeRegisterParticipant:
+		return "register_participant"
+	case HACTxTypeReviseProposal:
+		return "revise_proposal"
+	case HACTxTypeGeneric:
+		return "generic"
+	default:
+		return "unknown"
+	}
+}
+
 const (
 	HACTxPrefixLen = 4
 	HACTxSuffixLen = 8 + 8 + crypto.SignatureLength
@@ -4,4 +4,5 @@ const (
 	FlagHome      = "home"
 	FlagChainID   = "chain-id"
 	FlagOverwrite = "overwrite"
+	FlagObserver  = "observer"
 )
@@ -1,5 +1,7 @@
 package types
 
+import "github.com/calehh/hac-app/tx"
+
 type Proposal struct {
 	Index           uint64         `json:"index"`
 	Proposer        uint64         `json:"proposer"`
@@ -11,6 +13,19 @@ type Proposal struct {
 	ImageUrl        string         `json:"image_url"`
 	Title           string         `json:"title"`
 	Link            string         `json:"link"`
+	Author          string         `json:"author,omitempty"`
+	SubmissionHash  string         `json:"submission_hash,omitempty"`
+	// number of revisions since the proposal was created
+	Revision uint64 `json:"revision,omitempty"`
+	// height of the latest revision, the discussion restarts there
+	RevisionHeight uint64 `json:"revision_height,omitempty"`
+	// hex sha256 of the payload in the blob store, empty if all the
+	// content is in Data
+	ContentHash string `json:"content_hash,omitempty"`
+	// empty for proposals created before categories, which are text
+	Category string `json:"category,omitempty"`
+	// executed in order when the proposal is accepted
+	Actions []tx.ProposalAction `json:"actions,omitempty"`
 }
 
 type Discussion struct {
@@ -20,6 +35,15 @@ type Discussion struct {
 	SpeakerAddress string `json:"speaker_address"`
 	Data           []byte `json:"data"`
 	Height         uint64 `json:"height"`
+	Human          bool   `json:"human,omitempty"`
+
+	ReplyTo    uint64      `json:"reply_to,omitempty"`
+	References []Reference `json:"references,omitempty"`
+}
+
+type Reference struct {
+	Type  string `json:"type"`
+	Index uint64 `json:"index"`
 }
 
 type ProposalStatus uint64
@@ -2,20 +2,26 @@ package types
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
 
+	"github.com/calehh/hac-app/tx"
 	abci "github.com/cometbft/cometbft/abci/types"
 )
 
 const (
-	EventUnStakeType         = "retract"
-	EventGrantType           = "grant"
-	EventUpdateValidatorType = "update_validator"
-	EventProposalType        = "proposal"
-	EventSettleProposalType  = "settle_proposal"
-	EventDiscussionType      = "discussion"
+	EventUnStakeType             = "retract"
+	EventGrantType               = "grant"
+	EventUpdateValidatorType     = "update_validator"
+	EventProposalType            = "proposal"
+	EventSettleProposalType      = "settle_proposal"
+	EventDiscussionType          = "discussion"
+	EventRegisterParticipantType = "register_participant"
+	EventReviseProposalType      = "revise_proposal"
+	EventExecuteProposalType     = "execute_proposal"
+	EventProposalWebhookType     = "proposal_webhook"
 )
 
 type EventUnStake struct {
@@ -41,19 +47,24 @@ type EventUpdateValiators struct {
 }
 
 type EventProposal struct {
-	ProposalIndex   uint64 `json:"proposalIndex"`
-	Proposer        uint64 `json:"proposerIndex"`
-	ProposerAddress string `json:"proposerAddress"`
-	EndHeight       uint64 `json:"endHeight"`
-	Status          uint64 `json:"status"`
-	Data            []byte `json:"data"`
-	Title           string `json:"title"`
-	Link            string `json:"link"`
-	ImageUrl        string `json:"imageUrl"`
+	ProposalIndex   uint64              `json:"proposalIndex"`
+	Proposer        uint64              `json:"proposerIndex"`
+	ProposerAddress string              `json:"proposerAddress"`
+	EndHeight       uint64              `json:"endHeight"`
+	Status          uint64              `json:"status"`
+	Data            []byte              `json:"data"`
+	Title           string              `json:"title"`
+	Link            string              `json:"link"`
+	ImageUrl        string              `json:"imageUrl"`
+	Author          string              `json:"author"`
+	SubmissionHash  string              `json:"submissionHash"`
+	ContentHash     string              `json:"contentHash"`
+	Category        string              `json:"category"`
+	Actions         []tx.ProposalAction `json:"actions"`
 }
 
 func EncodeEventProposal(event *EventProposal) abci.Event {
-	return abci.Event{
+	ev := abci.Event{
 		Type: EventProposalType,
 		Attributes: []abci.EventAttribute{
 			{Key: "proposal", Value: fmt.Sprintf("%v", event.ProposalIndex), Index: true},
@@ -67,6 +78,24 @@ func EncodeEventProposal(event *EventProposal) abci.Event {
 			{Key: "imageUrl", Value: event.ImageUrl, Index: false},
 		},
 	}
+	// only sponsored community proposals carry a submission
+	if event.SubmissionHash != "" {
+		ev.Attributes = append(ev.Attributes,
+			abci.EventAttribute{Key: "author", Value: event.Author, Index: true},
+			abci.EventAttribute{Key: "submissionHash", Value: event.SubmissionHash, Index: true},
+		)
+	}
+	if event.ContentHash != "" {
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "contentHash", Value: event.ContentHash, Index: true})
+	}
+	if event.Category != "" {
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "category", Value: event.Category, Index: true})
+	}
+	if len(event.Actions) != 0 {
+		actions, _ := json.Marshal(event.Actions)
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "actions", Value: string(actions), Index: false})
+	}
+	return ev
 }
 
 func DecodeEventProposal(originEvent abci.Event) *EventProposal {
@@ -107,6 +136,18 @@ func DecodeEventProposal(originEvent abci.Event) *EventProposal {
 			event.Link = v.Value
 		case "imageUrl":
 			event.ImageUrl = v.Value
+		case "author":
+			event.Author = v.Value
+		case "submissionHash":
+			event.SubmissionHash = v.Value
+		case "contentHash":
+			event.ContentHash = v.Value
+		case "category":
+			event.Category = v.Value
+		case "actions":
+			if err := json.Unmarshal([]byte(v.Value), &event.Actions); err != nil {
+				return nil
+			}
 		}
 	}
 	return event
@@ -116,10 +157,11 @@ type EventSettleProposal struct {
 	Proposer uint64 `json:"proposerIndex"`
 	Proposal uint64 `json:"proposal"`
 	State    int64  `json:"state"`
+	Revision uint64 `json:"revision"`
 }
 
 func EncodeEventSettleProposal(event *EventSettleProposal) abci.Event {
-	return abci.Event{
+	ev := abci.Event{
 		Type: EventSettleProposalType,
 		Attributes: []abci.EventAttribute{
 			{Key: "proposer", Value: fmt.Sprintf("%v", event.Proposer), Index: true},
@@ -127,6 +169,11 @@ func EncodeEventSettleProposal(event *EventSettleProposal) abci.Event {
 			{Key: "state", Value: fmt.Sprintf("%v", event.State), Index: false},
 		},
 	}
+	// proposals never revised are settled on revision 0
+	if event.Revision != 0 {
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "revision", Value: fmt.Sprintf("%v", event.Revision), Index: false})
+	}
+	return ev
 }
 
 func DecodeEventSettleProposal(originEvent abci.Event) *EventSettleProposal {
@@ -151,34 +198,64 @@ func DecodeEventSettleProposal(originEvent abci.Event) *EventSettleProposal {
 				return nil
 			}
 			event.State = state
+		case "revision":
+			revision, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Revision = revision
 		}
 	}
 	return event
 }
 
 type EventDiscussion struct {
+	Index          uint64 `json:"index"`
 	Speaker        uint64 `json:"speakerIndex"`
 	SpeakerAddress string `json:"address"`
 	Proposal       uint64 `json:"proposal"`
 	Data           []byte `json:"data"`
+	Human          bool   `json:"human"`
+
+	ReplyTo    uint64      `json:"replyTo"`
+	References []Reference `json:"references"`
 }
 
 func EncodeEventDiscussion(event *EventDiscussion) abci.Event {
-	return abci.Event{
+	ev := abci.Event{
 		Type: EventDiscussionType,
 		Attributes: []abci.EventAttribute{
+			{Key: "index", Value: fmt.Sprintf("%v", event.Index), Index: true},
 			{Key: "speaker", Value: fmt.Sprintf("%v", event.Speaker), Index: true},
 			{Key: "address", Value: event.SpeakerAddress, Index: false},
 			{Key: "proposal", Value: fmt.Sprintf("%v", event.Proposal), Index: true},
 			{Key: "data", Value: string(event.Data), Index: false},
 		},
 	}
+	// only discussions of participants are marked
+	if event.Human {
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "human", Value: "true", Index: true})
+	}
+	if event.ReplyTo != 0 {
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "replyTo", Value: fmt.Sprintf("%v", event.ReplyTo), Index: true})
+	}
+	if len(event.References) != 0 {
+		refs, _ := json.Marshal(event.References)
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "references", Value: string(refs), Index: false})
+	}
+	return ev
 }
 
 func DecodeEventDiscussion(originEvent abci.Event) *EventDiscussion {
 	event := &EventDiscussion{}
 	for _, v := range originEvent.Attributes {
 		switch v.Key {
+		case "index":
+			index, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Index = index
 		case "speaker":
 			speaker, err := strconv.ParseUint(v.Value, 10, 64)
 			if err != nil {
@@ -195,6 +272,138 @@ func DecodeEventDiscussion(originEvent abci.Event) *EventDiscussion {
 			event.Proposal = proposal
 		case "data":
 			event.Data = []byte(v.Value)
+		case "human":
+			event.Human = v.Value == "true"
+		case "replyTo":
+			replyTo, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.ReplyTo = replyTo
+		case "references":
+			if err := json.Unmarshal([]byte(v.Value), &event.References); err != nil {
+				return nil
+			}
+		}
+	}
+	return event
+}
+
+type EventRegisterParticipant struct {
+	Index   uint64 `json:"index"`
+	Address string `json:"address"`
+	Name    string `json:"name"`
+}
+
+func EncodeEventRegisterParticipant(event *EventRegisterParticipant) abci.Event {
+	return abci.Event{
+		Type: EventRegisterParticipantType,
+		Attributes: []abci.EventAttribute{
+			{Key: "index", Value: fmt.Sprintf("%v", event.Index), Index: true},
+			{Key: "address", Value: event.Address, Index: true},
+			{Key: "name", Value: event.Name, Index: false},
+		},
+	}
+}
+
+func DecodeEventRegisterParticipant(originEvent abci.Event) *EventRegisterParticipant {
+	event := &EventRegisterParticipant{}
+	for _, v := range originEvent.Attributes {
+		switch v.Key {
+		case "index":
+			index, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Index = index
+		case "address":
+			event.Address = v.Value
+		case "name":
+			event.Name = v.Value
+		}
+	}
+	return event
+}
+
+type EventReviseProposal struct {
+	Proposal        uint64              `json:"proposal"`
+	Revision        uint64              `json:"revision"`
+	Proposer        uint64              `json:"proposerIndex"`
+	ProposerAddress string              `json:"proposerAddress"`
+	ImageUrl        string              `json:"imageUrl"`
+	Title           string              `json:"title"`
+	Link            string              `json:"link"`
+	Data            []byte              `json:"data"`
+	Note            string              `json:"note"`
+	ContentHash     string              `json:"contentHash"`
+	Actions         []tx.ProposalAction `json:"actions"`
+}
+
+func EncodeEventReviseProposal(event *EventReviseProposal) abci.Event {
+	ev := abci.Event{
+		Type: EventReviseProposalType,
+		Attributes: []abci.EventAttribute{
+			{Key: "proposal", Value: fmt.Sprintf("%v", event.Proposal), Index: true},
+			{Key: "revision", Value: fmt.Sprintf("%v", event.Revision), Index: false},
+			{Key: "proposer", Value: fmt.Sprintf("%v", event.Proposer), Index: true},
+			{Key: "proposerAddress", Value: event.ProposerAddress, Index: false},
+			{Key: "imageUrl", Value: event.ImageUrl, Index: false},
+			{Key: "title", Value: event.Title, Index: false},
+			{Key: "link", Value: event.Link, Index: false},
+			{Key: "data", Value: string(event.Data), Index: false},
+			{Key: "note", Value: event.Note, Index: false},
+		},
+	}
+	if event.ContentHash != "" {
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "contentHash", Value: event.ContentHash, Index: true})
+	}
+	if len(event.Actions) != 0 {
+		actions, _ := json.Marshal(event.Actions)
+		ev.Attributes = append(ev.Attributes, abci.EventAttribute{Key: "actions", Value: string(actions), Index: false})
+	}
+	return ev
+}
+
+func DecodeEventReviseProposal(originEvent abci.Event) *EventReviseProposal {
+	event := &EventReviseProposal{}
+	for _, v := range originEvent.Attributes {
+		switch v.Key {
+		case "proposal":
+			proposal, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Proposal = proposal
+		case "revision":
+			revision, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Revision = revision
+		case "proposer":
+			proposer, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Proposer = proposer
+		case "proposerAddress":
+			event.ProposerAddress = v.Value
+		case "imageUrl":
+			event.ImageUrl = v.Value
+		case "title":
+			event.Title = v.Value
+		case "link":
+			event.Link = v.Value
+		case "data":
+			event.Data = []byte(v.Value)
+		case "note":
+			event.Note = v.Value
+		case "contentHash":
+			event.ContentHash = v.Value
+		case "actions":
+			if err := json.Unmarshal([]byte(v.Value), &event.Actions); err != nil {
+				return nil
+			}
 		}
 	}
 	return event
@@ -316,6 +525,17 @@ func ParseEventGrant(originEvent abci.Event) *EventGrant {
 	return event
 }
 
+func EncodeEventUnStake(event *EventUnStake) abci.Event {
+	return abci.Event{
+		Type: EventUnStakeType,
+		Attributes: []abci.EventAttribute{
+			{Key: "validator", Value: strconv.FormatUint(event.Validator, 10), Index: true},
+			{Key: "amount", Value: fmt.Sprintf("%d", event.Amount), Index: false},
+			{Key: "addr", Value: fmt.Sprintf("%v", event.Address), Index: false},
+		},
+	}
+}
+
 func ParseEventUnStake(originEvent abci.Event) *EventUnStake {
 	event := &EventUnStake{}
 	for _, v := range originEvent.Attributes {
@@ -338,3 +558,104 @@ func ParseEventUnStake(originEvent abci.Event) *EventUnStake {
 	}
 	return event
 }
+
+// EventExecuteProposal reports the effect of an accepted proposal. Result
+// describes what its actions did, or why none of them applied.
+type EventExecuteProposal struct {
+	Proposal uint64 `json:"proposal"`
+	Category string `json:"category"`
+	Executed bool   `json:"executed"`
+	// number of actions, the one of the category included
+	Actions uint64 `json:"actions"`
+	Result  string `json:"result"`
+}
+
+func EncodeEventExecuteProposal(event *EventExecuteProposal) abci.Event {
+	return abci.Event{
+		Type: EventExecuteProposalType,
+		Attributes: []abci.EventAttribute{
+			{Key: "proposal", Value: fmt.Sprintf("%v", event.Proposal), Index: true},
+			{Key: "category", Value: event.Category, Index: true},
+			{Key: "executed", Value: strconv.FormatBool(event.Executed), Index: false},
+			{Key: "actions", Value: fmt.Sprintf("%v", event.Actions), Index: false},
+			{Key: "result", Value: event.Result, Index: false},
+		},
+	}
+}
+
+func DecodeEventExecuteProposal(originEvent abci.Event) *EventExecuteProposal {
+	event := &EventExecuteProposal{}
+	for _, v := range originEvent.Attributes {
+		switch v.Key {
+		case "proposal":
+			proposal, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Proposal = proposal
+		case "category":
+			event.Category = v.Value
+		case "executed":
+			executed, err := strconv.ParseBool(v.Value)
+			if err != nil {
+				return nil
+			}
+			event.Executed = executed
+		case "actions":
+			actions, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Actions = actions
+		case "result":
+			event.Result = v.Value
+		}
+	}
+	return event
+}
+
+// EventProposalWebhook asks the nodes to post Payload to Url, on behalf of
+// the webhook action at index Action of an executed proposal.
+type EventProposalWebhook struct {
+	Proposal uint64 `json:"proposal"`
+	Action   uint64 `json:"action"`
+	Url      string `json:"url"`
+	Payload  string `json:"payload"`
+}
+
+func EncodeEventProposalWebhook(event *EventProposalWebhook) abci.Event {
+	return abci.Event{
+		Type: EventProposalWebhookType,
+		Attributes: []abci.EventAttribute{
+			{Key: "proposal", Value: fmt.Sprintf("%v", event.Proposal), Index: true},
+			{Key: "action", Value: fmt.Sprintf("%v", event.Action), Index: false},
+			{Key: "url", Value: event.Url, Index: false},
+			{Key: "payload", Value: event.Payload, Index: false},
+		},
+	}
+}
+
+func DecodeEventProposalWebhook(originEvent abci.Event) *EventProposalWebhook {
+	event := &EventProposalWebhook{}
+	for _, v := range originEvent.Attributes {
+		switch v.Key {
+		case "proposal":
+			proposal, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Proposal = proposal
+		case "action":
+			action, err := strconv.ParseUint(v.Value, 10, 64)
+			if err != nil {
+				return nil
+			}
+			event.Action = action
+		case "url":
+			event.Url = v.Value
+		case "payload":
+			event.Payload = v.Value
+		}
+	}
+	return event
+}